@@ -19,6 +19,10 @@ const (
 
 	// PhaseFailed means that calling Porter failed.
 	PhaseFailed AgentPhase = "Failed"
+
+	// PhasePendingApproval means that Porter evaluated a change to an installation,
+	// and it is waiting to be approved before it is applied.
+	PhasePendingApproval AgentPhase = "PendingApproval"
 )
 
 // AgentConditionType are valid conditions of a Porter agent job
@@ -38,3 +42,24 @@ const (
 	// ConditionFailed means the Porter agent failed.
 	ConditionFailed AgentConditionType = "Failed"
 )
+
+// Reasons set on the Failed condition that describe why the Porter agent failed.
+const (
+	// FailureReasonJobFailed means the Porter agent failed for a reason that could not be determined.
+	FailureReasonJobFailed = "JobFailed"
+
+	// FailureReasonBundlePullFailed means the bundle could not be pulled from the registry.
+	FailureReasonBundlePullFailed = "BundlePullFailed"
+
+	// FailureReasonCredentialResolutionFailed means the credentials for the bundle could not be resolved.
+	FailureReasonCredentialResolutionFailed = "CredentialResolutionFailed"
+
+	// FailureReasonParameterResolutionFailed means the parameters for the bundle could not be resolved.
+	FailureReasonParameterResolutionFailed = "ParameterResolutionFailed"
+
+	// FailureReasonPluginMissing means a plugin required by the Porter configuration is not installed.
+	FailureReasonPluginMissing = "PluginMissing"
+
+	// FailureReasonInvocationImageFailed means the bundle's invocation image could not be run or failed.
+	FailureReasonInvocationImageFailed = "InvocationImageFailed"
+)
@@ -11,6 +11,11 @@ type AgentActionSpec struct {
 	// +optional
 	AgentConfig *corev1.LocalObjectReference `json:"agentConfig,omitempty"`
 
+	// Suspend stops the operator from starting the Porter Agent job for the action.
+	// The job is started when the action is resumed.
+	// +optional
+	Suspend bool `json:"suspend,omitempty"`
+
 	// Command to run inside the Porter Agent job. Defaults to running the agent.
 	Command []string `json:"command,omitempty"`
 
@@ -50,6 +55,10 @@ type AgentActionStatus struct {
 	// Each condition refers to the status of the Job
 	// Possible conditions are: Scheduled, Started, Completed, and Failed
 	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	// Logs is the ConfigMap that contains the end of the Porter Agent logs,
+	// captured when the job finished.
+	// +optional
+	Logs *corev1.LocalObjectReference `json:"logs,omitempty"`
 }
 
 // +kubebuilder:object:root=true
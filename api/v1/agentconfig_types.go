@@ -8,6 +8,7 @@ import (
 	"regexp"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/mitchellh/mapstructure"
 	"github.com/opencontainers/go-digest"
@@ -23,6 +24,14 @@ const (
 
 	// KindAgentConfig represents AgentConfig kind value.
 	KindAgentConfig = "AgentConfig"
+
+	// DefaultSuccessfulActionsHistoryLimit is the number of successful AgentActions
+	// kept for each resource when the limit is not specified.
+	DefaultSuccessfulActionsHistoryLimit = 3
+
+	// DefaultFailedActionsHistoryLimit is the number of failed AgentActions
+	// kept for each resource when the limit is not specified.
+	DefaultFailedActionsHistoryLimit = 1
 )
 
 // DefaultPlugins is the set of default plugins that will be used by the operator.
@@ -90,6 +99,50 @@ type AgentConfigSpec struct {
 	// In order to utilize mapstructure omitempty tag with an embedded struct, this field needs to be a pointer
 	// +optional
 	PluginConfigFile *PluginFileSpec `json:"pluginConfigFile,omitempty" mapstructure:"pluginConfigFile,omitempty"`
+
+	// ResyncInterval is how often an Installation is compared with the installation recorded by Porter to detect drift.
+	// Drift detection is disabled when the interval is not set or is zero.
+	// +optional
+	ResyncInterval *metav1.Duration `json:"resyncInterval,omitempty" mapstructure:"resyncInterval,omitempty"`
+
+	// DriftPolicy specifies how an Installation that has drifted is handled.
+	// Detect reports the drift with the Drifted condition, and Correct also re-applies the installation.
+	// Defaults to Detect.
+	// +kubebuilder:validation:Enum=Detect;Correct
+	// +optional
+	DriftPolicy DriftPolicy `json:"driftPolicy,omitempty" mapstructure:"driftPolicy,omitempty"`
+
+	// RetryPolicy enables automatically retrying Installations that fail.
+	// +optional
+	RetryPolicy *RetryPolicy `json:"retryPolicy,omitempty" mapstructure:"retryPolicy,omitempty"`
+
+	// ApprovalPolicy requires changes to Installations to be approved before they are applied.
+	// +optional
+	ApprovalPolicy *ApprovalPolicy `json:"approvalPolicy,omitempty" mapstructure:"approvalPolicy,omitempty"`
+
+	// RunHistoryLimit is the number of InstallationRuns that are kept for each Installation.
+	// The oldest runs are deleted when the limit is exceeded, and runs are not recorded when it is zero.
+	// Defaults to 10.
+	// +optional
+	RunHistoryLimit *int32 `json:"runHistoryLimit,omitempty" mapstructure:"runHistoryLimit,omitempty"`
+
+	// SuccessfulActionsHistoryLimit is the number of successful AgentActions that are kept for each resource, such as an Installation.
+	// Older AgentActions are deleted along with their Job, volume and secrets. The latest AgentAction of a resource is always kept.
+	// Defaults to 3.
+	// +optional
+	SuccessfulActionsHistoryLimit *int32 `json:"successfulActionsHistoryLimit,omitempty" mapstructure:"successfulActionsHistoryLimit,omitempty"`
+
+	// FailedActionsHistoryLimit is the number of failed AgentActions that are kept for each resource, such as an Installation.
+	// Older AgentActions are deleted along with their Job, volume and secrets. The latest AgentAction of a resource is always kept.
+	// Defaults to 1.
+	// +optional
+	FailedActionsHistoryLimit *int32 `json:"failedActionsHistoryLimit,omitempty" mapstructure:"failedActionsHistoryLimit,omitempty"`
+
+	// Suspend stops the operator from reconciling the resources that use this AgentConfig.
+	// Set it on the AgentConfig for a namespace to suspend every resource in that namespace.
+	// Changes made while suspended are applied when the resources are resumed.
+	// +optional
+	Suspend bool `json:"suspend,omitempty" mapstructure:"suspend,omitempty"`
 }
 
 // MergeConfig from another AgentConfigSpec. The values from the override are applied
@@ -128,6 +181,7 @@ type AgentConfigStatus struct {
 
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
+// +kubebuilder:storageversion
 
 // AgentConfig is the Schema for the agentconfigs API
 type AgentConfig struct {
@@ -303,11 +357,11 @@ func (c AgentConfigSpecAdapter) GetStorageClassName() string {
 }
 
 // GetVolumeSize returns the size of the shared volume to mount between the
-// Porter Agent and the bundle's invocation image. Defaults to 64Mi.
+// Porter Agent and the bundle's invocation image. Defaults to DefaultVolumeSize.
 func (c AgentConfigSpecAdapter) GetVolumeSize() resource.Quantity {
 	q, err := resource.ParseQuantity(c.original.VolumeSize)
 	if err != nil || q.IsZero() {
-		return resource.MustParse("64Mi")
+		return resource.MustParse(DefaultVolumeSize)
 	}
 	return q
 }
@@ -342,6 +396,68 @@ func (c *AgentConfigSpecAdapter) GetTTLSecondsAfterFinished() *int32 {
 	return c.original.TTLSecondsAfterFinished
 }
 
+// GetResyncInterval returns how often installations are checked for drift.
+// Returns zero when drift detection is disabled.
+func (c AgentConfigSpecAdapter) GetResyncInterval() time.Duration {
+	if c.original.ResyncInterval == nil {
+		return 0
+	}
+	return c.original.ResyncInterval.Duration
+}
+
+// GetRetryPolicy returns how failed installations are retried.
+// Returns nil when retries are not configured.
+func (c AgentConfigSpecAdapter) GetRetryPolicy() *RetryPolicy {
+	return c.original.RetryPolicy
+}
+
+// GetApprovalPolicy returns how changes to installations are approved.
+// Returns nil when approval is not configured.
+func (c AgentConfigSpecAdapter) GetApprovalPolicy() *ApprovalPolicy {
+	return c.original.ApprovalPolicy
+}
+
+// IsSuspended returns whether reconciling the resources that use the config is suspended.
+func (c AgentConfigSpecAdapter) IsSuspended() bool {
+	return c.original.Suspend
+}
+
+// GetDriftPolicy returns how installations that have drifted are handled.
+// Defaults to DriftPolicyDetect.
+func (c AgentConfigSpecAdapter) GetDriftPolicy() DriftPolicy {
+	if c.original.DriftPolicy == "" {
+		return DriftPolicyDetect
+	}
+	return c.original.DriftPolicy
+}
+
+// GetRunHistoryLimit returns the number of InstallationRuns that are kept for each Installation.
+// Defaults to DefaultRunHistoryLimit.
+func (c AgentConfigSpecAdapter) GetRunHistoryLimit() int {
+	if c.original.RunHistoryLimit == nil {
+		return DefaultRunHistoryLimit
+	}
+	return int(*c.original.RunHistoryLimit)
+}
+
+// GetSuccessfulActionsHistoryLimit returns the number of successful AgentActions that are kept for each resource.
+// Defaults to DefaultSuccessfulActionsHistoryLimit.
+func (c AgentConfigSpecAdapter) GetSuccessfulActionsHistoryLimit() int {
+	if c.original.SuccessfulActionsHistoryLimit == nil {
+		return DefaultSuccessfulActionsHistoryLimit
+	}
+	return int(*c.original.SuccessfulActionsHistoryLimit)
+}
+
+// GetFailedActionsHistoryLimit returns the number of failed AgentActions that are kept for each resource.
+// Defaults to DefaultFailedActionsHistoryLimit.
+func (c AgentConfigSpecAdapter) GetFailedActionsHistoryLimit() int {
+	if c.original.FailedActionsHistoryLimit == nil {
+		return DefaultFailedActionsHistoryLimit
+	}
+	return int(*c.original.FailedActionsHistoryLimit)
+}
+
 func (c AgentConfigSpecAdapter) ToPorterDocument() ([]byte, error) {
 	raw := struct {
 		SchemaType    string            `yaml:"schemaType"`
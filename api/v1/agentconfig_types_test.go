@@ -2,6 +2,7 @@ package v1
 
 import (
 	"testing"
+	"time"
 
 	"get.porter.sh/porter/pkg/plugins"
 	portertest "get.porter.sh/porter/pkg/test"
@@ -10,6 +11,7 @@ import (
 	"github.com/stretchr/testify/require"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 func TestAgentConfigSpecAdapter_GetPorterImage(t *testing.T) {
@@ -234,6 +236,22 @@ func TestAgentConfigSpec_MergeConfig(t *testing.T) {
 		assert.Equal(t, "override", config.InstallationServiceAccount)
 		assert.Equal(t, &PluginFileSpec{Plugins: map[string]Plugin{"azure": {FeedURL: "localhost:6000"}}}, config.PluginConfigFile)
 	})
+
+	t.Run("drift detection", func(t *testing.T) {
+		nsConfig := AgentConfigSpec{
+			ResyncInterval: &metav1.Duration{Duration: time.Hour},
+			DriftPolicy:    DriftPolicyCorrect,
+		}
+
+		config, err := nsConfig.MergeConfig(AgentConfigSpec{ServiceAccount: "override"})
+		require.NoError(t, err)
+		assert.Equal(t, &metav1.Duration{Duration: time.Hour}, config.ResyncInterval)
+		assert.Equal(t, DriftPolicyCorrect, config.DriftPolicy)
+
+		config, err = nsConfig.MergeConfig(AgentConfigSpec{ResyncInterval: &metav1.Duration{Duration: time.Minute}})
+		require.NoError(t, err)
+		assert.Equal(t, &metav1.Duration{Duration: time.Minute}, config.ResyncInterval)
+	})
 }
 
 func TestAgentConfig_MergeConfigs(t *testing.T) {
@@ -394,7 +412,40 @@ func TestAgentConfigSpecAdapter_GetTTLSecondsAfterFinished(t *testing.T) {
 	}
 }
 
+func TestAgentConfigSpecAdapter_GetRunHistoryLimit(t *testing.T) {
+	adapter := NewAgentConfigSpecAdapter(AgentConfigSpec{})
+	assert.Equal(t, DefaultRunHistoryLimit, adapter.GetRunHistoryLimit())
+
+	var testdataZero int32 = 0
+	adapter = NewAgentConfigSpecAdapter(AgentConfigSpec{RunHistoryLimit: &testdataZero})
+	assert.Equal(t, 0, adapter.GetRunHistoryLimit(), "a limit of zero should disable the run history")
+}
+
+func TestAgentConfigSpecAdapter_GetActionsHistoryLimits(t *testing.T) {
+	adapter := NewAgentConfigSpecAdapter(AgentConfigSpec{})
+	assert.Equal(t, DefaultSuccessfulActionsHistoryLimit, adapter.GetSuccessfulActionsHistoryLimit())
+	assert.Equal(t, DefaultFailedActionsHistoryLimit, adapter.GetFailedActionsHistoryLimit())
+
+	var successful, failed int32 = 5, 0
+	adapter = NewAgentConfigSpecAdapter(AgentConfigSpec{SuccessfulActionsHistoryLimit: &successful, FailedActionsHistoryLimit: &failed})
+	assert.Equal(t, 5, adapter.GetSuccessfulActionsHistoryLimit())
+	assert.Equal(t, 0, adapter.GetFailedActionsHistoryLimit())
+}
+
 func TestHashString(t *testing.T) {
 	str := hashString("fake-string")
 	assert.Equal(t, "ab19e45285992b247dd281213f803479", str)
 }
+
+func TestAgentConfigSpecAdapter_GetDriftSettings(t *testing.T) {
+	adapter := NewAgentConfigSpecAdapter(AgentConfigSpec{})
+	assert.Equal(t, time.Duration(0), adapter.GetResyncInterval(), "drift detection should be disabled by default")
+	assert.Equal(t, DriftPolicyDetect, adapter.GetDriftPolicy())
+
+	adapter = NewAgentConfigSpecAdapter(AgentConfigSpec{
+		ResyncInterval: &metav1.Duration{Duration: 10 * time.Minute},
+		DriftPolicy:    DriftPolicyCorrect,
+	})
+	assert.Equal(t, 10*time.Minute, adapter.GetResyncInterval())
+	assert.Equal(t, DriftPolicyCorrect, adapter.GetDriftPolicy())
+}
@@ -0,0 +1,134 @@
+package v1
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// SetupWebhookWithManager registers the AgentConfig webhooks with the manager.
+func (c *AgentConfig) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(c).
+		WithDefaulter(&AgentConfigCustomDefaulter{}).
+		WithValidator(&AgentConfigCustomValidator{}).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/mutate-getporter-org-v1-agentconfig,mutating=true,failurePolicy=fail,sideEffects=None,groups=getporter.org,resources=agentconfigs,verbs=create;update,versions=v1,name=magentconfig.getporter.org,admissionReviewVersions=v1
+
+// AgentConfigCustomDefaulter sets default values on an AgentConfig when it is created or updated.
+// +kubebuilder:object:generate=false
+type AgentConfigCustomDefaulter struct{}
+
+var _ webhook.CustomDefaulter = &AgentConfigCustomDefaulter{}
+
+// Default sets the volume size of the system level AgentConfig. Namespace and
+// installation level AgentConfigs are not defaulted, so that only the values set
+// on them override the system level configuration. The Porter Agent image is not
+// stored, it is resolved when the agent runs so that upgrading the operator also
+// upgrades the default Porter Agent.
+func (d *AgentConfigCustomDefaulter) Default(ctx context.Context, obj runtime.Object) error {
+	c, ok := obj.(*AgentConfig)
+	if !ok {
+		return fmt.Errorf("expected an AgentConfig but got %T", obj)
+	}
+
+	if c.Name != "default" || c.Namespace != OperatorNamespace {
+		return nil
+	}
+	if c.Spec.VolumeSize == "" {
+		c.Spec.VolumeSize = DefaultVolumeSize
+	}
+	return nil
+}
+
+// +kubebuilder:webhook:path=/validate-getporter-org-v1-agentconfig,mutating=false,failurePolicy=fail,sideEffects=None,groups=getporter.org,resources=agentconfigs,verbs=create;update,versions=v1,name=vagentconfig.getporter.org,admissionReviewVersions=v1
+
+// AgentConfigCustomValidator validates an AgentConfig when it is created or updated.
+// +kubebuilder:object:generate=false
+type AgentConfigCustomValidator struct{}
+
+var _ webhook.CustomValidator = &AgentConfigCustomValidator{}
+
+// ValidateCreate validates a new AgentConfig.
+func (v *AgentConfigCustomValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	c, ok := obj.(*AgentConfig)
+	if !ok {
+		return nil, fmt.Errorf("expected an AgentConfig but got %T", obj)
+	}
+	return nil, toValidationError("AgentConfig", c.Name, c.validate())
+}
+
+// ValidateUpdate validates changes to an AgentConfig.
+func (v *AgentConfigCustomValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	c, ok := newObj.(*AgentConfig)
+	if !ok {
+		return nil, fmt.Errorf("expected an AgentConfig but got %T", newObj)
+	}
+	old, ok := oldObj.(*AgentConfig)
+	if !ok {
+		return nil, fmt.Errorf("expected an AgentConfig but got %T", oldObj)
+	}
+	if skipSpecValidation(c, old.Spec, c.Spec) {
+		return nil, nil
+	}
+	return nil, toValidationError("AgentConfig", c.Name, c.validate())
+}
+
+// ValidateDelete allows an AgentConfig to be deleted.
+func (v *AgentConfigCustomValidator) ValidateDelete(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+func (c *AgentConfig) validate() field.ErrorList {
+	var errs field.ErrorList
+	specPath := field.NewPath("spec")
+
+	if c.Spec.VolumeSize != "" {
+		if _, err := resource.ParseQuantity(c.Spec.VolumeSize); err != nil {
+			errs = append(errs, field.Invalid(specPath.Child("volumeSize"), c.Spec.VolumeSize, err.Error()))
+		}
+	}
+
+	switch c.Spec.PullPolicy {
+	case "", corev1.PullAlways, corev1.PullIfNotPresent, corev1.PullNever:
+	default:
+		errs = append(errs, field.NotSupported(specPath.Child("pullPolicy"), c.Spec.PullPolicy,
+			[]corev1.PullPolicy{corev1.PullAlways, corev1.PullIfNotPresent, corev1.PullNever}))
+	}
+
+	if c.Spec.TTLSecondsAfterFinished != nil && *c.Spec.TTLSecondsAfterFinished < 0 {
+		errs = append(errs, field.Invalid(specPath.Child("ttlSecondsAfterFinished"), *c.Spec.TTLSecondsAfterFinished, "must not be negative"))
+	}
+	if c.Spec.RetryLimit != nil && *c.Spec.RetryLimit < 0 {
+		errs = append(errs, field.Invalid(specPath.Child("retryLimit"), *c.Spec.RetryLimit, "must not be negative"))
+	}
+	if c.Spec.RunHistoryLimit != nil && *c.Spec.RunHistoryLimit < 0 {
+		errs = append(errs, field.Invalid(specPath.Child("runHistoryLimit"), *c.Spec.RunHistoryLimit, "must not be negative"))
+	}
+	if c.Spec.SuccessfulActionsHistoryLimit != nil && *c.Spec.SuccessfulActionsHistoryLimit < 0 {
+		errs = append(errs, field.Invalid(specPath.Child("successfulActionsHistoryLimit"), *c.Spec.SuccessfulActionsHistoryLimit, "must not be negative"))
+	}
+	if c.Spec.FailedActionsHistoryLimit != nil && *c.Spec.FailedActionsHistoryLimit < 0 {
+		errs = append(errs, field.Invalid(specPath.Child("failedActionsHistoryLimit"), *c.Spec.FailedActionsHistoryLimit, "must not be negative"))
+	}
+	errs = append(errs, validateNonNegativeDuration(specPath.Child("resyncInterval"), c.Spec.ResyncInterval)...)
+
+	if c.Spec.PluginConfigFile != nil {
+		pluginsPath := specPath.Child("pluginConfigFile", "plugins")
+		for name, plugin := range c.Spec.PluginConfigFile.Plugins {
+			if plugin.URL != "" && plugin.FeedURL != "" {
+				errs = append(errs, field.Invalid(pluginsPath.Key(name), plugin.URL, "only one of url or feedURL may be specified"))
+			}
+		}
+	}
+
+	return errs
+}
@@ -0,0 +1,80 @@
+package v1
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+)
+
+func TestAgentConfigCustomValidator(t *testing.T) {
+	testcases := []struct {
+		name      string
+		spec      AgentConfigSpec
+		wantField string
+		wantErr   string
+	}{
+		{name: "valid", spec: AgentConfigSpec{VolumeSize: "64Mi", PullPolicy: "Always", RetryLimit: ptr.To(int32(2)),
+			PluginConfigFile: &PluginFileSpec{SchemaVersion: "1.0.0", Plugins: map[string]Plugin{"kubernetes": {Version: "v1.0.1"}}}}},
+		{name: "invalid volume size", spec: AgentConfigSpec{VolumeSize: "lots"}, wantField: "spec.volumeSize"},
+		{name: "invalid pull policy", spec: AgentConfigSpec{PullPolicy: "Sometimes"}, wantField: "spec.pullPolicy", wantErr: "Unsupported value"},
+		{name: "negative retry limit", spec: AgentConfigSpec{RetryLimit: ptr.To(int32(-1))}, wantField: "spec.retryLimit", wantErr: "must not be negative"},
+		{name: "negative run history limit", spec: AgentConfigSpec{RunHistoryLimit: ptr.To(int32(-1))}, wantField: "spec.runHistoryLimit", wantErr: "must not be negative"},
+		{name: "negative failed actions history limit", spec: AgentConfigSpec{FailedActionsHistoryLimit: ptr.To(int32(-1))}, wantField: "spec.failedActionsHistoryLimit", wantErr: "must not be negative"},
+		{name: "plugin url and feed", spec: AgentConfigSpec{PluginConfigFile: &PluginFileSpec{Plugins: map[string]Plugin{
+			"kubernetes": {URL: "https://example.com/kubernetes", FeedURL: "https://example.com/atom.xml"}}}},
+			wantField: "spec.pluginConfigFile.plugins[kubernetes]", wantErr: "only one of url or feedURL may be specified"},
+	}
+
+	v := &AgentConfigCustomValidator{}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &AgentConfig{ObjectMeta: metav1.ObjectMeta{Name: "mycfg", Namespace: "test"}, Spec: tc.spec}
+			_, err := v.ValidateCreate(context.Background(), cfg)
+			if tc.wantField == "" {
+				require.NoError(t, err)
+				return
+			}
+			assertFieldError(t, err, tc.wantField, tc.wantErr)
+		})
+	}
+}
+
+func TestAgentConfigCustomDefaulter_Default(t *testing.T) {
+	d := &AgentConfigCustomDefaulter{}
+
+	t.Run("system config", func(t *testing.T) {
+		c := &AgentConfig{
+			ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: OperatorNamespace},
+			Spec:       AgentConfigSpec{PorterVersion: "v1.1.0"},
+		}
+		require.NoError(t, d.Default(context.Background(), c))
+		assert.Empty(t, c.Spec.PorterRepository, "the default repository should be resolved when the agent runs")
+		assert.Equal(t, "v1.1.0", c.Spec.PorterVersion, "the configured version should not be changed")
+		assert.Equal(t, DefaultVolumeSize, c.Spec.VolumeSize)
+		assert.Equal(t, DefaultPorterAgentRepository+":v1.1.0", NewAgentConfigSpecAdapter(c.Spec).GetPorterImage())
+	})
+
+	t.Run("system config without an agent image", func(t *testing.T) {
+		c := &AgentConfig{
+			ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: OperatorNamespace},
+		}
+		require.NoError(t, d.Default(context.Background(), c))
+		assert.Empty(t, c.Spec.PorterRepository, "the default repository should be resolved when the agent runs")
+		assert.Empty(t, c.Spec.PorterVersion, "the default version should be resolved when the agent runs")
+		assert.Equal(t, DefaultPorterAgentRepository+":"+DefaultPorterAgentVersion, NewAgentConfigSpecAdapter(c.Spec).GetPorterImage())
+	})
+
+	t.Run("namespace config", func(t *testing.T) {
+		c := &AgentConfig{
+			ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "test"},
+			Spec:       AgentConfigSpec{PorterVersion: "v1.1.0"},
+		}
+		require.NoError(t, d.Default(context.Background(), c))
+		assert.Empty(t, c.Spec.PorterRepository, "only the system level config should be defaulted")
+		assert.Empty(t, c.Spec.VolumeSize, "only the system level config should be defaulted")
+	})
+}
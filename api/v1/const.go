@@ -12,6 +12,15 @@ const (
 	// up-to-date so that the default version is guaranteed to work.
 	DefaultPorterAgentVersion = "v1.0.14"
 
+	// DefaultVolumeSize is the default size of the volume shared between the
+	// Porter Agent and the bundle's invocation image.
+	DefaultVolumeSize = "64Mi"
+
+	// OperatorNamespace is the namespace where the operator is deployed. System
+	// level configuration, such as the default AgentConfig and PorterConfig, is
+	// defined in this namespace.
+	OperatorNamespace = "porter-operator-system"
+
 	// LabelJobType is a label applied to jobs created by the operator. It
 	// indicates the purpose of the job.
 	LabelJobType = Prefix + "jobType"
@@ -63,6 +72,38 @@ const (
 	// Porter Operator, representing the retry attempt identifier.
 	LabelRetry = Prefix + "retry"
 
+	// AnnotationTraceParent is an annotation that propagates the W3C traceparent
+	// of the trace that caused the resource to be created, so that the work done
+	// for the resource by another controller is recorded in the same trace.
+	AnnotationTraceParent = Prefix + "traceparent"
+
+	// AnnotationTraceState is an annotation that propagates the W3C tracestate
+	// along with AnnotationTraceParent.
+	AnnotationTraceState = Prefix + "tracestate"
+
+	// AgentLogsKey is the key in the ConfigMap created for an AgentAction that
+	// contains the end of the Porter Agent logs.
+	AgentLogsKey = "porter-agent.log"
+
+	// LabelRetryAttempt is a label applied to the AgentActions created to
+	// automatically retry a failed resource, representing the retry attempt number.
+	LabelRetryAttempt = Prefix + "retryAttempt"
+
+	// LabelParametersDigest is a label applied to the AgentActions created for an
+	// Installation with parameter sources, representing the resolved parameter
+	// values. It is used to apply the installation again when they change.
+	LabelParametersDigest = Prefix + "parametersDigest"
+
+	// AnnotationConfigDigest is an annotation applied to the pods of the Porter
+	// gRPC server, representing the porter configuration file. It is used to
+	// restart the server when the configuration changes.
+	AnnotationConfigDigest = Prefix + "configDigest"
+
+	// AnnotationTLSDigest is an annotation applied to the pods of the Porter
+	// gRPC server, representing its certificates. It is used to restart the
+	// server when the certificates are rotated.
+	AnnotationTLSDigest = Prefix + "tlsDigest"
+
 	// FinalizerName is the name of the finalizer applied to Porter Operator
 	// resources that should be reconciled by the operator before allowing it to
 	// be deleted.
@@ -107,4 +148,12 @@ const (
 	// VolumePorterPluginsPath is the mount path of the volume containing Porter's
 	// config file.
 	VolumePorterPluginsPath = "/app/.porter/plugins"
+
+	// VolumePorterServerTLSName is the name of the volume that contains the
+	// certificates of the Porter gRPC server.
+	VolumePorterServerTLSName = "porter-server-tls"
+
+	// VolumePorterServerTLSPath is the mount path of the volume containing the
+	// certificates of the Porter gRPC server.
+	VolumePorterServerTLSPath = "/porter-server-tls"
 )
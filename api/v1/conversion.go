@@ -0,0 +1,15 @@
+package v1
+
+import "sigs.k8s.io/controller-runtime/pkg/conversion"
+
+// v1 is the storage version of the API and the hub for conversions between versions.
+var (
+	_ conversion.Hub = &Installation{}
+	_ conversion.Hub = &AgentConfig{}
+)
+
+// Hub marks Installation as a conversion hub.
+func (*Installation) Hub() {}
+
+// Hub marks AgentConfig as a conversion hub.
+func (*AgentConfig) Hub() {}
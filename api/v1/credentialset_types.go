@@ -34,6 +34,11 @@ type CredentialSetSpec struct {
 	// +optional
 	AgentConfig *corev1.LocalObjectReference `json:"agentConfig,omitempty" yaml:"-"`
 
+	// Suspend stops the operator from reconciling the credential set.
+	// Changes made while the credential set is suspended are applied when it is resumed.
+	// +optional
+	Suspend bool `json:"suspend,omitempty" yaml:"-"`
+
 	//
 	// These are fields from the Porter credential set resource.
 	// Your goal is that someone can copy/paste a resource from Porter into the
@@ -0,0 +1,87 @@
+package v1
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// SetupWebhookWithManager registers the CredentialSet webhooks with the manager.
+func (cs *CredentialSet) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(cs).
+		WithValidator(&CredentialSetCustomValidator{}).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/validate-getporter-org-v1-credentialset,mutating=false,failurePolicy=fail,sideEffects=None,groups=getporter.org,resources=credentialsets,verbs=create;update,versions=v1,name=vcredentialset.getporter.org,admissionReviewVersions=v1
+
+// CredentialSetCustomValidator validates a CredentialSet when it is created or updated.
+// +kubebuilder:object:generate=false
+type CredentialSetCustomValidator struct{}
+
+var _ webhook.CustomValidator = &CredentialSetCustomValidator{}
+
+// ValidateCreate validates a new CredentialSet.
+func (v *CredentialSetCustomValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	cs, ok := obj.(*CredentialSet)
+	if !ok {
+		return nil, fmt.Errorf("expected a CredentialSet but got %T", obj)
+	}
+	return nil, toValidationError("CredentialSet", cs.Name, cs.validate())
+}
+
+// ValidateUpdate validates changes to a CredentialSet.
+func (v *CredentialSetCustomValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	cs, ok := newObj.(*CredentialSet)
+	if !ok {
+		return nil, fmt.Errorf("expected a CredentialSet but got %T", newObj)
+	}
+	old, ok := oldObj.(*CredentialSet)
+	if !ok {
+		return nil, fmt.Errorf("expected a CredentialSet but got %T", oldObj)
+	}
+
+	if skipSpecValidation(cs, old.Spec, cs.Spec) {
+		return nil, nil
+	}
+
+	errs := cs.validate()
+	errs = append(errs, validateImmutableIdentity(field.NewPath("spec"), cs.Spec.Name, cs.Spec.Namespace, old.Spec.Name, old.Spec.Namespace)...)
+	return nil, toValidationError("CredentialSet", cs.Name, errs)
+}
+
+// ValidateDelete allows a CredentialSet to be deleted.
+func (v *CredentialSetCustomValidator) ValidateDelete(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func (cs *CredentialSet) validate() field.ErrorList {
+	specPath := field.NewPath("spec")
+	errs := validateSchemaVersion(specPath.Child("schemaVersion"), cs.Spec.SchemaVersion, CredentialSetSchemaVersion)
+	if cs.Spec.Name == "" {
+		errs = append(errs, field.Required(specPath.Child("name"), ""))
+	}
+
+	names := make(map[string]bool, len(cs.Spec.Credentials))
+	for i, cred := range cs.Spec.Credentials {
+		credPath := specPath.Child("credentials").Index(i)
+		if cred.Name == "" {
+			errs = append(errs, field.Required(credPath.Child("name"), ""))
+		} else if names[cred.Name] {
+			errs = append(errs, field.Duplicate(credPath.Child("name"), cred.Name))
+		}
+		names[cred.Name] = true
+
+		if cred.Source.Secret == "" {
+			errs = append(errs, field.Required(credPath.Child("source", "secret"), "the credential must have a source"))
+		}
+	}
+
+	return errs
+}
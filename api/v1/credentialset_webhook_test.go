@@ -0,0 +1,61 @@
+package v1
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestCredentialSetCustomValidator(t *testing.T) {
+	validCredentialSet := func() *CredentialSet {
+		return &CredentialSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "mycreds", Namespace: "test"},
+			Spec: CredentialSetSpec{
+				SchemaVersion: CredentialSetSchemaVersion,
+				Name:          "mycreds",
+				Namespace:     "dev",
+				Credentials: []Credential{
+					{Name: "username", Source: CredentialSource{Secret: "myuser"}},
+					{Name: "password", Source: CredentialSource{Secret: "mypassword"}},
+				},
+			},
+		}
+	}
+	v := &CredentialSetCustomValidator{}
+
+	t.Run("valid", func(t *testing.T) {
+		_, err := v.ValidateCreate(context.Background(), validCredentialSet())
+		require.NoError(t, err)
+	})
+
+	t.Run("empty source", func(t *testing.T) {
+		cs := validCredentialSet()
+		cs.Spec.Credentials[1].Source = CredentialSource{}
+		_, err := v.ValidateCreate(context.Background(), cs)
+		assertFieldError(t, err, "spec.credentials[1].source.secret", "the credential must have a source")
+	})
+
+	t.Run("duplicate credential", func(t *testing.T) {
+		cs := validCredentialSet()
+		cs.Spec.Credentials[1].Name = "username"
+		_, err := v.ValidateCreate(context.Background(), cs)
+		assertFieldError(t, err, "spec.credentials[1].name", "Duplicate value")
+	})
+
+	t.Run("missing schema version", func(t *testing.T) {
+		cs := validCredentialSet()
+		cs.Spec.SchemaVersion = ""
+		_, err := v.ValidateCreate(context.Background(), cs)
+		assertFieldError(t, err, "spec.schemaVersion", "Required value")
+	})
+
+	t.Run("rename", func(t *testing.T) {
+		old := validCredentialSet()
+		cs := validCredentialSet()
+		cs.Spec.Name = "yourcreds"
+		_, err := v.ValidateUpdate(context.Background(), old, cs)
+		assertFieldError(t, err, "spec.name", "field is immutable")
+	})
+}
@@ -2,6 +2,7 @@ package v1
 
 import (
 	"encoding/json"
+	"time"
 
 	"github.com/pkg/errors"
 	"gopkg.in/yaml.v3"
@@ -16,8 +17,249 @@ const (
 	PorterDeletePolicyAnnotation = "getporter.org/deletion-policy"
 	PorterDeletePolicyDelete     = "delete"
 	PorterDeletePolicyOrphan     = "orphan"
+
+	// ConditionDrifted is set on an Installation when drift detection is enabled.
+	// It is true when the installation recorded by Porter no longer matches the resource.
+	ConditionDrifted = "Drifted"
+
+	// ConditionUpdateAvailable is set on an Installation with an update policy.
+	// It is true when a newer bundle that satisfies the policy is available from the registry.
+	ConditionUpdateAvailable = "UpdateAvailable"
+
+	// ConditionApproved is set on an Installation with an approval policy while its plan
+	// is waiting for approval. It is false until the plan is approved or expires.
+	ConditionApproved = "Approved"
+
+	// AnnotationApprove approves the plan for a generation of an Installation,
+	// when the value is the generation number.
+	AnnotationApprove = Prefix + "approve"
+
+	// AnnotationApprovedBy records who approved the plan for an Installation.
+	AnnotationApprovedBy = Prefix + "approved-by"
+
+	// ConditionWaitingForDependencies is set on an Installation with dependencies.
+	// It is true while the installation waits for its dependencies to succeed, or
+	// while it waits for the installations that depend on it to be uninstalled.
+	ConditionWaitingForDependencies = "WaitingForDependencies"
+
+	// ConditionOutputsAvailable is set on an Installation once outputs are retrieved
+	// from the Porter gRPC server. It is false when the installation succeeded but
+	// its outputs could not be retrieved.
+	ConditionOutputsAvailable = "OutputsAvailable"
+
+	// DefaultBundleUpdateInterval is how often the registry is checked for a new bundle
+	// when the interval is not specified on the update policy.
+	DefaultBundleUpdateInterval = time.Hour
+
+	// DefaultRetryBackoffBase is how long to wait before the first retry of a failed
+	// installation when the backoff base is not specified on the retry policy.
+	DefaultRetryBackoffBase = 30 * time.Second
+
+	// DefaultRetryBackoffCap is the longest time to wait between retries of a failed
+	// installation when the backoff cap is not specified on the retry policy.
+	DefaultRetryBackoffCap = 10 * time.Minute
+
+	// RedactedValue replaces sensitive values that are recorded in a resource status.
+	RedactedValue = "******"
 )
 
+// Actions that Porter would run for an installation, recorded in InstallationPlan.
+const (
+	PlanActionInstall   = "install"
+	PlanActionUpgrade   = "upgrade"
+	PlanActionUninstall = "uninstall"
+	PlanActionNoop      = "noop"
+	PlanActionUnknown   = "unknown"
+)
+
+// DriftPolicy specifies how the operator handles an Installation that no
+// longer matches the installation recorded by Porter.
+type DriftPolicy string
+
+const (
+	// DriftPolicyDetect reports the drift with the Drifted condition.
+	DriftPolicyDetect DriftPolicy = "Detect"
+
+	// DriftPolicyCorrect reports the drift and re-applies the installation.
+	DriftPolicyCorrect DriftPolicy = "Correct"
+)
+
+// BundleUpdateStrategy specifies how new versions of a bundle are resolved from the registry.
+type BundleUpdateStrategy string
+
+const (
+	// BundleUpdateSemVer updates to the highest tag that satisfies a semantic version constraint.
+	BundleUpdateSemVer BundleUpdateStrategy = "SemVer"
+
+	// BundleUpdateLatestDigest updates to the current digest of the bundle tag.
+	BundleUpdateLatestDigest BundleUpdateStrategy = "LatestDigest"
+)
+
+// BundleUpdateMode specifies what the operator does when a new bundle is available.
+type BundleUpdateMode string
+
+const (
+	// BundleUpdateNotify reports the new bundle with the UpdateAvailable condition.
+	BundleUpdateNotify BundleUpdateMode = "Notify"
+
+	// BundleUpdateApply updates the bundle on the installation, which upgrades the installation.
+	BundleUpdateApply BundleUpdateMode = "Apply"
+)
+
+// BundleUpdatePolicy defines how an Installation is kept up-to-date with new versions of its bundle.
+type BundleUpdatePolicy struct {
+	// Strategy used to resolve new versions of the bundle from the registry.
+	// SemVer selects the highest tag that satisfies Constraint.
+	// LatestDigest pins the bundle to the current digest of the tracked tag.
+	// +kubebuilder:validation:Enum=SemVer;LatestDigest
+	Strategy BundleUpdateStrategy `json:"strategy"`
+
+	// Constraint is a semantic version range, for example ~1.2 or ">= 1.0, < 2.0", that new versions must satisfy.
+	// Only used by the SemVer strategy. Defaults to any stable version.
+	// +optional
+	Constraint string `json:"constraint,omitempty"`
+
+	// Tag is the tag tracked by the LatestDigest strategy.
+	// Defaults to the bundle tag, the tag for the bundle version, or latest.
+	// The tag is recorded here when the bundle is pinned to a new digest.
+	// +optional
+	Tag string `json:"tag,omitempty"`
+
+	// Mode specifies if a new bundle is only reported (Notify) or applied to the installation (Apply).
+	// Defaults to Notify.
+	// +kubebuilder:validation:Enum=Notify;Apply
+	// +optional
+	Mode BundleUpdateMode `json:"mode,omitempty"`
+
+	// Interval is how often the registry is checked for a new bundle. Defaults to 1h.
+	// +optional
+	Interval *metav1.Duration `json:"interval,omitempty"`
+
+	// MaintenanceWindow limits when a new bundle is applied to the installation.
+	// When not specified, updates are applied as soon as they are found.
+	// +optional
+	MaintenanceWindow *MaintenanceWindow `json:"maintenanceWindow,omitempty"`
+
+	// PullSecret is a Secret in the same namespace with the credentials for the registry,
+	// such as the kubernetes.io/dockerconfigjson secret used to pull images.
+	// The registry is accessed anonymously when not specified.
+	// +optional
+	PullSecret *corev1.LocalObjectReference `json:"pullSecret,omitempty"`
+
+	// InsecureRegistry accesses the registry over plain HTTP instead of HTTPS.
+	// +optional
+	InsecureRegistry bool `json:"insecureRegistry,omitempty"`
+}
+
+// RetryPolicy defines how a failed Installation is automatically retried.
+// Each retry runs the installation again with a new AgentAction.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of times that a failed installation is retried.
+	// Retries are disabled when it is zero.
+	// +kubebuilder:validation:Minimum=0
+	MaxAttempts int32 `json:"maxAttempts" mapstructure:"maxAttempts"`
+
+	// BackoffBase is how long to wait before the first retry. The wait doubles after each retry.
+	// Defaults to 30s.
+	// +optional
+	BackoffBase *metav1.Duration `json:"backoffBase,omitempty" mapstructure:"backoffBase,omitempty"`
+
+	// BackoffCap is the longest time to wait between retries. Defaults to 10m.
+	// +optional
+	BackoffCap *metav1.Duration `json:"backoffCap,omitempty" mapstructure:"backoffCap,omitempty"`
+
+	// RetryableReasons limits retries to failures with one of these reasons on the Failed condition,
+	// for example BundlePullFailed. Defaults to retrying every failure.
+	// +optional
+	RetryableReasons []string `json:"retryableReasons,omitempty" mapstructure:"retryableReasons,omitempty"`
+}
+
+// GetBackoff returns how long to wait before the next retry, after the
+// specified number of retries have already been attempted.
+func (p RetryPolicy) GetBackoff(attempts int32) time.Duration {
+	base := DefaultRetryBackoffBase
+	if p.BackoffBase != nil && p.BackoffBase.Duration > 0 {
+		base = p.BackoffBase.Duration
+	}
+	limit := DefaultRetryBackoffCap
+	if p.BackoffCap != nil && p.BackoffCap.Duration > 0 {
+		limit = p.BackoffCap.Duration
+	}
+
+	backoff := base
+	for i := int32(0); i < attempts && backoff < limit; i++ {
+		backoff *= 2
+	}
+	if backoff > limit {
+		return limit
+	}
+	return backoff
+}
+
+// IsRetryable determines if a failure with the specified reason should be retried.
+func (p RetryPolicy) IsRetryable(reason string) bool {
+	if len(p.RetryableReasons) == 0 {
+		return true
+	}
+	for _, r := range p.RetryableReasons {
+		if r == reason {
+			return true
+		}
+	}
+	return false
+}
+
+// ApprovalPolicy defines how changes to an Installation are approved.
+// A change is first evaluated with a dry-run, and the resulting plan is
+// applied once it is approved with the approve annotation.
+type ApprovalPolicy struct {
+	// Required specifies that changes must be approved before they are applied.
+	Required bool `json:"required" mapstructure:"required"`
+
+	// Timeout is how long a plan waits to be approved before it expires.
+	// Plans do not expire when it is not set.
+	// +optional
+	Timeout *metav1.Duration `json:"timeout,omitempty" mapstructure:"timeout,omitempty"`
+}
+
+// IsRequired determines if changes must be approved before they are applied.
+func (p *ApprovalPolicy) IsRequired() bool {
+	return p != nil && p.Required
+}
+
+// GetTimeout returns how long a plan waits to be approved, or zero when plans do not expire.
+func (p *ApprovalPolicy) GetTimeout() time.Duration {
+	if p == nil || p.Timeout == nil || p.Timeout.Duration <= 0 {
+		return 0
+	}
+	return p.Timeout.Duration
+}
+
+// GetInterval returns how often the registry is checked for a new bundle.
+func (p BundleUpdatePolicy) GetInterval() time.Duration {
+	if p.Interval == nil || p.Interval.Duration <= 0 {
+		return DefaultBundleUpdateInterval
+	}
+	return p.Interval.Duration
+}
+
+// GetMode returns what to do when a new bundle is available.
+func (p BundleUpdatePolicy) GetMode() BundleUpdateMode {
+	if p.Mode == "" {
+		return BundleUpdateNotify
+	}
+	return p.Mode
+}
+
+// MaintenanceWindow is a recurring period of time when changes may be applied.
+type MaintenanceWindow struct {
+	// Schedule in Cron format when the window opens, see https://en.wikipedia.org/wiki/Cron.
+	Schedule string `json:"schedule"`
+
+	// Duration is how long the window stays open, for example 2h.
+	Duration metav1.Duration `json:"duration"`
+}
+
 // We marshal installation spec to yaml when converting to a porter object
 var _ yaml.Marshaler = InstallationSpec{}
 
@@ -31,6 +273,57 @@ type InstallationSpec struct {
 	// +optional
 	AgentConfig *corev1.LocalObjectReference `json:"agentConfig,omitempty" yaml:"-"`
 
+	// ResyncInterval is how often the installation is compared with the installation recorded by Porter to detect drift.
+	// Overrides the interval defined on the AgentConfig. Set to zero to disable drift detection.
+	// +optional
+	ResyncInterval *metav1.Duration `json:"resyncInterval,omitempty" yaml:"-"`
+
+	// DriftPolicy specifies how the installation is handled when it has drifted.
+	// Overrides the policy defined on the AgentConfig.
+	// +kubebuilder:validation:Enum=Detect;Correct
+	// +optional
+	DriftPolicy DriftPolicy `json:"driftPolicy,omitempty" yaml:"-"`
+
+	// UpdatePolicy enables checking the registry for new versions of the bundle.
+	// +optional
+	UpdatePolicy *BundleUpdatePolicy `json:"updatePolicy,omitempty" yaml:"-"`
+
+	// RetryPolicy enables automatically retrying the installation when it fails.
+	// Overrides the policy defined on the AgentConfig.
+	// +optional
+	RetryPolicy *RetryPolicy `json:"retryPolicy,omitempty" yaml:"-"`
+
+	// Suspend stops the operator from reconciling the installation.
+	// Changes made while the installation is suspended are applied when it is resumed.
+	// +optional
+	Suspend bool `json:"suspend,omitempty" yaml:"-"`
+
+	// DryRun evaluates changes to the installation with Porter without executing the bundle.
+	// What Porter would do is recorded in status.plan.
+	// +optional
+	DryRun bool `json:"dryRun,omitempty" yaml:"-"`
+
+	// ApprovalPolicy requires changes to the installation to be approved before they are applied.
+	// Overrides the policy defined on the AgentConfig.
+	// +optional
+	ApprovalPolicy *ApprovalPolicy `json:"approvalPolicy,omitempty" yaml:"-"`
+
+	// DependsOn is a list of installations that must succeed before this installation is applied.
+	// The installation is uninstalled after the installations that depend on it.
+	// +optional
+	DependsOn []InstallationReference `json:"dependsOn,omitempty" yaml:"-"`
+
+	// ParameterSources are parameters that are resolved by the operator when the
+	// installation is applied, for example from the outputs of another installation.
+	// They take precedence over parameters with the same name.
+	// +optional
+	ParameterSources []Parameter `json:"parameterSources,omitempty" yaml:"-"`
+
+	// OutputSync writes the outputs of the installation to a ConfigMap, and its
+	// sensitive outputs to a Secret, so that they can be used by applications in the cluster.
+	// +optional
+	OutputSync *OutputSync `json:"outputSync,omitempty" yaml:"-"`
+
 	//
 	// These are fields from the Porter installation resource.
 	// Your goal is that someone can copy/paste a resource from Porter into the
@@ -67,6 +360,69 @@ type InstallationSpec struct {
 	ParameterSets []string `json:"parameterSets,omitempty" yaml:"parameterSets,omitempty"`
 }
 
+// OutputSync defines where the outputs of an installation are written.
+// Outputs that are not sensitive are written to a ConfigMap, and sensitive
+// outputs are written to a Secret. Both are owned by the installation.
+type OutputSync struct {
+	// ConfigMapName is the name of the ConfigMap that the outputs are written to.
+	// Defaults to the name of the installation followed by -outputs.
+	// +optional
+	ConfigMapName string `json:"configMapName,omitempty"`
+
+	// SecretName is the name of the Secret that the sensitive outputs are written to.
+	// Defaults to the name of the installation followed by -outputs.
+	// +optional
+	SecretName string `json:"secretName,omitempty"`
+
+	// Keys maps the name of an output to the key that it is written to.
+	// Outputs that are not in the map are written to a key with the name of the output.
+	// +optional
+	Keys map[string]string `json:"keys,omitempty"`
+}
+
+// GetConfigMapName returns the name of the ConfigMap that the outputs of the installation are written to.
+func (s OutputSync) GetConfigMapName(installation string) string {
+	if s.ConfigMapName == "" {
+		return installation + "-outputs"
+	}
+	return s.ConfigMapName
+}
+
+// GetSecretName returns the name of the Secret that the sensitive outputs of the installation are written to.
+func (s OutputSync) GetSecretName(installation string) string {
+	if s.SecretName == "" {
+		return installation + "-outputs"
+	}
+	return s.SecretName
+}
+
+// GetKey returns the key that an output is written to.
+func (s OutputSync) GetKey(output string) string {
+	if key, ok := s.Keys[output]; ok && key != "" {
+		return key
+	}
+	return output
+}
+
+// InstallationReference is a reference to an Installation resource.
+type InstallationReference struct {
+	// Name of the Installation.
+	Name string `json:"name"`
+
+	// Namespace of the Installation. Defaults to the namespace of the installation that references it.
+	// Other namespaces are only allowed when the operator allows cross-namespace dependencies.
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// GetNamespace returns the namespace of the referenced installation, defaulting to the specified namespace.
+func (r InstallationReference) GetNamespace(defaultNamespace string) string {
+	if r.Namespace == "" {
+		return defaultNamespace
+	}
+	return r.Namespace
+}
+
 type OCIReferenceParts struct {
 	// Repository is the OCI repository of the current bundle definition.
 	Repository string `json:"repository" yaml:"repository"`
@@ -110,10 +466,102 @@ func (in InstallationSpec) MarshalYAML() (interface{}, error) {
 // InstallationStatus defines the observed state of Installation
 type InstallationStatus struct {
 	PorterResourceStatus `json:",inline"`
+
+	// LastResyncTime is the last time that the installation was compared with the installation recorded by Porter.
+	// +optional
+	LastResyncTime *metav1.Time `json:"lastResyncTime,omitempty"`
+
+	// AvailableUpdate is the newest bundle found in the registry that satisfies the update policy.
+	// +optional
+	AvailableUpdate *OCIReferenceParts `json:"availableUpdate,omitempty"`
+
+	// LastUpdateCheckTime is the last time that the registry was checked for a new bundle.
+	// +optional
+	LastUpdateCheckTime *metav1.Time `json:"lastUpdateCheckTime,omitempty"`
+
+	// RetryAttempts is the number of times that the current generation of the
+	// installation was automatically retried after it failed.
+	// +optional
+	RetryAttempts int32 `json:"retryAttempts,omitempty"`
+
+	// NextRetryTime is when the failed installation will be automatically retried.
+	// +optional
+	NextRetryTime *metav1.Time `json:"nextRetryTime,omitempty"`
+
+	// Plan is what Porter would do to apply the installation, from the most recent dry-run.
+	// +optional
+	Plan *InstallationPlan `json:"plan,omitempty"`
+
+	// Approval is the most recent approval of a plan for the installation.
+	// +optional
+	Approval *InstallationApproval `json:"approval,omitempty"`
+
+	// OutputConfigMap is the ConfigMap that the outputs of the installation are written to.
+	// +optional
+	OutputConfigMap *corev1.LocalObjectReference `json:"outputConfigMap,omitempty"`
+
+	// OutputSecret is the Secret that the sensitive outputs of the installation are written to.
+	// +optional
+	OutputSecret *corev1.LocalObjectReference `json:"outputSecret,omitempty"`
+}
+
+// InstallationApproval records the approval of the plan for a generation of an installation.
+type InstallationApproval struct {
+	// Generation of the installation that was approved.
+	Generation int64 `json:"generation"`
+
+	// ApprovedBy is who approved the plan, from the approved-by annotation.
+	ApprovedBy string `json:"approvedBy"`
+
+	// ApprovalTime is when the approval was recorded.
+	ApprovalTime metav1.Time `json:"approvalTime"`
+}
+
+// InstallationPlan is what Porter would do to apply a generation of an installation.
+type InstallationPlan struct {
+	// Generation of the installation that was planned.
+	Generation int64 `json:"generation"`
+
+	// AgentAction that ran the dry-run.
+	AgentAction corev1.LocalObjectReference `json:"agentAction"`
+
+	// Action is the bundle action that Porter would run: install, upgrade, uninstall,
+	// or noop when the installation is up-to-date. It is unknown when it could not be
+	// determined from the output of the dry-run.
+	Action string `json:"action"`
+
+	// Bundle is the reference to the bundle that would be run.
+	Bundle string `json:"bundle"`
+
+	// Parameters are the parameter values that would be used, from the installation and its parameter sets.
+	// Values from secrets are redacted.
+	// +optional
+	Parameters []PlannedParameter `json:"parameters,omitempty"`
+
+	// PlanTime is when the plan was recorded.
+	PlanTime metav1.Time `json:"planTime"`
+
+	// ExpiryTime is when the plan expires if it is not approved.
+	// +optional
+	ExpiryTime *metav1.Time `json:"expiryTime,omitempty"`
+}
+
+// PlannedParameter is the value of a parameter in an InstallationPlan.
+type PlannedParameter struct {
+	// Name of the bundle parameter.
+	Name string `json:"name"`
+
+	// Value of the parameter, or a placeholder when the value is sensitive.
+	// +optional
+	Value string `json:"value,omitempty"`
+
+	// Source of the value, either the installation's parameters, or the name of a parameter set or InstallationOutput.
+	Source string `json:"source"`
 }
 
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
+// +kubebuilder:storageversion
 
 // Installation is the Schema for the installations API
 // +kubebuilder:printcolumn:name="Porter Name",type="string",JSONPath=".spec.name"
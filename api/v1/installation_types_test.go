@@ -2,6 +2,7 @@ package v1
 
 import (
 	"testing"
+	"time"
 
 	"get.porter.sh/porter/pkg/storage"
 	"get.porter.sh/porter/pkg/test"
@@ -59,3 +60,51 @@ func TestInstallation_SetRetryAnnotation(t *testing.T) {
 	inst.SetRetryAnnotation("retry-1")
 	assert.Equal(t, "retry-1", inst.Annotations[AnnotationRetry])
 }
+
+func TestBundleUpdatePolicy_Defaults(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		policy := BundleUpdatePolicy{Strategy: BundleUpdateSemVer}
+		assert.Equal(t, DefaultBundleUpdateInterval, policy.GetInterval())
+		assert.Equal(t, BundleUpdateNotify, policy.GetMode())
+	})
+
+	t.Run("specified", func(t *testing.T) {
+		policy := BundleUpdatePolicy{
+			Strategy: BundleUpdateLatestDigest,
+			Mode:     BundleUpdateApply,
+			Interval: &metav1.Duration{Duration: 5 * time.Minute},
+		}
+		assert.Equal(t, 5*time.Minute, policy.GetInterval())
+		assert.Equal(t, BundleUpdateApply, policy.GetMode())
+	})
+}
+
+func TestRetryPolicy_GetBackoff(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		policy := RetryPolicy{MaxAttempts: 10}
+		assert.Equal(t, DefaultRetryBackoffBase, policy.GetBackoff(0))
+		assert.Equal(t, 2*DefaultRetryBackoffBase, policy.GetBackoff(1))
+		assert.Equal(t, DefaultRetryBackoffCap, policy.GetBackoff(9), "the backoff should be capped")
+	})
+
+	t.Run("specified", func(t *testing.T) {
+		policy := RetryPolicy{
+			MaxAttempts: 10,
+			BackoffBase: &metav1.Duration{Duration: time.Second},
+			BackoffCap:  &metav1.Duration{Duration: 5 * time.Second},
+		}
+		assert.Equal(t, time.Second, policy.GetBackoff(0))
+		assert.Equal(t, 4*time.Second, policy.GetBackoff(2))
+		assert.Equal(t, 5*time.Second, policy.GetBackoff(3))
+		assert.Equal(t, 5*time.Second, policy.GetBackoff(100), "the backoff should not overflow")
+	})
+}
+
+func TestRetryPolicy_IsRetryable(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 1}
+	assert.True(t, policy.IsRetryable(FailureReasonJobFailed), "every failure should be retried by default")
+
+	policy.RetryableReasons = []string{FailureReasonBundlePullFailed}
+	assert.True(t, policy.IsRetryable(FailureReasonBundlePullFailed))
+	assert.False(t, policy.IsRetryable(FailureReasonCredentialResolutionFailed))
+}
@@ -0,0 +1,306 @@
+package v1
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
+	"github.com/robfig/cron/v3"
+	admissionv1 "k8s.io/api/admission/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// SetupWebhookWithManager registers the Installation webhooks with the manager.
+func (i *Installation) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(i).
+		WithDefaulter(&InstallationCustomDefaulter{Client: mgr.GetAPIReader()}).
+		WithValidator(&InstallationCustomValidator{}).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/mutate-getporter-org-v1-installation,mutating=true,failurePolicy=fail,sideEffects=None,groups=getporter.org,resources=installations,verbs=create;update,versions=v1,name=minstallation.getporter.org,admissionReviewVersions=v1
+
+// InstallationCustomDefaulter sets default values on an Installation when it is created or updated.
+// +kubebuilder:object:generate=false
+type InstallationCustomDefaulter struct {
+	// Client is used to look up the PorterConfig that defines the default Porter namespace.
+	Client client.Reader
+}
+
+var _ webhook.CustomDefaulter = &InstallationCustomDefaulter{}
+
+// Default sets the schema version and deletion policy of the Installation when
+// they are not set. New installations without a Porter namespace are assigned the
+// default namespace from the PorterConfig, the namespace cannot be changed later.
+func (d *InstallationCustomDefaulter) Default(ctx context.Context, obj runtime.Object) error {
+	inst, ok := obj.(*Installation)
+	if !ok {
+		return fmt.Errorf("expected an Installation but got %T", obj)
+	}
+
+	inst.setDefaults()
+
+	if inst.Spec.Namespace == "" && isCreate(ctx) {
+		namespace, err := resolvePorterNamespace(ctx, d.Client, inst.Namespace)
+		if err != nil {
+			return err
+		}
+		inst.Spec.Namespace = namespace
+	}
+	return nil
+}
+
+func (i *Installation) setDefaults() {
+	if i.Spec.SchemaVersion == "" {
+		i.Spec.SchemaVersion = InstallationSchemaVersion
+	}
+
+	annotations := i.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	policy := strings.ToLower(annotations[PorterDeletePolicyAnnotation])
+	if policy == "" {
+		policy = PorterDeletePolicyDelete
+	}
+	annotations[PorterDeletePolicyAnnotation] = policy
+	i.SetAnnotations(annotations)
+}
+
+// isCreate determines if the admission request being handled creates a resource.
+func isCreate(ctx context.Context) bool {
+	req, err := admission.RequestFromContext(ctx)
+	if err != nil {
+		return false
+	}
+	return req.Operation == admissionv1.Create
+}
+
+// resolvePorterNamespace returns the default Porter namespace defined by the
+// PorterConfig for the specified Kubernetes namespace. The namespace level
+// PorterConfig takes precedence over the system level PorterConfig.
+func resolvePorterNamespace(ctx context.Context, c client.Reader, namespace string) (string, error) {
+	for _, ns := range []string{namespace, OperatorNamespace} {
+		cfg := &PorterConfig{}
+		err := c.Get(ctx, types.NamespacedName{Name: "default", Namespace: ns}, cfg)
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return "", errors.Wrapf(err, "cannot retrieve the porter configuration in namespace %s", ns)
+		}
+		if cfg.Spec.Namespace != nil && *cfg.Spec.Namespace != "" {
+			return *cfg.Spec.Namespace, nil
+		}
+	}
+	return "", nil
+}
+
+// +kubebuilder:webhook:path=/validate-getporter-org-v1-installation,mutating=false,failurePolicy=fail,sideEffects=None,groups=getporter.org,resources=installations,verbs=create;update,versions=v1,name=vinstallation.getporter.org,admissionReviewVersions=v1
+
+// InstallationCustomValidator validates an Installation when it is created or updated.
+// +kubebuilder:object:generate=false
+type InstallationCustomValidator struct{}
+
+var _ webhook.CustomValidator = &InstallationCustomValidator{}
+
+// ValidateCreate validates a new Installation.
+func (v *InstallationCustomValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	inst, ok := obj.(*Installation)
+	if !ok {
+		return nil, fmt.Errorf("expected an Installation but got %T", obj)
+	}
+	return nil, toValidationError("Installation", inst.Name, inst.validate())
+}
+
+// ValidateUpdate validates changes to an Installation.
+func (v *InstallationCustomValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	inst, ok := newObj.(*Installation)
+	if !ok {
+		return nil, fmt.Errorf("expected an Installation but got %T", newObj)
+	}
+	old, ok := oldObj.(*Installation)
+	if !ok {
+		return nil, fmt.Errorf("expected an Installation but got %T", oldObj)
+	}
+
+	if inst.DeletionTimestamp != nil {
+		return nil, nil
+	}
+	if skipSpecValidation(inst, old.Spec, inst.Spec) {
+		return nil, toValidationError("Installation", inst.Name, inst.validateDeletePolicy())
+	}
+
+	errs := inst.validate()
+	errs = append(errs, validateImmutableIdentity(field.NewPath("spec"), inst.Spec.Name, inst.Spec.Namespace, old.Spec.Name, old.Spec.Namespace)...)
+	return nil, toValidationError("Installation", inst.Name, errs)
+}
+
+// ValidateDelete allows an Installation to be deleted.
+func (v *InstallationCustomValidator) ValidateDelete(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func (i *Installation) validate() field.ErrorList {
+	errs := i.validateDeletePolicy()
+
+	specPath := field.NewPath("spec")
+	errs = append(errs, validateSchemaVersion(specPath.Child("schemaVersion"), i.Spec.SchemaVersion, InstallationSchemaVersion)...)
+	if i.Spec.Name == "" {
+		errs = append(errs, field.Required(specPath.Child("name"), ""))
+	}
+	errs = append(errs, i.Spec.Bundle.validate(specPath.Child("bundle"))...)
+
+	if i.Spec.Parameters.Raw != nil {
+		var params map[string]interface{}
+		if err := json.Unmarshal(i.Spec.Parameters.Raw, &params); err != nil {
+			errs = append(errs, field.Invalid(specPath.Child("parameters"), string(i.Spec.Parameters.Raw), "must be a map of parameter names to values"))
+		}
+	}
+
+	errs = append(errs, validateParameterSources(specPath.Child("parameterSources"), i.Spec.ParameterSources)...)
+	if i.Spec.OutputSync != nil {
+		errs = append(errs, i.Spec.OutputSync.validate(specPath.Child("outputSync"))...)
+	}
+	errs = append(errs, validateNonNegativeDuration(specPath.Child("resyncInterval"), i.Spec.ResyncInterval)...)
+	if i.Spec.UpdatePolicy != nil {
+		errs = append(errs, i.Spec.UpdatePolicy.validate(specPath.Child("updatePolicy"), i.Spec.Bundle)...)
+	}
+
+	return errs
+}
+
+// validateDeletePolicy checks the annotation that controls what happens to the installation in Porter
+// when the Installation resource is deleted.
+func (i *Installation) validateDeletePolicy() field.ErrorList {
+	policy, ok := i.Annotations[PorterDeletePolicyAnnotation]
+	if !ok || policy == PorterDeletePolicyDelete || policy == PorterDeletePolicyOrphan {
+		return nil
+	}
+	path := field.NewPath("metadata", "annotations").Key(PorterDeletePolicyAnnotation)
+	return field.ErrorList{field.NotSupported(path, policy, []string{PorterDeletePolicyDelete, PorterDeletePolicyOrphan})}
+}
+
+// validateParameterSources validates the parameters that are resolved by the
+// operator. Secrets are resolved by Porter, so they must be defined in a parameter set.
+func validateParameterSources(path *field.Path, params []Parameter) field.ErrorList {
+	var errs field.ErrorList
+	names := make(map[string]bool, len(params))
+	for i, param := range params {
+		paramPath := path.Index(i)
+		if param.Name == "" {
+			errs = append(errs, field.Required(paramPath.Child("name"), ""))
+		} else if names[param.Name] {
+			errs = append(errs, field.Duplicate(paramPath.Child("name"), param.Name))
+		}
+		names[param.Name] = true
+
+		source := param.Source
+		switch {
+		case source.Secret != "":
+			errs = append(errs, field.Forbidden(paramPath.Child("source", "secret"), "secret sources are resolved by Porter, use a parameter set instead"))
+		case source.Output != nil && source.Value != "":
+			errs = append(errs, field.Invalid(paramPath.Child("source"), source, "only one of output or value may be specified"))
+		case source.Output != nil:
+			if source.Output.Name == "" {
+				errs = append(errs, field.Required(paramPath.Child("source", "output", "name"), ""))
+			}
+			if source.Output.Key == "" {
+				errs = append(errs, field.Required(paramPath.Child("source", "output", "key"), ""))
+			}
+		case source.Value == "":
+			errs = append(errs, field.Required(paramPath.Child("source"), "the parameter must have an output or value source"))
+		}
+	}
+	return errs
+}
+
+func (s OutputSync) validate(path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	for name, value := range map[string]string{"configMapName": s.ConfigMapName, "secretName": s.SecretName} {
+		if value == "" {
+			continue
+		}
+		for _, msg := range validation.IsDNS1123Subdomain(value) {
+			errs = append(errs, field.Invalid(path.Child(name), value, msg))
+		}
+	}
+	for output, key := range s.Keys {
+		for _, msg := range validation.IsConfigMapKey(key) {
+			errs = append(errs, field.Invalid(path.Child("keys").Key(output), key, msg))
+		}
+	}
+	return errs
+}
+
+func (r OCIReferenceParts) validate(path *field.Path) field.ErrorList {
+	errs := validateRepository(path.Child("repository"), r.Repository)
+
+	var set []string
+	if r.Digest != "" {
+		set = append(set, "digest")
+		if _, err := digest.Parse(r.Digest); err != nil {
+			errs = append(errs, field.Invalid(path.Child("digest"), r.Digest, err.Error()))
+		}
+	}
+	if r.Tag != "" {
+		set = append(set, "tag")
+	}
+	if r.Version != "" {
+		set = append(set, "version")
+		if _, err := semver.NewVersion(r.Version); err != nil {
+			errs = append(errs, field.Invalid(path.Child("version"), r.Version, "must be a semantic version"))
+		}
+	}
+	if len(set) > 1 {
+		errs = append(errs, field.Invalid(path, set, "only one of digest, tag or version may be specified"))
+	}
+
+	return errs
+}
+
+func (p BundleUpdatePolicy) validate(path *field.Path, bundle OCIReferenceParts) field.ErrorList {
+	var errs field.ErrorList
+
+	if p.Strategy == BundleUpdateSemVer {
+		if p.Constraint != "" {
+			if _, err := semver.NewConstraint(p.Constraint); err != nil {
+				errs = append(errs, field.Invalid(path.Child("constraint"), p.Constraint, err.Error()))
+			}
+		}
+		current := bundle.Version
+		if current == "" {
+			current = bundle.Tag
+		}
+		if _, err := semver.NewVersion(current); err != nil {
+			errs = append(errs, field.Invalid(path.Child("strategy"), p.Strategy, "the SemVer strategy requires bundle.version or a semantic version bundle.tag"))
+		}
+	}
+
+	errs = append(errs, validateNonNegativeDuration(path.Child("interval"), p.Interval)...)
+
+	if p.MaintenanceWindow != nil {
+		windowPath := path.Child("maintenanceWindow")
+		if _, err := cron.ParseStandard(p.MaintenanceWindow.Schedule); err != nil {
+			errs = append(errs, field.Invalid(windowPath.Child("schedule"), p.MaintenanceWindow.Schedule, err.Error()))
+		}
+		if p.MaintenanceWindow.Duration.Duration <= 0 {
+			errs = append(errs, field.Invalid(windowPath.Child("duration"), p.MaintenanceWindow.Duration.Duration.String(), "must be greater than zero"))
+		}
+	}
+
+	return errs
+}
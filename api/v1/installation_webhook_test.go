@@ -0,0 +1,260 @@
+package v1
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	admissionv1 "k8s.io/api/admission/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+func TestInstallationCustomValidator_ValidateCreate(t *testing.T) {
+	validInstallation := func() *Installation {
+		return &Installation{
+			ObjectMeta: metav1.ObjectMeta{Name: "mybuns", Namespace: "test"},
+			Spec: InstallationSpec{
+				SchemaVersion: InstallationSchemaVersion,
+				Name:          "mybuns",
+				Namespace:     "dev",
+				Bundle:        OCIReferenceParts{Repository: "ghcr.io/getporter/porter-hello", Version: "0.2.0"},
+				Parameters:    runtime.RawExtension{Raw: []byte(`{"name":"llamas"}`)},
+			},
+		}
+	}
+
+	testcases := []struct {
+		name      string
+		modify    func(inst *Installation)
+		wantField string
+		wantErr   string
+	}{
+		{name: "valid", modify: func(inst *Installation) {}},
+		{name: "tag and digest", modify: func(inst *Installation) {
+			inst.Spec.Bundle = OCIReferenceParts{Repository: "ghcr.io/getporter/porter-hello", Tag: "v0.2.0",
+				Digest: "sha256:276b44be3f478b4c8d1f99c1925386d45a878a853f22436ece5589f32e9df384"}
+		}, wantField: "spec.bundle", wantErr: "only one of digest, tag or version may be specified"},
+		{name: "invalid digest", modify: func(inst *Installation) {
+			inst.Spec.Bundle = OCIReferenceParts{Repository: "ghcr.io/getporter/porter-hello", Digest: "sha256:abc"}
+		}, wantField: "spec.bundle.digest"},
+		{name: "invalid version", modify: func(inst *Installation) { inst.Spec.Bundle.Version = "latest" },
+			wantField: "spec.bundle.version", wantErr: "must be a semantic version"},
+		{name: "repository with tag", modify: func(inst *Installation) { inst.Spec.Bundle.Repository = "ghcr.io/getporter/porter-hello:v0.2.0" },
+			wantField: "spec.bundle.repository", wantErr: "must not include a tag or digest"},
+		{name: "invalid schema version", modify: func(inst *Installation) { inst.Spec.SchemaVersion = "2.0.0" },
+			wantField: "spec.schemaVersion", wantErr: "unsupported schema version"},
+		{name: "missing name", modify: func(inst *Installation) { inst.Spec.Name = "" },
+			wantField: "spec.name", wantErr: "Required value"},
+		{name: "invalid parameters", modify: func(inst *Installation) { inst.Spec.Parameters.Raw = []byte(`["llamas"]`) },
+			wantField: "spec.parameters"},
+		{name: "unknown deletion policy", modify: func(inst *Installation) {
+			inst.Annotations = map[string]string{PorterDeletePolicyAnnotation: "keep"}
+		}, wantField: "metadata.annotations[getporter.org/deletion-policy]", wantErr: "Unsupported value"},
+		{name: "negative resync interval", modify: func(inst *Installation) {
+			inst.Spec.ResyncInterval = &metav1.Duration{Duration: -time.Minute}
+		}, wantField: "spec.resyncInterval", wantErr: "must not be negative"},
+		{name: "invalid update constraint", modify: func(inst *Installation) {
+			inst.Spec.UpdatePolicy = &BundleUpdatePolicy{Strategy: BundleUpdateSemVer, Constraint: "oops"}
+		}, wantField: "spec.updatePolicy.constraint"},
+		{name: "semver update without version", modify: func(inst *Installation) {
+			inst.Spec.Bundle = OCIReferenceParts{Repository: "ghcr.io/getporter/porter-hello", Tag: "latest"}
+			inst.Spec.UpdatePolicy = &BundleUpdatePolicy{Strategy: BundleUpdateSemVer}
+		}, wantField: "spec.updatePolicy.strategy"},
+		{name: "invalid maintenance window", modify: func(inst *Installation) {
+			inst.Spec.UpdatePolicy = &BundleUpdatePolicy{Strategy: BundleUpdateSemVer,
+				MaintenanceWindow: &MaintenanceWindow{Schedule: "0 2 * * *"}}
+		}, wantField: "spec.updatePolicy.maintenanceWindow.duration", wantErr: "must be greater than zero"},
+		{name: "output parameter source", modify: func(inst *Installation) {
+			inst.Spec.ParameterSources = []Parameter{{Name: "connstr", Source: ParameterSource{Output: &OutputSource{Name: "mysql", Key: "connstr"}}}}
+		}},
+		{name: "secret parameter source", modify: func(inst *Installation) {
+			inst.Spec.ParameterSources = []Parameter{{Name: "password", Source: ParameterSource{Secret: "mysql-password"}}}
+		}, wantField: "spec.parameterSources[0].source.secret", wantErr: "use a parameter set instead"},
+		{name: "output parameter source without key", modify: func(inst *Installation) {
+			inst.Spec.ParameterSources = []Parameter{{Name: "connstr", Source: ParameterSource{Output: &OutputSource{Name: "mysql"}}}}
+		}, wantField: "spec.parameterSources[0].source.output.key", wantErr: "Required value"},
+		{name: "output sync", modify: func(inst *Installation) {
+			inst.Spec.OutputSync = &OutputSync{ConfigMapName: "mybuns-config", Keys: map[string]string{"connstr": "DATABASE_URL"}}
+		}},
+		{name: "invalid output sync name", modify: func(inst *Installation) {
+			inst.Spec.OutputSync = &OutputSync{SecretName: "My_Secret"}
+		}, wantField: "spec.outputSync.secretName"},
+		{name: "invalid output sync key", modify: func(inst *Installation) {
+			inst.Spec.OutputSync = &OutputSync{Keys: map[string]string{"connstr": "database url"}}
+		}, wantField: "spec.outputSync.keys[connstr]"},
+		{name: "duplicate parameter source", modify: func(inst *Installation) {
+			inst.Spec.ParameterSources = []Parameter{
+				{Name: "region", Source: ParameterSource{Value: "eastus"}},
+				{Name: "region", Source: ParameterSource{Value: "westus"}},
+			}
+		}, wantField: "spec.parameterSources[1].name", wantErr: "Duplicate value"},
+	}
+
+	v := &InstallationCustomValidator{}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			inst := validInstallation()
+			tc.modify(inst)
+
+			_, err := v.ValidateCreate(context.Background(), inst)
+			if tc.wantField == "" {
+				require.NoError(t, err)
+				return
+			}
+			assertFieldError(t, err, tc.wantField, tc.wantErr)
+		})
+	}
+}
+
+func TestInstallationCustomValidator_ValidateUpdate(t *testing.T) {
+	old := &Installation{
+		ObjectMeta: metav1.ObjectMeta{Name: "mybuns", Namespace: "test"},
+		Spec: InstallationSpec{
+			SchemaVersion: InstallationSchemaVersion,
+			Name:          "mybuns",
+			Namespace:     "dev",
+			Bundle:        OCIReferenceParts{Repository: "ghcr.io/getporter/porter-hello", Version: "0.2.0"},
+		},
+	}
+	v := &InstallationCustomValidator{}
+
+	t.Run("upgrade", func(t *testing.T) {
+		inst := old.DeepCopy()
+		inst.Spec.Bundle.Version = "0.3.0"
+		_, err := v.ValidateUpdate(context.Background(), old, inst)
+		require.NoError(t, err)
+	})
+
+	t.Run("rename", func(t *testing.T) {
+		inst := old.DeepCopy()
+		inst.Spec.Name = "yourbuns"
+		_, err := v.ValidateUpdate(context.Background(), old, inst)
+		assertFieldError(t, err, "spec.name", "field is immutable")
+	})
+
+	t.Run("move namespace", func(t *testing.T) {
+		inst := old.DeepCopy()
+		inst.Spec.Namespace = "prod"
+		_, err := v.ValidateUpdate(context.Background(), old, inst)
+		assertFieldError(t, err, "spec.namespace", "field is immutable")
+	})
+
+	// An installation created before a validation rule was added must still be
+	// labeled and have its finalizer removed
+	invalid := old.DeepCopy()
+	invalid.Spec.SchemaVersion = ""
+
+	t.Run("metadata changed", func(t *testing.T) {
+		inst := invalid.DeepCopy()
+		inst.Labels = map[string]string{"team": "dev"}
+		_, err := v.ValidateUpdate(context.Background(), invalid, inst)
+		require.NoError(t, err)
+	})
+
+	t.Run("delete policy changed", func(t *testing.T) {
+		inst := invalid.DeepCopy()
+		inst.Annotations = map[string]string{PorterDeletePolicyAnnotation: "keep"}
+		_, err := v.ValidateUpdate(context.Background(), invalid, inst)
+		assertFieldError(t, err, "metadata.annotations[getporter.org/deletion-policy]", "Unsupported value")
+	})
+
+	t.Run("finalizer removed", func(t *testing.T) {
+		deleting := invalid.DeepCopy()
+		deleting.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+		deleting.Finalizers = []string{FinalizerName}
+		inst := deleting.DeepCopy()
+		inst.Finalizers = nil
+		_, err := v.ValidateUpdate(context.Background(), deleting, inst)
+		require.NoError(t, err)
+	})
+}
+
+// assertFieldError checks that the webhook rejected the resource with an error for the field.
+func TestInstallationCustomDefaulter_Default(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, AddToScheme(scheme))
+
+	createRequest := admission.NewContextWithRequest(context.Background(), admission.Request{
+		AdmissionRequest: admissionv1.AdmissionRequest{Operation: admissionv1.Create}})
+	updateRequest := admission.NewContextWithRequest(context.Background(), admission.Request{
+		AdmissionRequest: admissionv1.AdmissionRequest{Operation: admissionv1.Update}})
+	systemCfg := &PorterConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: OperatorNamespace},
+		Spec:       PorterConfigSpec{Namespace: ptr.To("system")},
+	}
+	nsCfg := &PorterConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "test"},
+		Spec:       PorterConfigSpec{Namespace: ptr.To("dev")},
+	}
+
+	testcases := []struct {
+		name          string
+		ctx           context.Context
+		configs       []client.Object
+		annotations   map[string]string
+		namespace     string
+		wantPolicy    string
+		wantNamespace string
+	}{
+		{name: "no config", ctx: createRequest, wantPolicy: PorterDeletePolicyDelete, wantNamespace: ""},
+		{name: "system config", ctx: createRequest, configs: []client.Object{systemCfg},
+			wantPolicy: PorterDeletePolicyDelete, wantNamespace: "system"},
+		{name: "namespace config", ctx: createRequest, configs: []client.Object{systemCfg, nsCfg},
+			wantPolicy: PorterDeletePolicyDelete, wantNamespace: "dev"},
+		{name: "namespace set", ctx: createRequest, configs: []client.Object{systemCfg}, namespace: "prod",
+			wantPolicy: PorterDeletePolicyDelete, wantNamespace: "prod"},
+		{name: "update keeps empty namespace", ctx: updateRequest, configs: []client.Object{systemCfg},
+			wantPolicy: PorterDeletePolicyDelete, wantNamespace: ""},
+		{name: "orphan policy", ctx: createRequest, annotations: map[string]string{PorterDeletePolicyAnnotation: "Orphan"},
+			wantPolicy: PorterDeletePolicyOrphan, wantNamespace: ""},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(tc.configs...).Build()
+			inst := &Installation{
+				ObjectMeta: metav1.ObjectMeta{Name: "mybuns", Namespace: "test", Annotations: tc.annotations},
+				Spec: InstallationSpec{
+					Name:      "mybuns",
+					Namespace: tc.namespace,
+					Bundle:    OCIReferenceParts{Repository: "ghcr.io/getporter/porter-hello", Version: "0.2.0"},
+				},
+			}
+
+			d := &InstallationCustomDefaulter{Client: c}
+			require.NoError(t, d.Default(tc.ctx, inst))
+			assert.Equal(t, InstallationSchemaVersion, inst.Spec.SchemaVersion)
+			assert.Equal(t, tc.wantPolicy, inst.Annotations[PorterDeletePolicyAnnotation])
+			assert.Equal(t, tc.wantNamespace, inst.Spec.Namespace)
+
+			_, err := (&InstallationCustomValidator{}).ValidateCreate(tc.ctx, inst)
+			require.NoError(t, err, "the defaulted installation should be valid")
+		})
+	}
+}
+
+func assertFieldError(t *testing.T, err error, wantField string, wantErr string) {
+	t.Helper()
+
+	require.Error(t, err)
+	require.True(t, apierrors.IsInvalid(err), "expected an Invalid error, got %T", err)
+	statusErr := err.(*apierrors.StatusError)
+	require.NotNil(t, statusErr.ErrStatus.Details)
+
+	var fields []string
+	for _, cause := range statusErr.ErrStatus.Details.Causes {
+		fields = append(fields, cause.Field)
+		if cause.Field == wantField {
+			assert.Contains(t, cause.Message, wantErr)
+			return
+		}
+	}
+	assert.Failf(t, "missing field error", "expected an error for %s, got errors for %v: %s", wantField, fields, err)
+}
@@ -0,0 +1,93 @@
+package v1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ConditionInstallationUninstalled is set on an InstallationAction when its bundle
+// action was not run because the installation is uninstalled or being deleted.
+const ConditionInstallationUninstalled = "InstallationUninstalled"
+
+// InstallationActionSpec defines the desired state of InstallationAction
+type InstallationActionSpec struct {
+	// AgentConfig is the name of an AgentConfig to use instead of the AgentConfig defined on the Installation, namespace or system level.
+	// +optional
+	AgentConfig *corev1.LocalObjectReference `json:"agentConfig,omitempty"`
+
+	// Installation is a reference to the Installation resource, in the same namespace, that the action is run against.
+	Installation corev1.LocalObjectReference `json:"installation"`
+
+	// Action is the name of the custom bundle action to run, for example backup or rotate-keys.
+	Action string `json:"action"`
+
+	// Parameters overrides the value of the specified bundle parameters for this run.
+	// Do not put sensitive values here, use a ParameterSet instead.
+	// +optional
+	Parameters map[string]string `json:"parameters,omitempty"`
+
+	// ParameterSets to use for this run instead of the parameter sets defined on the installation.
+	// +optional
+	ParameterSets []string `json:"parameterSets,omitempty"`
+
+	// CredentialSets to use for this run instead of the credential sets defined on the installation.
+	// +optional
+	CredentialSets []string `json:"credentialSets,omitempty"`
+}
+
+// InstallationActionStatus defines the observed state of InstallationAction
+type InstallationActionStatus struct {
+	PorterResourceStatus `json:",inline"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+
+// InstallationAction is the Schema for the installationactions API
+// +kubebuilder:printcolumn:name="Installation",type="string",JSONPath=".spec.installation.name"
+// +kubebuilder:printcolumn:name="Action",type="string",JSONPath=".spec.action"
+// +kubebuilder:printcolumn:name="Last Status",type="string",JSONPath=".status.phase"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+type InstallationAction struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   InstallationActionSpec   `json:"spec,omitempty"`
+	Status InstallationActionStatus `json:"status,omitempty"`
+}
+
+func (a *InstallationAction) GetStatus() PorterResourceStatus {
+	return a.Status.PorterResourceStatus
+}
+
+func (a *InstallationAction) SetStatus(value PorterResourceStatus) {
+	a.Status.PorterResourceStatus = value
+}
+
+// GetRetryLabelValue returns a value that is safe to use
+// as a label value and represents the retry annotation used
+// to trigger reconciliation.
+func (a *InstallationAction) GetRetryLabelValue() string {
+	return getRetryLabelValue(a.Annotations)
+}
+
+// SetRetryAnnotation flags the resource to retry its last operation.
+func (a *InstallationAction) SetRetryAnnotation(retry string) {
+	if a.Annotations == nil {
+		a.Annotations = make(map[string]string, 1)
+	}
+	a.Annotations[AnnotationRetry] = retry
+}
+
+// +kubebuilder:object:root=true
+
+// InstallationActionList contains a list of InstallationAction
+type InstallationActionList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []InstallationAction `json:"items"`
+}
+
+func init() {
+	objectTypes = append(objectTypes, &InstallationAction{}, &InstallationActionList{})
+}
@@ -0,0 +1,14 @@
+package v1
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInstallationAction_SetRetryAnnotation(t *testing.T) {
+	action := InstallationAction{}
+	action.SetRetryAnnotation("retry-1")
+	assert.Equal(t, "retry-1", action.Annotations[AnnotationRetry])
+	assert.NotEmpty(t, action.GetRetryLabelValue())
+}
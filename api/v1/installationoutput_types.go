@@ -1,6 +1,7 @@
 package v1
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -13,7 +14,13 @@ type Output struct {
 	Name      string `json:"name"`
 	Type      string `json:"type"`
 	Sensitive bool   `json:"sensitive"`
-	Value     string `json:"value"`
+
+	// Value of the output. The value of a sensitive output is redacted, and is
+	// stored in the Secret referenced by SecretKeyRef.
+	Value string `json:"value"`
+
+	// SecretKeyRef is the key of the Secret that stores the value of a sensitive output.
+	SecretKeyRef *corev1.SecretKeySelector `json:"secretKeyRef,omitempty"`
 }
 
 // InstallationOutputSpec defines the desired state of InstallationOutput
@@ -32,6 +39,12 @@ type InstallationOutputStatus struct {
 	Outputs []Output `json:"outputs,omitempty"`
 
 	OutputNames string `json:"outputNames,omitempty"`
+
+	// Action is the AgentAction that ran the bundle when the outputs were produced.
+	Action *corev1.LocalObjectReference `json:"action,omitempty"`
+
+	// RunID is the id of the Porter run that produced the outputs.
+	RunID string `json:"runId,omitempty"`
 }
 
 //+kubebuilder:object:root=true
@@ -50,6 +63,12 @@ type InstallationOutput struct {
 	Status InstallationOutputStatus `json:"status,omitempty"`
 }
 
+// GetSensitiveOutputsSecretName returns the name of the Secret that stores the
+// values of sensitive outputs.
+func (o *InstallationOutput) GetSensitiveOutputsSecretName() string {
+	return o.Name + "-sensitive-outputs"
+}
+
 //+kubebuilder:object:root=true
 
 // InstallationOutputList contains a list of InstallationOutput
@@ -0,0 +1,104 @@
+package v1
+
+import (
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// DefaultRunHistoryLimit is the default number of InstallationRuns that are
+// kept for each Installation.
+const DefaultRunHistoryLimit = 10
+
+// InstallationRunSpec defines the desired state of InstallationRun
+type InstallationRunSpec struct {
+	// Installation is the Installation resource that was run.
+	Installation corev1.LocalObjectReference `json:"installation"`
+
+	// Name is the name of the installation in Porter.
+	Name string `json:"name"`
+
+	// Namespace is the namespace of the installation in Porter.
+	Namespace string `json:"namespace,omitempty"`
+
+	// AgentAction is the AgentAction that ran the installation.
+	AgentAction corev1.LocalObjectReference `json:"agentAction"`
+
+	// Job is the Job that ran the Porter Agent.
+	Job corev1.LocalObjectReference `json:"job"`
+}
+
+// InstallationRunStatus defines the observed state of InstallationRun
+type InstallationRunStatus struct {
+	// RunID is the id of the run recorded by Porter.
+	// It is not set when the run could not be retrieved from Porter.
+	RunID string `json:"runId,omitempty"`
+
+	// Action is the bundle action that Porter ran, for example install, upgrade or uninstall.
+	// It is not set when the run could not be retrieved from Porter.
+	Action string `json:"action,omitempty"`
+
+	// BundleReference is the reference of the bundle that was run.
+	BundleReference string `json:"bundleReference,omitempty"`
+
+	// StartTime is when the Porter Agent started.
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+
+	// CompletionTime is when the Porter Agent finished.
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+
+	// Phase is the result of the Porter Agent.
+	// Possible values are: Succeeded and Failed.
+	// +kubebuilder:validation:Type=string
+	Phase AgentPhase `json:"phase,omitempty"`
+
+	// Result is the status of the run recorded by Porter, for example succeeded or failed.
+	// It is not set when the run could not be retrieved from Porter.
+	Result string `json:"result,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+
+// +kubebuilder:printcolumn:name="Installation",type="string",JSONPath=".spec.installation.name"
+// +kubebuilder:printcolumn:name="Action",type="string",JSONPath=".status.action"
+// +kubebuilder:printcolumn:name="Phase",type="string",JSONPath=".status.phase"
+// +kubebuilder:printcolumn:name="Started",type="date",JSONPath=".status.startTime"
+// +kubebuilder:printcolumn:name="Completed",type="date",JSONPath=".status.completionTime",priority=1
+// +kubebuilder:printcolumn:name="Run ID",type="string",JSONPath=".status.runId",priority=1
+// +kubebuilder:printcolumn:name="Bundle",type="string",JSONPath=".status.bundleReference",priority=1
+// InstallationRun is the Schema for the installationruns API.
+// It records a run of an Installation by the Porter Agent.
+type InstallationRun struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   InstallationRunSpec   `json:"spec,omitempty"`
+	Status InstallationRunStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// InstallationRunList contains a list of InstallationRun
+type InstallationRunList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []InstallationRun `json:"items"`
+}
+
+// SortByStartTime sorts the runs from the most recent to the oldest.
+func (l *InstallationRunList) SortByStartTime() {
+	sort.SliceStable(l.Items, func(i, j int) bool {
+		a, b := l.Items[i].Status.StartTime, l.Items[j].Status.StartTime
+		if a == nil || b == nil {
+			// Runs without a start time are sorted last
+			return a != nil && b == nil
+		}
+		return b.Before(a)
+	})
+}
+
+func init() {
+	objectTypes = append(objectTypes, &InstallationRun{}, &InstallationRunList{})
+}
@@ -0,0 +1,30 @@
+package v1
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestInstallationRunList_SortByStartTime(t *testing.T) {
+	now := time.Now()
+	run := func(name string, start *metav1.Time) InstallationRun {
+		return InstallationRun{ObjectMeta: metav1.ObjectMeta{Name: name}, Status: InstallationRunStatus{StartTime: start}}
+	}
+	runs := InstallationRunList{Items: []InstallationRun{
+		run("unknown", nil),
+		run("first", &metav1.Time{Time: now.Add(-2 * time.Hour)}),
+		run("latest", &metav1.Time{Time: now}),
+		run("second", &metav1.Time{Time: now.Add(-time.Hour)}),
+	}}
+
+	runs.SortByStartTime()
+
+	var names []string
+	for _, r := range runs.Items {
+		names = append(names, r.Name)
+	}
+	assert.Equal(t, []string{"latest", "second", "first", "unknown"}, names)
+}
@@ -27,6 +27,20 @@ type ParameterSource struct {
 	Secret string `json:"secret,omitempty" yaml:"secret,omitempty"`
 	// Value is a paremeter source using plaintext value
 	Value string `json:"value,omitempty" yaml:"value,omitempty"`
+	// Output is a parameter source using an output of another installation.
+	// It is resolved by the operator, and is only supported in the parameterSources of an Installation.
+	// +optional
+	Output *OutputSource `json:"output,omitempty" yaml:"-"`
+}
+
+// OutputSource is a parameter source that uses an output of an installation,
+// captured in its InstallationOutput.
+type OutputSource struct {
+	// Name of the InstallationOutput, in the same namespace.
+	Name string `json:"name"`
+
+	// Key is the name of the output.
+	Key string `json:"key"`
 }
 
 // ParameterSetSpec defines the desired state of ParameterSet
@@ -35,6 +49,11 @@ type ParameterSetSpec struct {
 	// +optional
 	AgentConfig *corev1.LocalObjectReference `json:"agentConfig,omitempty" yaml:"-"`
 
+	// Suspend stops the operator from reconciling the parameter set.
+	// Changes made while the parameter set is suspended are applied when it is resumed.
+	// +optional
+	Suspend bool `json:"suspend,omitempty" yaml:"-"`
+
 	//
 	// These are fields from the Porter parameter set resource.
 	// Your goal is that someone can copy/paste a resource from Porter into the
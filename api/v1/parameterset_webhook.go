@@ -0,0 +1,91 @@
+package v1
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// SetupWebhookWithManager registers the ParameterSet webhooks with the manager.
+func (ps *ParameterSet) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(ps).
+		WithValidator(&ParameterSetCustomValidator{}).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/validate-getporter-org-v1-parameterset,mutating=false,failurePolicy=fail,sideEffects=None,groups=getporter.org,resources=parametersets,verbs=create;update,versions=v1,name=vparameterset.getporter.org,admissionReviewVersions=v1
+
+// ParameterSetCustomValidator validates a ParameterSet when it is created or updated.
+// +kubebuilder:object:generate=false
+type ParameterSetCustomValidator struct{}
+
+var _ webhook.CustomValidator = &ParameterSetCustomValidator{}
+
+// ValidateCreate validates a new ParameterSet.
+func (v *ParameterSetCustomValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	ps, ok := obj.(*ParameterSet)
+	if !ok {
+		return nil, fmt.Errorf("expected a ParameterSet but got %T", obj)
+	}
+	return nil, toValidationError("ParameterSet", ps.Name, ps.validate())
+}
+
+// ValidateUpdate validates changes to a ParameterSet.
+func (v *ParameterSetCustomValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	ps, ok := newObj.(*ParameterSet)
+	if !ok {
+		return nil, fmt.Errorf("expected a ParameterSet but got %T", newObj)
+	}
+	old, ok := oldObj.(*ParameterSet)
+	if !ok {
+		return nil, fmt.Errorf("expected a ParameterSet but got %T", oldObj)
+	}
+
+	if skipSpecValidation(ps, old.Spec, ps.Spec) {
+		return nil, nil
+	}
+
+	errs := ps.validate()
+	errs = append(errs, validateImmutableIdentity(field.NewPath("spec"), ps.Spec.Name, ps.Spec.Namespace, old.Spec.Name, old.Spec.Namespace)...)
+	return nil, toValidationError("ParameterSet", ps.Name, errs)
+}
+
+// ValidateDelete allows a ParameterSet to be deleted.
+func (v *ParameterSetCustomValidator) ValidateDelete(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func (ps *ParameterSet) validate() field.ErrorList {
+	specPath := field.NewPath("spec")
+	errs := validateSchemaVersion(specPath.Child("schemaVersion"), ps.Spec.SchemaVersion, ParameterSetSchemaVersion)
+	if ps.Spec.Name == "" {
+		errs = append(errs, field.Required(specPath.Child("name"), ""))
+	}
+
+	names := make(map[string]bool, len(ps.Spec.Parameters))
+	for i, param := range ps.Spec.Parameters {
+		paramPath := specPath.Child("parameters").Index(i)
+		if param.Name == "" {
+			errs = append(errs, field.Required(paramPath.Child("name"), ""))
+		} else if names[param.Name] {
+			errs = append(errs, field.Duplicate(paramPath.Child("name"), param.Name))
+		}
+		names[param.Name] = true
+
+		if param.Source.Output != nil {
+			errs = append(errs, field.Forbidden(paramPath.Child("source", "output"), "output sources are only supported in the parameterSources of an Installation"))
+		} else if param.Source.Secret != "" && param.Source.Value != "" {
+			errs = append(errs, field.Invalid(paramPath.Child("source"), param.Source, "only one of secret or value may be specified"))
+		} else if param.Source.Secret == "" && param.Source.Value == "" {
+			errs = append(errs, field.Required(paramPath.Child("source"), "the parameter must have a secret or value source"))
+		}
+	}
+
+	return errs
+}
@@ -0,0 +1,61 @@
+package v1
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestParameterSetCustomValidator(t *testing.T) {
+	validParameterSet := func() *ParameterSet {
+		return &ParameterSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "myparams", Namespace: "test"},
+			Spec: ParameterSetSpec{
+				SchemaVersion: ParameterSetSchemaVersion,
+				Name:          "myparams",
+				Namespace:     "dev",
+				Parameters: []Parameter{
+					{Name: "region", Source: ParameterSource{Value: "eastus"}},
+					{Name: "password", Source: ParameterSource{Secret: "mypassword"}},
+				},
+			},
+		}
+	}
+	v := &ParameterSetCustomValidator{}
+
+	t.Run("valid", func(t *testing.T) {
+		_, err := v.ValidateCreate(context.Background(), validParameterSet())
+		require.NoError(t, err)
+	})
+
+	t.Run("empty source", func(t *testing.T) {
+		ps := validParameterSet()
+		ps.Spec.Parameters[0].Source = ParameterSource{}
+		_, err := v.ValidateCreate(context.Background(), ps)
+		assertFieldError(t, err, "spec.parameters[0].source", "the parameter must have a secret or value source")
+	})
+
+	t.Run("secret and value", func(t *testing.T) {
+		ps := validParameterSet()
+		ps.Spec.Parameters[1].Source.Value = "oops"
+		_, err := v.ValidateCreate(context.Background(), ps)
+		assertFieldError(t, err, "spec.parameters[1].source", "only one of secret or value may be specified")
+	})
+
+	t.Run("output source", func(t *testing.T) {
+		ps := validParameterSet()
+		ps.Spec.Parameters[0].Source = ParameterSource{Output: &OutputSource{Name: "mysql", Key: "connstr"}}
+		_, err := v.ValidateCreate(context.Background(), ps)
+		assertFieldError(t, err, "spec.parameters[0].source.output", "only supported in the parameterSources of an Installation")
+	})
+
+	t.Run("move namespace", func(t *testing.T) {
+		old := validParameterSet()
+		ps := validParameterSet()
+		ps.Spec.Namespace = "prod"
+		_, err := v.ValidateUpdate(context.Background(), old, ps)
+		assertFieldError(t, err, "spec.namespace", "field is immutable")
+	})
+}
@@ -8,6 +8,10 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+// ConditionSuspended is set on a resource when reconciling it is suspended,
+// either on the resource or by its AgentConfig. It is false after the resource is resumed.
+const ConditionSuspended = "Suspended"
+
 type PorterResourceStatus struct {
 	// The last generation observed by the controller.
 	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
@@ -24,6 +28,11 @@ type PorterResourceStatus struct {
 	// Each condition refers to the status of the ActiveJob
 	// Possible conditions are: Scheduled, Started, Completed, and Failed
 	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// Logs is the ConfigMap that contains the end of the Porter Agent logs
+	// for the most recent action.
+	// +optional
+	Logs *corev1.LocalObjectReference `json:"logs,omitempty"`
 }
 
 // Initialize resets the resource status before Porter is run.
@@ -32,6 +41,7 @@ func (s *PorterResourceStatus) Initialize() {
 	s.Conditions = []metav1.Condition{}
 	s.Phase = PhaseUnknown
 	s.Action = nil
+	s.Logs = nil
 }
 
 // GetRetryLabelValue returns a value that is safe to use
@@ -0,0 +1,119 @@
+package v1
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// SetupWebhookWithManager registers the PorterConfig webhooks with the manager.
+func (c *PorterConfig) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(c).
+		WithValidator(&PorterConfigCustomValidator{}).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/validate-getporter-org-v1-porterconfig,mutating=false,failurePolicy=fail,sideEffects=None,groups=getporter.org,resources=porterconfigs,verbs=create;update,versions=v1,name=vporterconfig.getporter.org,admissionReviewVersions=v1
+
+// PorterConfigCustomValidator validates a PorterConfig when it is created or updated.
+// +kubebuilder:object:generate=false
+type PorterConfigCustomValidator struct{}
+
+var _ webhook.CustomValidator = &PorterConfigCustomValidator{}
+
+// ValidateCreate validates a new PorterConfig.
+func (v *PorterConfigCustomValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	c, ok := obj.(*PorterConfig)
+	if !ok {
+		return nil, fmt.Errorf("expected a PorterConfig but got %T", obj)
+	}
+	return nil, toValidationError("PorterConfig", c.Name, c.validate())
+}
+
+// ValidateUpdate validates changes to a PorterConfig.
+func (v *PorterConfigCustomValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	c, ok := newObj.(*PorterConfig)
+	if !ok {
+		return nil, fmt.Errorf("expected a PorterConfig but got %T", newObj)
+	}
+	old, ok := oldObj.(*PorterConfig)
+	if !ok {
+		return nil, fmt.Errorf("expected a PorterConfig but got %T", oldObj)
+	}
+	if skipSpecValidation(c, old.Spec, c.Spec) {
+		return nil, nil
+	}
+	return nil, toValidationError("PorterConfig", c.Name, c.validate())
+}
+
+// ValidateDelete allows a PorterConfig to be deleted.
+func (v *PorterConfigCustomValidator) ValidateDelete(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+func (c *PorterConfig) validate() field.ErrorList {
+	var errs field.ErrorList
+	specPath := field.NewPath("spec")
+
+	if c.Spec.Verbosity != nil {
+		switch *c.Spec.Verbosity {
+		case "debug", "info", "warning", "error":
+		default:
+			errs = append(errs, field.NotSupported(specPath.Child("verbosity"), *c.Spec.Verbosity, []string{"debug", "info", "warning", "error"}))
+		}
+	}
+
+	if c.Spec.DefaultStorage != nil && c.Spec.DefaultStoragePlugin != nil {
+		errs = append(errs, field.Invalid(specPath.Child("default-storage-plugin"), *c.Spec.DefaultStoragePlugin, "only one of default-storage or default-storage-plugin may be specified"))
+	}
+	if c.Spec.DefaultSecrets != nil && c.Spec.DefaultSecretsPlugin != nil {
+		errs = append(errs, field.Invalid(specPath.Child("default-secrets-plugin"), *c.Spec.DefaultSecretsPlugin, "only one of default-secrets or default-secrets-plugin may be specified"))
+	}
+
+	storage := make([]PluginConfig, len(c.Spec.Storage))
+	for i, s := range c.Spec.Storage {
+		storage[i] = s.PluginConfig
+	}
+	errs = append(errs, validatePluginConfigs(specPath.Child("storage"), storage)...)
+
+	secrets := make([]PluginConfig, len(c.Spec.Secrets))
+	for i, s := range c.Spec.Secrets {
+		secrets[i] = s.PluginConfig
+	}
+	errs = append(errs, validatePluginConfigs(specPath.Child("secrets"), secrets)...)
+
+	if c.Spec.Telemetry.Protocol != nil {
+		switch *c.Spec.Telemetry.Protocol {
+		case "grpc", "http/protobuf":
+		default:
+			errs = append(errs, field.NotSupported(specPath.Child("telemetry", "protocol"), *c.Spec.Telemetry.Protocol, []string{"grpc", "http/protobuf"}))
+		}
+	}
+
+	return errs
+}
+
+// validatePluginConfigs checks that each named plugin configuration is unique and specifies the plugin to use.
+func validatePluginConfigs(path *field.Path, configs []PluginConfig) field.ErrorList {
+	var errs field.ErrorList
+	names := make(map[string]bool, len(configs))
+	for i, cfg := range configs {
+		cfgPath := path.Index(i)
+		if cfg.Name == "" {
+			errs = append(errs, field.Required(cfgPath.Child("name"), ""))
+		} else if names[cfg.Name] {
+			errs = append(errs, field.Duplicate(cfgPath.Child("name"), cfg.Name))
+		}
+		names[cfg.Name] = true
+
+		if cfg.PluginSubKey == "" {
+			errs = append(errs, field.Required(cfgPath.Child("plugin"), ""))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,47 @@
+package v1
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+)
+
+func TestPorterConfigCustomValidator(t *testing.T) {
+	testcases := []struct {
+		name      string
+		spec      PorterConfigSpec
+		wantField string
+		wantErr   string
+	}{
+		{name: "valid", spec: PorterConfigSpec{
+			Verbosity:      ptr.To("debug"),
+			DefaultStorage: ptr.To("mongodb"),
+			Storage:        []StorageConfig{{PluginConfig{Name: "mongodb", PluginSubKey: "mongodb"}}},
+		}},
+		{name: "invalid verbosity", spec: PorterConfigSpec{Verbosity: ptr.To("loud")}, wantField: "spec.verbosity", wantErr: "Unsupported value"},
+		{name: "default storage and plugin", spec: PorterConfigSpec{DefaultStorage: ptr.To("mongodb"), DefaultStoragePlugin: ptr.To("mongodb-docker")},
+			wantField: "spec.default-storage-plugin", wantErr: "only one of default-storage or default-storage-plugin may be specified"},
+		{name: "duplicate secrets", spec: PorterConfigSpec{Secrets: []SecretsConfig{
+			{PluginConfig{Name: "vault", PluginSubKey: "hashicorp.vault"}},
+			{PluginConfig{Name: "vault", PluginSubKey: "hashicorp.vault"}},
+		}}, wantField: "spec.secrets[1].name", wantErr: "Duplicate value"},
+		{name: "missing plugin", spec: PorterConfigSpec{Storage: []StorageConfig{{PluginConfig{Name: "mongodb"}}}},
+			wantField: "spec.storage[0].plugin", wantErr: "Required value"},
+	}
+
+	v := &PorterConfigCustomValidator{}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &PorterConfig{ObjectMeta: metav1.ObjectMeta{Name: "mycfg", Namespace: "test"}, Spec: tc.spec}
+			_, err := v.ValidateCreate(context.Background(), cfg)
+			if tc.wantField == "" {
+				require.NoError(t, err)
+				return
+			}
+			assertFieldError(t, err, tc.wantField, tc.wantErr)
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package v1
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// DefaultPorterServerPort is the default port that the Porter gRPC server listens on.
+	DefaultPorterServerPort = 3001
+
+	// ConditionPorterServerReady indicates that the Porter gRPC server is available at the endpoint in the status.
+	ConditionPorterServerReady = "Ready"
+)
+
+// PorterServerSpec defines the desired state of PorterServer
+type PorterServerSpec struct {
+	// PorterRepository is the repository for the Porter Agent image that runs the gRPC server.
+	// Defaults to ghcr.io/getporter/porter-agent
+	// +optional
+	PorterRepository string `json:"porterRepository,omitempty"`
+
+	// PorterVersion is the tag for the Porter Agent image that runs the gRPC server.
+	// Defaults to a well-known version of the agent that has been tested with the operator.
+	// +optional
+	PorterVersion string `json:"porterVersion,omitempty"`
+
+	// PullPolicy specifies when to pull the Porter Agent image. The default
+	// is to use PullAlways when the tag is canary or latest, and PullIfNotPresent
+	// otherwise.
+	// +optional
+	PullPolicy corev1.PullPolicy `json:"pullPolicy,omitempty"`
+
+	// ServiceAccount is the service account to run the gRPC server.
+	// +optional
+	ServiceAccount string `json:"serviceAccount,omitempty"`
+
+	// Replicas is the number of gRPC server pods to run. Defaults to 1.
+	// +optional
+	Replicas *int32 `json:"replicas,omitempty"`
+
+	// Port that the gRPC server listens on. Defaults to 3001.
+	// +optional
+	Port int32 `json:"port,omitempty"`
+
+	// TLS configures the gRPC server to serve over TLS. When it is not set, the
+	// operator connects to the gRPC server without encryption.
+	// +optional
+	TLS *PorterServerTLS `json:"tls,omitempty"`
+}
+
+// PorterServerTLS defines the certificates used to secure the connection
+// between the operator and the Porter gRPC server.
+type PorterServerTLS struct {
+	// SecretName is the name of a kubernetes.io/tls Secret, in the namespace of
+	// the PorterServer, with the certificate of the gRPC server (tls.crt and
+	// tls.key), and the certificate authority (ca.crt) that signed it.
+	// The Secrets created by cert-manager for a Certificate are in this format.
+	SecretName string `json:"secretName"`
+
+	// ClientSecretName is the name of a kubernetes.io/tls Secret, in the
+	// namespace of the PorterServer, with the client certificate that the
+	// operator presents to the gRPC server. When it is set, the gRPC server
+	// requires clients to present a certificate signed by the ca.crt in
+	// SecretName (mTLS).
+	// +optional
+	ClientSecretName string `json:"clientSecretName,omitempty"`
+
+	// ServerName is used to verify the certificate of the gRPC server.
+	// Defaults to the host of the endpoint of the gRPC server.
+	// +optional
+	ServerName string `json:"serverName,omitempty"`
+}
+
+// PorterServerStatus defines the observed state of PorterServer
+type PorterServerStatus struct {
+	// The last generation observed by the controller.
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Endpoint is the address of the gRPC server, for example porter-server-default.porter-operator-system.svc:3001.
+	Endpoint string `json:"endpoint,omitempty"`
+
+	// Ready indicates that the gRPC server is available at the endpoint.
+	Ready bool `json:"ready,omitempty"`
+
+	// Conditions store a list of states that have been reached.
+	// Each condition refers to the status of the gRPC server deployment.
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+
+// PorterServer is the Schema for the porterservers API.
+// It deploys the Porter gRPC server that the operator uses to query Porter.
+// +kubebuilder:printcolumn:name="Endpoint",type="string",JSONPath=".status.endpoint"
+// +kubebuilder:printcolumn:name="Ready",type="boolean",JSONPath=".status.ready"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+type PorterServer struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   PorterServerSpec   `json:"spec,omitempty"`
+	Status PorterServerStatus `json:"status,omitempty"`
+}
+
+// GetResourceName returns the name of the Deployment, Service and config Secret of the gRPC server.
+func (s *PorterServer) GetResourceName() string {
+	return "porter-server-" + s.Name
+}
+
+// GetPorterImage returns the fully qualified image name of the Porter Agent that runs the gRPC server.
+func (s *PorterServer) GetPorterImage() string {
+	cfg := AgentConfigSpec{PorterRepository: s.Spec.PorterRepository, PorterVersion: s.Spec.PorterVersion}
+	return NewAgentConfigSpecAdapter(cfg).GetPorterImage()
+}
+
+// GetPullPolicy returns the PullPolicy of the Porter Agent image that runs the gRPC server.
+func (s *PorterServer) GetPullPolicy() corev1.PullPolicy {
+	cfg := AgentConfigSpec{PorterVersion: s.Spec.PorterVersion, PullPolicy: s.Spec.PullPolicy}
+	return NewAgentConfigSpecAdapter(cfg).GetPullPolicy()
+}
+
+// GetReplicas returns the number of gRPC server pods to run.
+func (s *PorterServer) GetReplicas() int32 {
+	if s.Spec.Replicas == nil {
+		return 1
+	}
+	return *s.Spec.Replicas
+}
+
+// GetPort returns the port that the gRPC server listens on.
+func (s *PorterServer) GetPort() int32 {
+	if s.Spec.Port == 0 {
+		return DefaultPorterServerPort
+	}
+	return s.Spec.Port
+}
+
+// IsMutualTLS determines if the gRPC server requires clients to present a certificate.
+func (s *PorterServer) IsMutualTLS() bool {
+	return s.Spec.TLS != nil && s.Spec.TLS.ClientSecretName != ""
+}
+
+// GetEndpoint returns the in-cluster address of the gRPC server service.
+func (s *PorterServer) GetEndpoint() string {
+	return fmt.Sprintf("%s.%s.svc:%d", s.GetResourceName(), s.Namespace, s.GetPort())
+}
+
+// +kubebuilder:object:root=true
+
+// PorterServerList contains a list of PorterServer
+type PorterServerList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []PorterServer `json:"items"`
+}
+
+func init() {
+	objectTypes = append(objectTypes, &PorterServer{}, &PorterServerList{})
+}
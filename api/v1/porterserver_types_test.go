@@ -0,0 +1,31 @@
+package v1
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+)
+
+func TestPorterServer_Defaults(t *testing.T) {
+	server := PorterServer{ObjectMeta: metav1.ObjectMeta{Namespace: "porter-operator-system", Name: "default"}}
+	assert.Equal(t, "porter-server-default", server.GetResourceName())
+	assert.Equal(t, "ghcr.io/getporter/porter-agent:"+DefaultPorterAgentVersion, server.GetPorterImage())
+	assert.Equal(t, corev1.PullIfNotPresent, server.GetPullPolicy())
+	assert.Equal(t, int32(1), server.GetReplicas())
+	assert.Equal(t, "porter-server-default.porter-operator-system.svc:3001", server.GetEndpoint())
+	assert.False(t, server.IsMutualTLS())
+
+	server.Spec = PorterServerSpec{PorterRepository: "example.com/porter", PorterVersion: "canary", Replicas: ptr.To(int32(0)), Port: 8443}
+	assert.Equal(t, "example.com/porter:canary", server.GetPorterImage())
+	assert.Equal(t, corev1.PullAlways, server.GetPullPolicy())
+	assert.Equal(t, int32(0), server.GetReplicas())
+	assert.Equal(t, "porter-server-default.porter-operator-system.svc:8443", server.GetEndpoint())
+
+	server.Spec.TLS = &PorterServerTLS{SecretName: "porter-server-tls"}
+	assert.False(t, server.IsMutualTLS(), "mTLS should only be enabled when a client certificate is configured")
+	server.Spec.TLS.ClientSecretName = "porter-operator-tls"
+	assert.True(t, server.IsMutualTLS())
+}
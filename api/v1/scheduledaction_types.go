@@ -0,0 +1,159 @@
+package v1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// KindScheduledAction represents ScheduledAction kind value.
+	KindScheduledAction = "ScheduledAction"
+
+	// AnnotationScheduledTime is the annotation applied to an AgentAction created
+	// by a ScheduledAction, recording the scheduled time that triggered the run.
+	AnnotationScheduledTime = Prefix + "scheduled-at"
+
+	// DefaultSuccessfulRunsHistoryLimit is the number of successful runs kept by a
+	// ScheduledAction when the limit is not specified.
+	DefaultSuccessfulRunsHistoryLimit int32 = 3
+
+	// DefaultFailedRunsHistoryLimit is the number of failed runs kept by a
+	// ScheduledAction when the limit is not specified.
+	DefaultFailedRunsHistoryLimit int32 = 1
+)
+
+// ConcurrencyPolicy describes how a ScheduledAction handles a scheduled run
+// when a previous run is still active.
+type ConcurrencyPolicy string
+
+const (
+	// AllowConcurrent allows runs to overlap.
+	AllowConcurrent ConcurrencyPolicy = "Allow"
+
+	// ForbidConcurrent skips the scheduled run when a previous run is still active.
+	ForbidConcurrent ConcurrencyPolicy = "Forbid"
+
+	// ReplaceConcurrent cancels the active run and replaces it with the new one.
+	ReplaceConcurrent ConcurrencyPolicy = "Replace"
+)
+
+// ScheduledActionSpec defines the desired state of ScheduledAction
+type ScheduledActionSpec struct {
+	// AgentConfig is the name of an AgentConfig to use instead of the AgentConfig defined on the Installation, namespace or system level.
+	// +optional
+	AgentConfig *corev1.LocalObjectReference `json:"agentConfig,omitempty"`
+
+	// Installation is a reference to the Installation resource, in the same namespace, that the action is run against.
+	Installation corev1.LocalObjectReference `json:"installation"`
+
+	// Action is the name of the bundle action to run, for example upgrade, or a custom action such as backup.
+	Action string `json:"action"`
+
+	// Schedule in Cron format, see https://en.wikipedia.org/wiki/Cron.
+	Schedule string `json:"schedule"`
+
+	// ConcurrencyPolicy specifies how to treat concurrent runs of the action.
+	// Valid values are Allow, Forbid and Replace. Defaults to Forbid.
+	// +kubebuilder:validation:Enum=Allow;Forbid;Replace
+	// +optional
+	ConcurrencyPolicy ConcurrencyPolicy `json:"concurrencyPolicy,omitempty"`
+
+	// StartingDeadlineSeconds is the deadline in seconds for starting a run if it
+	// misses its scheduled time for any reason. Missed runs are skipped.
+	// +optional
+	StartingDeadlineSeconds *int64 `json:"startingDeadlineSeconds,omitempty"`
+
+	// SuccessfulRunsHistoryLimit is the number of successful AgentActions to keep.
+	// Defaults to 3.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	SuccessfulRunsHistoryLimit *int32 `json:"successfulRunsHistoryLimit,omitempty"`
+
+	// FailedRunsHistoryLimit is the number of failed AgentActions to keep.
+	// Defaults to 1.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	FailedRunsHistoryLimit *int32 `json:"failedRunsHistoryLimit,omitempty"`
+}
+
+// GetConcurrencyPolicy returns the concurrency policy for the scheduled runs,
+// defaulting to ForbidConcurrent.
+func (s ScheduledActionSpec) GetConcurrencyPolicy() ConcurrencyPolicy {
+	if s.ConcurrencyPolicy == "" {
+		return ForbidConcurrent
+	}
+	return s.ConcurrencyPolicy
+}
+
+// GetSuccessfulRunsHistoryLimit returns the number of successful runs to keep.
+func (s ScheduledActionSpec) GetSuccessfulRunsHistoryLimit() int32 {
+	if s.SuccessfulRunsHistoryLimit == nil {
+		return DefaultSuccessfulRunsHistoryLimit
+	}
+	return *s.SuccessfulRunsHistoryLimit
+}
+
+// GetFailedRunsHistoryLimit returns the number of failed runs to keep.
+func (s ScheduledActionSpec) GetFailedRunsHistoryLimit() int32 {
+	if s.FailedRunsHistoryLimit == nil {
+		return DefaultFailedRunsHistoryLimit
+	}
+	return *s.FailedRunsHistoryLimit
+}
+
+// ScheduledActionStatus defines the observed state of ScheduledAction
+type ScheduledActionStatus struct {
+	// The last generation observed by the controller.
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Active is the list of AgentActions that are currently running.
+	// +optional
+	Active []corev1.LocalObjectReference `json:"active,omitempty"`
+
+	// LastScheduleTime is the last time that a run was scheduled.
+	// +optional
+	LastScheduleTime *metav1.Time `json:"lastScheduleTime,omitempty"`
+
+	// LastSuccessfulTime is the last time that a run completed successfully.
+	// +optional
+	LastSuccessfulTime *metav1.Time `json:"lastSuccessfulTime,omitempty"`
+
+	// NextScheduleTime is the next time that a run is scheduled.
+	// +optional
+	NextScheduleTime *metav1.Time `json:"nextScheduleTime,omitempty"`
+
+	// Conditions store a list of states that have been reached.
+	// Possible conditions are: Ready
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+
+// ScheduledAction is the Schema for the scheduledactions API
+// +kubebuilder:printcolumn:name="Installation",type="string",JSONPath=".spec.installation.name"
+// +kubebuilder:printcolumn:name="Action",type="string",JSONPath=".spec.action"
+// +kubebuilder:printcolumn:name="Schedule",type="string",JSONPath=".spec.schedule"
+// +kubebuilder:printcolumn:name="Last Schedule",type="date",JSONPath=".status.lastScheduleTime"
+// +kubebuilder:printcolumn:name="Next Schedule",type="date",JSONPath=".status.nextScheduleTime"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+type ScheduledAction struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ScheduledActionSpec   `json:"spec,omitempty"`
+	Status ScheduledActionStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// ScheduledActionList contains a list of ScheduledAction
+type ScheduledActionList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ScheduledAction `json:"items"`
+}
+
+func init() {
+	objectTypes = append(objectTypes, &ScheduledAction{}, &ScheduledActionList{})
+}
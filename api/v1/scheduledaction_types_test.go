@@ -0,0 +1,24 @@
+package v1
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/utils/ptr"
+)
+
+func TestScheduledActionSpec_Defaults(t *testing.T) {
+	spec := ScheduledActionSpec{}
+	assert.Equal(t, ForbidConcurrent, spec.GetConcurrencyPolicy())
+	assert.Equal(t, DefaultSuccessfulRunsHistoryLimit, spec.GetSuccessfulRunsHistoryLimit())
+	assert.Equal(t, DefaultFailedRunsHistoryLimit, spec.GetFailedRunsHistoryLimit())
+
+	spec = ScheduledActionSpec{
+		ConcurrencyPolicy:          ReplaceConcurrent,
+		SuccessfulRunsHistoryLimit: ptr.To(int32(0)),
+		FailedRunsHistoryLimit:     ptr.To(int32(5)),
+	}
+	assert.Equal(t, ReplaceConcurrent, spec.GetConcurrencyPolicy())
+	assert.Equal(t, int32(0), spec.GetSuccessfulRunsHistoryLimit())
+	assert.Equal(t, int32(5), spec.GetFailedRunsHistoryLimit())
+}
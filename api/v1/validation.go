@@ -0,0 +1,85 @@
+package v1
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apivalidation "k8s.io/apimachinery/pkg/api/validation"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+const (
+	// InstallationSchemaVersion is the newest version of the Porter installation schema supported by the operator.
+	InstallationSchemaVersion = "1.0.2"
+
+	// CredentialSetSchemaVersion is the newest version of the Porter credential set schema supported by the operator.
+	CredentialSetSchemaVersion = "1.0.1"
+
+	// ParameterSetSchemaVersion is the newest version of the Porter parameter set schema supported by the operator.
+	ParameterSetSchemaVersion = "1.0.1"
+)
+
+// validateSchemaVersion checks that the schema version of a Porter resource is supported,
+// it must have the same major version and not be newer than the supported version.
+func validateSchemaVersion(path *field.Path, value string, supported string) field.ErrorList {
+	if value == "" {
+		return field.ErrorList{field.Required(path, "")}
+	}
+
+	v, err := semver.NewVersion(value)
+	if err != nil {
+		return field.ErrorList{field.Invalid(path, value, "must be a semantic version")}
+	}
+	max := semver.MustParse(supported)
+	if v.Major() != max.Major() || v.GreaterThan(max) {
+		return field.ErrorList{field.Invalid(path, value, fmt.Sprintf("unsupported schema version, must be %s or an earlier %d.x version", supported, max.Major()))}
+	}
+	return nil
+}
+
+// validateImmutableIdentity checks that the name and namespace of a resource in Porter
+// are not changed after the resource is created.
+func validateImmutableIdentity(specPath *field.Path, name string, namespace string, oldName string, oldNamespace string) field.ErrorList {
+	errs := apivalidation.ValidateImmutableField(name, oldName, specPath.Child("name"))
+	return append(errs, apivalidation.ValidateImmutableField(namespace, oldNamespace, specPath.Child("namespace"))...)
+}
+
+// skipSpecValidation reports whether an update can be accepted without validating the spec again.
+// This is the case when the resource is being deleted, so that the finalizer can always be removed,
+// or when only the metadata or status of the resource changed.
+func skipSpecValidation(obj metav1.Object, oldSpec interface{}, newSpec interface{}) bool {
+	return obj.GetDeletionTimestamp() != nil || equality.Semantic.DeepEqual(oldSpec, newSpec)
+}
+
+// validateNonNegativeDuration checks that an optional duration is not negative.
+func validateNonNegativeDuration(path *field.Path, value *metav1.Duration) field.ErrorList {
+	if value != nil && value.Duration < 0 {
+		return field.ErrorList{field.Invalid(path, value.Duration.String(), "must not be negative")}
+	}
+	return nil
+}
+
+// validateRepository checks that a repository does not include a tag or digest.
+func validateRepository(path *field.Path, repository string) field.ErrorList {
+	if repository == "" {
+		return field.ErrorList{field.Required(path, "")}
+	}
+	// Only check the last part of the repository, the registry host may include a port
+	name := repository[strings.LastIndex(repository, "/")+1:]
+	if strings.ContainsAny(name, ":@") {
+		return field.ErrorList{field.Invalid(path, repository, "must not include a tag or digest")}
+	}
+	return nil
+}
+
+// toValidationError converts a list of field errors into the error returned by the webhook.
+func toValidationError(kind string, name string, errs field.ErrorList) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(GroupVersion.WithKind(kind).GroupKind(), name, errs)
+}
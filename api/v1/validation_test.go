@@ -0,0 +1,53 @@
+package v1
+
+import (
+	"testing"
+
+	"get.porter.sh/porter/pkg/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+func TestSchemaVersions(t *testing.T) {
+	// Keep the supported schema versions in sync with the version of Porter used by the operator
+	assert.Equal(t, string(storage.DefaultInstallationSchemaVersion), InstallationSchemaVersion)
+	assert.Equal(t, string(storage.DefaultCredentialSetSchemaVersion), CredentialSetSchemaVersion)
+	assert.Equal(t, string(storage.DefaultParameterSetSchemaVersion), ParameterSetSchemaVersion)
+}
+
+func TestValidateSchemaVersion(t *testing.T) {
+	path := field.NewPath("spec", "schemaVersion")
+	testcases := []struct {
+		value   string
+		wantErr string
+	}{
+		{value: "1.0.2"},
+		{value: "1.0.0"},
+		{value: "", wantErr: "Required value"},
+		{value: "oops", wantErr: "must be a semantic version"},
+		{value: "1.0.3", wantErr: "unsupported schema version, must be 1.0.2 or an earlier 1.x version"},
+		{value: "0.1.0", wantErr: "unsupported schema version"},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.value, func(t *testing.T) {
+			errs := validateSchemaVersion(path, tc.value, "1.0.2")
+			if tc.wantErr == "" {
+				assert.Empty(t, errs)
+				return
+			}
+			require.Len(t, errs, 1)
+			assert.Contains(t, errs[0].Error(), tc.wantErr)
+			assert.Equal(t, "spec.schemaVersion", errs[0].Field)
+		})
+	}
+}
+
+func TestValidateRepository(t *testing.T) {
+	path := field.NewPath("spec", "bundle", "repository")
+	assert.Empty(t, validateRepository(path, "ghcr.io/getporter/porter-hello"))
+	assert.Empty(t, validateRepository(path, "localhost:5000/porter-hello"), "the registry host may include a port")
+	assert.NotEmpty(t, validateRepository(path, ""))
+	assert.NotEmpty(t, validateRepository(path, "ghcr.io/getporter/porter-hello:v0.1.0"))
+	assert.NotEmpty(t, validateRepository(path, "ghcr.io/getporter/porter-hello@sha256:abc"))
+}
@@ -158,6 +158,11 @@ func (in *AgentActionStatus) DeepCopyInto(out *AgentActionStatus) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.Logs != nil {
+		in, out := &in.Logs, &out.Logs
+		*out = new(corev1.LocalObjectReference)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AgentActionStatus.
@@ -264,6 +269,36 @@ func (in *AgentConfigSpec) DeepCopyInto(out *AgentConfigSpec) {
 		*out = new(PluginFileSpec)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.ResyncInterval != nil {
+		in, out := &in.ResyncInterval, &out.ResyncInterval
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.RetryPolicy != nil {
+		in, out := &in.RetryPolicy, &out.RetryPolicy
+		*out = new(RetryPolicy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ApprovalPolicy != nil {
+		in, out := &in.ApprovalPolicy, &out.ApprovalPolicy
+		*out = new(ApprovalPolicy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.RunHistoryLimit != nil {
+		in, out := &in.RunHistoryLimit, &out.RunHistoryLimit
+		*out = new(int32)
+		**out = **in
+	}
+	if in.SuccessfulActionsHistoryLimit != nil {
+		in, out := &in.SuccessfulActionsHistoryLimit, &out.SuccessfulActionsHistoryLimit
+		*out = new(int32)
+		**out = **in
+	}
+	if in.FailedActionsHistoryLimit != nil {
+		in, out := &in.FailedActionsHistoryLimit, &out.FailedActionsHistoryLimit
+		*out = new(int32)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AgentConfigSpec.
@@ -309,6 +344,56 @@ func (in *AgentConfigStatus) DeepCopy() *AgentConfigStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ApprovalPolicy) DeepCopyInto(out *ApprovalPolicy) {
+	*out = *in
+	if in.Timeout != nil {
+		in, out := &in.Timeout, &out.Timeout
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ApprovalPolicy.
+func (in *ApprovalPolicy) DeepCopy() *ApprovalPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(ApprovalPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BundleUpdatePolicy) DeepCopyInto(out *BundleUpdatePolicy) {
+	*out = *in
+	if in.Interval != nil {
+		in, out := &in.Interval, &out.Interval
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.MaintenanceWindow != nil {
+		in, out := &in.MaintenanceWindow, &out.MaintenanceWindow
+		*out = new(MaintenanceWindow)
+		**out = **in
+	}
+	if in.PullSecret != nil {
+		in, out := &in.PullSecret, &out.PullSecret
+		*out = new(corev1.LocalObjectReference)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BundleUpdatePolicy.
+func (in *BundleUpdatePolicy) DeepCopy() *BundleUpdatePolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(BundleUpdatePolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Credential) DeepCopyInto(out *Credential) {
 	*out = *in
@@ -467,6 +552,135 @@ func (in *Installation) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *InstallationAction) DeepCopyInto(out *InstallationAction) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InstallationAction.
+func (in *InstallationAction) DeepCopy() *InstallationAction {
+	if in == nil {
+		return nil
+	}
+	out := new(InstallationAction)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *InstallationAction) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *InstallationActionList) DeepCopyInto(out *InstallationActionList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]InstallationAction, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InstallationActionList.
+func (in *InstallationActionList) DeepCopy() *InstallationActionList {
+	if in == nil {
+		return nil
+	}
+	out := new(InstallationActionList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *InstallationActionList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *InstallationActionSpec) DeepCopyInto(out *InstallationActionSpec) {
+	*out = *in
+	if in.AgentConfig != nil {
+		in, out := &in.AgentConfig, &out.AgentConfig
+		*out = new(corev1.LocalObjectReference)
+		**out = **in
+	}
+	out.Installation = in.Installation
+	if in.Parameters != nil {
+		in, out := &in.Parameters, &out.Parameters
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.ParameterSets != nil {
+		in, out := &in.ParameterSets, &out.ParameterSets
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.CredentialSets != nil {
+		in, out := &in.CredentialSets, &out.CredentialSets
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InstallationActionSpec.
+func (in *InstallationActionSpec) DeepCopy() *InstallationActionSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(InstallationActionSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *InstallationActionStatus) DeepCopyInto(out *InstallationActionStatus) {
+	*out = *in
+	in.PorterResourceStatus.DeepCopyInto(&out.PorterResourceStatus)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InstallationActionStatus.
+func (in *InstallationActionStatus) DeepCopy() *InstallationActionStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(InstallationActionStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *InstallationApproval) DeepCopyInto(out *InstallationApproval) {
+	*out = *in
+	in.ApprovalTime.DeepCopyInto(&out.ApprovalTime)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InstallationApproval.
+func (in *InstallationApproval) DeepCopy() *InstallationApproval {
+	if in == nil {
+		return nil
+	}
+	out := new(InstallationApproval)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *InstallationList) DeepCopyInto(out *InstallationList) {
 	*out = *in
@@ -586,7 +800,14 @@ func (in *InstallationOutputStatus) DeepCopyInto(out *InstallationOutputStatus)
 	if in.Outputs != nil {
 		in, out := &in.Outputs, &out.Outputs
 		*out = make([]Output, len(*in))
-		copy(*out, *in)
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Action != nil {
+		in, out := &in.Action, &out.Action
+		*out = new(corev1.LocalObjectReference)
+		**out = **in
 	}
 }
 
@@ -601,127 +822,67 @@ func (in *InstallationOutputStatus) DeepCopy() *InstallationOutputStatus {
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *InstallationSpec) DeepCopyInto(out *InstallationSpec) {
+func (in *InstallationPlan) DeepCopyInto(out *InstallationPlan) {
 	*out = *in
-	if in.AgentConfig != nil {
-		in, out := &in.AgentConfig, &out.AgentConfig
-		*out = new(corev1.LocalObjectReference)
-		**out = **in
-	}
-	out.Bundle = in.Bundle
-	if in.Labels != nil {
-		in, out := &in.Labels, &out.Labels
-		*out = make(map[string]string, len(*in))
-		for key, val := range *in {
-			(*out)[key] = val
-		}
-	}
-	in.Parameters.DeepCopyInto(&out.Parameters)
-	if in.CredentialSets != nil {
-		in, out := &in.CredentialSets, &out.CredentialSets
-		*out = make([]string, len(*in))
-		copy(*out, *in)
-	}
-	if in.ParameterSets != nil {
-		in, out := &in.ParameterSets, &out.ParameterSets
-		*out = make([]string, len(*in))
+	out.AgentAction = in.AgentAction
+	if in.Parameters != nil {
+		in, out := &in.Parameters, &out.Parameters
+		*out = make([]PlannedParameter, len(*in))
 		copy(*out, *in)
 	}
-}
-
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InstallationSpec.
-func (in *InstallationSpec) DeepCopy() *InstallationSpec {
-	if in == nil {
-		return nil
-	}
-	out := new(InstallationSpec)
-	in.DeepCopyInto(out)
-	return out
-}
-
-// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *InstallationStatus) DeepCopyInto(out *InstallationStatus) {
-	*out = *in
-	in.PorterResourceStatus.DeepCopyInto(&out.PorterResourceStatus)
-}
-
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InstallationStatus.
-func (in *InstallationStatus) DeepCopy() *InstallationStatus {
-	if in == nil {
-		return nil
-	}
-	out := new(InstallationStatus)
-	in.DeepCopyInto(out)
-	return out
-}
-
-// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *OCIReferenceParts) DeepCopyInto(out *OCIReferenceParts) {
-	*out = *in
-}
-
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OCIReferenceParts.
-func (in *OCIReferenceParts) DeepCopy() *OCIReferenceParts {
-	if in == nil {
-		return nil
+	in.PlanTime.DeepCopyInto(&out.PlanTime)
+	if in.ExpiryTime != nil {
+		in, out := &in.ExpiryTime, &out.ExpiryTime
+		*out = (*in).DeepCopy()
 	}
-	out := new(OCIReferenceParts)
-	in.DeepCopyInto(out)
-	return out
-}
-
-// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *Output) DeepCopyInto(out *Output) {
-	*out = *in
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Output.
-func (in *Output) DeepCopy() *Output {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InstallationPlan.
+func (in *InstallationPlan) DeepCopy() *InstallationPlan {
 	if in == nil {
 		return nil
 	}
-	out := new(Output)
+	out := new(InstallationPlan)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *Parameter) DeepCopyInto(out *Parameter) {
+func (in *InstallationReference) DeepCopyInto(out *InstallationReference) {
 	*out = *in
-	out.Source = in.Source
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Parameter.
-func (in *Parameter) DeepCopy() *Parameter {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InstallationReference.
+func (in *InstallationReference) DeepCopy() *InstallationReference {
 	if in == nil {
 		return nil
 	}
-	out := new(Parameter)
+	out := new(InstallationReference)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *ParameterSet) DeepCopyInto(out *ParameterSet) {
+func (in *InstallationRun) DeepCopyInto(out *InstallationRun) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	in.Spec.DeepCopyInto(&out.Spec)
+	out.Spec = in.Spec
 	in.Status.DeepCopyInto(&out.Status)
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ParameterSet.
-func (in *ParameterSet) DeepCopy() *ParameterSet {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InstallationRun.
+func (in *InstallationRun) DeepCopy() *InstallationRun {
 	if in == nil {
 		return nil
 	}
-	out := new(ParameterSet)
+	out := new(InstallationRun)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
-func (in *ParameterSet) DeepCopyObject() runtime.Object {
+func (in *InstallationRun) DeepCopyObject() runtime.Object {
 	if c := in.DeepCopy(); c != nil {
 		return c
 	}
@@ -729,31 +890,31 @@ func (in *ParameterSet) DeepCopyObject() runtime.Object {
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *ParameterSetList) DeepCopyInto(out *ParameterSetList) {
+func (in *InstallationRunList) DeepCopyInto(out *InstallationRunList) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ListMeta.DeepCopyInto(&out.ListMeta)
 	if in.Items != nil {
 		in, out := &in.Items, &out.Items
-		*out = make([]ParameterSet, len(*in))
+		*out = make([]InstallationRun, len(*in))
 		for i := range *in {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ParameterSetList.
-func (in *ParameterSetList) DeepCopy() *ParameterSetList {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InstallationRunList.
+func (in *InstallationRunList) DeepCopy() *InstallationRunList {
 	if in == nil {
 		return nil
 	}
-	out := new(ParameterSetList)
+	out := new(InstallationRunList)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
-func (in *ParameterSetList) DeepCopyObject() runtime.Object {
+func (in *InstallationRunList) DeepCopyObject() runtime.Object {
 	if c := in.DeepCopy(); c != nil {
 		return c
 	}
@@ -761,7 +922,340 @@ func (in *ParameterSetList) DeepCopyObject() runtime.Object {
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *ParameterSetSpec) DeepCopyInto(out *ParameterSetSpec) {
+func (in *InstallationRunSpec) DeepCopyInto(out *InstallationRunSpec) {
+	*out = *in
+	out.Installation = in.Installation
+	out.AgentAction = in.AgentAction
+	out.Job = in.Job
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InstallationRunSpec.
+func (in *InstallationRunSpec) DeepCopy() *InstallationRunSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(InstallationRunSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *InstallationRunStatus) DeepCopyInto(out *InstallationRunStatus) {
+	*out = *in
+	if in.StartTime != nil {
+		in, out := &in.StartTime, &out.StartTime
+		*out = (*in).DeepCopy()
+	}
+	if in.CompletionTime != nil {
+		in, out := &in.CompletionTime, &out.CompletionTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InstallationRunStatus.
+func (in *InstallationRunStatus) DeepCopy() *InstallationRunStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(InstallationRunStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *InstallationSpec) DeepCopyInto(out *InstallationSpec) {
+	*out = *in
+	if in.AgentConfig != nil {
+		in, out := &in.AgentConfig, &out.AgentConfig
+		*out = new(corev1.LocalObjectReference)
+		**out = **in
+	}
+	if in.ResyncInterval != nil {
+		in, out := &in.ResyncInterval, &out.ResyncInterval
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.UpdatePolicy != nil {
+		in, out := &in.UpdatePolicy, &out.UpdatePolicy
+		*out = new(BundleUpdatePolicy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.RetryPolicy != nil {
+		in, out := &in.RetryPolicy, &out.RetryPolicy
+		*out = new(RetryPolicy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ApprovalPolicy != nil {
+		in, out := &in.ApprovalPolicy, &out.ApprovalPolicy
+		*out = new(ApprovalPolicy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.DependsOn != nil {
+		in, out := &in.DependsOn, &out.DependsOn
+		*out = make([]InstallationReference, len(*in))
+		copy(*out, *in)
+	}
+	if in.ParameterSources != nil {
+		in, out := &in.ParameterSources, &out.ParameterSources
+		*out = make([]Parameter, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.OutputSync != nil {
+		in, out := &in.OutputSync, &out.OutputSync
+		*out = new(OutputSync)
+		(*in).DeepCopyInto(*out)
+	}
+	out.Bundle = in.Bundle
+	if in.Labels != nil {
+		in, out := &in.Labels, &out.Labels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	in.Parameters.DeepCopyInto(&out.Parameters)
+	if in.CredentialSets != nil {
+		in, out := &in.CredentialSets, &out.CredentialSets
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ParameterSets != nil {
+		in, out := &in.ParameterSets, &out.ParameterSets
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InstallationSpec.
+func (in *InstallationSpec) DeepCopy() *InstallationSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(InstallationSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *InstallationStatus) DeepCopyInto(out *InstallationStatus) {
+	*out = *in
+	in.PorterResourceStatus.DeepCopyInto(&out.PorterResourceStatus)
+	if in.LastResyncTime != nil {
+		in, out := &in.LastResyncTime, &out.LastResyncTime
+		*out = (*in).DeepCopy()
+	}
+	if in.AvailableUpdate != nil {
+		in, out := &in.AvailableUpdate, &out.AvailableUpdate
+		*out = new(OCIReferenceParts)
+		**out = **in
+	}
+	if in.LastUpdateCheckTime != nil {
+		in, out := &in.LastUpdateCheckTime, &out.LastUpdateCheckTime
+		*out = (*in).DeepCopy()
+	}
+	if in.NextRetryTime != nil {
+		in, out := &in.NextRetryTime, &out.NextRetryTime
+		*out = (*in).DeepCopy()
+	}
+	if in.Plan != nil {
+		in, out := &in.Plan, &out.Plan
+		*out = new(InstallationPlan)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Approval != nil {
+		in, out := &in.Approval, &out.Approval
+		*out = new(InstallationApproval)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.OutputConfigMap != nil {
+		in, out := &in.OutputConfigMap, &out.OutputConfigMap
+		*out = new(corev1.LocalObjectReference)
+		**out = **in
+	}
+	if in.OutputSecret != nil {
+		in, out := &in.OutputSecret, &out.OutputSecret
+		*out = new(corev1.LocalObjectReference)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InstallationStatus.
+func (in *InstallationStatus) DeepCopy() *InstallationStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(InstallationStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MaintenanceWindow) DeepCopyInto(out *MaintenanceWindow) {
+	*out = *in
+	out.Duration = in.Duration
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MaintenanceWindow.
+func (in *MaintenanceWindow) DeepCopy() *MaintenanceWindow {
+	if in == nil {
+		return nil
+	}
+	out := new(MaintenanceWindow)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OCIReferenceParts) DeepCopyInto(out *OCIReferenceParts) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OCIReferenceParts.
+func (in *OCIReferenceParts) DeepCopy() *OCIReferenceParts {
+	if in == nil {
+		return nil
+	}
+	out := new(OCIReferenceParts)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Output) DeepCopyInto(out *Output) {
+	*out = *in
+	if in.SecretKeyRef != nil {
+		in, out := &in.SecretKeyRef, &out.SecretKeyRef
+		*out = new(corev1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Output.
+func (in *Output) DeepCopy() *Output {
+	if in == nil {
+		return nil
+	}
+	out := new(Output)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OutputSource) DeepCopyInto(out *OutputSource) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OutputSource.
+func (in *OutputSource) DeepCopy() *OutputSource {
+	if in == nil {
+		return nil
+	}
+	out := new(OutputSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OutputSync) DeepCopyInto(out *OutputSync) {
+	*out = *in
+	if in.Keys != nil {
+		in, out := &in.Keys, &out.Keys
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OutputSync.
+func (in *OutputSync) DeepCopy() *OutputSync {
+	if in == nil {
+		return nil
+	}
+	out := new(OutputSync)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Parameter) DeepCopyInto(out *Parameter) {
+	*out = *in
+	in.Source.DeepCopyInto(&out.Source)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Parameter.
+func (in *Parameter) DeepCopy() *Parameter {
+	if in == nil {
+		return nil
+	}
+	out := new(Parameter)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ParameterSet) DeepCopyInto(out *ParameterSet) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ParameterSet.
+func (in *ParameterSet) DeepCopy() *ParameterSet {
+	if in == nil {
+		return nil
+	}
+	out := new(ParameterSet)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ParameterSet) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ParameterSetList) DeepCopyInto(out *ParameterSetList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]ParameterSet, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ParameterSetList.
+func (in *ParameterSetList) DeepCopy() *ParameterSetList {
+	if in == nil {
+		return nil
+	}
+	out := new(ParameterSetList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ParameterSetList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ParameterSetSpec) DeepCopyInto(out *ParameterSetSpec) {
 	*out = *in
 	if in.AgentConfig != nil {
 		in, out := &in.AgentConfig, &out.AgentConfig
@@ -771,7 +1265,9 @@ func (in *ParameterSetSpec) DeepCopyInto(out *ParameterSetSpec) {
 	if in.Parameters != nil {
 		in, out := &in.Parameters, &out.Parameters
 		*out = make([]Parameter, len(*in))
-		copy(*out, *in)
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
 	}
 }
 
@@ -804,6 +1300,11 @@ func (in *ParameterSetStatus) DeepCopy() *ParameterSetStatus {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ParameterSource) DeepCopyInto(out *ParameterSource) {
 	*out = *in
+	if in.Output != nil {
+		in, out := &in.Output, &out.Output
+		*out = new(OutputSource)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ParameterSource.
@@ -816,6 +1317,21 @@ func (in *ParameterSource) DeepCopy() *ParameterSource {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PlannedParameter) DeepCopyInto(out *PlannedParameter) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlannedParameter.
+func (in *PlannedParameter) DeepCopy() *PlannedParameter {
+	if in == nil {
+		return nil
+	}
+	out := new(PlannedParameter)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Plugin) DeepCopyInto(out *Plugin) {
 	*out = *in
@@ -1039,6 +1555,11 @@ func (in *PorterResourceStatus) DeepCopyInto(out *PorterResourceStatus) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.Logs != nil {
+		in, out := &in.Logs, &out.Logs
+		*out = new(corev1.LocalObjectReference)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PorterResourceStatus.
@@ -1051,6 +1572,291 @@ func (in *PorterResourceStatus) DeepCopy() *PorterResourceStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PorterServer) DeepCopyInto(out *PorterServer) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PorterServer.
+func (in *PorterServer) DeepCopy() *PorterServer {
+	if in == nil {
+		return nil
+	}
+	out := new(PorterServer)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *PorterServer) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PorterServerList) DeepCopyInto(out *PorterServerList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]PorterServer, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PorterServerList.
+func (in *PorterServerList) DeepCopy() *PorterServerList {
+	if in == nil {
+		return nil
+	}
+	out := new(PorterServerList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *PorterServerList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PorterServerSpec) DeepCopyInto(out *PorterServerSpec) {
+	*out = *in
+	if in.Replicas != nil {
+		in, out := &in.Replicas, &out.Replicas
+		*out = new(int32)
+		**out = **in
+	}
+	if in.TLS != nil {
+		in, out := &in.TLS, &out.TLS
+		*out = new(PorterServerTLS)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PorterServerSpec.
+func (in *PorterServerSpec) DeepCopy() *PorterServerSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(PorterServerSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PorterServerStatus) DeepCopyInto(out *PorterServerStatus) {
+	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PorterServerStatus.
+func (in *PorterServerStatus) DeepCopy() *PorterServerStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(PorterServerStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PorterServerTLS) DeepCopyInto(out *PorterServerTLS) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PorterServerTLS.
+func (in *PorterServerTLS) DeepCopy() *PorterServerTLS {
+	if in == nil {
+		return nil
+	}
+	out := new(PorterServerTLS)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RetryPolicy) DeepCopyInto(out *RetryPolicy) {
+	*out = *in
+	if in.BackoffBase != nil {
+		in, out := &in.BackoffBase, &out.BackoffBase
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.BackoffCap != nil {
+		in, out := &in.BackoffCap, &out.BackoffCap
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.RetryableReasons != nil {
+		in, out := &in.RetryableReasons, &out.RetryableReasons
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RetryPolicy.
+func (in *RetryPolicy) DeepCopy() *RetryPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(RetryPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ScheduledAction) DeepCopyInto(out *ScheduledAction) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ScheduledAction.
+func (in *ScheduledAction) DeepCopy() *ScheduledAction {
+	if in == nil {
+		return nil
+	}
+	out := new(ScheduledAction)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ScheduledAction) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ScheduledActionList) DeepCopyInto(out *ScheduledActionList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]ScheduledAction, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ScheduledActionList.
+func (in *ScheduledActionList) DeepCopy() *ScheduledActionList {
+	if in == nil {
+		return nil
+	}
+	out := new(ScheduledActionList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ScheduledActionList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ScheduledActionSpec) DeepCopyInto(out *ScheduledActionSpec) {
+	*out = *in
+	if in.AgentConfig != nil {
+		in, out := &in.AgentConfig, &out.AgentConfig
+		*out = new(corev1.LocalObjectReference)
+		**out = **in
+	}
+	out.Installation = in.Installation
+	if in.StartingDeadlineSeconds != nil {
+		in, out := &in.StartingDeadlineSeconds, &out.StartingDeadlineSeconds
+		*out = new(int64)
+		**out = **in
+	}
+	if in.SuccessfulRunsHistoryLimit != nil {
+		in, out := &in.SuccessfulRunsHistoryLimit, &out.SuccessfulRunsHistoryLimit
+		*out = new(int32)
+		**out = **in
+	}
+	if in.FailedRunsHistoryLimit != nil {
+		in, out := &in.FailedRunsHistoryLimit, &out.FailedRunsHistoryLimit
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ScheduledActionSpec.
+func (in *ScheduledActionSpec) DeepCopy() *ScheduledActionSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ScheduledActionSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ScheduledActionStatus) DeepCopyInto(out *ScheduledActionStatus) {
+	*out = *in
+	if in.Active != nil {
+		in, out := &in.Active, &out.Active
+		*out = make([]corev1.LocalObjectReference, len(*in))
+		copy(*out, *in)
+	}
+	if in.LastScheduleTime != nil {
+		in, out := &in.LastScheduleTime, &out.LastScheduleTime
+		*out = (*in).DeepCopy()
+	}
+	if in.LastSuccessfulTime != nil {
+		in, out := &in.LastSuccessfulTime, &out.LastSuccessfulTime
+		*out = (*in).DeepCopy()
+	}
+	if in.NextScheduleTime != nil {
+		in, out := &in.NextScheduleTime, &out.NextScheduleTime
+		*out = (*in).DeepCopy()
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ScheduledActionStatus.
+func (in *ScheduledActionStatus) DeepCopy() *ScheduledActionStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ScheduledActionStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *SecretsConfig) DeepCopyInto(out *SecretsConfig) {
 	*out = *in
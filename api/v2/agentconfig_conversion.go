@@ -0,0 +1,68 @@
+package v2
+
+import (
+	v1 "get.porter.sh/operator/api/v1"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+)
+
+var _ conversion.Convertible = &AgentConfig{}
+
+// ConvertTo converts this AgentConfig to the Hub version (v1).
+func (src *AgentConfig) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*v1.AgentConfig)
+
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+	spec := src.Spec.DeepCopy()
+	dst.Spec = v1.AgentConfigSpec{
+		PorterRepository:              spec.PorterRepository,
+		PorterVersion:                 spec.PorterVersion,
+		ServiceAccount:                spec.ServiceAccount,
+		StorageClassName:              spec.StorageClassName,
+		VolumeSize:                    spec.VolumeSize,
+		TTLSecondsAfterFinished:       spec.TTLSecondsAfterFinished,
+		PullPolicy:                    spec.PullPolicy,
+		InstallationServiceAccount:    spec.InstallationServiceAccount,
+		RetryLimit:                    spec.RetryLimit,
+		PluginConfigFile:              spec.PluginConfigFile,
+		ResyncInterval:                spec.ResyncInterval,
+		DriftPolicy:                   spec.DriftPolicy,
+		RetryPolicy:                   spec.RetryPolicy,
+		Suspend:                       spec.Suspend,
+		ApprovalPolicy:                spec.ApprovalPolicy,
+		RunHistoryLimit:               spec.RunHistoryLimit,
+		SuccessfulActionsHistoryLimit: spec.SuccessfulActionsHistoryLimit,
+		FailedActionsHistoryLimit:     spec.FailedActionsHistoryLimit,
+	}
+	dst.Status = *src.Status.DeepCopy()
+	return nil
+}
+
+// ConvertFrom converts from the Hub version (v1) to this version.
+func (dst *AgentConfig) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*v1.AgentConfig)
+
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+	spec := src.Spec.DeepCopy()
+	dst.Spec = AgentConfigSpec{
+		PorterRepository:              spec.PorterRepository,
+		PorterVersion:                 spec.PorterVersion,
+		ServiceAccount:                spec.ServiceAccount,
+		StorageClassName:              spec.StorageClassName,
+		VolumeSize:                    spec.VolumeSize,
+		TTLSecondsAfterFinished:       spec.TTLSecondsAfterFinished,
+		PullPolicy:                    spec.PullPolicy,
+		InstallationServiceAccount:    spec.InstallationServiceAccount,
+		RetryLimit:                    spec.RetryLimit,
+		PluginConfigFile:              spec.PluginConfigFile,
+		ResyncInterval:                spec.ResyncInterval,
+		DriftPolicy:                   spec.DriftPolicy,
+		RetryPolicy:                   spec.RetryPolicy,
+		Suspend:                       spec.Suspend,
+		ApprovalPolicy:                spec.ApprovalPolicy,
+		RunHistoryLimit:               spec.RunHistoryLimit,
+		SuccessfulActionsHistoryLimit: spec.SuccessfulActionsHistoryLimit,
+		FailedActionsHistoryLimit:     spec.FailedActionsHistoryLimit,
+	}
+	dst.Status = *src.Status.DeepCopy()
+	return nil
+}
@@ -0,0 +1,68 @@
+package v2
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	v1 "get.porter.sh/operator/api/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/yaml"
+)
+
+func TestAgentConfig_ConvertFrom_Sample(t *testing.T) {
+	b, err := os.ReadFile("../../config/samples/_v1_agentconfig.yaml")
+	require.NoError(t, err)
+	var hub v1.AgentConfig
+	require.NoError(t, yaml.Unmarshal(b, &hub))
+
+	var cfg AgentConfig
+	require.NoError(t, cfg.ConvertFrom(&hub))
+	assert.Equal(t, "canary", cfg.Spec.PorterVersion)
+	assert.Equal(t, "v1.0.1", cfg.Spec.PluginConfigFile.Plugins["kubernetes"].Version)
+
+	var roundTrip v1.AgentConfig
+	require.NoError(t, cfg.ConvertTo(&roundTrip))
+	assert.Equal(t, hub.ObjectMeta, roundTrip.ObjectMeta)
+	assert.Equal(t, hub.Spec, roundTrip.Spec)
+}
+
+func TestAgentConfig_RoundTrip(t *testing.T) {
+	cfg := &AgentConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "test", Labels: map[string]string{"team": "llamas"}},
+		Spec: AgentConfigSpec{
+			PorterRepository:           "localhost:5000/porter-agent",
+			PorterVersion:              "v1.1.0",
+			ServiceAccount:             "porter-agent",
+			StorageClassName:           "standard",
+			VolumeSize:                 "128Mi",
+			TTLSecondsAfterFinished:    ptr.To(int32(300)),
+			PullPolicy:                 corev1.PullIfNotPresent,
+			InstallationServiceAccount: "installation-agent",
+			RetryLimit:                 ptr.To(int32(2)),
+			PluginConfigFile: &v1.PluginFileSpec{SchemaVersion: "1.0.0",
+				Plugins: map[string]v1.Plugin{"kubernetes": {Version: "v1.0.1"}}},
+			ResyncInterval:                &metav1.Duration{Duration: time.Hour},
+			DriftPolicy:                   v1.DriftPolicyDetect,
+			RetryPolicy:                   &v1.RetryPolicy{MaxAttempts: 3, RetryableReasons: []string{v1.FailureReasonBundlePullFailed}},
+			Suspend:                       true,
+			ApprovalPolicy:                &v1.ApprovalPolicy{Required: true},
+			RunHistoryLimit:               ptr.To(int32(5)),
+			SuccessfulActionsHistoryLimit: ptr.To(int32(2)),
+			FailedActionsHistoryLimit:     ptr.To(int32(0)),
+		},
+		Status: v1.AgentConfigStatus{Ready: true},
+	}
+
+	var hub v1.AgentConfig
+	require.NoError(t, cfg.ConvertTo(&hub))
+	assert.Equal(t, int32(300), *hub.Spec.TTLSecondsAfterFinished)
+
+	var roundTrip AgentConfig
+	require.NoError(t, roundTrip.ConvertFrom(&hub))
+	assert.Equal(t, cfg, &roundTrip)
+}
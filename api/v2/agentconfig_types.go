@@ -0,0 +1,135 @@
+package v2
+
+import (
+	v1 "get.porter.sh/operator/api/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// AgentConfigSpec defines the configuration for the Porter agent.
+type AgentConfigSpec struct {
+	// PorterRepository is the repository for the Porter Agent image.
+	// Defaults to ghcr.io/getporter/porter-agent
+	// +optional
+	PorterRepository string `json:"porterRepository,omitempty"`
+
+	// PorterVersion is the tag for the Porter Agent image.
+	// Defaults to a well-known version of the agent that has been tested with the operator.
+	// Users SHOULD override this to use more recent versions.
+	// +optional
+	PorterVersion string `json:"porterVersion,omitempty"`
+
+	// ServiceAccount is the service account to run the Porter Agent under.
+	// +optional
+	ServiceAccount string `json:"serviceAccount,omitempty"`
+
+	// StorageClassName is the name of the storage class that Porter will request
+	// when running the Porter Agent. It is used to determine what the storage class
+	// will be for the volume requested
+	// +optional
+	StorageClassName string `json:"storageClassName,omitempty"`
+
+	// VolumeSize is the size of the persistent volume that Porter will
+	// request when running the Porter Agent. It is used to share data
+	// between the Porter Agent and the bundle invocation image. It must
+	// be large enough to store any files used by the bundle including credentials,
+	// parameters and outputs.
+	// +optional
+	VolumeSize string `json:"volumeSize,omitempty"`
+
+	// TTLSecondsAfterFinished set the time limit of the lifetime of a Job
+	// that has finished execution.
+	// +kubebuilder:default:=600
+	TTLSecondsAfterFinished *int32 `json:"ttlSecondsAfterFinished,omitempty"`
+
+	// PullPolicy specifies when to pull the Porter Agent image. The default
+	// is to use PullAlways when the tag is canary or latest, and PullIfNotPresent
+	// otherwise.
+	// +optional
+	PullPolicy corev1.PullPolicy `json:"pullPolicy,omitempty"`
+
+	// InstallationServiceAccount specifies a service account to run the Kubernetes pod/job for the installation image.
+	// The default is to run without a service account.
+	// This can be useful for a bundle which is targeting the kubernetes cluster that the operator is installed in.
+	// +optional
+	InstallationServiceAccount string `json:"installationServiceAccount,omitempty"`
+
+	// RetryLimit specifies the maximum number of retries that a failed agent job will run before being marked as failure.
+	// The default is set to 6 the same as the `BackoffLimit` on a kubernetes job.
+	// +optional
+	RetryLimit *int32 `json:"retryLimit,omitempty"`
+
+	// PluginConfigFile specifies plugins required to run Porter bundles.
+	// +optional
+	PluginConfigFile *v1.PluginFileSpec `json:"pluginConfigFile,omitempty"`
+
+	// ResyncInterval is how often an Installation is compared with the installation recorded by Porter to detect drift.
+	// Drift detection is disabled when the interval is not set or is zero.
+	// +optional
+	ResyncInterval *metav1.Duration `json:"resyncInterval,omitempty"`
+
+	// DriftPolicy specifies how an Installation that has drifted is handled.
+	// Detect reports the drift with the Drifted condition, and Correct also re-applies the installation.
+	// Defaults to Detect.
+	// +kubebuilder:validation:Enum=Detect;Correct
+	// +optional
+	DriftPolicy v1.DriftPolicy `json:"driftPolicy,omitempty"`
+
+	// RetryPolicy enables automatically retrying Installations that fail.
+	// +optional
+	RetryPolicy *v1.RetryPolicy `json:"retryPolicy,omitempty"`
+
+	// ApprovalPolicy requires changes to Installations to be approved before they are applied.
+	// +optional
+	ApprovalPolicy *v1.ApprovalPolicy `json:"approvalPolicy,omitempty"`
+
+	// RunHistoryLimit is the number of InstallationRuns that are kept for each Installation.
+	// The oldest runs are deleted when the limit is exceeded, and runs are not recorded when it is zero.
+	// Defaults to 10.
+	// +optional
+	RunHistoryLimit *int32 `json:"runHistoryLimit,omitempty"`
+
+	// SuccessfulActionsHistoryLimit is the number of successful AgentActions that are kept for each resource, such as an Installation.
+	// Older AgentActions are deleted along with their Job, volume and secrets. The latest AgentAction of a resource is always kept.
+	// Defaults to 3.
+	// +optional
+	SuccessfulActionsHistoryLimit *int32 `json:"successfulActionsHistoryLimit,omitempty"`
+
+	// FailedActionsHistoryLimit is the number of failed AgentActions that are kept for each resource, such as an Installation.
+	// Older AgentActions are deleted along with their Job, volume and secrets. The latest AgentAction of a resource is always kept.
+	// Defaults to 1.
+	// +optional
+	FailedActionsHistoryLimit *int32 `json:"failedActionsHistoryLimit,omitempty"`
+
+	// Suspend stops the operator from reconciling the resources that use this AgentConfig.
+	// Set it on the AgentConfig for a namespace to suspend every resource in that namespace.
+	// Changes made while suspended are applied when the resources are resumed.
+	// +optional
+	Suspend bool `json:"suspend,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:unservedversion
+
+// AgentConfig is the Schema for the agentconfigs API
+type AgentConfig struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   AgentConfigSpec      `json:"spec,omitempty"`
+	Status v1.AgentConfigStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// AgentConfigList contains a list of AgentConfig
+type AgentConfigList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []AgentConfig `json:"items"`
+}
+
+func init() {
+	objectTypes = append(objectTypes, &AgentConfig{}, &AgentConfigList{})
+}
@@ -0,0 +1,38 @@
+package v2
+
+import (
+	"testing"
+
+	v1 "get.porter.sh/operator/api/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/conversion"
+)
+
+func TestAddKnownTypes(t *testing.T) {
+	scheme := runtime.NewScheme()
+	AddToScheme(scheme)
+	err := addKnownTypes(scheme)
+	if err != nil {
+		t.Fatalf("failure to add known types %v", err)
+	}
+}
+
+func TestIsConvertible(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := v1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, obj := range []runtime.Object{&v1.Installation{}, &v1.AgentConfig{}} {
+		ok, err := conversion.IsConvertible(scheme, obj)
+		if err != nil {
+			t.Fatalf("error checking if %T is convertible: %v", obj, err)
+		}
+		if !ok {
+			t.Fatalf("expected %T to be convertible", obj)
+		}
+	}
+}
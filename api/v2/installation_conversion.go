@@ -0,0 +1,107 @@
+package v2
+
+import (
+	"encoding/json"
+	"strings"
+
+	v1 "get.porter.sh/operator/api/v1"
+	"github.com/pkg/errors"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+)
+
+var _ conversion.Convertible = &Installation{}
+
+// ConvertTo converts this Installation to the Hub version (v1).
+func (src *Installation) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*v1.Installation)
+
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+	if src.Spec.DeletionPolicy != "" {
+		if dst.Annotations == nil {
+			dst.Annotations = make(map[string]string, 1)
+		}
+		dst.Annotations[v1.PorterDeletePolicyAnnotation] = strings.ToLower(string(src.Spec.DeletionPolicy))
+	}
+
+	spec := src.Spec.DeepCopy()
+	dst.Spec = v1.InstallationSpec{
+		AgentConfig:      spec.AgentConfig,
+		ResyncInterval:   spec.ResyncInterval,
+		DriftPolicy:      spec.DriftPolicy,
+		UpdatePolicy:     spec.UpdatePolicy,
+		RetryPolicy:      spec.RetryPolicy,
+		Suspend:          spec.Suspend,
+		DryRun:           spec.DryRun,
+		ApprovalPolicy:   spec.ApprovalPolicy,
+		DependsOn:        spec.DependsOn,
+		ParameterSources: spec.ParameterSources,
+		OutputSync:       spec.OutputSync,
+		SchemaVersion:    spec.SchemaVersion,
+		Name:             spec.Name,
+		Namespace:        spec.Namespace,
+		Uninstalled:      spec.Uninstalled,
+		Bundle:           spec.Bundle,
+		Labels:           spec.Labels,
+		CredentialSets:   spec.CredentialSets,
+		ParameterSets:    spec.ParameterSets,
+	}
+	if spec.Parameters != nil {
+		raw, err := json.Marshal(spec.Parameters)
+		if err != nil {
+			return errors.Wrapf(err, "error converting the parameters of installation %s to %s", src.Name, v1.GroupVersion)
+		}
+		dst.Spec.Parameters.Raw = raw
+	}
+
+	dst.Status = *src.Status.DeepCopy()
+	return nil
+}
+
+// ConvertFrom converts from the Hub version (v1) to this version.
+func (dst *Installation) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*v1.Installation)
+
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+	// Known deletion policies are moved from the annotation into the spec,
+	// other values are left on the annotation so that they are not lost.
+	switch strings.ToLower(dst.Annotations[v1.PorterDeletePolicyAnnotation]) {
+	case v1.PorterDeletePolicyDelete:
+		dst.Spec.DeletionPolicy = DeletionPolicyDelete
+		delete(dst.Annotations, v1.PorterDeletePolicyAnnotation)
+	case v1.PorterDeletePolicyOrphan:
+		dst.Spec.DeletionPolicy = DeletionPolicyOrphan
+		delete(dst.Annotations, v1.PorterDeletePolicyAnnotation)
+	}
+	if len(dst.Annotations) == 0 {
+		dst.Annotations = nil
+	}
+
+	spec := src.Spec.DeepCopy()
+	dst.Spec.AgentConfig = spec.AgentConfig
+	dst.Spec.ResyncInterval = spec.ResyncInterval
+	dst.Spec.DriftPolicy = spec.DriftPolicy
+	dst.Spec.UpdatePolicy = spec.UpdatePolicy
+	dst.Spec.RetryPolicy = spec.RetryPolicy
+	dst.Spec.Suspend = spec.Suspend
+	dst.Spec.DryRun = spec.DryRun
+	dst.Spec.ApprovalPolicy = spec.ApprovalPolicy
+	dst.Spec.DependsOn = spec.DependsOn
+	dst.Spec.ParameterSources = spec.ParameterSources
+	dst.Spec.OutputSync = spec.OutputSync
+	dst.Spec.SchemaVersion = spec.SchemaVersion
+	dst.Spec.Name = spec.Name
+	dst.Spec.Namespace = spec.Namespace
+	dst.Spec.Uninstalled = spec.Uninstalled
+	dst.Spec.Bundle = spec.Bundle
+	dst.Spec.Labels = spec.Labels
+	dst.Spec.CredentialSets = spec.CredentialSets
+	dst.Spec.ParameterSets = spec.ParameterSets
+	if spec.Parameters.Raw != nil {
+		if err := json.Unmarshal(spec.Parameters.Raw, &dst.Spec.Parameters); err != nil {
+			return errors.Wrapf(err, "error converting the parameters of installation %s to %s, the parameters must be a map of parameter names to values", src.Name, GroupVersion)
+		}
+	}
+
+	dst.Status = *src.Status.DeepCopy()
+	return nil
+}
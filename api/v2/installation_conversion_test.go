@@ -0,0 +1,142 @@
+package v2
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	v1 "get.porter.sh/operator/api/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/yaml"
+)
+
+func TestInstallation_ConvertFrom_Sample(t *testing.T) {
+	// Existing v1 manifests must be readable through the v2 API
+	b, err := os.ReadFile("../../config/samples/porter-hello.yaml")
+	require.NoError(t, err)
+	var hub v1.Installation
+	require.NoError(t, yaml.Unmarshal(b, &hub))
+
+	var inst Installation
+	require.NoError(t, inst.ConvertFrom(&hub))
+	assert.Equal(t, "hello", inst.Spec.Name)
+	assert.Equal(t, "operator", inst.Spec.Namespace)
+	assert.Equal(t, v1.OCIReferenceParts{Repository: "ghcr.io/getporter/test/porter-hello", Version: "0.2.0"}, inst.Spec.Bundle)
+	assert.Equal(t, map[string]apiextensionsv1.JSON{"name": {Raw: []byte(`"llamas"`)}}, inst.Spec.Parameters)
+	assert.Empty(t, inst.Spec.DeletionPolicy)
+
+	var roundTrip v1.Installation
+	require.NoError(t, inst.ConvertTo(&roundTrip))
+	assert.Equal(t, hub.ObjectMeta, roundTrip.ObjectMeta)
+	assert.JSONEq(t, string(hub.Spec.Parameters.Raw), string(roundTrip.Spec.Parameters.Raw))
+	roundTrip.Spec.Parameters = hub.Spec.Parameters
+	assert.Equal(t, hub.Spec, roundTrip.Spec)
+}
+
+func TestInstallation_RoundTrip_FromHub(t *testing.T) {
+	testcases := []struct {
+		name       string
+		annotation string
+		wantPolicy DeletionPolicy
+	}{
+		{name: "no deletion policy"},
+		{name: "delete", annotation: v1.PorterDeletePolicyDelete, wantPolicy: DeletionPolicyDelete},
+		{name: "orphan", annotation: v1.PorterDeletePolicyOrphan, wantPolicy: DeletionPolicyOrphan},
+		{name: "unknown policy", annotation: "keep"},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			hub := &v1.Installation{
+				ObjectMeta: metav1.ObjectMeta{Name: "mybuns", Namespace: "test", Generation: 2,
+					Annotations: map[string]string{v1.AnnotationRetry: "1"}},
+				Spec: v1.InstallationSpec{
+					AgentConfig:    &corev1.LocalObjectReference{Name: "myagent"},
+					ResyncInterval: &metav1.Duration{Duration: time.Hour},
+					DriftPolicy:    v1.DriftPolicyCorrect,
+					UpdatePolicy:   &v1.BundleUpdatePolicy{Strategy: v1.BundleUpdateSemVer, Constraint: "~0.2"},
+					RetryPolicy:    &v1.RetryPolicy{MaxAttempts: 3, BackoffBase: &metav1.Duration{Duration: time.Minute}},
+					Suspend:        true,
+					DryRun:         true,
+					ApprovalPolicy: &v1.ApprovalPolicy{Required: true, Timeout: &metav1.Duration{Duration: time.Hour}},
+					DependsOn:      []v1.InstallationReference{{Name: "mysql"}, {Name: "redis", Namespace: "shared"}},
+					ParameterSources: []v1.Parameter{
+						{Name: "connstr", Source: v1.ParameterSource{Output: &v1.OutputSource{Name: "mysql", Key: "connstr"}}},
+					},
+					OutputSync:     &v1.OutputSync{SecretName: "mybuns-creds", Keys: map[string]string{"connstr": "DATABASE_URL"}},
+					SchemaVersion:  v1.InstallationSchemaVersion,
+					Name:           "mybuns",
+					Namespace:      "dev",
+					Bundle:         v1.OCIReferenceParts{Repository: "ghcr.io/getporter/porter-hello", Version: "0.2.0"},
+					Labels:         map[string]string{"team": "llamas"},
+					Parameters:     runtime.RawExtension{Raw: []byte(`{"count":2,"name":"llamas","tags":["a","b"]}`)},
+					CredentialSets: []string{"mycreds"},
+					ParameterSets:  []string{"myparams"},
+				},
+				Status: v1.InstallationStatus{PorterResourceStatus: v1.PorterResourceStatus{Phase: v1.PhaseSucceeded}},
+			}
+			if tc.annotation != "" {
+				hub.Annotations[v1.PorterDeletePolicyAnnotation] = tc.annotation
+			}
+
+			var inst Installation
+			require.NoError(t, inst.ConvertFrom(hub))
+			assert.Equal(t, tc.wantPolicy, inst.Spec.DeletionPolicy)
+			assert.Equal(t, &corev1.LocalObjectReference{Name: "myagent"}, inst.Spec.AgentConfig)
+			assert.Len(t, inst.Spec.Parameters, 3)
+			assert.Equal(t, `["a","b"]`, string(inst.Spec.Parameters["tags"].Raw))
+			if tc.wantPolicy != "" {
+				assert.NotContains(t, inst.Annotations, v1.PorterDeletePolicyAnnotation, "the deletion policy should only be in the spec")
+			}
+
+			var roundTrip v1.Installation
+			require.NoError(t, inst.ConvertTo(&roundTrip))
+			assert.Equal(t, hub, &roundTrip)
+		})
+	}
+}
+
+func TestInstallation_RoundTrip_FromSpoke(t *testing.T) {
+	inst := &Installation{
+		ObjectMeta: metav1.ObjectMeta{Name: "mybuns", Namespace: "test"},
+		Spec: InstallationSpec{
+			AgentConfig:    &corev1.LocalObjectReference{Name: "myagent"},
+			DeletionPolicy: DeletionPolicyOrphan,
+			SchemaVersion:  v1.InstallationSchemaVersion,
+			Name:           "mybuns",
+			Namespace:      "dev",
+			Bundle:         v1.OCIReferenceParts{Repository: "ghcr.io/getporter/porter-hello", Version: "0.2.0"},
+			Parameters: map[string]apiextensionsv1.JSON{
+				"name":  {Raw: []byte(`"llamas"`)},
+				"count": {Raw: []byte(`2`)},
+			},
+		},
+	}
+
+	var hub v1.Installation
+	require.NoError(t, inst.ConvertTo(&hub))
+	assert.Equal(t, v1.PorterDeletePolicyOrphan, hub.Annotations[v1.PorterDeletePolicyAnnotation])
+	assert.Equal(t, &corev1.LocalObjectReference{Name: "myagent"}, hub.Spec.AgentConfig)
+	assert.JSONEq(t, `{"name":"llamas","count":2}`, string(hub.Spec.Parameters.Raw))
+	assert.Nil(t, inst.Annotations, "converting should not modify the source")
+
+	var roundTrip Installation
+	require.NoError(t, roundTrip.ConvertFrom(&hub))
+	assert.Equal(t, inst, &roundTrip)
+}
+
+func TestInstallation_ConvertFrom_InvalidParameters(t *testing.T) {
+	hub := &v1.Installation{
+		ObjectMeta: metav1.ObjectMeta{Name: "mybuns", Namespace: "test"},
+		Spec:       v1.InstallationSpec{Parameters: runtime.RawExtension{Raw: []byte(`["llamas"]`)}},
+	}
+
+	var inst Installation
+	err := inst.ConvertFrom(hub)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "the parameters must be a map of parameter names to values")
+}
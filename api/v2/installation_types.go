@@ -0,0 +1,145 @@
+package v2
+
+import (
+	v1 "get.porter.sh/operator/api/v1"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// DeletionPolicy specifies what happens to the installation in Porter when
+// the Installation resource is deleted.
+type DeletionPolicy string
+
+const (
+	// DeletionPolicyDelete uninstalls the bundle when the Installation is deleted.
+	DeletionPolicyDelete DeletionPolicy = "Delete"
+
+	// DeletionPolicyOrphan leaves the installation in Porter when the Installation is deleted.
+	DeletionPolicyOrphan DeletionPolicy = "Orphan"
+)
+
+// InstallationSpec defines the desired state of Installation
+type InstallationSpec struct {
+	// AgentConfig is the name of an AgentConfig to use instead of the AgentConfig defined at the namespace or system level.
+	// +optional
+	AgentConfig *corev1.LocalObjectReference `json:"agentConfig,omitempty"`
+
+	// DeletionPolicy specifies if the bundle is uninstalled (Delete) or the
+	// installation is left in Porter (Orphan) when the Installation is deleted.
+	// Defaults to Delete.
+	// +kubebuilder:validation:Enum=Delete;Orphan
+	// +optional
+	DeletionPolicy DeletionPolicy `json:"deletionPolicy,omitempty"`
+
+	// ResyncInterval is how often the installation is compared with the installation recorded by Porter to detect drift.
+	// Overrides the interval defined on the AgentConfig. Set to zero to disable drift detection.
+	// +optional
+	ResyncInterval *metav1.Duration `json:"resyncInterval,omitempty"`
+
+	// DriftPolicy specifies how the installation is handled when it has drifted.
+	// Overrides the policy defined on the AgentConfig.
+	// +kubebuilder:validation:Enum=Detect;Correct
+	// +optional
+	DriftPolicy v1.DriftPolicy `json:"driftPolicy,omitempty"`
+
+	// UpdatePolicy enables checking the registry for new versions of the bundle.
+	// +optional
+	UpdatePolicy *v1.BundleUpdatePolicy `json:"updatePolicy,omitempty"`
+
+	// RetryPolicy enables automatically retrying the installation when it fails.
+	// Overrides the policy defined on the AgentConfig.
+	// +optional
+	RetryPolicy *v1.RetryPolicy `json:"retryPolicy,omitempty"`
+
+	// Suspend stops the operator from reconciling the installation.
+	// Changes made while the installation is suspended are applied when it is resumed.
+	// +optional
+	Suspend bool `json:"suspend,omitempty"`
+
+	// DryRun evaluates changes to the installation with Porter without executing the bundle.
+	// What Porter would do is recorded in status.plan.
+	// +optional
+	DryRun bool `json:"dryRun,omitempty"`
+
+	// ApprovalPolicy requires changes to the installation to be approved before they are applied.
+	// Overrides the policy defined on the AgentConfig.
+	// +optional
+	ApprovalPolicy *v1.ApprovalPolicy `json:"approvalPolicy,omitempty"`
+
+	// DependsOn is a list of installations that must succeed before this installation is applied.
+	// The installation is uninstalled after the installations that depend on it.
+	// +optional
+	DependsOn []v1.InstallationReference `json:"dependsOn,omitempty"`
+
+	// ParameterSources are parameters that are resolved by the operator when the
+	// installation is applied, for example from the outputs of another installation.
+	// They take precedence over parameters with the same name.
+	// +optional
+	ParameterSources []v1.Parameter `json:"parameterSources,omitempty"`
+
+	// OutputSync writes the outputs of the installation to a ConfigMap, and its
+	// sensitive outputs to a Secret, so that they can be used by applications in the cluster.
+	// +optional
+	OutputSync *v1.OutputSync `json:"outputSync,omitempty"`
+
+	// SchemaVersion is the version of the installation state schema.
+	SchemaVersion string `json:"schemaVersion"`
+
+	// Name is the name of the installation in Porter. Immutable.
+	Name string `json:"name"`
+
+	// Namespace (in Porter) where the installation is defined.
+	Namespace string `json:"namespace"`
+
+	// Uninstalled specifies if the installation should be uninstalled.
+	Uninstalled bool `json:"uninstalled,omitempty"`
+
+	// Bundle definition for the installation.
+	Bundle v1.OCIReferenceParts `json:"bundle"`
+
+	// Labels applied to the installation.
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Parameters specified by the user through overrides, keyed by the parameter name.
+	// Does not include defaults, or values resolved from parameter sources.
+	// +optional
+	Parameters map[string]apiextensionsv1.JSON `json:"parameters,omitempty"`
+
+	// CredentialSets that should be included when the bundle is reconciled.
+	CredentialSets []string `json:"credentialSets,omitempty"`
+
+	// ParameterSets that should be included when the bundle is reconciled.
+	ParameterSets []string `json:"parameterSets,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:unservedversion
+
+// Installation is the Schema for the installations API
+// +kubebuilder:printcolumn:name="Porter Name",type="string",JSONPath=".spec.name"
+// +kubebuilder:printcolumn:name="Porter Namespace",type="string",JSONPath=".spec.namespace"
+// +kubebuilder:printcolumn:name="Last Action",type="string",JSONPath=".status.action.name"
+// +kubebuilder:printcolumn:name="Last Status",type="string",JSONPath=".status.phase"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+type Installation struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   InstallationSpec      `json:"spec,omitempty"`
+	Status v1.InstallationStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// InstallationList contains a list of Installation
+type InstallationList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Installation `json:"items"`
+}
+
+func init() {
+	objectTypes = append(objectTypes, &Installation{}, &InstallationList{})
+}
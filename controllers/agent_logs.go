@@ -0,0 +1,151 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	// agentLogTailLines is the number of lines from the end of the Porter Agent logs that are captured.
+	agentLogTailLines = 500
+
+	// maxAgentLogSize is the maximum number of bytes of the Porter Agent logs that are captured,
+	// well under the size limit of a ConfigMap.
+	maxAgentLogSize = 256 * 1024
+
+	// agentContainerName is the name of the container that runs the Porter Agent in the agent job.
+	agentContainerName = "porter-agent"
+)
+
+// PodLogReader reads the logs of a container in a pod.
+type PodLogReader interface {
+	// GetLogs returns up to the specified number of lines from the end of the container's logs.
+	GetLogs(ctx context.Context, namespace string, pod string, container string, tailLines int64) ([]byte, error)
+}
+
+// NewPodLogReader creates a PodLogReader that reads the logs from the Kubernetes API.
+func NewPodLogReader(clientset kubernetes.Interface) PodLogReader {
+	return &kubernetesPodLogReader{clientset: clientset}
+}
+
+type kubernetesPodLogReader struct {
+	clientset kubernetes.Interface
+}
+
+func (r *kubernetesPodLogReader) GetLogs(ctx context.Context, namespace string, pod string, container string, tailLines int64) ([]byte, error) {
+	opts := &corev1.PodLogOptions{
+		Container: container,
+		TailLines: ptr.To(tailLines),
+	}
+	return r.clientset.CoreV1().Pods(namespace).GetLogs(pod, opts).DoRaw(ctx)
+}
+
+// captureAgentLogs saves the end of the logs from the agent job in a ConfigMap
+// owned by the agent action, so that they are available after the job's pods
+// are cleaned up, and links the ConfigMap from the action's status.
+// Capturing the logs is best effort, and does not fail the reconcile.
+func (r *AgentActionReconciler) captureAgentLogs(ctx context.Context, log logr.Logger, action *porterv1.AgentAction, job *batchv1.Job) {
+	if r.PodLogs == nil || job == nil {
+		return
+	}
+
+	cm, err := r.saveAgentLogs(ctx, log, action, job)
+	if err != nil {
+		log.Error(err, "Unable to capture the Porter Agent logs", "job", job.Name)
+		return
+	}
+	if cm == nil {
+		return
+	}
+
+	action.Status.Logs = &corev1.LocalObjectReference{Name: cm.Name}
+
+	eventType := "Normal"
+	if action.Status.Phase == porterv1.PhaseFailed {
+		eventType = "Warning"
+	}
+	r.Recorder.Event(action, eventType, "AgentLogs", fmt.Sprintf("the Porter Agent logs are in the ConfigMap %s", cm.Name))
+}
+
+func (r *AgentActionReconciler) saveAgentLogs(ctx context.Context, log logr.Logger, action *porterv1.AgentAction, job *batchv1.Job) (*corev1.ConfigMap, error) {
+	pod, err := r.getAgentPod(ctx, job)
+	if err != nil {
+		return nil, err
+	}
+	if pod == nil {
+		log.V(Log4Debug).Info("Not capturing the Porter Agent logs because the job has no pods", "job", job.Name)
+		return nil, nil
+	}
+
+	logs, err := r.PodLogs.GetLogs(ctx, pod.Namespace, pod.Name, agentContainerName, agentLogTailLines)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error retrieving the logs for pod %s", pod.Name)
+	}
+
+	cm := &corev1.ConfigMap{}
+	cm.Name = action.Name + "-logs"
+	cm.Namespace = action.Namespace
+	_, err = controllerutil.CreateOrUpdate(ctx, r.Client, cm, func() error {
+		cm.Labels = r.getSharedAgentLabels(action)
+		cm.Data = map[string]string{
+			porterv1.AgentLogsKey: truncateLogs(string(logs), maxAgentLogSize),
+		}
+		return controllerutil.SetControllerReference(action, cm, r.Scheme)
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error saving the Porter Agent logs")
+	}
+
+	log.V(Log4Debug).Info("Captured the Porter Agent logs", "configmap", cm.Name, "pod", pod.Name)
+	return cm, nil
+}
+
+// getAgentPod returns the most recent pod created by the agent job.
+// A job that was retried has a pod for each attempt.
+func (r *AgentActionReconciler) getAgentPod(ctx context.Context, job *batchv1.Job) (*corev1.Pod, error) {
+	var pods corev1.PodList
+	if err := r.apiReader().List(ctx, &pods, client.InNamespace(job.Namespace), client.MatchingLabels{batchv1.JobNameLabel: job.Name}); err != nil {
+		return nil, errors.Wrapf(err, "error listing the pods for job %s", job.Name)
+	}
+
+	var latest *corev1.Pod
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if latest == nil || latest.CreationTimestamp.Before(&pod.CreationTimestamp) {
+			latest = pod
+		}
+	}
+	return latest, nil
+}
+
+func (r *AgentActionReconciler) apiReader() client.Reader {
+	if r.APIReader == nil {
+		return r.Client
+	}
+	return r.APIReader
+}
+
+// truncateLogs keeps the end of the logs that fits within the maximum size,
+// starting at a line boundary.
+func truncateLogs(logs string, maxSize int) string {
+	if len(logs) <= maxSize {
+		return logs
+	}
+
+	logs = logs[len(logs)-maxSize:]
+	if i := strings.IndexByte(logs, '\n'); i >= 0 {
+		logs = logs[i+1:]
+	}
+	return logs
+}
@@ -0,0 +1,188 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	clientfake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+// testPodLogReader returns canned logs and records which pod was read.
+type testPodLogReader struct {
+	logs      string
+	err       error
+	pod       string
+	container string
+	tailLines int64
+}
+
+func (r *testPodLogReader) GetLogs(ctx context.Context, namespace string, pod string, container string, tailLines int64) ([]byte, error) {
+	r.pod = namespace + "/" + pod
+	r.container = container
+	r.tailLines = tailLines
+	return []byte(r.logs), r.err
+}
+
+func testAgentPod(name string, jobName string, created time.Time) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:         "test",
+			Name:              name,
+			Labels:            map[string]string{batchv1.JobNameLabel: jobName},
+			CreationTimestamp: metav1.NewTime(created),
+		},
+	}
+}
+
+func testFinishedJob(phase porterv1.AgentPhase) *batchv1.Job {
+	start := metav1.NewTime(time.Now().Add(-time.Minute))
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "porter-hello-abc"},
+		Status:     batchv1.JobStatus{StartTime: &start},
+	}
+	if phase == porterv1.PhaseFailed {
+		job.Status.Failed = 1
+		job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, LastTransitionTime: metav1.Now()}}
+	} else {
+		end := metav1.Now()
+		job.Status.Succeeded = 1
+		job.Status.CompletionTime = &end
+		job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}
+	}
+	return job
+}
+
+func TestAgentActionReconciler_syncStatus_CapturesLogs(t *testing.T) {
+	now := time.Now()
+	action := testAgentAction()
+	job := testFinishedJob(porterv1.PhaseFailed)
+	controller := setupAgentActionController(action,
+		testAgentPod("porter-hello-abc-1", job.Name, now.Add(-time.Minute)),
+		testAgentPod("porter-hello-abc-2", job.Name, now),
+		testAgentPod("other-job-pod", "other-job", now.Add(time.Minute)))
+	logReader := &testPodLogReader{logs: "Error: the bundle failed\n"}
+	controller.PodLogs = logReader
+
+	require.NoError(t, controller.syncStatus(context.Background(), logr.Discard(), action, job))
+
+	assert.Equal(t, "test/porter-hello-abc-2", logReader.pod, "the logs should be read from the most recent pod for the job")
+	assert.Equal(t, "porter-agent", logReader.container, "the logs should be read from the agent container")
+	assert.Equal(t, int64(agentLogTailLines), logReader.tailLines, "incorrect number of lines read")
+
+	require.NotNil(t, action.Status.Logs, "expected the logs to be linked from the action status")
+	assert.Equal(t, "porter-hello-logs", action.Status.Logs.Name)
+
+	var cm corev1.ConfigMap
+	require.NoError(t, controller.Get(context.Background(), types.NamespacedName{Namespace: "test", Name: "porter-hello-logs"}, &cm))
+	assert.Equal(t, "Error: the bundle failed\n", cm.Data[porterv1.AgentLogsKey])
+	require.Len(t, cm.OwnerReferences, 1, "expected the ConfigMap to be owned by the action")
+	assert.Equal(t, action.Name, cm.OwnerReferences[0].Name)
+	assertContains(t, cm.Labels, porterv1.LabelResourceName, action.Name, "incorrect label")
+
+	var saved porterv1.AgentAction
+	require.NoError(t, controller.Get(context.Background(), types.NamespacedName{Namespace: "test", Name: action.Name}, &saved))
+	assert.Equal(t, action.Status.Logs, saved.Status.Logs, "the logs link should be saved in the status")
+
+	recorder := controller.Recorder.(*record.FakeRecorder)
+	require.Len(t, recorder.Events, 1)
+	assert.Equal(t, "Warning AgentLogs the Porter Agent logs are in the ConfigMap porter-hello-logs", <-recorder.Events)
+
+	// The logs are only captured once, when the job finishes
+	logReader.pod = ""
+	require.NoError(t, controller.syncStatus(context.Background(), logr.Discard(), action, job))
+	assert.Empty(t, logReader.pod, "the logs should not be captured again")
+	assert.Equal(t, "porter-hello-logs", action.Status.Logs.Name, "the logs link should be kept")
+}
+
+func TestAgentActionReconciler_syncStatus_LogCaptureFails(t *testing.T) {
+	action := testAgentAction()
+	job := testFinishedJob(porterv1.PhaseSucceeded)
+	controller := setupAgentActionController(action, testAgentPod("porter-hello-abc-1", job.Name, time.Now()))
+	controller.PodLogs = &testPodLogReader{err: errors.New("pod not found")}
+
+	require.NoError(t, controller.syncStatus(context.Background(), logr.Discard(), action, job), "failing to capture logs should not fail the reconcile")
+	assert.Equal(t, porterv1.PhaseSucceeded, action.Status.Phase)
+	assert.Nil(t, action.Status.Logs)
+}
+
+func TestAgentActionReconciler_syncStatus_NoPods(t *testing.T) {
+	action := testAgentAction()
+	job := testFinishedJob(porterv1.PhaseSucceeded)
+	controller := setupAgentActionController(action)
+	logReader := &testPodLogReader{}
+	controller.PodLogs = logReader
+
+	require.NoError(t, controller.syncStatus(context.Background(), logr.Discard(), action, job))
+	assert.Empty(t, logReader.pod, "there are no pods to read logs from")
+	assert.Nil(t, action.Status.Logs)
+}
+
+func TestAgentActionReconciler_getAgentPod_UsesAPIReader(t *testing.T) {
+	job := testFinishedJob(porterv1.PhaseSucceeded)
+	controller := setupAgentActionController()
+	// Pods are read from the API server instead of the cached client
+	controller.APIReader = setupAgentActionController(testAgentPod("porter-hello-abc-1", job.Name, time.Now())).Client
+
+	pod, err := controller.getAgentPod(context.Background(), job)
+	require.NoError(t, err)
+	require.NotNil(t, pod, "expected the pod to be read with the APIReader")
+	assert.Equal(t, "porter-hello-abc-1", pod.Name)
+}
+
+func TestAgentActionReconciler_getAgentPod_DefaultsToClient(t *testing.T) {
+	job := testFinishedJob(porterv1.PhaseSucceeded)
+	controller := setupAgentActionController(testAgentPod("porter-hello-abc-1", job.Name, time.Now()))
+	controller.APIReader = nil
+
+	pod, err := controller.getAgentPod(context.Background(), job)
+	require.NoError(t, err)
+	require.NotNil(t, pod, "expected the pod to be read with the client when the APIReader is not set")
+	assert.Equal(t, "porter-hello-abc-1", pod.Name)
+}
+
+func TestKubernetesPodLogReader(t *testing.T) {
+	clientset := clientfake.NewSimpleClientset(testAgentPod("mypod", "myjob", time.Now()))
+	reader := NewPodLogReader(clientset)
+
+	logs, err := reader.GetLogs(context.Background(), "test", "mypod", "porter-agent", 10)
+	require.NoError(t, err)
+	assert.Equal(t, "fake logs", string(logs))
+}
+
+func TestTruncateLogs(t *testing.T) {
+	assert.Equal(t, "line 1\nline 2\n", truncateLogs("line 1\nline 2\n", 100), "logs under the limit should not be modified")
+	assert.Equal(t, "line 3\n", truncateLogs("line 1\nline 2\nline 3\n", 10), "only whole lines from the end should be kept")
+
+	long := strings.Repeat("a", 20)
+	assert.Equal(t, strings.Repeat("a", 10), truncateLogs(long, 10), "a line longer than the limit should be cut")
+}
+
+func TestApplyAgentAction_Logs(t *testing.T) {
+	inst := &porterv1.Installation{}
+	action := &porterv1.AgentAction{
+		ObjectMeta: metav1.ObjectMeta{Name: "myaction"},
+		Status: porterv1.AgentActionStatus{
+			Phase: porterv1.PhaseFailed,
+			Logs:  &corev1.LocalObjectReference{Name: "myaction-logs"},
+		},
+	}
+
+	applyAgentAction(logr.Discard(), inst, action)
+	require.NotNil(t, inst.Status.Logs)
+	assert.Equal(t, "myaction-logs", inst.Status.Logs.Name, "the logs should be linked from the resource status")
+
+	applyAgentAction(logr.Discard(), inst, nil)
+	assert.Nil(t, inst.Status.Logs, "the logs should be cleared when there is no action")
+}
@@ -19,11 +19,13 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/utils/ptr"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 )
 
 // +kubebuilder:rbac:groups=getporter.org,resources=agentconfigs,verbs=get;list;watch;create;update;patch;delete
@@ -35,11 +37,24 @@ import (
 // +kubebuilder:rbac:groups="",resources=serviceaccounts,verbs=get;list;watch
 // +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups="",resources=persistentvolumeclaims,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups="",resources=pods,verbs=get;list
+// +kubebuilder:rbac:groups="",resources=pods/log,verbs=get
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 
 type AgentActionReconciler struct {
 	client.Client
-	Log    logr.Logger
-	Scheme *runtime.Scheme
+	Log      logr.Logger
+	Recorder record.EventRecorder
+	Scheme   *runtime.Scheme
+
+	// PodLogs reads the Porter Agent logs when the job finishes.
+	// The logs are not captured when it is not set.
+	PodLogs PodLogReader
+
+	// APIReader reads the pods of an agent job directly from the API server,
+	// so that the operator does not cache every pod in the cluster. Defaults to the cached client.
+	APIReader client.Reader
 }
 
 // SetupWithManager sets up the controller with the Manager.
@@ -47,6 +62,9 @@ func (r *AgentActionReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&porterv1.AgentAction{}, builder.WithPredicates(resourceChanged{})).
 		Owns(&batchv1.Job{}).
+		Watches(&porterv1.AgentConfig{},
+			handler.EnqueueRequestsFromMapFunc(requestsForAgentConfig(r.Client, func() client.ObjectList { return &porterv1.AgentActionList{} })),
+			builder.WithPredicates(agentConfigSuspendChanged{})).
 		Complete(r)
 }
 
@@ -66,6 +84,12 @@ func (r *AgentActionReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		return ctrl.Result{Requeue: false}, err
 	}
 
+	// Do not start the agent job while the action is suspended, it is started when the action is resumed
+	if suspended, err := r.checkSuspended(ctx, log, action); err != nil || suspended {
+		log.V(Log4Debug).Info("Reconciliation skipped: The agent action is suspended.")
+		return ctrl.Result{}, err
+	}
+
 	if action.DeletionTimestamp != nil {
 		if controllerutil.ContainsFinalizer(action, porterv1.FinalizerName) {
 			controllerutil.RemoveFinalizer(action, porterv1.FinalizerName)
@@ -96,6 +120,13 @@ func (r *AgentActionReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 
 	// Check if we have already handled any spec changes
 	if handled {
+		// Remove the older actions of the resource once the agent has finished
+		if isFinished(action.Status.Phase) {
+			if err = r.pruneActions(ctx, log, action); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+
 		// Nothing for us to do at this point
 		log.V(Log4Debug).Info("Reconciliation complete: A porter agent has already been dispatched.")
 		return ctrl.Result{}, nil
@@ -111,6 +142,20 @@ func (r *AgentActionReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 	return ctrl.Result{}, nil
 }
 
+// checkSuspended records on the Suspended condition whether the action is suspended.
+// Returns true when the action is suspended and should not be reconciled.
+func (r *AgentActionReconciler) checkSuspended(ctx context.Context, log logr.Logger, action *porterv1.AgentAction) (bool, error) {
+	suspended, message, err := isSuspended(ctx, log, r.Client, action.Namespace, action.Spec.Suspend, action.Spec.AgentConfig)
+	if err != nil {
+		return false, err
+	}
+
+	if !applySuspended(r.Recorder, action, &action.Status.Conditions, suspended, message) {
+		return suspended, nil
+	}
+	return suspended, r.saveStatus(ctx, log, action)
+}
+
 // Determines if this generation of the AgentAction has being processed by Porter.
 func (r *AgentActionReconciler) isHandled(ctx context.Context, log logr.Logger, action *porterv1.AgentAction) (*batchv1.Job, bool, error) {
 	// Retrieve the Job running the porter action
@@ -139,6 +184,15 @@ func (r *AgentActionReconciler) syncStatus(ctx context.Context, log logr.Logger,
 
 	r.applyJobToStatus(log, action, job)
 
+	if !isFinished(origStatus.Phase) && isFinished(action.Status.Phase) {
+		if action.Status.Phase == porterv1.PhaseFailed {
+			r.applyFailureReason(ctx, log, action, job)
+		}
+		recordAgentJobDuration(action, job)
+		recordAgentJobSpan(ctx, action, job)
+		r.captureAgentLogs(ctx, log, action, job)
+	}
+
 	if !reflect.DeepEqual(origStatus, action.Status) {
 		return r.saveStatus(ctx, log, action)
 	}
@@ -183,13 +237,16 @@ func (r *AgentActionReconciler) applyJobToStatus(log logr.Logger, action *porter
 			setCondition(log, action, porterv1.ConditionComplete, "JobCompleted")
 		case batchv1.JobFailed:
 			action.Status.Phase = porterv1.PhaseFailed
-			setCondition(log, action, porterv1.ConditionFailed, "JobFailed")
+			setCondition(log, action, porterv1.ConditionFailed, porterv1.FailureReasonJobFailed)
 		}
 	}
 }
 
 // Create a job that runs the specified porter command in a job
-func (r *AgentActionReconciler) runPorter(ctx context.Context, log logr.Logger, action *porterv1.AgentAction) error {
+func (r *AgentActionReconciler) runPorter(ctx context.Context, log logr.Logger, action *porterv1.AgentAction) (err error) {
+	ctx, span := startAgentActionSpan(ctx, action)
+	defer func() { endSpan(span, err) }()
+
 	log.V(Log5Trace).Info("Porter agent requested", "namespace", action.Namespace, "action", action.Name)
 
 	agentCfg, err := r.resolveAgentConfig(ctx, log, action)
@@ -278,6 +335,11 @@ func (r *AgentActionReconciler) createAgentVolume(ctx context.Context, log logr.
 		pvc.Spec.StorageClassName = &storageClassName
 	}
 
+	// The volume is deleted along with the action
+	if err := controllerutil.SetControllerReference(action, pvc, r.Scheme); err != nil {
+		return nil, err
+	}
+
 	if err := r.Create(ctx, pvc); err != nil {
 		return nil, errors.Wrap(err, "error creating the agent volume (pvc)")
 	}
@@ -320,6 +382,11 @@ func (r *AgentActionReconciler) createConfigSecret(ctx context.Context, log logr
 		},
 	}
 
+	// The secret is deleted along with the action
+	if err := controllerutil.SetControllerReference(action, secret, r.Scheme); err != nil {
+		return nil, err
+	}
+
 	if err = r.Create(ctx, secret); err != nil {
 		return nil, errors.Wrap(err, "error creating the porter config secret")
 	}
@@ -354,6 +421,11 @@ func (r *AgentActionReconciler) createWorkdirSecret(ctx context.Context, log log
 		Data:      action.Spec.Files,
 	}
 
+	// The secret is deleted along with the action
+	if err := controllerutil.SetControllerReference(action, secret, r.Scheme); err != nil {
+		return nil, err
+	}
+
 	if err := r.Create(ctx, secret); err != nil {
 		return nil, errors.Wrap(err, "error creating the porter workdir secret")
 	}
@@ -411,6 +483,7 @@ func (r *AgentActionReconciler) createAgentJob(ctx context.Context, log logr.Log
 
 	labels := r.getAgentJobLabels(action)
 	env, envFrom := r.getAgentEnv(action, agentCfg, pvc)
+	env = append(env, getTraceEnv(ctx)...)
 	volumes, volumeMounts := r.getAgentVolumes(ctx, log, action, agentCfg, pvc, configSecret, workdirSecret, imgPullSecret)
 
 	porterJob := batchv1.Job{
@@ -432,7 +505,7 @@ func (r *AgentActionReconciler) createAgentJob(ctx context.Context, log logr.Log
 				Spec: corev1.PodSpec{
 					Containers: []corev1.Container{
 						{
-							Name:            "porter-agent",
+							Name:            agentContainerName,
 							Image:           agentCfg.GetPorterImage(),
 							ImagePullPolicy: agentCfg.GetPullPolicy(),
 							Command:         action.Spec.Command,
@@ -441,6 +514,8 @@ func (r *AgentActionReconciler) createAgentJob(ctx context.Context, log logr.Log
 							EnvFrom:         envFrom,
 							VolumeMounts:    volumeMounts,
 							WorkingDir:      porterv1.VolumePorterWorkDirPath,
+							// Include the end of the logs in the termination message so that we can report why Porter failed
+							TerminationMessagePolicy: corev1.TerminationMessageFallbackToLogsOnError,
 						},
 					},
 					Volumes: volumes,
@@ -462,6 +537,7 @@ func (r *AgentActionReconciler) createAgentJob(ctx context.Context, log logr.Log
 			},
 		},
 	}
+	injectTraceContext(ctx, &porterJob)
 	if err := controllerutil.SetControllerReference(action, &porterJob, r.Scheme); err != nil {
 		return batchv1.Job{}, err
 	}
@@ -485,6 +561,30 @@ func (r *AgentActionReconciler) createAgentJob(ctx context.Context, log logr.Log
 }
 
 func (r *AgentActionReconciler) resolveAgentConfig(ctx context.Context, log logr.Logger, action *porterv1.AgentAction) (porterv1.AgentConfigSpecAdapter, error) {
+	cfg, err := resolveAgentConfigSpec(ctx, log, r.Client, action.Namespace, action.Spec.AgentConfig)
+	if err != nil {
+		return porterv1.AgentConfigSpecAdapter{}, err
+	}
+
+	if !cfg.Status.Ready && !action.CreatedByAgentConfig() {
+		return porterv1.AgentConfigSpecAdapter{}, errors.New("resolved agent configuration is not ready to be used. Waiting for the next retry")
+	}
+	cfgList := porterv1.NewAgentConfigSpecAdapter(cfg.Spec)
+
+	log.V(Log4Debug).Info("resolved porter agent configuration",
+		"porterImage", cfgList.GetPorterImage(),
+		"pullPolicy", cfgList.GetPullPolicy(),
+		"serviceAccount", cfgList.GetServiceAccount(),
+		"volumeSize", cfgList.GetVolumeSize(),
+		"installationServiceAccount", cfgList.GetInstallationServiceAccount(),
+		"plugin", cfgList.Plugins.GetNames(),
+	)
+	return cfgList, nil
+}
+
+// resolveAgentConfigSpec merges the AgentConfig defined at the system level, the
+// namespace level and the override referenced by a resource.
+func resolveAgentConfigSpec(ctx context.Context, log logr.Logger, clnt client.Client, namespace string, override *corev1.LocalObjectReference) (porterv1.AgentConfig, error) {
 	log.V(Log5Trace).Info("Resolving porter agent configuration")
 
 	logConfig := func(level string, config *porterv1.AgentConfig) {
@@ -501,26 +601,26 @@ func (r *AgentActionReconciler) resolveAgentConfig(ctx context.Context, log logr
 
 	// Read agent configuration defined at the system level
 	systemCfg := &porterv1.AgentConfig{}
-	err := r.Get(ctx, types.NamespacedName{Name: "default", Namespace: operatorNamespace}, systemCfg)
+	err := clnt.Get(ctx, types.NamespacedName{Name: "default", Namespace: operatorNamespace}, systemCfg)
 	if err != nil && !apierrors.IsNotFound(err) {
-		return porterv1.AgentConfigSpecAdapter{}, errors.Wrap(err, "cannot retrieve system level porter agent configuration")
+		return porterv1.AgentConfig{}, errors.Wrap(err, "cannot retrieve system level porter agent configuration")
 	}
 	logConfig("system", systemCfg)
 
 	// Read agent configuration defined at the namespace level
 	nsCfg := &porterv1.AgentConfig{}
-	err = r.Get(ctx, types.NamespacedName{Name: "default", Namespace: action.Namespace}, nsCfg)
+	err = clnt.Get(ctx, types.NamespacedName{Name: "default", Namespace: namespace}, nsCfg)
 	if err != nil && !apierrors.IsNotFound(err) {
-		return porterv1.AgentConfigSpecAdapter{}, errors.Wrap(err, "cannot retrieve system level porter agent configuration")
+		return porterv1.AgentConfig{}, errors.Wrap(err, "cannot retrieve system level porter agent configuration")
 	}
 	logConfig("namespace", nsCfg)
 
 	// Read agent configuration override
 	instCfg := &porterv1.AgentConfig{}
-	if action.Spec.AgentConfig != nil {
-		err = r.Get(ctx, types.NamespacedName{Name: action.Spec.AgentConfig.Name, Namespace: action.Namespace}, instCfg)
+	if override != nil {
+		err = clnt.Get(ctx, types.NamespacedName{Name: override.Name, Namespace: namespace}, instCfg)
 		if err != nil && !apierrors.IsNotFound(err) {
-			return porterv1.AgentConfigSpecAdapter{}, errors.Wrap(err, "cannot retrieve system level porter agent configuration")
+			return porterv1.AgentConfig{}, errors.Wrap(err, "cannot retrieve system level porter agent configuration")
 		}
 		logConfig("instance", instCfg)
 	}
@@ -530,28 +630,16 @@ func (r *AgentActionReconciler) resolveAgentConfig(ctx context.Context, log logr
 	// for example, if namespace Spec.Plugins is {"azure": {}, "hashicorp": {}} and installation Spec.Plugins is {"kubernetes": {}}
 	// the result of the merge will be {"kubernetes": {}}
 	base := systemCfg
-	cfg, err := base.MergeConfigs(*nsCfg, *instCfg)
-	if err != nil {
-		return porterv1.AgentConfigSpecAdapter{}, err
-	}
-
-	if !cfg.Status.Ready && !action.CreatedByAgentConfig() {
-		return porterv1.AgentConfigSpecAdapter{}, errors.New("resolved agent configuration is not ready to be used. Waiting for the next retry")
-	}
-	cfgList := porterv1.NewAgentConfigSpecAdapter(cfg.Spec)
-
-	log.V(Log4Debug).Info("resolved porter agent configuration",
-		"porterImage", cfgList.GetPorterImage(),
-		"pullPolicy", cfgList.GetPullPolicy(),
-		"serviceAccount", cfgList.GetServiceAccount(),
-		"volumeSize", cfgList.GetVolumeSize(),
-		"installationServiceAccount", cfgList.GetInstallationServiceAccount(),
-		"plugin", cfgList.Plugins.GetNames(),
-	)
-	return cfgList, nil
+	return base.MergeConfigs(*nsCfg, *instCfg)
 }
 
 func (r *AgentActionReconciler) resolvePorterConfig(ctx context.Context, log logr.Logger, action *porterv1.AgentAction) (porterv1.PorterConfigSpec, error) {
+	return resolvePorterConfigSpec(ctx, log, r.Client, action.Namespace)
+}
+
+// resolvePorterConfigSpec merges the PorterConfig defined at the system level and
+// the namespace level with a safe default configuration.
+func resolvePorterConfigSpec(ctx context.Context, log logr.Logger, clnt client.Client, namespace string) (porterv1.PorterConfigSpec, error) {
 	log.V(Log5Trace).Info("Resolving porter configuration file")
 
 	logConfig := func(level string, config *porterv1.PorterConfig) {
@@ -579,7 +667,7 @@ func (r *AgentActionReconciler) resolvePorterConfig(ctx context.Context, log log
 
 	// Read agent configuration defined at the system level
 	systemCfg := &porterv1.PorterConfig{}
-	err := r.Get(ctx, types.NamespacedName{Name: "default", Namespace: operatorNamespace}, systemCfg)
+	err := clnt.Get(ctx, types.NamespacedName{Name: "default", Namespace: operatorNamespace}, systemCfg)
 	if err != nil && !apierrors.IsNotFound(err) {
 		return porterv1.PorterConfigSpec{}, errors.Wrap(err, "cannot retrieve system level porter agent configuration")
 	}
@@ -587,7 +675,7 @@ func (r *AgentActionReconciler) resolvePorterConfig(ctx context.Context, log log
 
 	// Read agent configuration defined at the namespace level
 	nsCfg := &porterv1.PorterConfig{}
-	err = r.Get(ctx, types.NamespacedName{Name: "default", Namespace: action.Namespace}, nsCfg)
+	err = clnt.Get(ctx, types.NamespacedName{Name: "default", Namespace: namespace}, nsCfg)
 	if err != nil && !apierrors.IsNotFound(err) {
 		return porterv1.PorterConfigSpec{}, errors.Wrap(err, "cannot retrieve namespace level porter agent configuration")
 	}
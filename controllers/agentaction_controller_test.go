@@ -16,6 +16,7 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/utils/ptr"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -119,6 +120,33 @@ func TestPorterResourceStatus_ApplyAgentAction(t *testing.T) {
 					{Type: string(v1.ConditionFailed), Status: metav1.ConditionTrue},
 				}},
 		},
+		{name: "resource conditions are preserved",
+			resource: &v1.Installation{
+				ObjectMeta: metav1.ObjectMeta{Generation: 1},
+				Status: v1.InstallationStatus{PorterResourceStatus: v1.PorterResourceStatus{
+					ObservedGeneration: 1,
+					Phase:              v1.PhaseSucceeded,
+					Conditions: []metav1.Condition{
+						{Type: string(v1.ConditionComplete), Status: metav1.ConditionTrue},
+						{Type: v1.ConditionDrifted, Status: metav1.ConditionTrue},
+					}}}},
+			action: &v1.AgentAction{
+				ObjectMeta: metav1.ObjectMeta{Name: "myaction"},
+				Status: v1.AgentActionStatus{
+					Phase: v1.PhaseRunning,
+					Conditions: []metav1.Condition{
+						{Type: string(v1.ConditionStarted), Status: metav1.ConditionTrue},
+					},
+				}},
+			wantStatus: v1.PorterResourceStatus{
+				ObservedGeneration: 1,
+				Action:             &corev1.LocalObjectReference{Name: "myaction"},
+				Phase:              v1.PhaseRunning,
+				Conditions: []metav1.Condition{
+					{Type: string(v1.ConditionStarted), Status: metav1.ConditionTrue},
+					{Type: v1.ConditionDrifted, Status: metav1.ConditionTrue},
+				}},
+		},
 		{name: "update resets status",
 			resource: &v1.Installation{
 				ObjectMeta: metav1.ObjectMeta{Generation: 2},
@@ -1040,8 +1068,10 @@ func setupAgentActionController(objs ...client.Object) AgentActionReconciler {
 	fakeClient := fakeBuilder.Build()
 
 	return AgentActionReconciler{
-		Log:    logr.Discard(),
-		Client: fakeClient,
-		Scheme: scheme,
+		Log:       logr.Discard(),
+		Client:    fakeClient,
+		APIReader: fakeClient,
+		Recorder:  record.NewFakeRecorder(42),
+		Scheme:    scheme,
 	}
 }
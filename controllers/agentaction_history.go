@@ -0,0 +1,112 @@
+package controllers
+
+import (
+	"context"
+	"sort"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// pruneActions deletes the oldest finished AgentActions created by the same
+// resource as the action, such as an Installation, when they exceed the history
+// limits of the resolved AgentConfig. The latest action of the resource is always
+// kept, and actions that have not finished are never deleted. Actions created by
+// a ScheduledAction are pruned by the ScheduledAction instead.
+func (r *AgentActionReconciler) pruneActions(ctx context.Context, log logr.Logger, action *porterv1.AgentAction) error {
+	owner := metav1.GetControllerOf(action)
+	if owner == nil || owner.Kind == porterv1.KindScheduledAction {
+		return nil
+	}
+
+	agentCfg, err := resolveAgentConfigSpec(ctx, log, r.Client, action.Namespace, action.Spec.AgentConfig)
+	if err != nil {
+		return err
+	}
+	cfg := porterv1.NewAgentConfigSpecAdapter(agentCfg.Spec)
+
+	results := porterv1.AgentActionList{}
+	if err = r.List(ctx, &results, client.InNamespace(action.Namespace)); err != nil {
+		return errors.Wrap(err, "could not query for the agent actions to prune")
+	}
+	var actions []porterv1.AgentAction
+	for _, item := range results.Items {
+		if ref := metav1.GetControllerOf(&item); ref != nil && ref.UID == owner.UID {
+			actions = append(actions, item)
+		}
+	}
+
+	// Sort from the latest to the oldest action
+	sort.SliceStable(actions, func(i, j int) bool {
+		return actions[j].CreationTimestamp.Before(&actions[i].CreationTimestamp)
+	})
+
+	remaining := map[porterv1.AgentPhase]int{
+		porterv1.PhaseSucceeded: cfg.GetSuccessfulActionsHistoryLimit(),
+		porterv1.PhaseFailed:    cfg.GetFailedActionsHistoryLimit(),
+	}
+	for i := range actions {
+		item := &actions[i]
+		if !isFinished(item.Status.Phase) {
+			continue
+		}
+		if i == 0 || remaining[item.Status.Phase] > 0 {
+			remaining[item.Status.Phase]--
+			continue
+		}
+
+		log.V(Log4Debug).Info("Removing agent action that exceeds the history limit", "agentaction", item.Name, "owner", owner.Name, "phase", item.Status.Phase)
+		if err = r.deleteAction(ctx, item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteAction deletes an AgentAction with the volume and secrets used by its
+// agent jobs. The job and the logs are owned by the action, and are deleted
+// along with it. Volumes and secrets created by earlier versions of the operator
+// are not owned by the action, so they are deleted explicitly.
+func (r *AgentActionReconciler) deleteAction(ctx context.Context, action *porterv1.AgentAction) error {
+	labels := getAgentResourceLabels(action)
+
+	var pvcs corev1.PersistentVolumeClaimList
+	if err := r.List(ctx, &pvcs, client.InNamespace(action.Namespace), client.MatchingLabels(labels)); err != nil {
+		return errors.Wrapf(err, "could not query for the agent volume (pvc) of %s", action.Name)
+	}
+	for i := range pvcs.Items {
+		if err := r.Delete(ctx, &pvcs.Items[i]); client.IgnoreNotFound(err) != nil {
+			return errors.Wrapf(err, "error removing the agent volume (pvc) %s", pvcs.Items[i].Name)
+		}
+	}
+
+	var secrets corev1.SecretList
+	if err := r.List(ctx, &secrets, client.InNamespace(action.Namespace), client.MatchingLabels(labels)); err != nil {
+		return errors.Wrapf(err, "could not query for the agent secrets of %s", action.Name)
+	}
+	for i := range secrets.Items {
+		if err := r.Delete(ctx, &secrets.Items[i]); client.IgnoreNotFound(err) != nil {
+			return errors.Wrapf(err, "error removing the agent secret %s", secrets.Items[i].Name)
+		}
+	}
+
+	err := r.Delete(ctx, action, client.PropagationPolicy(metav1.DeletePropagationBackground))
+	if client.IgnoreNotFound(err) != nil {
+		return errors.Wrapf(err, "error removing the agent action %s", action.Name)
+	}
+	return nil
+}
+
+// getAgentResourceLabels returns the labels that select the volume and secrets
+// created for every run of the action, including when it was retried.
+func getAgentResourceLabels(action *porterv1.AgentAction) map[string]string {
+	return map[string]string{
+		porterv1.LabelManaged:      "true",
+		porterv1.LabelResourceKind: "AgentAction",
+		porterv1.LabelResourceName: action.Name,
+	}
+}
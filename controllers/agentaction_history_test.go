@@ -0,0 +1,103 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	v1 "get.porter.sh/operator/api/v1"
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestAgentActionReconciler_pruneActions(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	owner := func(kind string, name string, uid types.UID) metav1.OwnerReference {
+		return metav1.OwnerReference{APIVersion: v1.GroupVersion.String(), Kind: kind, Name: name, UID: uid, Controller: ptr.To(true)}
+	}
+	newAction := func(name string, owner metav1.OwnerReference, age time.Duration, phase v1.AgentPhase) *v1.AgentAction {
+		return &v1.AgentAction{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:         "test",
+				Name:              name,
+				CreationTimestamp: metav1.NewTime(now.Add(-age)),
+				OwnerReferences:   []metav1.OwnerReference{owner},
+			},
+			Status: v1.AgentActionStatus{Phase: phase},
+		}
+	}
+	agentResources := func(action *v1.AgentAction) (*corev1.PersistentVolumeClaim, *corev1.Secret) {
+		// Created by an earlier version of the operator, without an owner reference
+		meta := metav1.ObjectMeta{Namespace: "test", Name: action.Name + "-abcde", Labels: getAgentResourceLabels(action)}
+		return &corev1.PersistentVolumeClaim{ObjectMeta: meta}, &corev1.Secret{ObjectMeta: meta}
+	}
+
+	mysql := owner("Installation", "mysql", "mysql-uid")
+	oldestSucceeded := newAction("mysql-1", mysql, 6*time.Hour, v1.PhaseSucceeded)
+	oldestFailed := newAction("mysql-2", mysql, 5*time.Hour, v1.PhaseFailed)
+	succeeded := newAction("mysql-3", mysql, 4*time.Hour, v1.PhaseSucceeded)
+	failed := newAction("mysql-4", mysql, 3*time.Hour, v1.PhaseFailed)
+	running := newAction("mysql-5", mysql, 2*time.Hour, v1.PhaseRunning)
+	latest := newAction("mysql-6", mysql, time.Hour, v1.PhaseFailed)
+	otherInstallation := newAction("wordpress-1", owner("Installation", "wordpress", "wordpress-uid"), 7*time.Hour, v1.PhaseSucceeded)
+	scheduled := newAction("backup-1", owner(v1.KindScheduledAction, "backup", "backup-uid"), 7*time.Hour, v1.PhaseSucceeded)
+	nsCfg := &v1.AgentConfig{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "default"},
+		Spec:       v1.AgentConfigSpec{SuccessfulActionsHistoryLimit: ptr.To(int32(1)), FailedActionsHistoryLimit: ptr.To(int32(0))},
+	}
+	oldPVC, oldSecret := agentResources(oldestSucceeded)
+	keptPVC, keptSecret := agentResources(succeeded)
+
+	controller := setupAgentActionController(oldestSucceeded, oldestFailed, succeeded, failed, running, latest,
+		otherInstallation, scheduled, nsCfg, oldPVC, oldSecret, keptPVC, keptSecret)
+
+	require.NoError(t, controller.pruneActions(ctx, logr.Discard(), latest))
+
+	exists := func(obj client.Object) bool {
+		err := controller.Get(ctx, client.ObjectKeyFromObject(obj), obj)
+		require.NoError(t, client.IgnoreNotFound(err))
+		return err == nil
+	}
+	assert.True(t, exists(latest), "the latest action should be kept even though it exceeds the failed history limit")
+	assert.True(t, exists(running), "actions that have not finished should be kept")
+	assert.True(t, exists(succeeded), "the most recent successful action should be kept")
+	assert.False(t, exists(oldestSucceeded), "successful actions that exceed the history limit should be removed")
+	assert.False(t, exists(oldestFailed), "failed actions that exceed the history limit should be removed")
+	assert.False(t, exists(failed), "failed actions that exceed the history limit should be removed")
+	assert.True(t, exists(otherInstallation), "actions for other resources should not be pruned")
+
+	assert.False(t, exists(oldPVC), "the volume of a removed action should be removed")
+	assert.False(t, exists(oldSecret), "the secrets of a removed action should be removed")
+	assert.True(t, exists(keptPVC))
+	assert.True(t, exists(keptSecret))
+
+	// Actions created by a ScheduledAction are pruned by the ScheduledAction instead
+	scheduledLatest := newAction("backup-2", owner(v1.KindScheduledAction, "backup", "backup-uid"), time.Hour, v1.PhaseSucceeded)
+	require.NoError(t, controller.Create(ctx, scheduledLatest))
+	require.NoError(t, controller.pruneActions(ctx, logr.Discard(), scheduledLatest))
+	assert.True(t, exists(scheduled), "the limits of the AgentConfig should not apply to scheduled actions")
+}
+
+func TestAgentActionReconciler_createAgentVolume_Owned(t *testing.T) {
+	ctx := context.Background()
+	action := testAgentAction()
+	controller := setupAgentActionController(action)
+
+	pvc, err := controller.createAgentVolume(ctx, logr.Discard(), action, v1.NewAgentConfigSpecAdapter(v1.AgentConfigSpec{}))
+	require.NoError(t, err)
+	assert.True(t, metav1.IsControlledBy(pvc, action), "the volume should be deleted with the action")
+	for k, v := range getAgentResourceLabels(action) {
+		assert.Equal(t, v, pvc.Labels[k], "the volume should be selected when the action is pruned")
+	}
+
+	secret, err := controller.createWorkdirSecret(ctx, logr.Discard(), action)
+	require.NoError(t, err)
+	assert.True(t, metav1.IsControlledBy(secret, action), "the secret should be deleted with the action")
+}
@@ -14,6 +14,7 @@ import (
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/utils/ptr"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
@@ -24,8 +25,9 @@ import (
 // AgentConfigReconciler calls porter to execute changes made to an AgentConfig CRD
 type AgentConfigReconciler struct {
 	client.Client
-	Log    logr.Logger
-	Scheme *runtime.Scheme
+	Log      logr.Logger
+	Recorder record.EventRecorder
+	Scheme   *runtime.Scheme
 }
 
 //+kubebuilder:rbac:groups=getporter.org,resources=agentconfigs,verbs=get;list;watch;create;update;patch;delete
@@ -294,6 +296,7 @@ func (r *AgentConfigReconciler) createAgentAction(ctx context.Context, log logr.
 		return nil, errors.Wrap(err, "error creating the porter agent action")
 	}
 
+	r.Recorder.Event(&agentCfg.AgentConfig, "Normal", "CreateAgentAction", fmt.Sprintf("created agent action %s to install plugins", action.Name))
 	log.V(Log4Debug).Info("Created porter agent action", "name", action.Name)
 	return action, nil
 }
@@ -310,6 +313,10 @@ func (r *AgentConfigReconciler) syncStatus(ctx context.Context, log logr.Logger,
 		agentCfg.Status.Ready = false
 	}
 
+	if !isFinished(origStatus.Phase) && isFinished(agentCfg.Status.Phase) {
+		recordPluginInstallDuration(action)
+	}
+
 	if !reflect.DeepEqual(origStatus, agentCfg.Status) {
 		return r.saveStatus(ctx, log, agentCfg)
 	}
@@ -343,6 +350,7 @@ func (r *AgentConfigReconciler) retry(ctx context.Context, log logr.Logger, agen
 	}
 
 	log.V(Log4Debug).Info("Retried associated porter agent action", "name", "retry", action.Name, retry)
+	retries.WithLabelValues("AgentConfig", agentCfg.Namespace).Inc()
 	return nil
 }
 
@@ -18,6 +18,7 @@ import (
 	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/utils/ptr"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -817,6 +818,10 @@ func TestAgentConfigReconciler_createAgentAction(t *testing.T) {
 	assert.Equal(t, action.Spec.VolumeMounts[0].Name, porterv1.VolumePorterPluginsName, "incorrect VolumeMounts")
 	assert.Equal(t, action.Spec.VolumeMounts[0].MountPath, porterv1.VolumePorterPluginsPath, "incorrect VolumeMounts")
 	assert.Equal(t, action.Spec.VolumeMounts[0].SubPath, "plugins", "incorrect VolumeMounts")
+
+	recorder := controller.Recorder.(*record.FakeRecorder)
+	require.Len(t, recorder.Events, 1)
+	assert.Equal(t, "Normal CreateAgentAction created agent action "+action.Name+" to install plugins", <-recorder.Events)
 }
 
 func TestRenamePluginVolume(t *testing.T) {
@@ -882,8 +887,9 @@ func setupAgentConfigController(objs ...client.Object) *AgentConfigReconciler {
 	fakeClient := fakeBuilder.Build()
 
 	return &AgentConfigReconciler{
-		Log:    logr.Discard(),
-		Client: fakeClient,
-		Scheme: scheme,
+		Log:      logr.Discard(),
+		Client:   fakeClient,
+		Recorder: record.NewFakeRecorder(42),
+		Scheme:   scheme,
 	}
 }
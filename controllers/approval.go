@@ -0,0 +1,178 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+
+	v1 "get.porter.sh/operator/api/v1"
+	"github.com/go-logr/logr"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// planInstallation runs the porter agent with the command `porter installation apply --dry-run`,
+// so that the change to the installation can be approved before it is applied.
+func (r *InstallationReconciler) planInstallation(ctx context.Context, log logr.Logger, inst *v1.Installation) error {
+	log.V(Log5Trace).Info("Initializing installation status")
+	inst.Status.Initialize()
+	inst.Status.RetryAttempts = 0
+	inst.Status.NextRetryTime = nil
+	if err := r.saveStatus(ctx, log, inst); err != nil {
+		return err
+	}
+
+	// Evaluate the change without executing the bundle
+	log.V(Log5Trace).Info("Setting dryRun=true to plan the change to the installation")
+	inst.Spec.DryRun = true
+
+	return r.runPorter(ctx, log, inst)
+}
+
+// checkApproval applies the installation once its plan is approved, and
+// reports that the plan is waiting for approval or has expired otherwise.
+func (r *InstallationReconciler) checkApproval(ctx context.Context, log logr.Logger, inst *v1.Installation, action *v1.AgentAction) (ctrl.Result, error) {
+	plan := inst.Status.Plan
+	if action.Status.Phase != v1.PhaseSucceeded || plan == nil || plan.AgentAction.Name != action.Name {
+		log.V(Log4Debug).Info("Reconciliation complete: Waiting for the change to the installation to be planned.")
+		return ctrl.Result{}, nil
+	}
+
+	policy, err := r.resolveApprovalPolicy(ctx, log, inst)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if !policy.IsRequired() {
+		log.V(Log4Debug).Info("Reconciliation complete: A porter agent has been dispatched to apply the plan because approval is no longer required.")
+		return ctrl.Result{}, r.applyInstallation(ctx, log, inst)
+	}
+
+	origStatus := inst.Status.DeepCopy()
+	now := r.now()
+	if timeout := policy.GetTimeout(); timeout > 0 && plan.ExpiryTime == nil {
+		plan.ExpiryTime = &metav1.Time{Time: plan.PlanTime.Add(timeout).Truncate(time.Second)}
+	}
+
+	if isPlanExpired(plan, now) {
+		if setApprovalCondition(inst, "Expired", fmt.Sprintf("the plan for generation %d expired at %s without being approved, retry the installation to plan it again", inst.Generation, plan.ExpiryTime.UTC().Format(time.RFC3339))) {
+			r.Recorder.Event(inst, "Warning", "ApprovalExpired", fmt.Sprintf("the plan for generation %d of %s expired without being approved", inst.Generation, inst.Name))
+		}
+		applyApprovalPhase(inst, action, now)
+		log.V(Log4Debug).Info("Reconciliation complete: The plan expired without being approved.")
+		return ctrl.Result{}, r.saveStatusIfChanged(ctx, log, inst, origStatus)
+	}
+
+	if approvedBy, ok := getApproval(inst); ok {
+		inst.Status.Approval = &v1.InstallationApproval{
+			Generation:   inst.Generation,
+			ApprovedBy:   approvedBy,
+			ApprovalTime: metav1.NewTime(now),
+		}
+		r.Recorder.Event(inst, "Normal", "Approved", fmt.Sprintf("the plan for generation %d of %s was approved by %s", inst.Generation, inst.Name, approvedBy))
+		log.V(Log4Debug).Info("Reconciliation complete: A porter agent has been dispatched to apply the approved plan.", "approvedBy", approvedBy)
+		return ctrl.Result{}, r.applyInstallation(ctx, log, inst)
+	}
+
+	if setApprovalCondition(inst, "PendingApproval", fmt.Sprintf("approve the plan by setting the %s annotation to %d", v1.AnnotationApprove, inst.Generation)) {
+		r.Recorder.Event(inst, "Normal", "PendingApproval", fmt.Sprintf("porter would run the %s action, the plan for generation %d of %s is waiting for approval", plan.Action, inst.Generation, inst.Name))
+	}
+	applyApprovalPhase(inst, action, now)
+	if err = r.saveStatusIfChanged(ctx, log, inst, origStatus); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	log.V(Log4Debug).Info("Reconciliation complete: The plan is waiting for approval.")
+	if plan.ExpiryTime != nil {
+		return ctrl.Result{RequeueAfter: plan.ExpiryTime.Sub(now)}, nil
+	}
+	return ctrl.Result{}, nil
+}
+
+// resolveApprovalPolicy returns the approval policy defined on the installation, or its AgentConfig.
+func (r *InstallationReconciler) resolveApprovalPolicy(ctx context.Context, log logr.Logger, inst *v1.Installation) (*v1.ApprovalPolicy, error) {
+	if inst.Spec.ApprovalPolicy != nil {
+		return inst.Spec.ApprovalPolicy, nil
+	}
+
+	agentCfg, err := resolveAgentConfigSpec(ctx, log, r.Client, inst.Namespace, inst.Spec.AgentConfig)
+	if err != nil {
+		return nil, err
+	}
+	return v1.NewAgentConfigSpecAdapter(agentCfg.Spec).GetApprovalPolicy(), nil
+}
+
+func (r *InstallationReconciler) saveStatusIfChanged(ctx context.Context, log logr.Logger, inst *v1.Installation, origStatus *v1.InstallationStatus) error {
+	if reflect.DeepEqual(*origStatus, inst.Status) {
+		return nil
+	}
+	return r.saveStatus(ctx, log, inst)
+}
+
+// applyApprovalPhase sets the phase of an installation whose plan is waiting
+// for approval. A plan that expired before it was approved, at the specified
+// time, has failed.
+func applyApprovalPhase(inst *v1.Installation, action *v1.AgentAction, now time.Time) {
+	if !isAwaitingApproval(inst, action) {
+		return
+	}
+
+	if isPlanExpired(inst.Status.Plan, now) {
+		inst.Status.Phase = v1.PhaseFailed
+	} else {
+		inst.Status.Phase = v1.PhasePendingApproval
+	}
+}
+
+// isAwaitingApproval determines if the action planned the current generation
+// of the installation, and the plan has not been approved yet.
+func isAwaitingApproval(inst *v1.Installation, action *v1.AgentAction) bool {
+	if inst.Spec.DryRun || action == nil || !isDryRunAction(action) || action.Status.Phase != v1.PhaseSucceeded {
+		return false
+	}
+
+	plan := inst.Status.Plan
+	if plan == nil || plan.AgentAction.Name != action.Name {
+		return false
+	}
+
+	approval := inst.Status.Approval
+	return approval == nil || approval.Generation != inst.Generation
+}
+
+func isPlanExpired(plan *v1.InstallationPlan, now time.Time) bool {
+	return plan.ExpiryTime != nil && !now.Before(plan.ExpiryTime.Time)
+}
+
+// getApproval returns who approved the current generation of the installation,
+// when the approve annotation is set to the generation.
+func getApproval(inst *v1.Installation) (string, bool) {
+	generation, err := strconv.ParseInt(inst.Annotations[v1.AnnotationApprove], 10, 64)
+	if err != nil || generation != inst.Generation {
+		return "", false
+	}
+
+	approvedBy := inst.Annotations[v1.AnnotationApprovedBy]
+	if approvedBy == "" {
+		approvedBy = "unknown"
+	}
+	return approvedBy, true
+}
+
+// setApprovalCondition sets the Approved condition to false with the specified
+// reason, and returns whether the reason changed.
+func setApprovalCondition(inst *v1.Installation, reason string, message string) bool {
+	cond := apimeta.FindStatusCondition(inst.Status.Conditions, v1.ConditionApproved)
+	changed := cond == nil || cond.Reason != reason || cond.ObservedGeneration != inst.Generation
+
+	apimeta.SetStatusCondition(&inst.Status.Conditions, metav1.Condition{
+		Type:               v1.ConditionApproved,
+		Status:             metav1.ConditionFalse,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: inst.Generation,
+	})
+	return changed
+}
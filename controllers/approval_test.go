@@ -0,0 +1,235 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	v1 "get.porter.sh/operator/api/v1"
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	clocktesting "k8s.io/utils/clock/testing"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func testApprovalInstallation() *v1.Installation {
+	inst := testInstallation("test", "mysql")
+	inst.Spec.ApprovalPolicy = &v1.ApprovalPolicy{Required: true, Timeout: &metav1.Duration{Duration: time.Hour}}
+	return inst
+}
+
+// drainEvents returns the events that were recorded.
+func drainEvents(recorder *record.FakeRecorder) []string {
+	var events []string
+	for {
+		select {
+		case e := <-recorder.Events:
+			events = append(events, e)
+		default:
+			return events
+		}
+	}
+}
+
+func TestInstallationReconciler_Reconcile_Approval(t *testing.T) {
+	ctx := context.Background()
+	controller := setupInstallationController(testApprovalInstallation())
+	recorder := controller.Recorder.(*record.FakeRecorder)
+
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "test", Name: "mysql"}}
+	var inst v1.Installation
+	reconcile := func() ctrl.Result {
+		result, err := controller.Reconcile(ctx, req)
+		require.NoError(t, err)
+		require.NoError(t, controller.Get(ctx, req.NamespacedName, &inst))
+		return result
+	}
+
+	// The change is planned with a dry-run
+	reconcile()
+	require.NotNil(t, inst.Status.Action, "expected an agent action to plan the change")
+	var planAction v1.AgentAction
+	require.NoError(t, controller.Get(ctx, client.ObjectKey{Namespace: "test", Name: inst.Status.Action.Name}, &planAction))
+	assert.True(t, isDryRunAction(&planAction), "the change should be planned with a dry-run")
+
+	// Finish the dry-run
+	logs := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: planAction.Name + "-logs"},
+		Data:       map[string]string{v1.AgentLogsKey: "The installation is out-of-sync, running the install action...\n"},
+	}
+	require.NoError(t, controller.Create(ctx, logs))
+	planAction.Status.Phase = v1.PhaseSucceeded
+	planAction.Status.Logs = &corev1.LocalObjectReference{Name: logs.Name}
+	require.NoError(t, controller.Update(ctx, &planAction))
+
+	// The plan waits for approval
+	result := reconcile()
+	require.NotNil(t, inst.Status.Plan, "expected the plan to be recorded")
+	assert.Equal(t, v1.PlanActionInstall, inst.Status.Plan.Action)
+	require.NotNil(t, inst.Status.Plan.ExpiryTime, "expected the plan to expire")
+	assert.Equal(t, v1.PhasePendingApproval, inst.Status.Phase)
+	approved := apimeta.FindStatusCondition(inst.Status.Conditions, v1.ConditionApproved)
+	require.NotNil(t, approved, "expected the Approved condition")
+	assert.Equal(t, metav1.ConditionFalse, approved.Status)
+	assert.Equal(t, "PendingApproval", approved.Reason)
+	assert.True(t, result.RequeueAfter > 0 && result.RequeueAfter <= time.Hour, "expected to be requeued when the plan expires, got %s", result.RequeueAfter)
+	assert.Contains(t, drainEvents(recorder), "Normal PendingApproval porter would run the install action, the plan for generation 1 of mysql is waiting for approval")
+
+	// Reconciling again does not change anything
+	reconcile()
+	assert.Equal(t, v1.PhasePendingApproval, inst.Status.Phase)
+	assert.Empty(t, drainEvents(recorder))
+
+	// Approving another generation does not apply the plan
+	inst.Annotations = map[string]string{v1.AnnotationApprove: "2"}
+	require.NoError(t, controller.Update(ctx, &inst))
+	reconcile()
+	assert.Equal(t, planAction.Name, inst.Status.Action.Name, "the plan should not be applied")
+
+	// Approve the plan
+	inst.Annotations = map[string]string{v1.AnnotationApprove: "1", v1.AnnotationApprovedBy: "alice"}
+	require.NoError(t, controller.Update(ctx, &inst))
+	reconcile()
+
+	require.NotNil(t, inst.Status.Approval, "expected the approval to be recorded")
+	assert.Equal(t, int64(1), inst.Status.Approval.Generation)
+	assert.Equal(t, "alice", inst.Status.Approval.ApprovedBy)
+	assert.False(t, inst.Status.Approval.ApprovalTime.IsZero())
+	assert.Contains(t, drainEvents(recorder), "Normal Approved the plan for generation 1 of mysql was approved by alice")
+
+	require.NotNil(t, inst.Status.Action)
+	assert.NotEqual(t, planAction.Name, inst.Status.Action.Name, "expected a new agent action to apply the plan")
+	applyAction, handled, err := controller.isHandled(ctx, logr.Discard(), &inst)
+	require.NoError(t, err)
+	require.True(t, handled)
+	assert.Equal(t, inst.Status.Action.Name, applyAction.Name, "the action that applies the plan should be the current action")
+	assert.False(t, isDryRunAction(applyAction), "the approved plan should be applied")
+	assert.NotNil(t, inst.Status.Plan, "the plan should be kept after it is approved")
+}
+
+func TestInstallationReconciler_checkApproval_Expired(t *testing.T) {
+	ctx := context.Background()
+	planTime := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	inst := testApprovalInstallation()
+	inst.Annotations = map[string]string{v1.AnnotationApprove: "1"}
+	action := &v1.AgentAction{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "mysql-abc"},
+		Spec:       v1.AgentActionSpec{Args: []string{"installation", "apply", "installation.yaml", dryRunFlag}},
+		Status:     v1.AgentActionStatus{Phase: v1.PhaseSucceeded},
+	}
+	inst.Status.Plan = &v1.InstallationPlan{
+		Generation:  1,
+		AgentAction: corev1.LocalObjectReference{Name: action.Name},
+		Action:      v1.PlanActionUpgrade,
+		PlanTime:    metav1.NewTime(planTime),
+	}
+	controller := setupInstallationController(inst, action)
+	controller.Clock = clocktesting.NewFakePassiveClock(planTime.Add(2 * time.Hour))
+
+	result, err := controller.checkApproval(ctx, logr.Discard(), inst, action)
+	require.NoError(t, err)
+	assert.True(t, result.IsZero(), "an expired plan should not be requeued")
+	require.NotNil(t, inst.Status.Plan.ExpiryTime)
+	assert.Equal(t, planTime.Add(time.Hour), inst.Status.Plan.ExpiryTime.Time.UTC())
+
+	assert.Equal(t, v1.PhaseFailed, inst.Status.Phase, "an expired plan has failed")
+	assert.Nil(t, inst.Status.Approval, "an expired plan should not be approved")
+	approved := apimeta.FindStatusCondition(inst.Status.Conditions, v1.ConditionApproved)
+	require.NotNil(t, approved, "expected the Approved condition")
+	assert.Equal(t, "Expired", approved.Reason)
+
+	events := drainEvents(controller.Recorder.(*record.FakeRecorder))
+	require.Len(t, events, 1)
+	assert.True(t, strings.HasPrefix(events[0], "Warning ApprovalExpired"), "unexpected event %s", events[0])
+
+	var actions v1.AgentActionList
+	require.NoError(t, controller.List(ctx, &actions))
+	assert.Len(t, actions.Items, 1, "the expired plan should not be applied")
+}
+
+func TestInstallationReconciler_checkApproval_NoLongerRequired(t *testing.T) {
+	ctx := context.Background()
+	inst := testApprovalInstallation()
+	inst.Spec.ApprovalPolicy = nil
+	action := &v1.AgentAction{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "mysql-abc"},
+		Spec:       v1.AgentActionSpec{Args: []string{"installation", "apply", "installation.yaml", dryRunFlag}},
+		Status:     v1.AgentActionStatus{Phase: v1.PhaseSucceeded},
+	}
+	inst.Status.Plan = &v1.InstallationPlan{Generation: 1, AgentAction: corev1.LocalObjectReference{Name: action.Name}, PlanTime: metav1.Now()}
+	inst.TypeMeta = metav1.TypeMeta{APIVersion: v1.GroupVersion.String(), Kind: "Installation"}
+	controller := setupInstallationController(inst, action)
+
+	_, err := controller.checkApproval(ctx, logr.Discard(), inst, action)
+	require.NoError(t, err)
+
+	var actions v1.AgentActionList
+	require.NoError(t, controller.List(ctx, &actions))
+	assert.Len(t, actions.Items, 2, "the plan should be applied when approval is no longer required")
+}
+
+func TestGetApproval(t *testing.T) {
+	inst := &v1.Installation{ObjectMeta: metav1.ObjectMeta{Generation: 3}}
+
+	_, ok := getApproval(inst)
+	assert.False(t, ok, "no approval annotation")
+
+	inst.Annotations = map[string]string{v1.AnnotationApprove: "true"}
+	_, ok = getApproval(inst)
+	assert.False(t, ok, "the approval must be for a generation")
+
+	inst.Annotations = map[string]string{v1.AnnotationApprove: "3"}
+	approvedBy, ok := getApproval(inst)
+	assert.True(t, ok)
+	assert.Equal(t, "unknown", approvedBy)
+
+	inst.Annotations[v1.AnnotationApprovedBy] = "alice"
+	approvedBy, _ = getApproval(inst)
+	assert.Equal(t, "alice", approvedBy)
+}
+
+func TestApprovalPolicy(t *testing.T) {
+	var policy *v1.ApprovalPolicy
+	assert.False(t, policy.IsRequired())
+	assert.Zero(t, policy.GetTimeout())
+
+	policy = &v1.ApprovalPolicy{Required: true, Timeout: &metav1.Duration{Duration: time.Hour}}
+	assert.True(t, policy.IsRequired())
+	assert.Equal(t, time.Hour, policy.GetTimeout())
+}
+
+func TestApplyApprovalPhase(t *testing.T) {
+	planTime := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	action := &v1.AgentAction{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "mysql-abc"},
+		Spec:       v1.AgentActionSpec{Args: []string{"installation", "apply", "installation.yaml", dryRunFlag}},
+		Status:     v1.AgentActionStatus{Phase: v1.PhaseSucceeded},
+	}
+	newInstallation := func() *v1.Installation {
+		inst := testApprovalInstallation()
+		inst.Status.Phase = v1.PhaseSucceeded
+		inst.Status.Plan = &v1.InstallationPlan{
+			Generation:  1,
+			AgentAction: corev1.LocalObjectReference{Name: action.Name},
+			PlanTime:    metav1.NewTime(planTime),
+			ExpiryTime:  &metav1.Time{Time: planTime.Add(time.Hour)},
+		}
+		return inst
+	}
+
+	inst := newInstallation()
+	applyApprovalPhase(inst, action, planTime.Add(59*time.Minute))
+	assert.Equal(t, v1.PhasePendingApproval, inst.Status.Phase, "the plan should wait for approval until it expires")
+
+	inst = newInstallation()
+	applyApprovalPhase(inst, action, planTime.Add(time.Hour+time.Second))
+	assert.Equal(t, v1.PhaseFailed, inst.Status.Phase, "a plan that expired has failed")
+}
@@ -0,0 +1,302 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	v1 "get.porter.sh/operator/api/v1"
+	"github.com/Masterminds/semver/v3"
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	"github.com/robfig/cron/v3"
+	corev1 "k8s.io/api/core/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// checkBundleUpdate checks the registry for a new bundle that satisfies the update
+// policy of the installation, reports it on the UpdateAvailable condition, and
+// updates the installation when the policy allows it. The result requeues the
+// installation for the next check.
+func (r *InstallationReconciler) checkBundleUpdate(ctx context.Context, log logr.Logger, inst *v1.Installation) (ctrl.Result, error) {
+	if isDeleted(inst) {
+		return ctrl.Result{}, nil
+	}
+
+	origStatus := inst.Status.DeepCopy()
+
+	policy := inst.Spec.UpdatePolicy
+	if policy == nil || inst.Spec.Uninstalled {
+		// Clean up after a policy that was removed
+		apimeta.RemoveStatusCondition(&inst.Status.Conditions, v1.ConditionUpdateAvailable)
+		inst.Status.AvailableUpdate = nil
+		inst.Status.LastUpdateCheckTime = nil
+		return ctrl.Result{}, r.saveStatusIfChanged(ctx, log, inst, origStatus)
+	}
+
+	log.V(Log5Trace).Info("Checking for bundle updates")
+	now := r.now()
+	interval := policy.GetInterval()
+
+	// Check right away when the installation changed, otherwise wait for the interval
+	update := inst.Status.AvailableUpdate
+	cond := apimeta.FindStatusCondition(inst.Status.Conditions, v1.ConditionUpdateAvailable)
+	if cond == nil || cond.ObservedGeneration != inst.Generation || inst.Status.LastUpdateCheckTime == nil ||
+		!now.Before(inst.Status.LastUpdateCheckTime.Add(interval)) {
+		log.V(Log5Trace).Info("Checking the registry for a new bundle", "repository", inst.Spec.Bundle.Repository)
+		var err error
+		update, err = r.findUpdate(ctx, inst.Namespace, inst.Spec.Bundle, *policy)
+		if err != nil {
+			log.V(Log4Debug).Info("Unable to check the registry for a new bundle", "error", err.Error())
+			r.Recorder.Event(inst, "Warning", "UpdateCheckFailed", fmt.Sprintf("unable to check for a new bundle: %s", err))
+			setUpdateCondition(inst, metav1.ConditionUnknown, "CheckFailed", err.Error())
+			inst.Status.LastUpdateCheckTime = &metav1.Time{Time: now}
+			return ctrl.Result{RequeueAfter: interval}, r.saveStatusIfChanged(ctx, log, inst, origStatus)
+		}
+		inst.Status.LastUpdateCheckTime = &metav1.Time{Time: now}
+		inst.Status.AvailableUpdate = update
+	}
+	nextCheck := inst.Status.LastUpdateCheckTime.Add(interval).Sub(now)
+
+	if update == nil {
+		setUpdateCondition(inst, metav1.ConditionFalse, "UpToDate", "the installation is using the newest bundle")
+		log.V(Log5Trace).Info("The bundle is up-to-date.")
+		return ctrl.Result{RequeueAfter: nextCheck}, r.saveStatusIfChanged(ctx, log, inst, origStatus)
+	}
+
+	ref := formatBundleReference(*update)
+	log = log.WithValues("update", ref)
+	if !apimeta.IsStatusConditionTrue(inst.Status.Conditions, v1.ConditionUpdateAvailable) {
+		r.Recorder.Event(inst, "Normal", "UpdateAvailable", fmt.Sprintf("a new bundle is available: %s", ref))
+	}
+
+	if policy.GetMode() != v1.BundleUpdateApply {
+		setUpdateCondition(inst, metav1.ConditionTrue, "UpdateAvailable", fmt.Sprintf("a new bundle is available: %s", ref))
+		log.V(Log4Debug).Info("A new bundle is available.")
+		return ctrl.Result{RequeueAfter: nextCheck}, r.saveStatusIfChanged(ctx, log, inst, origStatus)
+	}
+
+	open, opens, err := getMaintenanceWindow(policy.MaintenanceWindow, now)
+	if err != nil {
+		r.Recorder.Event(inst, "Warning", "InvalidMaintenanceWindow", err.Error())
+		setUpdateCondition(inst, metav1.ConditionTrue, "InvalidMaintenanceWindow", fmt.Sprintf("a new bundle is available: %s, but it cannot be applied: %s", ref, err))
+		log.V(Log4Debug).Info("The maintenance window is invalid.", "error", err.Error())
+		return ctrl.Result{RequeueAfter: nextCheck}, r.saveStatusIfChanged(ctx, log, inst, origStatus)
+	}
+	if !open {
+		setUpdateCondition(inst, metav1.ConditionTrue, "WaitingForMaintenanceWindow",
+			fmt.Sprintf("a new bundle is available: %s, it will be applied at %s", ref, opens.Format(time.RFC3339)))
+		log.V(Log4Debug).Info("Waiting for the maintenance window to apply the new bundle.", "opens", opens.Format(time.RFC3339))
+		wait := opens.Sub(now)
+		if nextCheck < wait {
+			wait = nextCheck
+		}
+		return ctrl.Result{RequeueAfter: wait}, r.saveStatusIfChanged(ctx, log, inst, origStatus)
+	}
+
+	if err = r.applyUpdate(ctx, log, inst, *update); err != nil {
+		return ctrl.Result{}, err
+	}
+	inst.Status.AvailableUpdate = nil
+	setUpdateCondition(inst, metav1.ConditionFalse, "UpdateApplied", fmt.Sprintf("the installation was updated to %s", ref))
+	log.V(Log4Debug).Info("The new bundle was applied to the installation.")
+	return ctrl.Result{RequeueAfter: nextCheck}, r.saveStatusIfChanged(ctx, log, inst, origStatus)
+}
+
+func (r *InstallationReconciler) now() time.Time {
+	if r.Clock == nil {
+		return time.Now()
+	}
+	return r.Clock.Now()
+}
+
+func (r *InstallationReconciler) registry() RegistryClient {
+	if r.Registry == nil {
+		return NewRegistryClient(nil)
+	}
+	return r.Registry
+}
+
+// findUpdate returns the newest bundle in the registry that satisfies the update policy,
+// or nil when the installation is already using it.
+func (r *InstallationReconciler) findUpdate(ctx context.Context, namespace string, bundle v1.OCIReferenceParts, policy v1.BundleUpdatePolicy) (*v1.OCIReferenceParts, error) {
+	opts, err := r.getRegistryOptions(ctx, namespace, policy)
+	if err != nil {
+		return nil, err
+	}
+
+	switch policy.Strategy {
+	case v1.BundleUpdateSemVer:
+		tags, err := r.registry().ListTags(ctx, bundle.Repository, opts)
+		if err != nil {
+			return nil, err
+		}
+		return findSemVerUpdate(bundle, policy.Constraint, tags)
+	case v1.BundleUpdateLatestDigest:
+		digest, err := r.registry().GetDigest(ctx, bundle.Repository, getTrackedTag(bundle, policy), opts)
+		if err != nil {
+			return nil, err
+		}
+		if digest == bundle.Digest {
+			return nil, nil
+		}
+		// Only one of digest, tag or version may be set on the bundle
+		return &v1.OCIReferenceParts{Repository: bundle.Repository, Digest: digest}, nil
+	default:
+		return nil, errors.Errorf("unsupported update strategy %q", policy.Strategy)
+	}
+}
+
+// getRegistryOptions returns how the registry is accessed, with the credentials from the pull secret of the update policy.
+func (r *InstallationReconciler) getRegistryOptions(ctx context.Context, namespace string, policy v1.BundleUpdatePolicy) (RegistryOptions, error) {
+	opts := RegistryOptions{Insecure: policy.InsecureRegistry}
+	if policy.PullSecret == nil {
+		return opts, nil
+	}
+
+	secret := &corev1.Secret{}
+	if err := r.Get(ctx, client.ObjectKey{Namespace: namespace, Name: policy.PullSecret.Name}, secret); err != nil {
+		return opts, errors.Wrapf(err, "could not retrieve the pull secret %s", policy.PullSecret.Name)
+	}
+	data, ok := secret.Data[corev1.DockerConfigJsonKey]
+	if !ok {
+		if data, ok = secret.Data[corev1.DockerConfigKey]; !ok {
+			return opts, errors.Errorf("the pull secret %s does not have a %s or %s key", policy.PullSecret.Name, corev1.DockerConfigJsonKey, corev1.DockerConfigKey)
+		}
+	}
+
+	creds, err := parseDockerConfig(data)
+	if err != nil {
+		return opts, errors.Wrapf(err, "could not read the pull secret %s", policy.PullSecret.Name)
+	}
+	opts.Credentials = creds
+	return opts, nil
+}
+
+// findSemVerUpdate returns the bundle for the highest tag that satisfies the constraint and is newer
+// than the current version of the bundle, or nil when there isn't one.
+func findSemVerUpdate(bundle v1.OCIReferenceParts, constraint string, tags []string) (*v1.OCIReferenceParts, error) {
+	if constraint == "" {
+		constraint = "*"
+	}
+	c, err := semver.NewConstraint(constraint)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid version constraint %q", constraint)
+	}
+
+	currentVersion := bundle.Version
+	if currentVersion == "" {
+		currentVersion = bundle.Tag
+	}
+	current, err := semver.NewVersion(currentVersion)
+	if err != nil {
+		return nil, errors.Errorf("the current version of the bundle could not be determined from %q, set bundle.version or use a semantic version tag", currentVersion)
+	}
+
+	var newest *semver.Version
+	for _, tag := range tags {
+		v, err := semver.NewVersion(tag)
+		if err != nil || !c.Check(v) {
+			continue
+		}
+		if newest == nil || v.GreaterThan(newest) {
+			newest = v
+		}
+	}
+	if newest == nil || !newest.GreaterThan(current) {
+		return nil, nil
+	}
+
+	// Keep the same style of reference, and drop the digest so that the new version is used
+	update := bundle
+	update.Digest = ""
+	if bundle.Version != "" {
+		update.Version = newest.String()
+	} else {
+		update.Tag = newest.Original()
+	}
+	return &update, nil
+}
+
+// getTrackedTag returns the tag that is tracked by the LatestDigest update strategy.
+func getTrackedTag(bundle v1.OCIReferenceParts, policy v1.BundleUpdatePolicy) string {
+	if policy.Tag != "" {
+		return policy.Tag
+	}
+	if bundle.Tag != "" {
+		return bundle.Tag
+	}
+	if bundle.Version != "" {
+		// Porter tags bundles with the version prefixed with a v
+		return "v" + strings.TrimPrefix(bundle.Version, "v")
+	}
+	return "latest"
+}
+
+// applyUpdate patches the bundle on the installation, which triggers an upgrade.
+func (r *InstallationReconciler) applyUpdate(ctx context.Context, log logr.Logger, inst *v1.Installation, update v1.OCIReferenceParts) error {
+	log.V(Log4Debug).Info("Applying the new bundle to the installation")
+	status := inst.Status.DeepCopy()
+	patch := client.MergeFrom(inst.DeepCopy())
+	if policy := inst.Spec.UpdatePolicy; policy.Strategy == v1.BundleUpdateLatestDigest && policy.Tag == "" {
+		// Remember which tag is tracked once the bundle is pinned to the digest
+		policy.Tag = getTrackedTag(inst.Spec.Bundle, *policy)
+	}
+	inst.Spec.Bundle = update
+	if err := r.Patch(ctx, inst, patch); err != nil {
+		return errors.Wrap(err, "error updating the bundle on the installation")
+	}
+	// The patch response doesn't include our pending status changes
+	inst.Status = *status
+
+	r.Recorder.Event(inst, "Normal", "ApplyUpdate", fmt.Sprintf("updated the bundle to %s", formatBundleReference(update)))
+	return nil
+}
+
+// getMaintenanceWindow determines if the maintenance window is open, and if not, when it opens next.
+// When no window is defined, changes may be applied at any time.
+func getMaintenanceWindow(window *v1.MaintenanceWindow, now time.Time) (bool, time.Time, error) {
+	if window == nil {
+		return true, now, nil
+	}
+
+	sched, err := cron.ParseStandard(window.Schedule)
+	if err != nil {
+		return false, time.Time{}, errors.Wrapf(err, "unparseable maintenance window schedule %q", window.Schedule)
+	}
+
+	// Find the first window that started within the duration, it is still open
+	start := sched.Next(now.Add(-window.Duration.Duration))
+	if !start.After(now) {
+		return true, start, nil
+	}
+	return false, start, nil
+}
+
+// formatBundleReference returns a human readable reference for the bundle.
+func formatBundleReference(bundle v1.OCIReferenceParts) string {
+	ref := bundle.Repository
+	if bundle.Version != "" {
+		ref += ":v" + strings.TrimPrefix(bundle.Version, "v")
+	} else if bundle.Tag != "" {
+		ref += ":" + bundle.Tag
+	}
+	if bundle.Digest != "" {
+		ref += "@" + bundle.Digest
+	}
+	return ref
+}
+
+func setUpdateCondition(inst *v1.Installation, status metav1.ConditionStatus, reason string, message string) {
+	apimeta.SetStatusCondition(&inst.Status.Conditions, metav1.Condition{
+		Type:               v1.ConditionUpdateAvailable,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: inst.Generation,
+	})
+}
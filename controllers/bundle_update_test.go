@@ -0,0 +1,297 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clocktesting "k8s.io/utils/clock/testing"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestBundleUpdateReconciler_Reconcile_Notify(t *testing.T) {
+	ctx := context.Background()
+	reg := newTestRegistry(t, "getporter/mybuns", map[string]string{
+		"v1.2.0": "sha256:120", "v1.2.5": "sha256:125", "v1.3.0": "sha256:130",
+	})
+
+	inst := &porterv1.Installation{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "mybuns", Generation: 1},
+		Spec: porterv1.InstallationSpec{
+			Name:      "mybuns",
+			Namespace: "dev",
+			Bundle:    porterv1.OCIReferenceParts{Repository: reg.Repository(), Version: "1.2.0"},
+			UpdatePolicy: &porterv1.BundleUpdatePolicy{
+				Strategy:   porterv1.BundleUpdateSemVer,
+				Constraint: "~1.2",
+				Interval:   &metav1.Duration{Duration: 10 * time.Minute},
+			},
+		},
+		Status: porterv1.InstallationStatus{PorterResourceStatus: porterv1.PorterResourceStatus{
+			Conditions: []metav1.Condition{{Type: porterv1.ConditionDrifted, Status: metav1.ConditionFalse, Reason: "InSync"}},
+		}},
+	}
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	clock := clocktesting.NewFakePassiveClock(now)
+	controller := setupBundleUpdateController(clock, reg.Client(), inst)
+
+	result := triggerBundleUpdateReconcile(t, controller, inst)
+	assert.Equal(t, 10*time.Minute, result.RequeueAfter, "the installation should be checked again at the next interval")
+
+	// The newest version matching the constraint is reported, but not applied
+	assert.Equal(t, "1.2.0", inst.Spec.Bundle.Version, "Notify should not change the installation")
+	require.NotNil(t, inst.Status.AvailableUpdate, "expected an available update")
+	assert.Equal(t, "1.2.5", inst.Status.AvailableUpdate.Version)
+	assert.Equal(t, now, inst.Status.LastUpdateCheckTime.Time.UTC())
+	cond := apimeta.FindStatusCondition(inst.Status.Conditions, porterv1.ConditionUpdateAvailable)
+	require.NotNil(t, cond, "expected the UpdateAvailable condition to be set")
+	assert.Equal(t, metav1.ConditionTrue, cond.Status)
+	assert.Equal(t, "UpdateAvailable", cond.Reason)
+	assert.Contains(t, cond.Message, reg.Repository()+":v1.2.5")
+	assert.True(t, apimeta.IsStatusConditionFalse(inst.Status.Conditions, porterv1.ConditionDrifted), "the other conditions of the installation should be kept")
+
+	// Don't check the registry again until the interval has passed
+	reg.Tags["v1.2.9"] = "sha256:129"
+	clock.SetTime(now.Add(time.Minute))
+	result = triggerBundleUpdateReconcile(t, controller, inst)
+	assert.Equal(t, 9*time.Minute, result.RequeueAfter)
+	assert.Equal(t, "1.2.5", inst.Status.AvailableUpdate.Version, "the registry should not be checked before the interval")
+
+	clock.SetTime(now.Add(10 * time.Minute))
+	triggerBundleUpdateReconcile(t, controller, inst)
+	assert.Equal(t, "1.2.9", inst.Status.AvailableUpdate.Version, "the registry should be checked after the interval")
+
+	// Removing the policy cleans up the status
+	inst.Spec.UpdatePolicy = nil
+	require.NoError(t, controller.Update(ctx, inst))
+	triggerBundleUpdateReconcile(t, controller, inst)
+	assert.Nil(t, inst.Status.AvailableUpdate)
+	assert.Nil(t, inst.Status.LastUpdateCheckTime)
+	assert.Nil(t, apimeta.FindStatusCondition(inst.Status.Conditions, porterv1.ConditionUpdateAvailable))
+}
+
+func TestBundleUpdateReconciler_Reconcile_ApplyInMaintenanceWindow(t *testing.T) {
+	reg := newTestRegistry(t, "getporter/mybuns", map[string]string{"stable": "sha256:new"})
+
+	inst := &porterv1.Installation{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "mybuns", Generation: 1},
+		Spec: porterv1.InstallationSpec{
+			Name:      "mybuns",
+			Namespace: "dev",
+			Bundle:    porterv1.OCIReferenceParts{Repository: reg.Repository(), Tag: "stable"},
+			UpdatePolicy: &porterv1.BundleUpdatePolicy{
+				Strategy: porterv1.BundleUpdateLatestDigest,
+				Mode:     porterv1.BundleUpdateApply,
+				// Every day from 02:00-04:00
+				MaintenanceWindow: &porterv1.MaintenanceWindow{Schedule: "0 2 * * *", Duration: metav1.Duration{Duration: 2 * time.Hour}},
+			},
+		},
+	}
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.Local)
+	clock := clocktesting.NewFakePassiveClock(now)
+	controller := setupBundleUpdateController(clock, reg.Client(), inst)
+
+	// Wait for the maintenance window before applying the update
+	result := triggerBundleUpdateReconcile(t, controller, inst)
+	assert.Equal(t, time.Hour, result.RequeueAfter, "the next check is sooner than the maintenance window")
+	assert.Equal(t, "stable", inst.Spec.Bundle.Tag, "the update should not be applied outside the maintenance window")
+	assert.Empty(t, inst.Spec.Bundle.Digest, "the update should not be applied outside the maintenance window")
+	cond := apimeta.FindStatusCondition(inst.Status.Conditions, porterv1.ConditionUpdateAvailable)
+	require.NotNil(t, cond, "expected the UpdateAvailable condition to be set")
+	assert.Equal(t, metav1.ConditionTrue, cond.Status)
+	assert.Equal(t, "WaitingForMaintenanceWindow", cond.Reason)
+
+	// Apply the update when the window opens
+	clock.SetTime(time.Date(2024, 1, 2, 2, 30, 0, 0, time.Local))
+	triggerBundleUpdateReconcile(t, controller, inst)
+	assert.Equal(t, "sha256:new", inst.Spec.Bundle.Digest, "the update should be applied in the maintenance window")
+	assert.Empty(t, inst.Spec.Bundle.Tag, "the bundle should only be pinned to the digest")
+	assert.Equal(t, "stable", inst.Spec.UpdatePolicy.Tag, "the tracked tag should be recorded on the update policy")
+	assert.Nil(t, inst.Status.AvailableUpdate, "the available update should be cleared once applied")
+	cond = apimeta.FindStatusCondition(inst.Status.Conditions, porterv1.ConditionUpdateAvailable)
+	require.NotNil(t, cond, "expected the UpdateAvailable condition to be set")
+	assert.Equal(t, metav1.ConditionFalse, cond.Status)
+	assert.Equal(t, "UpdateApplied", cond.Reason)
+}
+
+func TestBundleUpdateReconciler_Reconcile_CheckFailed(t *testing.T) {
+	reg := newTestRegistry(t, "getporter/mybuns", map[string]string{})
+
+	inst := &porterv1.Installation{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "mybuns", Generation: 1},
+		Spec: porterv1.InstallationSpec{
+			Bundle:       porterv1.OCIReferenceParts{Repository: reg.Repository(), Tag: "latest"},
+			UpdatePolicy: &porterv1.BundleUpdatePolicy{Strategy: porterv1.BundleUpdateSemVer},
+		},
+	}
+	controller := setupBundleUpdateController(clocktesting.NewFakePassiveClock(time.Now()), reg.Client(), inst)
+
+	result := triggerBundleUpdateReconcile(t, controller, inst)
+	assert.Equal(t, porterv1.DefaultBundleUpdateInterval, result.RequeueAfter, "the check should be retried at the next interval")
+	cond := apimeta.FindStatusCondition(inst.Status.Conditions, porterv1.ConditionUpdateAvailable)
+	require.NotNil(t, cond, "expected the UpdateAvailable condition to be set")
+	assert.Equal(t, metav1.ConditionUnknown, cond.Status)
+	assert.Equal(t, "CheckFailed", cond.Reason)
+	assert.Contains(t, cond.Message, "the current version of the bundle could not be determined")
+}
+
+func TestBundleUpdateReconciler_Reconcile_PullSecret(t *testing.T) {
+	reg := newTestRegistry(t, "getporter/mybuns", map[string]string{"v1.0.0": "sha256:100", "v1.1.0": "sha256:110"})
+	reg.Credential = &RegistryCredential{Username: "porter", Password: "hunter2"}
+	host := strings.TrimPrefix(reg.URL, "https://")
+
+	pullSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "registry-creds"},
+		Type:       corev1.SecretTypeDockerConfigJson,
+		Data: map[string][]byte{
+			corev1.DockerConfigJsonKey: []byte(fmt.Sprintf(`{"auths":{%q:{"username":"porter","password":"hunter2"}}}`, host)),
+		},
+	}
+	inst := &porterv1.Installation{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "mybuns", Generation: 1},
+		Spec: porterv1.InstallationSpec{
+			Bundle: porterv1.OCIReferenceParts{Repository: reg.Repository(), Version: "1.0.0"},
+			UpdatePolicy: &porterv1.BundleUpdatePolicy{
+				Strategy:   porterv1.BundleUpdateSemVer,
+				PullSecret: &corev1.LocalObjectReference{Name: "registry-creds"},
+			},
+		},
+	}
+	controller := setupBundleUpdateController(clocktesting.NewFakePassiveClock(time.Now()), reg.Client(), inst, pullSecret)
+
+	triggerBundleUpdateReconcile(t, controller, inst)
+	require.NotNil(t, inst.Status.AvailableUpdate, "the private registry should be accessed with the credentials from the pull secret")
+	assert.Equal(t, "1.1.0", inst.Status.AvailableUpdate.Version)
+}
+
+func TestFindSemVerUpdate(t *testing.T) {
+	tags := []string{"latest", "v1.0.0", "v1.2.0", "v1.2.3", "v1.3.0", "v2.0.0", "v2.1.0-beta.1"}
+	repo := "ghcr.io/getporter/mybuns"
+
+	testcases := []struct {
+		name       string
+		bundle     porterv1.OCIReferenceParts
+		constraint string
+		want       *porterv1.OCIReferenceParts
+		wantErr    string
+	}{
+		{name: "any version", bundle: porterv1.OCIReferenceParts{Repository: repo, Version: "1.0.0"},
+			want: &porterv1.OCIReferenceParts{Repository: repo, Version: "2.0.0"}},
+		{name: "patch range", bundle: porterv1.OCIReferenceParts{Repository: repo, Version: "1.2.0", Digest: "sha256:abc"}, constraint: "~1.2",
+			want: &porterv1.OCIReferenceParts{Repository: repo, Version: "1.2.3"}},
+		{name: "tag", bundle: porterv1.OCIReferenceParts{Repository: repo, Tag: "v1.0.0"}, constraint: "^1.0",
+			want: &porterv1.OCIReferenceParts{Repository: repo, Tag: "v1.3.0"}},
+		{name: "up-to-date", bundle: porterv1.OCIReferenceParts{Repository: repo, Version: "2.0.0"}},
+		{name: "never downgrade", bundle: porterv1.OCIReferenceParts{Repository: repo, Version: "1.5.0"}, constraint: "~1.2"},
+		{name: "unknown version", bundle: porterv1.OCIReferenceParts{Repository: repo, Tag: "latest"},
+			wantErr: "the current version of the bundle could not be determined"},
+		{name: "invalid constraint", bundle: porterv1.OCIReferenceParts{Repository: repo, Version: "1.0.0"}, constraint: "oops",
+			wantErr: "invalid version constraint"},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := findSemVerUpdate(tc.bundle, tc.constraint, tags)
+			if tc.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestGetTrackedTag(t *testing.T) {
+	repo := "ghcr.io/getporter/mybuns"
+	policy := porterv1.BundleUpdatePolicy{Strategy: porterv1.BundleUpdateLatestDigest}
+
+	testcases := []struct {
+		name   string
+		bundle porterv1.OCIReferenceParts
+		tag    string
+		want   string
+	}{
+		{name: "tag", bundle: porterv1.OCIReferenceParts{Repository: repo, Tag: "stable"}, want: "stable"},
+		{name: "version", bundle: porterv1.OCIReferenceParts{Repository: repo, Version: "1.2.0"}, want: "v1.2.0"},
+		{name: "latest", bundle: porterv1.OCIReferenceParts{Repository: repo}, want: "latest"},
+		{name: "pinned to a digest", bundle: porterv1.OCIReferenceParts{Repository: repo, Digest: "sha256:abc"}, tag: "stable", want: "stable"},
+		{name: "policy takes precedence", bundle: porterv1.OCIReferenceParts{Repository: repo, Tag: "edge"}, tag: "stable", want: "stable"},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			policy := policy
+			policy.Tag = tc.tag
+			assert.Equal(t, tc.want, getTrackedTag(tc.bundle, policy))
+		})
+	}
+}
+
+func TestGetMaintenanceWindow(t *testing.T) {
+	window := &porterv1.MaintenanceWindow{Schedule: "0 2 * * *", Duration: metav1.Duration{Duration: 2 * time.Hour}}
+	day := func(hour int, min int) time.Time {
+		return time.Date(2024, 1, 1, hour, min, 0, 0, time.Local)
+	}
+
+	t.Run("no window", func(t *testing.T) {
+		open, _, err := getMaintenanceWindow(nil, day(12, 0))
+		require.NoError(t, err)
+		assert.True(t, open, "changes can be applied at any time without a maintenance window")
+	})
+
+	t.Run("before window", func(t *testing.T) {
+		open, opens, err := getMaintenanceWindow(window, day(1, 0))
+		require.NoError(t, err)
+		assert.False(t, open)
+		assert.Equal(t, day(2, 0), opens)
+	})
+
+	t.Run("in window", func(t *testing.T) {
+		open, _, err := getMaintenanceWindow(window, day(3, 59))
+		require.NoError(t, err)
+		assert.True(t, open)
+	})
+
+	t.Run("after window", func(t *testing.T) {
+		open, opens, err := getMaintenanceWindow(window, day(4, 0))
+		require.NoError(t, err)
+		assert.False(t, open)
+		assert.Equal(t, day(2, 0).AddDate(0, 0, 1), opens)
+	})
+
+	t.Run("invalid schedule", func(t *testing.T) {
+		_, _, err := getMaintenanceWindow(&porterv1.MaintenanceWindow{Schedule: "oops"}, day(1, 0))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "unparseable maintenance window schedule")
+	})
+}
+
+func triggerBundleUpdateReconcile(t *testing.T, controller *InstallationReconciler, inst *porterv1.Installation) ctrl.Result {
+	ctx := context.Background()
+	key := client.ObjectKeyFromObject(inst)
+	require.NoError(t, controller.Get(ctx, key, inst))
+	result, err := controller.checkBundleUpdate(ctx, logr.Discard(), inst)
+	require.NoError(t, err)
+	require.NoError(t, controller.Get(ctx, key, inst))
+	return result
+}
+
+func setupBundleUpdateController(clock *clocktesting.FakePassiveClock, httpClient *http.Client, objs ...client.Object) *InstallationReconciler {
+	controller := setupInstallationController(objs...)
+	controller.Registry = NewRegistryClient(httpClient)
+	controller.Clock = clock
+	return controller
+}
@@ -0,0 +1,329 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	v1 "get.porter.sh/operator/api/v1"
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	// reasonDependenciesNotReady is the reason that an installation waits for its dependencies to succeed.
+	reasonDependenciesNotReady = "DependenciesNotReady"
+
+	// reasonDependencyCycle is the reason that an installation can't be applied because it depends on itself.
+	reasonDependencyCycle = "DependencyCycle"
+
+	// reasonDependencyNotAllowed is the reason that an installation can't be applied
+	// because it depends on an installation in another namespace.
+	reasonDependencyNotAllowed = "DependencyNotAllowed"
+
+	// reasonDependentsInstalled is the reason that an installation waits for
+	// the installations that depend on it to be uninstalled.
+	reasonDependentsInstalled = "DependentsInstalled"
+)
+
+// checkDependencies determines if the installation must wait for its dependencies
+// before it is applied, and reports why it is waiting in its status.
+func (r *InstallationReconciler) checkDependencies(ctx context.Context, log logr.Logger, inst *v1.Installation) (bool, error) {
+	if len(inst.Spec.DependsOn) == 0 {
+		return false, nil
+	}
+
+	if notAllowed := r.getCrossNamespaceDependencies(inst); len(notAllowed) > 0 {
+		msg := fmt.Sprintf("dependencies in another namespace are not allowed: %s", strings.Join(notAllowed, ", "))
+		log.V(Log4Debug).Info("Reconciliation complete: The installation depends on installations in another namespace.", "dependencies", notAllowed)
+		return true, r.waitForDependencies(ctx, log, inst, reasonDependencyNotAllowed, msg)
+	}
+
+	cycle, err := r.findDependencyCycle(ctx, inst)
+	if err != nil {
+		return false, err
+	}
+	if cycle != nil {
+		msg := fmt.Sprintf("the installation depends on itself: %s", strings.Join(cycle, " -> "))
+		log.V(Log4Debug).Info("Reconciliation complete: The installation has a dependency cycle.", "cycle", msg)
+		return true, r.waitForDependencies(ctx, log, inst, reasonDependencyCycle, msg)
+	}
+
+	var pending []string
+	for _, ref := range inst.Spec.DependsOn {
+		key := types.NamespacedName{Namespace: ref.GetNamespace(inst.Namespace), Name: ref.Name}
+		var dep v1.Installation
+		if err := r.Get(ctx, key, &dep); err != nil {
+			if !apierrors.IsNotFound(err) {
+				return false, errors.Wrapf(err, "could not retrieve the dependency %s", key)
+			}
+			pending = append(pending, fmt.Sprintf("%s (not found)", key))
+			continue
+		}
+		if !isDependencyReady(&dep) {
+			pending = append(pending, fmt.Sprintf("%s (%s)", key, getDependencyPhase(&dep)))
+		}
+	}
+	if len(pending) == 0 {
+		return false, nil
+	}
+
+	msg := fmt.Sprintf("waiting for dependencies to succeed: %s", strings.Join(pending, ", "))
+	log.V(Log4Debug).Info("Reconciliation complete: The installation is waiting for its dependencies.", "pending", pending)
+	return true, r.waitForDependencies(ctx, log, inst, reasonDependenciesNotReady, msg)
+}
+
+// checkDependents determines if the installation must wait for the installations
+// that depend on it to be uninstalled before it is uninstalled, and reports why
+// it is waiting in its status.
+func (r *InstallationReconciler) checkDependents(ctx context.Context, log logr.Logger, inst *v1.Installation) (bool, error) {
+	var list v1.InstallationList
+	if err := r.List(ctx, &list, r.dependencyListOptions(inst)...); err != nil {
+		return false, errors.Wrap(err, "could not query for the installations that depend on the installation")
+	}
+
+	var installed []string
+	for i := range list.Items {
+		dependent := &list.Items[i]
+		if dependsOn(dependent, inst) && !isDependentUninstalled(dependent) {
+			installed = append(installed, client.ObjectKeyFromObject(dependent).String())
+		}
+	}
+	if len(installed) == 0 {
+		return false, nil
+	}
+
+	msg := fmt.Sprintf("waiting for dependents to be uninstalled: %s", strings.Join(installed, ", "))
+	log.V(Log4Debug).Info("Reconciliation complete: The installation is waiting for its dependents to be uninstalled.", "dependents", installed)
+	return true, r.waitForDependencies(ctx, log, inst, reasonDependentsInstalled, msg)
+}
+
+// waitForDependencies sets the WaitingForDependencies condition, and emits an
+// event when the reason the installation is waiting changes.
+func (r *InstallationReconciler) waitForDependencies(ctx context.Context, log logr.Logger, inst *v1.Installation, reason string, message string) error {
+	origStatus := inst.Status.DeepCopy()
+
+	cond := apimeta.FindStatusCondition(inst.Status.Conditions, v1.ConditionWaitingForDependencies)
+	if cond == nil || cond.Status != metav1.ConditionTrue || cond.Message != message {
+		eventType := "Normal"
+		if isDependencyFailure(reason) {
+			eventType = "Warning"
+		}
+		r.Recorder.Event(inst, eventType, reason, message)
+	}
+
+	apimeta.SetStatusCondition(&inst.Status.Conditions, metav1.Condition{
+		Type:               v1.ConditionWaitingForDependencies,
+		Status:             metav1.ConditionTrue,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: inst.Generation,
+	})
+	applyDependencyPhase(inst, nil)
+	return r.saveStatusIfChanged(ctx, log, inst, origStatus)
+}
+
+// getCrossNamespaceDependencies returns the dependencies of the installation in
+// other namespaces, when cross-namespace dependencies are not allowed.
+func (r *InstallationReconciler) getCrossNamespaceDependencies(inst *v1.Installation) []string {
+	if r.AllowCrossNamespaceDependencies {
+		return nil
+	}
+
+	var notAllowed []string
+	for _, ref := range inst.Spec.DependsOn {
+		if ns := ref.GetNamespace(inst.Namespace); ns != inst.Namespace {
+			notAllowed = append(notAllowed, types.NamespacedName{Namespace: ns, Name: ref.Name}.String())
+		}
+	}
+	return notAllowed
+}
+
+// dependencyListOptions limits the installations that are checked for a
+// dependency on the installation to its namespace, when cross-namespace
+// dependencies are not allowed.
+func (r *InstallationReconciler) dependencyListOptions(inst *v1.Installation) []client.ListOption {
+	if r.AllowCrossNamespaceDependencies {
+		return nil
+	}
+	return []client.ListOption{client.InNamespace(inst.Namespace)}
+}
+
+// findDependencyCycle walks the dependencies of the installation, and returns
+// the path back to the installation when it depends on itself.
+func (r *InstallationReconciler) findDependencyCycle(ctx context.Context, inst *v1.Installation) ([]string, error) {
+	start := client.ObjectKeyFromObject(inst)
+	visited := map[types.NamespacedName]bool{}
+
+	var visit func(namespace string, deps []v1.InstallationReference, path []string) ([]string, error)
+	visit = func(namespace string, deps []v1.InstallationReference, path []string) ([]string, error) {
+		for _, ref := range deps {
+			key := types.NamespacedName{Namespace: ref.GetNamespace(namespace), Name: ref.Name}
+			if key == start {
+				return append(path, key.String()), nil
+			}
+			// Installations in another namespace are rejected when they are applied
+			if visited[key] || (!r.AllowCrossNamespaceDependencies && key.Namespace != start.Namespace) {
+				continue
+			}
+			visited[key] = true
+
+			var dep v1.Installation
+			if err := r.Get(ctx, key, &dep); err != nil {
+				if apierrors.IsNotFound(err) {
+					continue
+				}
+				return nil, errors.Wrapf(err, "could not retrieve the dependency %s", key)
+			}
+
+			cycle, err := visit(key.Namespace, dep.Spec.DependsOn, append(path[:len(path):len(path)], key.String()))
+			if err != nil || cycle != nil {
+				return cycle, err
+			}
+		}
+		return nil, nil
+	}
+
+	return visit(inst.Namespace, inst.Spec.DependsOn, []string{start.String()})
+}
+
+// applyDependencyPhase sets the phase of an installation that is waiting for
+// its dependencies. An installation with a dependency cycle has failed.
+func applyDependencyPhase(inst *v1.Installation, action *v1.AgentAction) {
+	if action != nil {
+		return
+	}
+
+	cond := apimeta.FindStatusCondition(inst.Status.Conditions, v1.ConditionWaitingForDependencies)
+	if cond == nil || cond.Status != metav1.ConditionTrue || cond.ObservedGeneration != inst.Generation {
+		return
+	}
+
+	if isDependencyFailure(cond.Reason) {
+		inst.Status.Phase = v1.PhaseFailed
+	} else {
+		inst.Status.Phase = v1.PhasePending
+	}
+}
+
+// isDependencyFailure determines if the installation waits for its dependencies
+// because they are invalid, and it can't be applied until its dependsOn is fixed.
+func isDependencyFailure(reason string) bool {
+	return reason == reasonDependencyCycle || reason == reasonDependencyNotAllowed
+}
+
+// isDependencyReady determines if the current generation of a dependency was applied successfully.
+func isDependencyReady(dep *v1.Installation) bool {
+	return !isDeleted(dep) && !dep.Spec.Uninstalled && !dep.Spec.DryRun &&
+		dep.Status.ObservedGeneration == dep.Generation && dep.Status.Phase == v1.PhaseSucceeded
+}
+
+// getDependencyPhase describes the state of a dependency that is not ready.
+func getDependencyPhase(dep *v1.Installation) string {
+	switch {
+	case isDeleted(dep):
+		return "deleted"
+	case dep.Spec.Uninstalled:
+		return "uninstalled"
+	case dep.Spec.DryRun:
+		return "dry-run"
+	case dep.Status.Phase == "":
+		return string(v1.PhaseUnknown)
+	default:
+		return string(dep.Status.Phase)
+	}
+}
+
+// isDependentUninstalled determines if an installation that depends on another
+// installation no longer needs it.
+func isDependentUninstalled(dependent *v1.Installation) bool {
+	if isDeleted(dependent) && !isFinalizerSet(dependent) {
+		return true
+	}
+	return dependent.Spec.Uninstalled && dependent.Status.ObservedGeneration == dependent.Generation &&
+		dependent.Status.Phase == v1.PhaseSucceeded
+}
+
+// dependsOn determines if the installation lists the dependency in its dependsOn.
+func dependsOn(inst *v1.Installation, dependency *v1.Installation) bool {
+	for _, ref := range inst.Spec.DependsOn {
+		if ref.Name == dependency.Name && ref.GetNamespace(inst.Namespace) == dependency.Namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// isWaitingForDependencies determines if the installation is waiting for its dependencies or dependents.
+func isWaitingForDependencies(inst *v1.Installation) bool {
+	return apimeta.IsStatusConditionTrue(inst.Status.Conditions, v1.ConditionWaitingForDependencies)
+}
+
+// requestsForDependencies requeues the installations that are waiting for the
+// installation to succeed, and its dependencies that are waiting for it to be uninstalled.
+func (r *InstallationReconciler) requestsForDependencies(ctx context.Context, obj client.Object) []reconcile.Request {
+	inst, ok := obj.(*v1.Installation)
+	if !ok {
+		return nil
+	}
+
+	var list v1.InstallationList
+	if err := r.List(ctx, &list, r.dependencyListOptions(inst)...); err != nil {
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for i := range list.Items {
+		other := &list.Items[i]
+		if !isWaitingForDependencies(other) {
+			continue
+		}
+		if dependsOn(other, inst) || dependsOn(inst, other) {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(other)})
+		}
+	}
+	return requests
+}
+
+// installationProgressed is a predicate that triggers when an installation
+// changes in a way that may unblock the installations that depend on it, or
+// that it depends on.
+type installationProgressed struct {
+	predicate.Funcs
+}
+
+func (installationProgressed) Create(event.CreateEvent) bool {
+	return true
+}
+
+func (installationProgressed) Delete(event.DeleteEvent) bool {
+	return true
+}
+
+func (installationProgressed) Update(e event.UpdateEvent) bool {
+	oldInst, ok := e.ObjectOld.(*v1.Installation)
+	if !ok {
+		return false
+	}
+	newInst, ok := e.ObjectNew.(*v1.Installation)
+	if !ok {
+		return false
+	}
+
+	return oldInst.Generation != newInst.Generation ||
+		oldInst.Status.Phase != newInst.Status.Phase ||
+		oldInst.Status.ObservedGeneration != newInst.Status.ObservedGeneration ||
+		isDeleted(oldInst) != isDeleted(newInst)
+}
+
+func (installationProgressed) Generic(event.GenericEvent) bool {
+	return false
+}
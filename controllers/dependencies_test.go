@@ -0,0 +1,241 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	v1 "get.porter.sh/operator/api/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func testDependentInstallation(namespace string, name string, deps ...v1.InstallationReference) *v1.Installation {
+	inst := testInstallation(namespace, name)
+	inst.Spec.DependsOn = deps
+	return inst
+}
+
+func TestInstallationReconciler_Reconcile_DependsOn(t *testing.T) {
+	ctx := context.Background()
+	db := testDependentInstallation("shared", "mysql")
+	db.Status.ObservedGeneration = 1
+	db.Status.Phase = v1.PhaseRunning
+	app := testDependentInstallation("test", "wordpress", v1.InstallationReference{Name: "mysql", Namespace: "shared"})
+	controller := setupInstallationController(db, app)
+	controller.AllowCrossNamespaceDependencies = true
+	recorder := controller.Recorder.(*record.FakeRecorder)
+
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "test", Name: "wordpress"}}
+	_, err := controller.Reconcile(ctx, req)
+	require.NoError(t, err)
+
+	var inst v1.Installation
+	require.NoError(t, controller.Get(ctx, req.NamespacedName, &inst))
+	assert.Nil(t, inst.Status.Action, "the installation should not be applied until its dependencies succeed")
+	assert.Equal(t, v1.PhasePending, inst.Status.Phase)
+	cond := apimeta.FindStatusCondition(inst.Status.Conditions, v1.ConditionWaitingForDependencies)
+	require.NotNil(t, cond, "expected the WaitingForDependencies condition")
+	assert.Equal(t, metav1.ConditionTrue, cond.Status)
+	assert.Equal(t, "DependenciesNotReady", cond.Reason)
+	assert.Equal(t, "waiting for dependencies to succeed: shared/mysql (Running)", cond.Message)
+	assert.Equal(t, []string{"Normal DependenciesNotReady waiting for dependencies to succeed: shared/mysql (Running)"}, drainEvents(recorder))
+
+	// Reconciling again while waiting does not emit another event
+	_, err = controller.Reconcile(ctx, req)
+	require.NoError(t, err)
+	assert.Empty(t, drainEvents(recorder))
+
+	// The installation is requeued when its dependency succeeds
+	db.Status.Phase = v1.PhaseSucceeded
+	require.NoError(t, controller.Status().Update(ctx, db))
+	assert.Equal(t, []reconcile.Request{{NamespacedName: req.NamespacedName}}, controller.requestsForDependencies(ctx, db))
+
+	_, err = controller.Reconcile(ctx, req)
+	require.NoError(t, err)
+	require.NoError(t, controller.Get(ctx, req.NamespacedName, &inst))
+	require.NotNil(t, inst.Status.Action, "the installation should be applied once its dependencies succeed")
+	assert.False(t, isWaitingForDependencies(&inst), "the WaitingForDependencies condition should be cleared")
+}
+
+func TestInstallationReconciler_checkDependencies(t *testing.T) {
+	ctx := context.Background()
+	ready := testDependentInstallation("test", "ready")
+	ready.Status.ObservedGeneration = 1
+	ready.Status.Phase = v1.PhaseSucceeded
+	stale := testDependentInstallation("test", "stale")
+	stale.Generation = 2
+	stale.Status.ObservedGeneration = 1
+	stale.Status.Phase = v1.PhaseSucceeded
+	uninstalled := testDependentInstallation("test", "uninstalled")
+	uninstalled.Spec.Uninstalled = true
+	uninstalled.Status.ObservedGeneration = 1
+	uninstalled.Status.Phase = v1.PhaseSucceeded
+
+	testcases := []struct {
+		name    string
+		deps    []v1.InstallationReference
+		waiting bool
+		message string
+	}{
+		{name: "no dependencies"},
+		{name: "ready", deps: []v1.InstallationReference{{Name: "ready"}}},
+		{name: "missing", deps: []v1.InstallationReference{{Name: "ready"}, {Name: "missing"}},
+			waiting: true, message: "waiting for dependencies to succeed: test/missing (not found)"},
+		{name: "not applied for its current generation", deps: []v1.InstallationReference{{Name: "stale"}},
+			waiting: true, message: "waiting for dependencies to succeed: test/stale (Succeeded)"},
+		{name: "uninstalled", deps: []v1.InstallationReference{{Name: "uninstalled"}},
+			waiting: true, message: "waiting for dependencies to succeed: test/uninstalled (uninstalled)"},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			inst := testDependentInstallation("test", "app", tc.deps...)
+			controller := setupInstallationController(inst, ready, stale, uninstalled)
+
+			waiting, err := controller.checkDependencies(ctx, controller.Log, inst)
+			require.NoError(t, err)
+			assert.Equal(t, tc.waiting, waiting)
+			if tc.waiting {
+				cond := apimeta.FindStatusCondition(inst.Status.Conditions, v1.ConditionWaitingForDependencies)
+				require.NotNil(t, cond)
+				assert.Equal(t, tc.message, cond.Message)
+			}
+		})
+	}
+}
+
+func TestInstallationReconciler_checkDependencies_Cycle(t *testing.T) {
+	ctx := context.Background()
+	app := testDependentInstallation("test", "app", v1.InstallationReference{Name: "cache"}, v1.InstallationReference{Name: "db"})
+	cache := testDependentInstallation("test", "cache")
+	db := testDependentInstallation("test", "db", v1.InstallationReference{Name: "storage", Namespace: "infra"})
+	storage := testDependentInstallation("infra", "storage", v1.InstallationReference{Name: "app", Namespace: "test"})
+	controller := setupInstallationController(app, cache, db, storage)
+	controller.AllowCrossNamespaceDependencies = true
+
+	waiting, err := controller.checkDependencies(ctx, controller.Log, app)
+	require.NoError(t, err)
+	assert.True(t, waiting, "an installation that depends on itself can't be applied")
+	assert.Equal(t, v1.PhaseFailed, app.Status.Phase)
+
+	cond := apimeta.FindStatusCondition(app.Status.Conditions, v1.ConditionWaitingForDependencies)
+	require.NotNil(t, cond)
+	assert.Equal(t, "DependencyCycle", cond.Reason)
+	assert.Equal(t, "the installation depends on itself: test/app -> test/db -> infra/storage -> test/app", cond.Message)
+	assert.Equal(t, []string{"Warning DependencyCycle " + cond.Message}, drainEvents(controller.Recorder.(*record.FakeRecorder)))
+
+	// A cycle between other installations is reported by those installations
+	cycle, err := controller.findDependencyCycle(ctx, testDependentInstallation("test", "web", v1.InstallationReference{Name: "app"}))
+	require.NoError(t, err)
+	assert.Nil(t, cycle)
+}
+
+func TestInstallationReconciler_checkDependencies_CrossNamespace(t *testing.T) {
+	ctx := context.Background()
+	db := testDependentInstallation("shared", "mysql")
+	db.Status.ObservedGeneration = 1
+	db.Status.Phase = v1.PhaseSucceeded
+	app := testDependentInstallation("test", "wordpress", v1.InstallationReference{Name: "redis"}, v1.InstallationReference{Name: "mysql", Namespace: "shared"})
+	controller := setupInstallationController(db, app)
+
+	waiting, err := controller.checkDependencies(ctx, controller.Log, app)
+	require.NoError(t, err)
+	assert.True(t, waiting, "an installation can't depend on an installation in another namespace by default")
+	assert.Equal(t, v1.PhaseFailed, app.Status.Phase)
+
+	cond := apimeta.FindStatusCondition(app.Status.Conditions, v1.ConditionWaitingForDependencies)
+	require.NotNil(t, cond)
+	assert.Equal(t, "DependencyNotAllowed", cond.Reason)
+	assert.Equal(t, "dependencies in another namespace are not allowed: shared/mysql", cond.Message)
+	assert.Equal(t, []string{"Warning DependencyNotAllowed " + cond.Message}, drainEvents(controller.Recorder.(*record.FakeRecorder)))
+
+	// The installation in the other namespace isn't requeued when it changes
+	assert.Empty(t, controller.requestsForDependencies(ctx, db))
+}
+
+func TestInstallationReconciler_checkDependents_CrossNamespace(t *testing.T) {
+	ctx := context.Background()
+	db := testDependentInstallation("shared", "mysql")
+	db.Spec.Uninstalled = true
+	db.Generation = 2
+	app := testDependentInstallation("test", "wordpress", v1.InstallationReference{Name: "mysql", Namespace: "shared"})
+	app.Status.ObservedGeneration = 1
+	app.Status.Phase = v1.PhaseSucceeded
+	controller := setupInstallationController(db, app)
+
+	waiting, err := controller.checkDependents(ctx, controller.Log, db)
+	require.NoError(t, err)
+	assert.False(t, waiting, "an installation in another namespace should not block the uninstall by default")
+
+	controller.AllowCrossNamespaceDependencies = true
+	waiting, err = controller.checkDependents(ctx, controller.Log, db)
+	require.NoError(t, err)
+	assert.True(t, waiting, "the installation should wait for dependents in other namespaces when they are allowed")
+	cond := apimeta.FindStatusCondition(db.Status.Conditions, v1.ConditionWaitingForDependencies)
+	require.NotNil(t, cond)
+	assert.Equal(t, "waiting for dependents to be uninstalled: test/wordpress", cond.Message)
+}
+
+func TestInstallationReconciler_Reconcile_UninstallDependents(t *testing.T) {
+	ctx := context.Background()
+	db := testDependentInstallation("test", "mysql")
+	db.Spec.Uninstalled = true
+	db.Generation = 2
+	app := testDependentInstallation("test", "wordpress", v1.InstallationReference{Name: "mysql"})
+	app.Status.ObservedGeneration = 1
+	app.Status.Phase = v1.PhaseSucceeded
+	controller := setupInstallationController(db, app)
+
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "test", Name: "mysql"}}
+	_, err := controller.Reconcile(ctx, req)
+	require.NoError(t, err)
+
+	var inst v1.Installation
+	require.NoError(t, controller.Get(ctx, req.NamespacedName, &inst))
+	assert.Nil(t, inst.Status.Action, "the installation should not be uninstalled before its dependents")
+	cond := apimeta.FindStatusCondition(inst.Status.Conditions, v1.ConditionWaitingForDependencies)
+	require.NotNil(t, cond, "expected the WaitingForDependencies condition")
+	assert.Equal(t, "DependentsInstalled", cond.Reason)
+	assert.Equal(t, "waiting for dependents to be uninstalled: test/wordpress", cond.Message)
+
+	// The dependency is requeued when its dependent is uninstalled
+	app.Spec.Uninstalled = true
+	app.Generation = 2
+	require.NoError(t, controller.Update(ctx, app))
+	app.Status.ObservedGeneration = 2
+	require.NoError(t, controller.Status().Update(ctx, app))
+	assert.Equal(t, []reconcile.Request{{NamespacedName: req.NamespacedName}}, controller.requestsForDependencies(ctx, app))
+
+	_, err = controller.Reconcile(ctx, req)
+	require.NoError(t, err)
+	require.NoError(t, controller.Get(ctx, req.NamespacedName, &inst))
+	require.NotNil(t, inst.Status.Action, "the installation should be uninstalled after its dependents")
+}
+
+func TestInstallationProgressed(t *testing.T) {
+	inst := testDependentInstallation("test", "mysql")
+	pred := installationProgressed{}
+
+	changed := inst.DeepCopy()
+	changed.Labels = map[string]string{"team": "llamas"}
+	assert.False(t, pred.Update(event.UpdateEvent{ObjectOld: inst, ObjectNew: changed}), "unrelated changes should not trigger")
+
+	changed = inst.DeepCopy()
+	changed.Status.Phase = v1.PhaseSucceeded
+	assert.True(t, pred.Update(event.UpdateEvent{ObjectOld: inst, ObjectNew: changed}), "phase changes should trigger")
+
+	changed = inst.DeepCopy()
+	changed.Generation = 2
+	assert.True(t, pred.Update(event.UpdateEvent{ObjectOld: inst, ObjectNew: changed}), "spec changes should trigger")
+
+	changed = inst.DeepCopy()
+	now := metav1.Now()
+	changed.DeletionTimestamp = &now
+	assert.True(t, pred.Update(event.UpdateEvent{ObjectOld: inst, ObjectNew: changed}), "deletion should trigger")
+}
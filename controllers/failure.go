@@ -0,0 +1,168 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+	"github.com/go-logr/logr"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// maxFailureMessageLength is the maximum length of the message on the Failed condition.
+const maxFailureMessageLength = 1024
+
+// failureClassifications identify why Porter failed from the error that it
+// returned. The patterns match the errors reported by Porter, rather than
+// words that may also appear in the output of the bundle.
+var failureClassifications = []struct {
+	reason  string
+	pattern *regexp.Regexp
+}{
+	{
+		reason:  porterv1.FailureReasonPluginMissing,
+		pattern: regexp.MustCompile(`(?i)(could not|unable to|failed to) (find|load) plugin|plugin \S+ (is )?not installed|plugin (is )?not (installed|found)|unknown plugin`),
+	},
+	{
+		reason:  porterv1.FailureReasonCredentialResolutionFailed,
+		pattern: regexp.MustCompile(`(?i)(could not|unable to|failed to|error) resolv(e|ing) (the )?credential|credential ?set \S+ (not found|does not exist)|missing required credential`),
+	},
+	{
+		reason:  porterv1.FailureReasonParameterResolutionFailed,
+		pattern: regexp.MustCompile(`(?i)(could not|unable to|failed to|error) resolv(e|ing) (the )?parameter|parameter ?set \S+ (not found|does not exist)|missing required parameter`),
+	},
+	{
+		reason:  porterv1.FailureReasonBundlePullFailed,
+		pattern: regexp.MustCompile(`(?i)(could not|unable to|failed to|error) pull(ing)? (the )?bundle|manifest unknown|failed to resolve reference`),
+	},
+	{
+		reason:  porterv1.FailureReasonInvocationImageFailed,
+		pattern: regexp.MustCompile(`(?i)invocation image|errimagepull|imagepullbackoff|container exited with code`),
+	},
+}
+
+// porterLogEntry is a line of Porter's structured (json) log output.
+type porterLogEntry struct {
+	Level   string `json:"level"`
+	Message string `json:"msg"`
+	Error   string `json:"error"`
+}
+
+// applyFailureReason determines why the agent job failed from the termination
+// state of the Porter Agent container, and records it on the Failed condition.
+// When the cause can't be determined, the Failed condition keeps the generic JobFailed reason.
+func (r *AgentActionReconciler) applyFailureReason(ctx context.Context, log logr.Logger, action *porterv1.AgentAction, job *batchv1.Job) {
+	pod, err := r.getAgentPod(ctx, job)
+	if err != nil {
+		log.Error(err, "Unable to determine why the Porter Agent failed", "job", job.Name)
+		return
+	}
+
+	reason, message := classifyFailure(getAgentTermination(pod))
+	log.V(Log4Debug).Info("Classified the Porter Agent failure", "reason", reason, "message", message)
+	apimeta.SetStatusCondition(&action.Status.Conditions, metav1.Condition{
+		Type:               string(porterv1.ConditionFailed),
+		Reason:             reason,
+		Message:            message,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: action.Generation,
+	})
+}
+
+// getAgentTermination returns how the Porter Agent container in the pod exited.
+func getAgentTermination(pod *corev1.Pod) *corev1.ContainerStateTerminated {
+	if pod == nil {
+		return nil
+	}
+
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Name != agentContainerName {
+			continue
+		}
+		if status.State.Terminated != nil {
+			return status.State.Terminated
+		}
+		return status.LastTerminationState.Terminated
+	}
+	return nil
+}
+
+// classifyFailure returns the reason and a message that describe why the
+// Porter Agent failed, based on its exit code and termination message.
+func classifyFailure(state *corev1.ContainerStateTerminated) (string, string) {
+	if state == nil {
+		return porterv1.FailureReasonJobFailed, ""
+	}
+
+	porterErr := getPorterError(state.Message)
+	if porterErr != "" {
+		for _, classification := range failureClassifications {
+			if classification.pattern.MatchString(porterErr) {
+				return classification.reason, truncateMessage(porterErr)
+			}
+		}
+	}
+
+	if state.Reason == "OOMKilled" {
+		return porterv1.FailureReasonJobFailed, "the Porter Agent ran out of memory"
+	}
+
+	message := fmt.Sprintf("the Porter Agent exited with code %d", state.ExitCode)
+	if porterErr != "" {
+		message = fmt.Sprintf("%s: %s", message, porterErr)
+	}
+	return porterv1.FailureReasonJobFailed, truncateMessage(message)
+}
+
+// getPorterError returns the error that Porter failed with, from the end of the
+// Porter Agent output, which also includes the output of the bundle. It is the
+// last of Porter's structured error entries, or when there are none, the last
+// error line printed by Porter, or the last line of the output.
+func getPorterError(output string) string {
+	lines := strings.Split(output, "\n")
+	var lastLine, lastError string
+	for i := len(lines) - 1; i >= 0; i-- {
+		line := strings.TrimSpace(lines[i])
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "{") {
+			var entry porterLogEntry
+			if err := json.Unmarshal([]byte(line), &entry); err == nil {
+				if entry.Error == "" && !strings.EqualFold(entry.Level, "error") {
+					continue
+				}
+				if entry.Error == "" {
+					return entry.Message
+				}
+				return strings.TrimPrefix(fmt.Sprintf("%s: %s", entry.Message, entry.Error), ": ")
+			}
+		}
+
+		if lastLine == "" {
+			lastLine = line
+		}
+		if lastError == "" && strings.HasPrefix(line, "Error:") {
+			lastError = line
+		}
+	}
+
+	if lastError != "" {
+		return lastError
+	}
+	return lastLine
+}
+
+func truncateMessage(message string) string {
+	if len(message) <= maxFailureMessageLength {
+		return message
+	}
+	return message[:maxFailureMessageLength-3] + "..."
+}
@@ -0,0 +1,175 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestClassifyFailure(t *testing.T) {
+	testcases := []struct {
+		name        string
+		state       *corev1.ContainerStateTerminated
+		wantReason  string
+		wantMessage string
+	}{
+		{
+			name:       "no termination state",
+			wantReason: porterv1.FailureReasonJobFailed,
+		},
+		{
+			name:        "bundle pull",
+			state:       &corev1.ContainerStateTerminated{ExitCode: 1, Message: "Error: unable to pull bundle ghcr.io/getporter/mysql:v0.1.0: manifest unknown\n"},
+			wantReason:  porterv1.FailureReasonBundlePullFailed,
+			wantMessage: "Error: unable to pull bundle ghcr.io/getporter/mysql:v0.1.0: manifest unknown",
+		},
+		{
+			name:        "credentials",
+			state:       &corev1.ContainerStateTerminated{ExitCode: 1, Message: "Error: could not resolve credentials: secret mysql-password not found\n"},
+			wantReason:  porterv1.FailureReasonCredentialResolutionFailed,
+			wantMessage: "Error: could not resolve credentials: secret mysql-password not found",
+		},
+		{
+			name:        "parameters",
+			state:       &corev1.ContainerStateTerminated{ExitCode: 1, Message: "Error: unable to resolve parameter set mysql\n"},
+			wantReason:  porterv1.FailureReasonParameterResolutionFailed,
+			wantMessage: "Error: unable to resolve parameter set mysql",
+		},
+		{
+			name:        "final error is classified",
+			state:       &corev1.ContainerStateTerminated{ExitCode: 1, Message: "Error: could not resolve credentials\nError: could not find plugin azure.keyvault\n"},
+			wantReason:  porterv1.FailureReasonPluginMissing,
+			wantMessage: "Error: could not find plugin azure.keyvault",
+		},
+		{
+			name: "bundle output is not classified",
+			state: &corev1.ContainerStateTerminated{ExitCode: 1, Message: `executing install action
+curl: (22) The requested URL returned error: 401 unauthorized
+using the credential set from the previous run
+Error: container exited with code 22
+Removing the bundle image
+`},
+			wantReason:  porterv1.FailureReasonInvocationImageFailed,
+			wantMessage: "Error: container exited with code 22",
+		},
+		{
+			name: "structured errors take precedence over other lines",
+			state: &corev1.ContainerStateTerminated{ExitCode: 1, Message: `{"level":"error","msg":"unable to resolve parameter set mysql"}
+could not resolve credentials for the database
+`},
+			wantReason:  porterv1.FailureReasonParameterResolutionFailed,
+			wantMessage: "unable to resolve parameter set mysql",
+		},
+		{
+			name:        "invocation image",
+			state:       &corev1.ContainerStateTerminated{ExitCode: 1, Message: "executing install action\nError: container exited with code 2\n"},
+			wantReason:  porterv1.FailureReasonInvocationImageFailed,
+			wantMessage: "Error: container exited with code 2",
+		},
+		{
+			name: "structured output",
+			state: &corev1.ContainerStateTerminated{ExitCode: 1, Message: `{"level":"info","msg":"pulling bundle ghcr.io/getporter/mysql:v0.1.0"}
+{"level":"error","msg":"unable to pull bundle","error":"unauthorized: authentication required"}
+`},
+			wantReason:  porterv1.FailureReasonBundlePullFailed,
+			wantMessage: "unable to pull bundle: unauthorized: authentication required",
+		},
+		{
+			name:        "out of memory",
+			state:       &corev1.ContainerStateTerminated{ExitCode: 137, Reason: "OOMKilled"},
+			wantReason:  porterv1.FailureReasonJobFailed,
+			wantMessage: "the Porter Agent ran out of memory",
+		},
+		{
+			name:        "unknown error",
+			state:       &corev1.ContainerStateTerminated{ExitCode: 2, Reason: "Error", Message: "Error: something unexpected\n"},
+			wantReason:  porterv1.FailureReasonJobFailed,
+			wantMessage: "the Porter Agent exited with code 2: Error: something unexpected",
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			reason, message := classifyFailure(tc.state)
+			assert.Equal(t, tc.wantReason, reason, "incorrect reason")
+			assert.Equal(t, tc.wantMessage, message, "incorrect message")
+		})
+	}
+}
+
+func TestClassifyFailure_LongMessage(t *testing.T) {
+	state := &corev1.ContainerStateTerminated{ExitCode: 1, Message: "Error: " + strings.Repeat("a", 2000)}
+	_, message := classifyFailure(state)
+	assert.Len(t, message, maxFailureMessageLength)
+	assert.True(t, strings.HasSuffix(message, "..."))
+}
+
+func TestAgentActionReconciler_syncStatus_FailureReason(t *testing.T) {
+	action := testAgentAction()
+	job := testFinishedJob(porterv1.PhaseFailed)
+	pod := testAgentPod("porter-hello-abc-1", job.Name, time.Now())
+	pod.Status.ContainerStatuses = []corev1.ContainerStatus{{
+		Name: "porter-agent",
+		State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+			ExitCode: 1,
+			Message:  "Error: could not resolve credentials: secret mysql-password not found\n",
+		}},
+	}}
+	controller := setupAgentActionController(action, pod)
+
+	require.NoError(t, controller.syncStatus(context.Background(), logr.Discard(), action, job))
+
+	assert.Equal(t, porterv1.PhaseFailed, action.Status.Phase)
+	failed := apimeta.FindStatusCondition(action.Status.Conditions, string(porterv1.ConditionFailed))
+	require.NotNil(t, failed, "expected the Failed condition")
+	assert.Equal(t, porterv1.FailureReasonCredentialResolutionFailed, failed.Reason)
+	assert.Equal(t, "Error: could not resolve credentials: secret mysql-password not found", failed.Message)
+
+	// The reason is kept when the status is synced again
+	require.NoError(t, controller.syncStatus(context.Background(), logr.Discard(), action, job))
+	failed = apimeta.FindStatusCondition(action.Status.Conditions, string(porterv1.ConditionFailed))
+	require.NotNil(t, failed, "expected the Failed condition")
+	assert.Equal(t, porterv1.FailureReasonCredentialResolutionFailed, failed.Reason)
+
+	// The reason is copied to the resource that created the action
+	cs := &porterv1.CredentialSet{}
+	applyAgentAction(logr.Discard(), cs, action)
+	failed = apimeta.FindStatusCondition(cs.Status.Conditions, string(porterv1.ConditionFailed))
+	require.NotNil(t, failed, "expected the Failed condition to be copied to the credential set")
+	assert.Equal(t, porterv1.FailureReasonCredentialResolutionFailed, failed.Reason)
+}
+
+func TestAgentActionReconciler_syncStatus_UnknownFailure(t *testing.T) {
+	action := testAgentAction()
+	job := testFinishedJob(porterv1.PhaseFailed)
+	controller := setupAgentActionController(action)
+
+	require.NoError(t, controller.syncStatus(context.Background(), logr.Discard(), action, job))
+
+	failed := apimeta.FindStatusCondition(action.Status.Conditions, string(porterv1.ConditionFailed))
+	require.NotNil(t, failed, "expected the Failed condition")
+	assert.Equal(t, porterv1.FailureReasonJobFailed, failed.Reason, "the generic reason should be used when there is no pod")
+}
+
+func TestGetAgentTermination(t *testing.T) {
+	assert.Nil(t, getAgentTermination(nil))
+
+	lastState := &corev1.ContainerStateTerminated{ExitCode: 1}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "mypod"},
+		Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{
+			{Name: "sidecar", State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 2}}},
+			{Name: "porter-agent", LastTerminationState: corev1.ContainerState{Terminated: lastState}},
+		}},
+	}
+	assert.Equal(t, lastState, getAgentTermination(pod), "expected the last termination state of the agent container")
+}
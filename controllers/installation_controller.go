@@ -2,8 +2,11 @@ package controllers
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"reflect"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -12,23 +15,32 @@ import (
 	porterv1alpha1 "get.porter.sh/porter/gen/proto/go/porterapis/porter/v1alpha1"
 	"github.com/go-logr/logr"
 	"github.com/pkg/errors"
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/clock"
 	"k8s.io/utils/ptr"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 )
 
 const (
-	operatorNamespace = "porter-operator-system"
+	operatorNamespace = v1.OperatorNamespace
+
+	// porterValueStrategy is the source strategy Porter uses for parameter values
+	// that are stored on the installation, instead of in a secret store.
+	porterValueStrategy = "value"
+
+	// outputsRetryInterval is how long to wait before retrieving the outputs of
+	// an installation again, after they could not be retrieved from Porter.
+	outputsRetryInterval = time.Minute
 )
 
 // InstallationReconciler calls porter to execute changes made to an Installation CRD
@@ -38,17 +50,31 @@ type InstallationReconciler struct {
 	Recorder         record.EventRecorder
 	Scheme           *runtime.Scheme
 	CreateGRPCClient func(ctx context.Context) (porterv1alpha1.PorterClient, ClientConn, error)
+
+	// Registry is used to check for new versions of the bundle. Defaults to the OCI distribution API over HTTPS.
+	Registry RegistryClient
+
+	// Clock is used to determine when retries, drift checks and update checks are due, when plans expire, and if the maintenance window is open. Defaults to the system clock.
+	Clock clock.PassiveClock
+
+	// AllowCrossNamespaceDependencies allows installations to depend on installations in other namespaces.
+	// Otherwise dependencies are limited to the same namespace, so that installations in one namespace
+	// can't wait on, or block the uninstall of, installations in another namespace.
+	AllowCrossNamespaceDependencies bool
 }
 
 // +kubebuilder:rbac:groups=getporter.org,resources=agentconfigs,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=getporter.org,resources=porterconfigs,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=getporter.org,resources=installations,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=getporter.org,resources=installationoutputs,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=getporter.org,resources=installationruns,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=getporter.org,resources=installations/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=getporter.org,resources=installationoutputs/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=getporter.org,resources=installationruns/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=getporter.org,resources=installations/finalizers,verbs=update;patch
 // +kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups="",resources=persistentvolumeclaims,verbs=get;list;watch;create;update;patch;delete
 
 // SetupWithManager sets up the controller with the Manager.
@@ -57,6 +83,16 @@ func (r *InstallationReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		For(&v1.Installation{}, builder.WithPredicates(resourceChanged{})).
 		Owns(&v1.AgentAction{}).
 		Owns(&v1.InstallationOutput{}, builder.MatchEveryOwner).
+		Owns(&v1.ParameterSet{}).
+		Watches(&v1.AgentConfig{},
+			handler.EnqueueRequestsFromMapFunc(requestsForAgentConfig(r.Client, func() client.ObjectList { return &v1.InstallationList{} })),
+			builder.WithPredicates(agentConfigSuspendChanged{})).
+		Watches(&v1.Installation{},
+			handler.EnqueueRequestsFromMapFunc(r.requestsForDependencies),
+			builder.WithPredicates(installationProgressed{})).
+		Watches(&v1.InstallationOutput{},
+			handler.EnqueueRequestsFromMapFunc(r.requestsForOutputs),
+			builder.WithPredicates(outputsChanged{})).
 		Complete(r)
 }
 
@@ -64,6 +100,13 @@ func (r *InstallationReconciler) SetupWithManager(mgr ctrl.Manager) error {
 // or a job associated with an installation is updated.
 // Either schedule a job to handle a spec change, or update the installation status in response to the job's state.
 func (r *InstallationReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	ctx, span := startReconcileSpan(ctx, "Installation", req)
+	result, err := r.reconcile(ctx, req)
+	endSpan(span, err)
+	return result, err
+}
+
+func (r *InstallationReconciler) reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	log := r.Log.WithValues("installation", req.Name, "namespace", req.Namespace)
 
 	// Retrieve the Installation
@@ -77,6 +120,12 @@ func (r *InstallationReconciler) Reconcile(ctx context.Context, req ctrl.Request
 		return ctrl.Result{}, err
 	}
 
+	// Leave the installation as-is while it is suspended, changes are applied when it is resumed
+	if suspended, err := checkSuspended(ctx, log, r.Client, r.Recorder, inst, inst.Spec.Suspend, inst.Spec.AgentConfig); err != nil || suspended {
+		log.V(Log4Debug).Info("Reconciliation skipped: The installation is suspended.")
+		return ctrl.Result{}, err
+	}
+
 	if inst.DeletionTimestamp != nil {
 		if controllerutil.ContainsFinalizer(inst, v1.FinalizerName) {
 			controllerutil.RemoveFinalizer(inst, v1.FinalizerName)
@@ -115,6 +164,11 @@ func (r *InstallationReconciler) Reconcile(ctx context.Context, req ctrl.Request
 
 	// Check if we have already handled any spec changes
 	if handled {
+		// Record the run in the history of the installation once the agent has finished
+		if err = r.recordRun(ctx, log, inst, action); err != nil {
+			return ctrl.Result{}, err
+		}
+
 		// Check if a retry was requested
 		if action.GetRetryLabelValue() != inst.GetRetryLabelValue() {
 			err = r.retry(ctx, log, inst, action)
@@ -122,14 +176,53 @@ func (r *InstallationReconciler) Reconcile(ctx context.Context, req ctrl.Request
 			return ctrl.Result{}, err
 		}
 
+		// Check if the failed installation should be retried automatically
+		if result, retrying, err := r.retryFailure(ctx, log, inst, action); err != nil || retrying {
+			return result, err
+		}
+
+		// Record what Porter would do when the installation was evaluated with a dry-run
+		if isDryRunAction(action) {
+			if err = r.recordPlan(ctx, log, inst, action); err != nil {
+				return ctrl.Result{}, err
+			}
+
+			// Apply the change once its plan is approved
+			if !inst.Spec.DryRun {
+				return r.checkApproval(ctx, log, inst, action)
+			}
+
+			log.V(Log4Debug).Info("Reconciliation complete: The installation was evaluated with a dry-run.")
+			return ctrl.Result{}, nil
+		}
+
 		// Nothing for us to do at this point
 		log.V(Log4Debug).Info("Reconciliation complete: A porter agent has already been dispatched.")
 		log.V(Log4Debug).Info(fmt.Sprintf("performing installation outputs for %s", inst.Name))
-		return r.CheckOrCreateInstallationOutputsCR(ctx, log, inst)
+		// Failures to record the outputs do not stop the drift and update checks
+		outputsResult, outputsErr := r.CheckOrCreateInstallationOutputsCR(ctx, log, inst)
+		if outputsErr == nil {
+			outputsErr = r.syncOutputs(ctx, log, inst)
+		}
+		driftResult, err := r.checkDrift(ctx, log, inst)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		// The update check is part of reconciling the installation, so that only one controller updates its status
+		updateResult, err := r.checkBundleUpdate(ctx, log, inst)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		return earliestResult(earliestResult(driftResult, outputsResult), updateResult), outputsErr
 	}
 
 	// Should we uninstall the bundle?
 	if r.shouldUninstall(inst) {
+		// Installations are uninstalled after the installations that depend on them
+		if waiting, err := r.checkDependents(ctx, log, inst); err != nil || waiting {
+			return ctrl.Result{}, err
+		}
+
 		err = r.uninstallInstallation(ctx, log, inst)
 		log.V(Log4Debug).Info("Reconciliation complete: A porter agent has been dispatched to uninstall the installation.")
 		return ctrl.Result{}, err
@@ -156,25 +249,63 @@ func (r *InstallationReconciler) Reconcile(ctx context.Context, req ctrl.Request
 		return ctrl.Result{}, nil
 	}
 
-	// Use porter to finish reconciling the installation
-	err = r.applyInstallation(ctx, log, inst)
+	// Installations are applied after their dependencies, and uninstalled before them
+	var waiting bool
+	if inst.Spec.Uninstalled {
+		waiting, err = r.checkDependents(ctx, log, inst)
+	} else {
+		waiting, err = r.checkDependencies(ctx, log, inst)
+		if err == nil && !waiting {
+			waiting, err = r.checkParameterSources(ctx, log, inst)
+		}
+	}
+	if err != nil || waiting {
+		return ctrl.Result{}, err
+	}
+
+	// Changes that must be approved are planned first, and applied once the plan is approved
+	approvalPolicy, err := r.resolveApprovalPolicy(ctx, log, inst)
 	if err != nil {
 		return ctrl.Result{}, err
 	}
 
-	log.V(Log4Debug).Info("Reconciliation complete: A porter agent has been dispatched to apply changes to the installation.")
-	// NOTE:  If this is nil, it will use the default policy of Delete
-	err = r.applyDeletionPolicy(ctx, log, inst, inst.GetAnnotations()[v1.PorterDeletePolicyAnnotation])
+	// Use porter to finish reconciling the installation
+	if approvalPolicy.IsRequired() && !inst.Spec.DryRun {
+		err = r.planInstallation(ctx, log, inst)
+	} else {
+		err = r.applyInstallation(ctx, log, inst)
+	}
 	if err != nil {
 		return ctrl.Result{}, err
 	}
 
+	if inst.Spec.DryRun {
+		log.V(Log4Debug).Info("Reconciliation complete: A porter agent has been dispatched to evaluate changes to the installation with a dry-run.")
+		return ctrl.Result{}, nil
+	}
+
 	log.V(Log4Debug).Info("Reconciliation complete: A porter agent has been dispatched to apply changes to the installation.")
 	log.V(Log4Debug).Info(fmt.Sprintf("performing installation outputs for %s", inst.Name))
 	return r.CheckOrCreateInstallationOutputsCR(ctx, log, inst)
 }
 
 func (r *InstallationReconciler) CheckOrCreateInstallationOutputsCR(ctx context.Context, log logr.Logger, inst *v1.Installation) (ctrl.Result, error) {
+	installCr := &v1.InstallationOutput{}
+	err := r.Get(ctx, types.NamespacedName{Name: inst.Spec.Name, Namespace: inst.Namespace}, installCr)
+	exists := err == nil
+	if err != nil && !apierrors.IsNotFound(err) {
+		return ctrl.Result{}, errors.Wrap(err, "could not retrieve the installation outputs")
+	}
+	if exists {
+		// Outputs created before sensitive values were stored in a Secret are redacted
+		if err = r.migrateSensitiveOutputs(ctx, log, installCr); err != nil {
+			return ctrl.Result{}, err
+		}
+		if !isOutputsStale(inst, installCr) {
+			return ctrl.Result{}, nil
+		}
+	}
+
 	// NOTE: May not want to requeue if this fails
 	if r.CreateGRPCClient == nil {
 		log.V(Log4Debug).Info("no grpc client function set on controller")
@@ -184,59 +315,124 @@ func (r *InstallationReconciler) CheckOrCreateInstallationOutputsCR(ctx context.
 
 	porterGRPCClient, conn, err := r.CreateGRPCClient(ctx)
 	if err != nil {
-		log.V(Log4Debug).Info("no grpc client... Not performing installation outputs")
-		r.Recorder.Event(inst, "Warning", "CreateInstallationOutputs", "no grpc client not creating installation outputs")
-		return ctrl.Result{}, nil
+		outputFetchErrors.WithLabelValues(inst.Namespace).Inc()
+		return r.setOutputsUnavailable(ctx, log, inst, "PorterServerUnavailable", errors.Wrap(err, "could not connect to the porter server"))
 	}
 	defer conn.Close()
-	installCr := &v1.InstallationOutput{}
-	err = r.Get(ctx, types.NamespacedName{Name: inst.Spec.Name, Namespace: inst.Spec.Namespace}, installCr)
+	if exists {
+		log.V(Log4Debug).Info("installation output cr is out of date, refreshing the outputs")
+	} else {
+		log.V(Log4Debug).Info("installation output cr doesn't exist, seeing if we should create")
+	}
+	in := &installationv1.ListInstallationLatestOutputRequest{Name: inst.Spec.Name, Namespace: ptr.To(inst.Spec.Namespace)}
+	resp, err := porterGRPCClient.ListInstallationLatestOutputs(ctx, in)
 	if err != nil {
-		if apierrors.IsNotFound(err) {
-			log.V(Log4Debug).Info("installation output cr doesn't exist, seeing if we should create")
-			in := &installationv1.ListInstallationLatestOutputRequest{Name: inst.Spec.Name, Namespace: ptr.To(inst.Spec.Namespace)}
-			resp, err := porterGRPCClient.ListInstallationLatestOutputs(ctx, in)
-			if err != nil {
-				log.V(Log4Debug).Info(fmt.Sprintf("failed to get output from grpc server for: %s:%s installation error: %s", inst.Spec.Name, inst.Spec.Namespace, err.Error()))
-				// NOTE: Stop installation output cr creation
-				r.Recorder.Event(inst, "Warning", "CreatingInstallationOutputs", fmt.Sprintf("created installation outputs failed for %s", inst.Name))
-				return ctrl.Result{}, nil
-			}
-			// TODO: Separate this into it's own func to test and extract what you
-			// can
-			log.V(Log5Trace).Info("creating installation outputs cr")
-			outputs, err := r.CreateInstallationOutputsCR(ctx, inst, resp)
-			if err != nil {
-				log.V(Log4Debug).Error(err, "error creating installation outputs resource")
-				return ctrl.Result{}, err
-			}
-			// TODO: Wrap in a retry? Try to reduce the errors
-			log.V(Log5Trace).Info("setting owner references on outputs cr")
-			controllerutil.SetOwnerReference(inst, outputs, r.Scheme)
-			err = r.Create(ctx, outputs, &client.CreateOptions{})
-			if err != nil {
-				return ctrl.Result{}, err
-			}
-			r.Recorder.Event(inst, "Normal", "CreatingInstallationOutputs", fmt.Sprintf("created installation outputs for %s", inst.Name))
-			installOutputs, err := r.CreateStatusOutputs(ctx, outputs, resp)
-			if err != nil {
-				return ctrl.Result{}, err
-			}
+		outputFetchErrors.WithLabelValues(inst.Namespace).Inc()
+		// NOTE: Stop installation output cr creation
+		return r.setOutputsUnavailable(ctx, log, inst, "OutputsFetchFailed", errors.Wrapf(err, "could not retrieve the outputs of %s/%s from porter", inst.Spec.Namespace, inst.Spec.Name))
+	}
 
-			err = r.Status().Update(ctx, installOutputs)
-			if err != nil {
-				return ctrl.Result{}, err
-			}
-			log.V(Log5Trace).Info("successfully created outputs cr")
-			patchInstall := client.MergeFrom(inst.DeepCopy())
-			inst.SetAnnotations(map[string]string{v1.AnnotationInstallationOutput: "true"})
-			log.V(Log5Trace).Info("patching installation cr")
-			return ctrl.Result{}, r.Patch(ctx, inst, patchInstall)
+	// Bundles without outputs have nothing to record
+	if !exists && len(resp.Outputs) == 0 {
+		log.V(Log5Trace).Info("the installation has no outputs")
+		return ctrl.Result{}, r.setOutputsAvailable(ctx, log, inst)
+	}
+
+	if !exists {
+		// TODO: Separate this into it's own func to test and extract what you
+		// can
+		log.V(Log5Trace).Info("creating installation outputs cr")
+		installCr, err = r.CreateInstallationOutputsCR(ctx, inst, resp)
+		if err != nil {
+			log.V(Log4Debug).Error(err, "error creating installation outputs resource")
+			return ctrl.Result{}, err
 		}
+		// TODO: Wrap in a retry? Try to reduce the errors
+		log.V(Log5Trace).Info("setting owner references on outputs cr")
+		controllerutil.SetOwnerReference(inst, installCr, r.Scheme)
+		err = r.Create(ctx, installCr, &client.CreateOptions{})
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		r.Recorder.Event(inst, "Normal", "CreatingInstallationOutputs", fmt.Sprintf("created installation outputs for %s", inst.Name))
+	}
+
+	installOutputs, err := r.CreateStatusOutputs(ctx, installCr, resp)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	r.recordOutputsRun(ctx, log, porterGRPCClient, inst, installOutputs)
+	if _, err = r.storeSensitiveOutputs(ctx, installOutputs); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	err = r.Status().Update(ctx, installOutputs)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if err = r.setOutputsAvailable(ctx, log, inst); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if exists {
+		log.V(Log5Trace).Info("successfully refreshed outputs cr")
+		r.Recorder.Event(inst, "Normal", "RefreshedInstallationOutputs", fmt.Sprintf("refreshed installation outputs for %s from %s", inst.Name, inst.Status.Action.Name))
+		return ctrl.Result{}, nil
+	}
+
+	log.V(Log5Trace).Info("successfully created outputs cr")
+	patchInstall := client.MergeFrom(inst.DeepCopy())
+	// Keep the other annotations on the installation, such as its deletion policy
+	annotations := make(map[string]string, len(inst.GetAnnotations())+1)
+	for k, v := range inst.GetAnnotations() {
+		annotations[k] = v
 	}
-	patchInstallCR := client.MergeFrom(installCr.DeepCopy())
-	return ctrl.Result{}, r.Patch(ctx, installCr, patchInstallCR)
+	annotations[v1.AnnotationInstallationOutput] = "true"
+	inst.SetAnnotations(annotations)
+	log.V(Log5Trace).Info("patching installation cr")
+	return ctrl.Result{}, r.Patch(ctx, inst, patchInstall)
 }
+
+// setOutputsUnavailable records that the outputs of the installation could not
+// be retrieved from Porter, and requeues the installation to try again. Outputs
+// are only expected once the installation has succeeded, until then the
+// failure is only logged.
+func (r *InstallationReconciler) setOutputsUnavailable(ctx context.Context, log logr.Logger, inst *v1.Installation, reason string, err error) (ctrl.Result, error) {
+	log.V(Log4Debug).Info("Unable to retrieve the installation outputs", "error", err.Error())
+	if inst.Status.Phase != v1.PhaseSucceeded || inst.Spec.Uninstalled {
+		return ctrl.Result{}, nil
+	}
+
+	if !apimeta.IsStatusConditionFalse(inst.Status.Conditions, v1.ConditionOutputsAvailable) {
+		r.Recorder.Event(inst, "Warning", "OutputsUnavailable", err.Error())
+	}
+	apimeta.SetStatusCondition(&inst.Status.Conditions, metav1.Condition{
+		Type:               v1.ConditionOutputsAvailable,
+		Status:             metav1.ConditionFalse,
+		Reason:             reason,
+		Message:            err.Error(),
+		ObservedGeneration: inst.Generation,
+	})
+	if err = r.saveStatus(ctx, log, inst); err != nil {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{RequeueAfter: outputsRetryInterval}, nil
+}
+
+// setOutputsAvailable records that the outputs of the installation were retrieved from Porter.
+func (r *InstallationReconciler) setOutputsAvailable(ctx context.Context, log logr.Logger, inst *v1.Installation) error {
+	origStatus := inst.Status.DeepCopy()
+	apimeta.SetStatusCondition(&inst.Status.Conditions, metav1.Condition{
+		Type:               v1.ConditionOutputsAvailable,
+		Status:             metav1.ConditionTrue,
+		Reason:             "OutputsRetrieved",
+		Message:            "the outputs were retrieved from porter",
+		ObservedGeneration: inst.Generation,
+	})
+	return r.saveStatusIfChanged(ctx, log, inst, origStatus)
+}
+
 func (r *InstallationReconciler) CreateStatusOutputs(ctx context.Context, install *v1.InstallationOutput, in *installationv1.ListInstallationLatestOutputResponse) (*v1.InstallationOutput, error) {
 	install.Status = v1.InstallationOutputStatus{
 		Phase: v1.PhaseSucceeded,
@@ -258,7 +454,7 @@ func (r *InstallationReconciler) CreateStatusOutputs(ctx context.Context, instal
 			Name:      output.Name,
 			Type:      output.Type,
 			Sensitive: output.Sensitive,
-			Value:     output.GetValue().GetStringValue(),
+			Value:     getPorterValue(output.GetValue()),
 		}
 		outputNames = append(outputNames, output.Name)
 		outputs = append(outputs, tmpOutput)
@@ -294,20 +490,63 @@ func (r *InstallationReconciler) isHandled(ctx context.Context, log logr.Logger,
 	if err != nil {
 		return nil, false, errors.Wrapf(err, "could not query for the current agent action")
 	}
+
 	if len(results.Items) == 0 {
 		log.V(Log4Debug).Info("No existing agent action was found")
 		return nil, false, nil
 	}
 
+	var digest string
+	if !isDeleted(inst) {
+		digest, err = r.getParametersDigest(ctx, inst)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
 	action := results.Items[0]
+	for _, item := range results.Items[1:] {
+		if isLaterAction(&item, &action, digest) {
+			action = item
+		}
+	}
+
+	// Installations with parameter sources are applied again when the resolved values change,
+	// including when they change back to values that were applied by an earlier action
+	if digest != "" && action.Labels[v1.LabelParametersDigest] != digest {
+		log.V(Log4Debug).Info("The parameter sources changed since the latest agent action", "agentaction", action.Name)
+		return nil, false, nil
+	}
+
 	log.V(Log4Debug).Info("Found existing agent action", "agentaction", action.Name, "namespace", action.Namespace)
 	return &action, true, nil
 }
 
+// isLaterAction determines if the action was created after the other action
+// for the same generation of the installation. When the installation was
+// automatically retried, there is an action for each attempt, and when the
+// installation was approved, there is an action that planned it and one that
+// applied it. Actions created in the same second are ordered by the steps that
+// created them, and then by whether they used the current parameters.
+func isLaterAction(action *v1.AgentAction, other *v1.AgentAction, digest string) bool {
+	if !action.CreationTimestamp.Equal(&other.CreationTimestamp) {
+		return other.CreationTimestamp.Before(&action.CreationTimestamp)
+	}
+	if isDryRunAction(action) != isDryRunAction(other) {
+		return !isDryRunAction(action)
+	}
+	if getRetryAttempt(action) != getRetryAttempt(other) {
+		return getRetryAttempt(action) > getRetryAttempt(other)
+	}
+	return digest != "" && action.Labels[v1.LabelParametersDigest] == digest && other.Labels[v1.LabelParametersDigest] != digest
+}
+
 // Run the porter agent with the command `porter installation apply`
 func (r *InstallationReconciler) applyInstallation(ctx context.Context, log logr.Logger, inst *v1.Installation) error {
 	log.V(Log5Trace).Info("Initializing installation status")
 	inst.Status.Initialize()
+	inst.Status.RetryAttempts = 0
+	inst.Status.NextRetryTime = nil
 	if err := r.saveStatus(ctx, log, inst); err != nil {
 		return err
 	}
@@ -342,17 +581,48 @@ func (r *InstallationReconciler) runPorter(ctx context.Context, log logr.Logger,
 }
 
 // create an AgentAction that will trigger running porter
-func (r *InstallationReconciler) createAgentAction(ctx context.Context, log logr.Logger, inst *v1.Installation) (*v1.AgentAction, error) {
+func (r *InstallationReconciler) createAgentAction(ctx context.Context, log logr.Logger, inst *v1.Installation) (_ *v1.AgentAction, err error) {
+	ctx, span := tracer().Start(ctx, "Create AgentAction")
+	defer func() { endSpan(span, err) }()
+
 	log.V(Log5Trace).Info("Creating porter agent action")
 
-	installationResourceB, err := inst.Spec.ToPorterDocument()
+	labels := getActionLabels(inst)
+	for k, v := range inst.Labels {
+		labels[k] = v
+	}
+	if inst.Status.RetryAttempts > 0 {
+		labels[v1.LabelRetryAttempt] = strconv.Itoa(int(inst.Status.RetryAttempts))
+	}
+
+	// Parameter sources are resolved into the parameters given to Porter,
+	// sensitive outputs are passed by reference in a parameter set
+	spec := inst.Spec
+	if len(spec.ParameterSources) > 0 {
+		resolved, err := r.resolveParameters(ctx, inst)
+		if err != nil {
+			return nil, err
+		}
+		spec.Parameters = resolved.Parameters
+		if len(resolved.Sensitive) > 0 {
+			spec.ParameterSets = append(append([]string(nil), spec.ParameterSets...), getOutputParameterSetName(spec))
+		}
+		if len(resolved.Pending) == 0 {
+			labels[v1.LabelParametersDigest] = resolved.Digest()
+		} else {
+			log.V(Log4Debug).Info("Applying the installation without the outputs that are not available", "pending", resolved.Pending)
+		}
+	}
+
+	installationResourceB, err := spec.ToPorterDocument()
 	if err != nil {
 		return nil, err
 	}
 
-	labels := getActionLabels(inst)
-	for k, v := range inst.Labels {
-		labels[k] = v
+	args := []string{"installation", "apply", "installation.yaml"}
+	// Installations that are deleted are always uninstalled, even when changes are evaluated with a dry-run
+	if inst.Spec.DryRun && !isDeleted(inst) {
+		args = append(args, dryRunFlag)
 	}
 
 	action := &v1.AgentAction{
@@ -364,12 +634,13 @@ func (r *InstallationReconciler) createAgentAction(ctx context.Context, log logr
 		},
 		Spec: v1.AgentActionSpec{
 			AgentConfig: inst.Spec.AgentConfig,
-			Args:        []string{"installation", "apply", "installation.yaml"},
+			Args:        args,
 			Files: map[string][]byte{
 				"installation.yaml": installationResourceB,
 			},
 		},
 	}
+	injectTraceContext(ctx, action)
 	if err := controllerutil.SetControllerReference(inst, action, r.Scheme); err != nil {
 		return nil, err
 	}
@@ -382,11 +653,356 @@ func (r *InstallationReconciler) createAgentAction(ctx context.Context, log logr
 	return action, nil
 }
 
+// getBundleActionArgs builds the porter command that runs the specified bundle
+// action against an existing installation. The built-in actions use their
+// dedicated porter command, custom actions are run with porter invoke.
+func getBundleActionArgs(inst *v1.Installation, action string) []string {
+	var args []string
+	switch action {
+	case "install", "upgrade", "uninstall":
+		args = []string{action, inst.Spec.Name}
+	default:
+		args = []string{"invoke", inst.Spec.Name, "--action", action}
+	}
+	return append(args, "--namespace", inst.Spec.Namespace)
+}
+
+// checkDrift compares the installation with the installation recorded by Porter,
+// when drift detection is enabled, and requeues the installation for the next check.
+func (r *InstallationReconciler) checkDrift(ctx context.Context, log logr.Logger, inst *v1.Installation) (ctrl.Result, error) {
+	interval, policy, err := r.resolveDriftPolicy(ctx, log, inst)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if interval <= 0 {
+		return ctrl.Result{}, nil
+	}
+
+	// Only compare with Porter after the installation was applied successfully,
+	// we are requeued when the agent action completes.
+	if isDeleted(inst) || inst.Spec.Uninstalled || inst.Status.Phase != v1.PhaseSucceeded {
+		log.V(Log5Trace).Info("Skipping drift detection until the installation has been applied")
+		return ctrl.Result{}, nil
+	}
+
+	now := r.now()
+	if inst.Status.LastResyncTime != nil {
+		if wait := inst.Status.LastResyncTime.Add(interval).Sub(now); wait > 0 {
+			log.V(Log5Trace).Info("Waiting for the next drift check", "wait", wait)
+			return ctrl.Result{RequeueAfter: wait}, nil
+		}
+	}
+
+	log.V(Log5Trace).Info("Checking the installation for drift")
+	drift, err := r.getDrift(ctx, inst)
+	if err != nil {
+		// Don't fail the reconcile when Porter can't be reached, try again at the next interval
+		log.V(Log4Debug).Info("Unable to check the installation for drift", "error", err.Error())
+		r.Recorder.Event(inst, "Warning", "DriftCheckFailed", fmt.Sprintf("unable to check %s for drift: %s", inst.Name, err))
+		return ctrl.Result{RequeueAfter: interval}, nil
+	}
+
+	inst.Status.LastResyncTime = &metav1.Time{Time: now}
+	if len(drift) == 0 {
+		apimeta.SetStatusCondition(&inst.Status.Conditions, metav1.Condition{
+			Type:               v1.ConditionDrifted,
+			Status:             metav1.ConditionFalse,
+			Reason:             "InSync",
+			Message:            "the installation matches the installation recorded by Porter",
+			ObservedGeneration: inst.Generation,
+		})
+	} else {
+		msg := strings.Join(drift, "; ")
+		log.V(Log4Debug).Info("Drift detected", "drift", msg)
+		if !apimeta.IsStatusConditionTrue(inst.Status.Conditions, v1.ConditionDrifted) {
+			r.Recorder.Event(inst, "Warning", "DriftDetected", msg)
+		}
+		apimeta.SetStatusCondition(&inst.Status.Conditions, metav1.Condition{
+			Type:               v1.ConditionDrifted,
+			Status:             metav1.ConditionTrue,
+			Reason:             "DriftDetected",
+			Message:            msg,
+			ObservedGeneration: inst.Generation,
+		})
+	}
+	if err = r.saveStatus(ctx, log, inst); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if len(drift) > 0 && policy == v1.DriftPolicyCorrect {
+		// Re-apply the installation by requesting a retry of the last agent action
+		log.V(Log4Debug).Info("Re-applying the installation to correct drift")
+		r.Recorder.Event(inst, "Normal", "CorrectDrift", fmt.Sprintf("re-applying %s to correct drift", inst.Name))
+		patch := client.MergeFrom(inst.DeepCopy())
+		inst.SetRetryAnnotation(fmt.Sprintf("drift-%d", now.Unix()))
+		if err = r.Patch(ctx, inst, patch); err != nil {
+			return ctrl.Result{}, errors.Wrap(err, "error requesting the installation be re-applied to correct drift")
+		}
+	}
+
+	log.V(Log4Debug).Info("Reconciliation complete: Waiting for the next drift check.", "interval", interval)
+	return ctrl.Result{RequeueAfter: interval}, nil
+}
+
+// resolveDriftPolicy determines how often to check the installation for drift, and how to handle it.
+// The values on the installation take precedence over the resolved AgentConfig.
+func (r *InstallationReconciler) resolveDriftPolicy(ctx context.Context, log logr.Logger, inst *v1.Installation) (time.Duration, v1.DriftPolicy, error) {
+	var interval time.Duration
+	policy := inst.Spec.DriftPolicy
+	if inst.Spec.ResyncInterval != nil {
+		interval = inst.Spec.ResyncInterval.Duration
+	}
+
+	if inst.Spec.ResyncInterval == nil || policy == "" {
+		agentCfg, err := resolveAgentConfigSpec(ctx, log, r.Client, inst.Namespace, inst.Spec.AgentConfig)
+		if err != nil {
+			return 0, "", err
+		}
+		cfg := v1.NewAgentConfigSpecAdapter(agentCfg.Spec)
+		if inst.Spec.ResyncInterval == nil {
+			interval = cfg.GetResyncInterval()
+		}
+		if policy == "" {
+			policy = cfg.GetDriftPolicy()
+		}
+	}
+
+	return interval, policy, nil
+}
+
+// retryFailure creates a new agent action to run the installation again after
+// it failed, when allowed by the retry policy. Retries are delayed with an
+// exponential backoff. Returns true when the installation is being retried,
+// and the result requeues the installation until the next retry.
+func (r *InstallationReconciler) retryFailure(ctx context.Context, log logr.Logger, inst *v1.Installation, action *v1.AgentAction) (ctrl.Result, bool, error) {
+	if isDeleted(inst) || action.Status.Phase != v1.PhaseFailed {
+		return ctrl.Result{}, false, nil
+	}
+
+	failed := apimeta.FindStatusCondition(action.Status.Conditions, string(v1.ConditionFailed))
+	if failed == nil {
+		return ctrl.Result{}, false, nil
+	}
+
+	policy, err := r.resolveRetryPolicy(ctx, log, inst)
+	if err != nil {
+		return ctrl.Result{}, false, err
+	}
+	if policy == nil || !policy.IsRetryable(failed.Reason) {
+		log.V(Log5Trace).Info("Not retrying the failed installation because of the retry policy", "reason", failed.Reason)
+		return ctrl.Result{}, false, nil
+	}
+	if inst.Status.RetryAttempts >= policy.MaxAttempts {
+		if inst.Status.NextRetryTime != nil {
+			inst.Status.NextRetryTime = nil
+			r.Recorder.Event(inst, "Warning", "RetryLimitReached", fmt.Sprintf("%s failed after %d retries", inst.Name, inst.Status.RetryAttempts))
+			return ctrl.Result{}, false, r.saveStatus(ctx, log, inst)
+		}
+		return ctrl.Result{}, false, nil
+	}
+
+	now := r.now()
+	// Round to the precision of the time saved in the status
+	nextRetry := failed.LastTransitionTime.Add(policy.GetBackoff(inst.Status.RetryAttempts)).Truncate(time.Second)
+	if wait := nextRetry.Sub(now); wait > 0 {
+		if inst.Status.NextRetryTime == nil || !inst.Status.NextRetryTime.Time.Equal(nextRetry) {
+			inst.Status.NextRetryTime = &metav1.Time{Time: nextRetry}
+			if err = r.saveStatus(ctx, log, inst); err != nil {
+				return ctrl.Result{}, false, err
+			}
+		}
+		log.V(Log4Debug).Info("Reconciliation complete: Waiting to retry the failed installation.", "wait", wait)
+		return ctrl.Result{RequeueAfter: wait}, true, nil
+	}
+
+	inst.Status.Initialize()
+	inst.Status.RetryAttempts++
+	inst.Status.NextRetryTime = nil
+	if err = r.saveStatus(ctx, log, inst); err != nil {
+		return ctrl.Result{}, false, err
+	}
+
+	// A plan that failed is planned again, the change is only applied once it is approved
+	if isDryRunAction(action) {
+		log.V(Log5Trace).Info("Setting dryRun=true to retry planning the change to the installation")
+		inst.Spec.DryRun = true
+	}
+
+	r.Recorder.Event(inst, "Normal", "RetryFailure", fmt.Sprintf("retrying %s after it failed with %s, attempt %d of %d", inst.Name, failed.Reason, inst.Status.RetryAttempts, policy.MaxAttempts))
+	retries.WithLabelValues("Installation", inst.Namespace).Inc()
+	if err = r.runPorter(ctx, log, inst); err != nil {
+		return ctrl.Result{}, false, err
+	}
+
+	log.V(Log4Debug).Info("Reconciliation complete: A porter agent has been dispatched to retry the failed installation.", "attempt", inst.Status.RetryAttempts)
+	return ctrl.Result{}, true, nil
+}
+
+// resolveRetryPolicy determines how the installation is retried when it fails.
+// The policy on the installation takes precedence over the resolved AgentConfig.
+func (r *InstallationReconciler) resolveRetryPolicy(ctx context.Context, log logr.Logger, inst *v1.Installation) (*v1.RetryPolicy, error) {
+	if inst.Spec.RetryPolicy != nil {
+		return inst.Spec.RetryPolicy, nil
+	}
+
+	agentCfg, err := resolveAgentConfigSpec(ctx, log, r.Client, inst.Namespace, inst.Spec.AgentConfig)
+	if err != nil {
+		return nil, err
+	}
+	return v1.NewAgentConfigSpecAdapter(agentCfg.Spec).GetRetryPolicy(), nil
+}
+
+// getDrift retrieves the installation from Porter and returns a description of
+// each difference from the installation resource.
+func (r *InstallationReconciler) getDrift(ctx context.Context, inst *v1.Installation) ([]string, error) {
+	if r.CreateGRPCClient == nil {
+		return nil, errors.New("no grpc client function set on controller")
+	}
+
+	porterGRPCClient, conn, err := r.CreateGRPCClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	in := &installationv1.ListInstallationsRequest{Name: inst.Spec.Name, Namespace: ptr.To(inst.Spec.Namespace)}
+	resp, err := porterGRPCClient.ListInstallations(ctx, in)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list the installation %s/%s from porter", inst.Spec.Namespace, inst.Spec.Name)
+	}
+
+	for _, porterInst := range resp.GetInstallation() {
+		if porterInst.GetName() == inst.Spec.Name && porterInst.GetNamespace() == inst.Spec.Namespace {
+			return compareInstallation(inst.Spec, porterInst), nil
+		}
+	}
+	return []string{"the installation is not recorded by Porter"}, nil
+}
+
+// compareInstallation returns a description of each difference between the
+// installation resource and the installation recorded by Porter.
+func compareInstallation(spec v1.InstallationSpec, porterInst *installationv1.Installation) []string {
+	var drift []string
+	compare := func(field string, want string, got string) {
+		if want != got {
+			drift = append(drift, fmt.Sprintf("%s is %q, expected %q", field, got, want))
+		}
+	}
+
+	if spec.Uninstalled != porterInst.GetUninstalled() {
+		drift = append(drift, fmt.Sprintf("uninstalled is %t, expected %t", porterInst.GetUninstalled(), spec.Uninstalled))
+	}
+
+	bundle := porterInst.GetBundle()
+	compare("bundle.repository", spec.Bundle.Repository, bundle.GetRepository())
+	// Only compare the parts of the bundle reference that were specified, Porter resolves the rest
+	if spec.Bundle.Digest != "" {
+		compare("bundle.digest", spec.Bundle.Digest, bundle.GetDigest())
+	}
+	if spec.Bundle.Version != "" {
+		compare("bundle.version", spec.Bundle.Version, bundle.GetVersion())
+	}
+	if spec.Bundle.Tag != "" {
+		compare("bundle.tag", spec.Bundle.Tag, bundle.GetTag())
+	}
+
+	compare("credentialSets", strings.Join(spec.CredentialSets, ","), strings.Join(porterInst.GetCredentialSets(), ","))
+	// The parameter set with the sensitive outputs is added by the operator
+	var paramSets []string
+	for _, ps := range porterInst.GetParameterSets() {
+		if ps != getOutputParameterSetName(spec) {
+			paramSets = append(paramSets, ps)
+		}
+	}
+	compare("parameterSets", strings.Join(spec.ParameterSets, ","), strings.Join(paramSets, ","))
+	drift = append(drift, compareParameters(spec, porterInst)...)
+
+	if !(len(spec.Labels) == 0 && len(porterInst.GetLabels()) == 0) && !reflect.DeepEqual(spec.Labels, porterInst.GetLabels()) {
+		drift = append(drift, "labels do not match")
+	}
+
+	return drift
+}
+
+// compareParameters returns a description of each parameter that does not match
+// the parameter recorded by Porter. Values are not included in the description
+// because the parameter may be sensitive. Parameters that are resolved from a
+// parameter source, and parameters that Porter stores as a secret, are not compared.
+func compareParameters(spec v1.InstallationSpec, porterInst *installationv1.Installation) []string {
+	want := make(map[string]interface{})
+	if spec.Parameters.Raw != nil {
+		if err := json.Unmarshal(spec.Parameters.Raw, &want); err != nil {
+			return []string{"parameters could not be compared"}
+		}
+	}
+
+	skip := make(map[string]bool, len(spec.ParameterSources))
+	for _, param := range spec.ParameterSources {
+		skip[param.Name] = true
+	}
+
+	got := make(map[string]*installationv1.ValueSource)
+	for _, param := range porterInst.GetParameters().GetParameters() {
+		got[param.GetName()] = param.GetSource()
+	}
+
+	names := make([]string, 0, len(want)+len(got))
+	for name := range want {
+		names = append(names, name)
+	}
+	for name := range got {
+		if _, ok := want[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var drift []string
+	for _, name := range names {
+		if skip[name] {
+			continue
+		}
+		value, ok := want[name]
+		source, recorded := got[name]
+		switch {
+		case !recorded:
+			drift = append(drift, fmt.Sprintf("parameters.%s is not set", name))
+		case !ok:
+			drift = append(drift, fmt.Sprintf("parameters.%s is set, expected it to not be set", name))
+		case source.GetStrategy() == porterValueStrategy && source.GetHint() != formatParameterValue(value):
+			drift = append(drift, fmt.Sprintf("parameters.%s does not match", name))
+		}
+	}
+	return drift
+}
+
+// formatParameterValue formats a parameter value the way it is recorded by Porter.
+func formatParameterValue(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return s
+	}
+	b, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return string(b)
+}
+
 // Check the status of the porter-agent job and use that to update the AgentAction status
 func (r *InstallationReconciler) syncStatus(ctx context.Context, log logr.Logger, inst *v1.Installation, action *v1.AgentAction) error {
 	origStatus := inst.Status
 
 	applyAgentAction(log, inst, action)
+	applyApprovalPhase(inst, action, r.now())
+	applyDependencyPhase(inst, action)
+
+	if logs := inst.Status.Logs; logs != nil && !reflect.DeepEqual(origStatus.Logs, logs) {
+		eventType := "Normal"
+		if inst.Status.Phase == v1.PhaseFailed {
+			eventType = "Warning"
+		}
+		r.Recorder.Event(inst, eventType, "AgentLogs", fmt.Sprintf("the Porter Agent logs for %s are in the ConfigMap %s", action.Name, logs.Name))
+	}
 
 	if !reflect.DeepEqual(origStatus, inst.Status) {
 		return r.saveStatus(ctx, log, inst)
@@ -405,11 +1021,21 @@ func (r *InstallationReconciler) saveStatus(ctx context.Context, log logr.Logger
 
 func (r *InstallationReconciler) shouldUninstall(inst *v1.Installation) bool {
 	// ignore a deleted CRD with no finalizers
-	return isDeleted(inst) && isFinalizerSet(inst) && inst.GetAnnotations()[v1.PorterDeletePolicyAnnotation] == v1.PorterDeletePolicyDelete
+	return isDeleted(inst) && isFinalizerSet(inst) && getDeletionPolicy(inst) == v1.PorterDeletePolicyDelete
 }
 
 func (r *InstallationReconciler) shouldOrphan(inst *v1.Installation) bool {
-	return isDeleted(inst) && isFinalizerSet(inst) && inst.GetAnnotations()[v1.PorterDeletePolicyAnnotation] == v1.PorterDeletePolicyOrphan
+	return isDeleted(inst) && isFinalizerSet(inst) && getDeletionPolicy(inst) == v1.PorterDeletePolicyOrphan
+}
+
+// getDeletionPolicy returns what to do with the installation in Porter when the
+// Installation resource is deleted. The defaulting webhook is optional, so the
+// annotation may be missing or not normalized, in which case the bundle is uninstalled.
+func getDeletionPolicy(inst *v1.Installation) string {
+	if strings.EqualFold(inst.GetAnnotations()[v1.PorterDeletePolicyAnnotation], v1.PorterDeletePolicyOrphan) {
+		return v1.PorterDeletePolicyOrphan
+	}
+	return v1.PorterDeletePolicyDelete
 }
 
 // Sync the retry annotation from the installation to the agent action to trigger another run.
@@ -417,6 +1043,10 @@ func (r *InstallationReconciler) retry(ctx context.Context, log logr.Logger, ins
 	log.V(Log5Trace).Info("Initializing installation status")
 	inst.Status.Initialize()
 	inst.Status.Action = &corev1.LocalObjectReference{Name: action.Name}
+	if isDryRunAction(action) {
+		// Record a new plan when the dry-run is run again
+		inst.Status.Plan = nil
+	}
 	if err := r.saveStatus(ctx, log, inst); err != nil {
 		return err
 	}
@@ -429,43 +1059,15 @@ func (r *InstallationReconciler) retry(ctx context.Context, log logr.Logger, ins
 	}
 
 	log.V(Log4Debug).Info("Retried associated porter agent action", "name", "retry", action.Name, retry)
+	retries.WithLabelValues("Installation", inst.Namespace).Inc()
 	return nil
 }
 
-func (r *InstallationReconciler) applyDeletionPolicy(ctx context.Context, log logr.Logger, inst *v1.Installation, policy string) error {
-	log.V(Log5Trace).Info("updating deletion policy")
-	annotations := inst.GetAnnotations()
-	if len(annotations) < 1 {
-		annotations = map[string]string{}
-	}
-
-	if _, ok := annotations[v1.PorterDeletePolicyAnnotation]; !ok {
-		annotations[v1.PorterDeletePolicyAnnotation] = v1.PorterDeletePolicyDelete
-		inst.SetAnnotations(annotations)
-		return r.Update(ctx, inst)
-	}
-
-	if strings.ToLower(policy) != v1.PorterDeletePolicyOrphan && strings.ToLower(policy) != v1.PorterDeletePolicyDelete {
-		log.V(Log4Debug).Info("this policy doesn't exist: ", policy)
-		annotations[v1.PorterDeletePolicyAnnotation] = v1.PorterDeletePolicyDelete
-		inst.SetAnnotations(annotations)
-		return r.Update(ctx, inst)
-	}
-
-	annotations[v1.PorterDeletePolicyAnnotation] = policy
-	inst.SetAnnotations(annotations)
-	return r.Update(ctx, inst)
-}
-
-func CreatePorterGRPCClient(ctx context.Context) (porterv1alpha1.PorterClient, ClientConn, error) {
-	// TODO: Make this not a hard coded value of grpc deployment/service.
-	// Have a controller create deployment of grpc server and service
-	conn, err := grpc.NewClient("porter-grpc-service:3001", grpc.WithTransportCredentials(insecure.NewCredentials()))
-	if err != nil {
-		return nil, nil, fmt.Errorf("error setting up listener for porter grpc client")
-	}
-	if conn != nil {
-		return porterv1alpha1.NewPorterClient(conn), conn, nil
+// earliestResult returns the result that requeues the installation first.
+func earliestResult(a ctrl.Result, b ctrl.Result) ctrl.Result {
+	if b.RequeueAfter > 0 && (a.RequeueAfter == 0 || b.RequeueAfter < a.RequeueAfter) {
+		a.RequeueAfter = b.RequeueAfter
 	}
-	return nil, nil, fmt.Errorf("error creating porter grpc client")
+	a.Requeue = a.Requeue || b.Requeue
+	return a
 }
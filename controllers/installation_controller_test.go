@@ -11,6 +11,7 @@ import (
 	installationv1 "get.porter.sh/porter/gen/proto/go/porterapis/installation/v1alpha1"
 	porterv1alpha1 "get.porter.sh/porter/gen/proto/go/porterapis/porter/v1alpha1"
 	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"google.golang.org/protobuf/types/known/structpb"
@@ -24,6 +25,7 @@ import (
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/record"
+	clocktesting "k8s.io/utils/clock/testing"
 	"k8s.io/utils/ptr"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -96,6 +98,63 @@ func TestShouldOrphan(t *testing.T) {
 	}
 }
 
+func TestDeletionPolicyWithNoAnnotation(t *testing.T) {
+	now := metav1.Now()
+	inst := &v1.Installation{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "fake-install",
+			Namespace:         "fake-ns",
+			Finalizers:        []string{v1.FinalizerName},
+			DeletionTimestamp: &now,
+		},
+		Spec: v1.InstallationSpec{
+			Name:      "fake-install",
+			Namespace: "fake-ns",
+		},
+	}
+	rec := setupInstallationController(inst)
+
+	assert.Equal(t, v1.PorterDeletePolicyDelete, getDeletionPolicy(inst))
+	assert.True(t, rec.shouldUninstall(inst), "an installation without a deletion policy should be uninstalled")
+	assert.False(t, rec.shouldOrphan(inst), "an installation without a deletion policy should not be orphaned")
+}
+
+func TestDeletionPolicyWithAnnotation(t *testing.T) {
+	tests := map[string]struct {
+		policy     string
+		wantPolicy string
+	}{
+		"empty-string":   {policy: "", wantPolicy: v1.PorterDeletePolicyDelete},
+		"policy-orphan":  {policy: v1.PorterDeletePolicyOrphan, wantPolicy: v1.PorterDeletePolicyOrphan},
+		"policy-delete":  {policy: v1.PorterDeletePolicyDelete, wantPolicy: v1.PorterDeletePolicyDelete},
+		"mixed-case":     {policy: "Orphan", wantPolicy: v1.PorterDeletePolicyOrphan},
+		"unknown-policy": {policy: "keep", wantPolicy: v1.PorterDeletePolicyDelete},
+	}
+	now := metav1.Now()
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			inst := &v1.Installation{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:              "fake-install",
+					Namespace:         "fake-ns",
+					Finalizers:        []string{v1.FinalizerName},
+					DeletionTimestamp: &now,
+					Annotations:       map[string]string{v1.PorterDeletePolicyAnnotation: test.policy},
+				},
+				Spec: v1.InstallationSpec{
+					Name:      "fake-install",
+					Namespace: "fake-ns",
+				},
+			}
+			rec := setupInstallationController(inst)
+
+			assert.Equal(t, test.wantPolicy, getDeletionPolicy(inst))
+			assert.Equal(t, test.wantPolicy == v1.PorterDeletePolicyDelete, rec.shouldUninstall(inst))
+			assert.Equal(t, test.wantPolicy == v1.PorterDeletePolicyOrphan, rec.shouldOrphan(inst))
+		})
+	}
+}
+
 func TestUninstallInstallation(t *testing.T) {
 	ctx := context.Background()
 	inst := &v1.Installation{
@@ -128,8 +187,10 @@ func TestRetry(t *testing.T) {
 		},
 	}
 	rec := setupInstallationController(inst, action)
+	before := testutil.ToFloat64(retries.WithLabelValues("Installation", "fake-ns"))
 	err := rec.retry(ctx, rec.Log, inst, action)
 	assert.NoError(t, err)
+	assert.Equal(t, before+1, testutil.ToFloat64(retries.WithLabelValues("Installation", "fake-ns")), "the retry should be counted")
 }
 
 func TestInstallationReconciler_Reconcile(t *testing.T) {
@@ -150,7 +211,7 @@ func TestInstallationReconciler_Reconcile(t *testing.T) {
 	}
 
 	var inst v1.Installation
-	triggerReconcile := func() {
+	reconcileInstallation := func() ctrl.Result {
 		fullname := types.NamespacedName{Namespace: namespace, Name: name}
 		key := client.ObjectKey{Namespace: namespace, Name: name}
 
@@ -159,12 +220,16 @@ func TestInstallationReconciler_Reconcile(t *testing.T) {
 		}
 		result, err := controller.Reconcile(ctx, request)
 		require.NoError(t, err)
-		require.True(t, result.IsZero())
 
 		err = controller.Get(ctx, key, &inst)
 		if !apierrors.IsNotFound(err) {
 			require.NoError(t, err)
 		}
+		return result
+	}
+	triggerReconcile := func() {
+		result := reconcileInstallation()
+		require.True(t, result.IsZero())
 	}
 
 	triggerReconcile()
@@ -208,13 +273,20 @@ func TestInstallationReconciler_Reconcile(t *testing.T) {
 	action.Status.Conditions = []metav1.Condition{{Type: string(v1.ConditionComplete), Status: metav1.ConditionTrue}}
 	require.NoError(t, controller.Status().Update(ctx, &action))
 
-	triggerReconcile()
+	result := reconcileInstallation()
 
 	// Verify that the installation status was synced with the action
 	require.NotNil(t, inst.Status.Action, "expected Action to still be set")
 	assert.Equal(t, v1.PhaseSucceeded, inst.Status.Phase, "incorrect Phase")
 	assert.True(t, apimeta.IsStatusConditionTrue(inst.Status.Conditions, string(v1.ConditionComplete)))
 
+	// Verify that the outputs are retrieved again when the porter server is unavailable
+	assert.Equal(t, outputsRetryInterval, result.RequeueAfter, "the outputs should be retrieved again")
+	outputsCond := apimeta.FindStatusCondition(inst.Status.Conditions, v1.ConditionOutputsAvailable)
+	require.NotNil(t, outputsCond, "expected the OutputsAvailable condition to be set")
+	assert.Equal(t, metav1.ConditionFalse, outputsCond.Status)
+	assert.Equal(t, "PorterServerUnavailable", outputsCond.Reason)
+
 	// Fail the action
 	action.Status.Phase = v1.PhaseFailed
 	action.Status.Conditions = []metav1.Condition{{Type: string(v1.ConditionFailed), Status: metav1.ConditionTrue}}
@@ -237,7 +309,9 @@ func TestInstallationReconciler_Reconcile(t *testing.T) {
 	// Verify that the installation status was re-initialized
 	assert.Equal(t, int64(2), inst.Status.ObservedGeneration)
 	assert.Equal(t, v1.PhaseUnknown, inst.Status.Phase, "New resources should be initialized to Phase: Unknown")
-	assert.Empty(t, inst.Status.Conditions, "Conditions should have been reset")
+	// The outputs condition is managed by the installation controller, and is kept until the installation is applied again
+	require.Len(t, inst.Status.Conditions, 1, "Only the OutputsAvailable condition should have been kept")
+	assert.Equal(t, v1.ConditionOutputsAvailable, inst.Status.Conditions[0].Type)
 
 	// Retry the last action
 	lastAction := actionName
@@ -515,6 +589,238 @@ func TestSetupWithManager(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestCompareInstallation(t *testing.T) {
+	spec := v1.InstallationSpec{
+		Name:           "mybuns",
+		Namespace:      "dev",
+		Bundle:         v1.OCIReferenceParts{Repository: "ghcr.io/getporter/porter-hello", Version: "0.2.0"},
+		Labels:         map[string]string{"env": "dev"},
+		CredentialSets: []string{"mycreds"},
+	}
+	porterInst := func() *installationv1.Installation {
+		return &installationv1.Installation{
+			Name:      "mybuns",
+			Namespace: "dev",
+			Bundle: &installationv1.Bundle{
+				Repository: "ghcr.io/getporter/porter-hello",
+				Version:    "0.2.0",
+				Digest:     "sha256:276b44be3f478b4c8d1f99c1925386d45a878a853f22436ece5589f32e9df384",
+			},
+			Labels:         map[string]string{"env": "dev"},
+			CredentialSets: []string{"mycreds"},
+		}
+	}
+
+	t.Run("in sync", func(t *testing.T) {
+		assert.Empty(t, compareInstallation(spec, porterInst()), "fields that are not specified on the resource should not be compared")
+	})
+
+	t.Run("upgraded out of band", func(t *testing.T) {
+		pi := porterInst()
+		pi.Bundle.Version = "0.3.0"
+		assert.Equal(t, []string{`bundle.version is "0.3.0", expected "0.2.0"`}, compareInstallation(spec, pi))
+	})
+
+	t.Run("sets and labels changed", func(t *testing.T) {
+		pi := porterInst()
+		pi.CredentialSets = nil
+		pi.ParameterSets = []string{"myparams"}
+		pi.Labels = nil
+		pi.Uninstalled = true
+		drift := compareInstallation(spec, pi)
+		assert.Equal(t, []string{
+			"uninstalled is true, expected false",
+			`credentialSets is "", expected "mycreds"`,
+			`parameterSets is "myparams", expected ""`,
+			"labels do not match",
+		}, drift)
+	})
+
+	t.Run("parameters changed", func(t *testing.T) {
+		spec := spec
+		spec.Parameters = runtime.RawExtension{Raw: []byte(`{"name":"llama","replicas":3,"password":"topsecret","region":"eastus","endpoint":"ignored"}`)}
+		spec.ParameterSources = []v1.Parameter{{Name: "endpoint", Source: v1.ParameterSource{Output: &v1.OutputSource{Name: "db", Key: "endpoint"}}}}
+		pi := porterInst()
+		pi.Parameters = &installationv1.ParameterSet{Parameters: []*installationv1.Parameter{
+			{Name: "name", Source: &installationv1.ValueSource{Strategy: "value", Hint: "alpaca"}},
+			{Name: "replicas", Source: &installationv1.ValueSource{Strategy: "value", Hint: "3"}},
+			{Name: "password", Source: &installationv1.ValueSource{Strategy: "secret", Hint: "01ABC-password"}},
+			{Name: "debug", Source: &installationv1.ValueSource{Strategy: "value", Hint: "true"}},
+			{Name: "endpoint", Source: &installationv1.ValueSource{Strategy: "value", Hint: "db.example.com"}},
+		}}
+		assert.Equal(t, []string{
+			"parameters.debug is set, expected it to not be set",
+			"parameters.name does not match",
+			"parameters.region is not set",
+		}, compareInstallation(spec, pi), "parameters stored as secrets, or resolved from parameter sources, should not be compared")
+	})
+}
+
+func TestInstallationReconciler_checkDrift(t *testing.T) {
+	ctx := context.Background()
+
+	newInstallation := func() *v1.Installation {
+		return &v1.Installation{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "mybuns", Generation: 1},
+			Spec: v1.InstallationSpec{
+				ResyncInterval: &metav1.Duration{Duration: time.Hour},
+				Name:           "mybuns",
+				Namespace:      "dev",
+				Bundle:         v1.OCIReferenceParts{Repository: "ghcr.io/getporter/porter-hello", Version: "0.2.0"},
+			},
+			Status: v1.InstallationStatus{PorterResourceStatus: v1.PorterResourceStatus{Phase: v1.PhaseSucceeded}},
+		}
+	}
+	setupPorter := func(rec *InstallationReconciler, version string) {
+		grpcClient := &mocks.PorterClient{}
+		resp := &installationv1.ListInstallationsResponse{
+			Installation: []*installationv1.Installation{{
+				Name:      "mybuns",
+				Namespace: "dev",
+				Bundle:    &installationv1.Bundle{Repository: "ghcr.io/getporter/porter-hello", Version: version},
+			}},
+		}
+		grpcClient.On("ListInstallations", ctx, &installationv1.ListInstallationsRequest{Name: "mybuns", Namespace: ptr.To("dev")}).Return(resp, nil)
+		clientConn := &mocks.ClientConn{}
+		clientConn.On("Close").Return(nil)
+		rec.CreateGRPCClient = func(ctx context.Context) (porterv1alpha1.PorterClient, ClientConn, error) {
+			return grpcClient, clientConn, nil
+		}
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		inst := newInstallation()
+		inst.Spec.ResyncInterval = nil
+		rec := setupInstallationController(inst)
+
+		result, err := rec.checkDrift(ctx, logr.Discard(), inst)
+		require.NoError(t, err)
+		assert.True(t, result.IsZero(), "the installation should not be requeued when drift detection is disabled")
+		assert.Nil(t, apimeta.FindStatusCondition(inst.Status.Conditions, v1.ConditionDrifted))
+	})
+
+	t.Run("not applied yet", func(t *testing.T) {
+		inst := newInstallation()
+		inst.Status.Phase = v1.PhaseRunning
+		rec := setupInstallationController(inst)
+
+		result, err := rec.checkDrift(ctx, logr.Discard(), inst)
+		require.NoError(t, err)
+		assert.True(t, result.IsZero(), "drift detection should wait for the agent action to complete")
+	})
+
+	t.Run("in sync", func(t *testing.T) {
+		inst := newInstallation()
+		rec := setupInstallationController(inst)
+		setupPorter(rec, "0.2.0")
+		checkedAt := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+		clock := clocktesting.NewFakePassiveClock(checkedAt)
+		rec.Clock = clock
+
+		result, err := rec.checkDrift(ctx, logr.Discard(), inst)
+		require.NoError(t, err)
+		assert.Equal(t, time.Hour, result.RequeueAfter)
+
+		require.NoError(t, rec.Get(ctx, client.ObjectKeyFromObject(inst), inst))
+		require.NotNil(t, inst.Status.LastResyncTime)
+		assert.Equal(t, checkedAt, inst.Status.LastResyncTime.Time.UTC())
+		assert.True(t, apimeta.IsStatusConditionFalse(inst.Status.Conditions, v1.ConditionDrifted))
+
+		// Checking again before the interval elapses should not call porter
+		clock.SetTime(checkedAt.Add(10 * time.Minute))
+		rec.CreateGRPCClient = nil
+		result, err = rec.checkDrift(ctx, logr.Discard(), inst)
+		require.NoError(t, err)
+		assert.Equal(t, 50*time.Minute, result.RequeueAfter, "expected to be requeued for the remainder of the interval")
+	})
+
+	t.Run("drift detected", func(t *testing.T) {
+		inst := newInstallation()
+		rec := setupInstallationController(inst)
+		setupPorter(rec, "0.3.0")
+
+		result, err := rec.checkDrift(ctx, logr.Discard(), inst)
+		require.NoError(t, err)
+		assert.Equal(t, time.Hour, result.RequeueAfter)
+
+		require.NoError(t, rec.Get(ctx, client.ObjectKeyFromObject(inst), inst))
+		cond := apimeta.FindStatusCondition(inst.Status.Conditions, v1.ConditionDrifted)
+		require.NotNil(t, cond)
+		assert.Equal(t, metav1.ConditionTrue, cond.Status)
+		assert.Contains(t, cond.Message, "bundle.version")
+		assert.Empty(t, inst.Annotations[v1.AnnotationRetry], "the installation should not be re-applied by default")
+	})
+
+	t.Run("drift corrected", func(t *testing.T) {
+		inst := newInstallation()
+		inst.Spec.DriftPolicy = v1.DriftPolicyCorrect
+		rec := setupInstallationController(inst)
+		setupPorter(rec, "0.3.0")
+
+		_, err := rec.checkDrift(ctx, logr.Discard(), inst)
+		require.NoError(t, err)
+
+		require.NoError(t, rec.Get(ctx, client.ObjectKeyFromObject(inst), inst))
+		assert.True(t, apimeta.IsStatusConditionTrue(inst.Status.Conditions, v1.ConditionDrifted))
+		assert.Contains(t, inst.Annotations[v1.AnnotationRetry], "drift-", "the installation should be re-applied with a retry")
+	})
+
+	t.Run("porter unavailable", func(t *testing.T) {
+		inst := newInstallation()
+		rec := setupInstallationController(inst)
+
+		result, err := rec.checkDrift(ctx, logr.Discard(), inst)
+		require.NoError(t, err)
+		assert.Equal(t, time.Hour, result.RequeueAfter, "the drift check should be tried again at the next interval")
+		assert.Nil(t, inst.Status.LastResyncTime)
+	})
+}
+
+func TestInstallationReconciler_resolveDriftPolicy(t *testing.T) {
+	ctx := context.Background()
+	nsCfg := &v1.AgentConfig{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "default"},
+		Spec: v1.AgentConfigSpec{
+			ResyncInterval: &metav1.Duration{Duration: time.Hour},
+			DriftPolicy:    v1.DriftPolicyCorrect,
+		},
+	}
+	rec := setupInstallationController(nsCfg)
+
+	inst := &v1.Installation{ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "mybuns"}}
+	interval, policy, err := rec.resolveDriftPolicy(ctx, logr.Discard(), inst)
+	require.NoError(t, err)
+	assert.Equal(t, time.Hour, interval, "the interval should be inherited from the agent config")
+	assert.Equal(t, v1.DriftPolicyCorrect, policy, "the policy should be inherited from the agent config")
+
+	inst.Spec.ResyncInterval = &metav1.Duration{}
+	inst.Spec.DriftPolicy = v1.DriftPolicyDetect
+	interval, policy, err = rec.resolveDriftPolicy(ctx, logr.Discard(), inst)
+	require.NoError(t, err)
+	assert.Equal(t, time.Duration(0), interval, "the installation should be able to disable drift detection")
+	assert.Equal(t, v1.DriftPolicyDetect, policy)
+}
+
+// testInstallation returns an Installation of the bundle with the same name,
+// that tests override with the fields under test.
+func testInstallation(namespace string, name string) *v1.Installation {
+	return &v1.Installation{
+		TypeMeta: metav1.TypeMeta{APIVersion: v1.GroupVersion.String(), Kind: "Installation"},
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:  namespace,
+			Name:       name,
+			UID:        types.UID(namespace + "-" + name),
+			Generation: 1,
+			Finalizers: []string{v1.FinalizerName},
+		},
+		Spec: v1.InstallationSpec{
+			Namespace: "dev",
+			Name:      name,
+			Bundle:    v1.OCIReferenceParts{Repository: "ghcr.io/getporter/" + name, Version: "0.1.0"},
+		},
+	}
+}
+
 func setupInstallationController(objs ...client.Object) *InstallationReconciler {
 	scheme := runtime.NewScheme()
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
@@ -523,6 +829,8 @@ func setupInstallationController(objs ...client.Object) *InstallationReconciler
 	fakeBuilder := fake.NewClientBuilder()
 	fakeBuilder.WithScheme(scheme)
 	fakeBuilder.WithObjects(objs...).WithStatusSubresource(objs...)
+	// Installation outputs, runs and parameter sets are created by the controller, and are not one of the initial objects
+	fakeBuilder.WithStatusSubresource(&v1.InstallationOutput{}, &v1.InstallationRun{}, &v1.ParameterSet{})
 	fakeClient := fakeBuilder.Build()
 
 	clientConn := &mocks.ClientConn{}
@@ -571,77 +879,158 @@ func TestIsHandled(t *testing.T) {
 	assert.Error(t, err)
 }
 
-func TestApplyDeletionPolicyWithNoAnnotation(t *testing.T) {
-	tests := map[string]struct {
-		wantPolicy string
-		policy     string
-	}{
-		"empty-string":  {policy: "", wantPolicy: v1.PorterDeletePolicyDelete},
-		"policy-orphan": {policy: v1.PorterDeletePolicyOrphan, wantPolicy: v1.PorterDeletePolicyOrphan},
-		"policy-delete": {policy: v1.PorterDeletePolicyDelete, wantPolicy: v1.PorterDeletePolicyDelete},
-	}
-	ctx := context.Background()
+func TestInstallationReconciler_syncStatus_AgentLogs(t *testing.T) {
 	inst := &v1.Installation{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      "fake-install",
-			Namespace: "fake-ns",
-		},
-		Spec: v1.InstallationSpec{
-			Name:      "fake-install",
-			Namespace: "fake-ns",
+		ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "mysql", Generation: 1},
+	}
+	controller := setupInstallationController(inst)
+	action := &v1.AgentAction{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "mysql-abc"},
+		Status: v1.AgentActionStatus{
+			Phase: v1.PhaseFailed,
+			Logs:  &corev1.LocalObjectReference{Name: "mysql-abc-logs"},
 		},
 	}
 
-	scheme := runtime.NewScheme()
-	utilruntime.Must(v1.AddToScheme(scheme))
-	fakeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(inst).WithStatusSubresource(inst).Build()
-	rc := &InstallationReconciler{
-		Client: fakeClient,
-	}
-	for name, test := range tests {
-		t.Run(name, func(t *testing.T) {
-			err := rc.applyDeletionPolicy(ctx, logr.Discard(), inst, test.policy)
-			assert.NoError(t, err)
-			assert.Equal(t, inst.GetAnnotations()[v1.PorterDeletePolicyAnnotation], test.wantPolicy)
-		})
-	}
+	require.NoError(t, controller.syncStatus(context.Background(), logr.Discard(), inst, action))
+	require.NotNil(t, inst.Status.Logs)
+	assert.Equal(t, "mysql-abc-logs", inst.Status.Logs.Name)
+
+	recorder := controller.Recorder.(*record.FakeRecorder)
+	require.Len(t, recorder.Events, 1)
+	assert.Equal(t, "Warning AgentLogs the Porter Agent logs for mysql-abc are in the ConfigMap mysql-abc-logs", <-recorder.Events)
+
+	// The event is only sent when the logs change
+	require.NoError(t, controller.syncStatus(context.Background(), logr.Discard(), inst, action))
+	assert.Empty(t, recorder.Events)
 }
 
-func TestApplyDeletionPolicyWithAnnotation(t *testing.T) {
+func TestInstallationReconciler_retryFailure(t *testing.T) {
 	ctx := context.Background()
-	inst := &v1.Installation{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      "fake-install",
-			Namespace: "fake-ns",
-			Annotations: map[string]string{
-				v1.PorterDeletePolicyAnnotation: v1.PorterDeletePolicyDelete,
+	newTestObjects := func(failedAt time.Time, reason string) (*v1.Installation, *v1.AgentAction) {
+		inst := &v1.Installation{
+			TypeMeta:   metav1.TypeMeta{APIVersion: v1.GroupVersion.String(), Kind: "Installation"},
+			ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "mybuns", Generation: 1, UID: "random-uid"},
+			Spec: v1.InstallationSpec{
+				Name:        "mybuns",
+				Namespace:   "dev",
+				RetryPolicy: &v1.RetryPolicy{MaxAttempts: 2, BackoffBase: &metav1.Duration{Duration: time.Minute}},
 			},
-		},
-		Spec: v1.InstallationSpec{
-			Name:      "fake-install",
-			Namespace: "fake-ns",
-		},
+		}
+		action := &v1.AgentAction{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "mybuns-abc", Labels: getActionLabels(inst)},
+			Status: v1.AgentActionStatus{
+				Phase: v1.PhaseFailed,
+				Conditions: []metav1.Condition{{
+					Type:               string(v1.ConditionFailed),
+					Status:             metav1.ConditionTrue,
+					Reason:             reason,
+					LastTransitionTime: metav1.NewTime(failedAt),
+				}},
+			},
+		}
+		return inst, action
 	}
 
-	scheme := runtime.NewScheme()
-	utilruntime.Must(v1.AddToScheme(scheme))
-	fakeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(inst).WithStatusSubresource(inst).Build()
-	rc := &InstallationReconciler{
-		Client: fakeClient,
-	}
+	t.Run("wait for backoff", func(t *testing.T) {
+		failedAt := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+		inst, action := newTestObjects(failedAt, v1.FailureReasonBundlePullFailed)
+		controller := setupInstallationController(inst, action)
+		controller.Clock = clocktesting.NewFakePassiveClock(failedAt.Add(15 * time.Second))
 
-	tests := map[string]struct {
-		policy     string
-		wantPolicy string
-	}{
-		"no-policy":               {policy: "", wantPolicy: v1.PorterDeletePolicyDelete},
-		"delete-update-to-orphan": {policy: v1.PorterDeletePolicyOrphan, wantPolicy: v1.PorterDeletePolicyOrphan},
-	}
-	for name, test := range tests {
-		t.Run(name, func(t *testing.T) {
-			err := rc.applyDeletionPolicy(ctx, logr.Discard(), inst, test.policy)
-			assert.NoError(t, err)
-			assert.Equal(t, inst.GetAnnotations()[v1.PorterDeletePolicyAnnotation], test.wantPolicy)
-		})
-	}
+		result, retrying, err := controller.retryFailure(ctx, logr.Discard(), inst, action)
+		require.NoError(t, err)
+		assert.True(t, retrying)
+		assert.Equal(t, 45*time.Second, result.RequeueAfter, "expected to be requeued for the next retry")
+		require.NotNil(t, inst.Status.NextRetryTime, "expected the next retry time to be set")
+		assert.Equal(t, failedAt.Add(time.Minute), inst.Status.NextRetryTime.Time.UTC())
+		assert.Equal(t, int32(0), inst.Status.RetryAttempts)
+	})
+
+	t.Run("retry with a new action", func(t *testing.T) {
+		inst, action := newTestObjects(time.Now().Add(-2*time.Minute), v1.FailureReasonBundlePullFailed)
+		inst.Status.NextRetryTime = &metav1.Time{Time: time.Now()}
+		controller := setupInstallationController(inst, action)
+
+		_, retrying, err := controller.retryFailure(ctx, logr.Discard(), inst, action)
+		require.NoError(t, err)
+		assert.True(t, retrying)
+		assert.Equal(t, int32(1), inst.Status.RetryAttempts)
+		assert.Nil(t, inst.Status.NextRetryTime)
+
+		latest, handled, err := controller.isHandled(ctx, logr.Discard(), inst)
+		require.NoError(t, err)
+		require.True(t, handled)
+		assert.NotEqual(t, action.Name, latest.Name, "expected a new action to be created for the retry")
+		assertContains(t, latest.Labels, v1.LabelRetryAttempt, "1", "incorrect retry attempt label")
+		assert.Equal(t, latest.Name, inst.Status.Action.Name, "the installation status should be synced with the new action")
+	})
+
+	t.Run("retry a failed plan", func(t *testing.T) {
+		inst, action := newTestObjects(time.Now().Add(-2*time.Minute), v1.FailureReasonBundlePullFailed)
+		inst.Spec.ApprovalPolicy = &v1.ApprovalPolicy{Required: true}
+		action.Spec.Args = []string{"installation", "apply", "installation.yaml", dryRunFlag}
+		controller := setupInstallationController(inst, action)
+
+		_, retrying, err := controller.retryFailure(ctx, logr.Discard(), inst, action)
+		require.NoError(t, err)
+		assert.True(t, retrying)
+
+		latest, handled, err := controller.isHandled(ctx, logr.Discard(), inst)
+		require.NoError(t, err)
+		require.True(t, handled)
+		assert.NotEqual(t, action.Name, latest.Name, "expected a new action to be created for the retry")
+		assert.Contains(t, latest.Spec.Args, dryRunFlag, "the plan should be retried with a dry-run so that the change is not applied before it is approved")
+	})
+
+	t.Run("reason not retryable", func(t *testing.T) {
+		inst, action := newTestObjects(time.Now().Add(-time.Hour), v1.FailureReasonCredentialResolutionFailed)
+		inst.Spec.RetryPolicy.RetryableReasons = []string{v1.FailureReasonBundlePullFailed}
+		controller := setupInstallationController(inst, action)
+
+		_, retrying, err := controller.retryFailure(ctx, logr.Discard(), inst, action)
+		require.NoError(t, err)
+		assert.False(t, retrying)
+		assert.Equal(t, int32(0), inst.Status.RetryAttempts)
+	})
+
+	t.Run("limit reached", func(t *testing.T) {
+		inst, action := newTestObjects(time.Now().Add(-time.Hour), v1.FailureReasonBundlePullFailed)
+		inst.Status.RetryAttempts = 2
+		inst.Status.NextRetryTime = &metav1.Time{Time: time.Now()}
+		controller := setupInstallationController(inst, action)
+
+		_, retrying, err := controller.retryFailure(ctx, logr.Discard(), inst, action)
+		require.NoError(t, err)
+		assert.False(t, retrying)
+		assert.Nil(t, inst.Status.NextRetryTime)
+		recorder := controller.Recorder.(*record.FakeRecorder)
+		require.Len(t, recorder.Events, 1)
+		assert.Equal(t, "Warning RetryLimitReached mybuns failed after 2 retries", <-recorder.Events)
+	})
+
+	t.Run("no policy", func(t *testing.T) {
+		inst, action := newTestObjects(time.Now().Add(-time.Hour), v1.FailureReasonBundlePullFailed)
+		inst.Spec.RetryPolicy = nil
+		controller := setupInstallationController(inst, action)
+
+		_, retrying, err := controller.retryFailure(ctx, logr.Discard(), inst, action)
+		require.NoError(t, err)
+		assert.False(t, retrying)
+	})
+
+	t.Run("policy from agent config", func(t *testing.T) {
+		inst, action := newTestObjects(time.Now().Add(-time.Hour), v1.FailureReasonBundlePullFailed)
+		inst.Spec.RetryPolicy = nil
+		nsCfg := &v1.AgentConfig{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "default"},
+			Spec:       v1.AgentConfigSpec{RetryPolicy: &v1.RetryPolicy{MaxAttempts: 1}},
+		}
+		controller := setupInstallationController(inst, action, nsCfg)
+
+		_, retrying, err := controller.retryFailure(ctx, logr.Discard(), inst, action)
+		require.NoError(t, err)
+		assert.True(t, retrying)
+		assert.Equal(t, int32(1), inst.Status.RetryAttempts)
+	})
 }
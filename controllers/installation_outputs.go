@@ -0,0 +1,62 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	v1 "get.porter.sh/operator/api/v1"
+	installationv1 "get.porter.sh/porter/gen/proto/go/porterapis/installation/v1alpha1"
+	"github.com/go-logr/logr"
+	"google.golang.org/protobuf/types/known/structpb"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/utils/ptr"
+)
+
+// isOutputsStale determines if the outputs were captured before the last
+// successful run of the installation, and should be refreshed.
+func isOutputsStale(inst *v1.Installation, outputs *v1.InstallationOutput) bool {
+	if inst.Status.Action == nil || inst.Status.Phase != v1.PhaseSucceeded || inst.Spec.Uninstalled {
+		return false
+	}
+	return outputs.Status.Action == nil || outputs.Status.Action.Name != inst.Status.Action.Name
+}
+
+// recordOutputsRun records the agent action, and the Porter run, that produced
+// the outputs. Outputs that are captured before the installation succeeds are
+// not associated with a run, so that they are refreshed when it succeeds.
+func (r *InstallationReconciler) recordOutputsRun(ctx context.Context, log logr.Logger, porterClient PorterClient, inst *v1.Installation, outputs *v1.InstallationOutput) {
+	if inst.Status.Action == nil || inst.Status.Phase != v1.PhaseSucceeded {
+		return
+	}
+	outputs.Status.Action = &corev1.LocalObjectReference{Name: inst.Status.Action.Name}
+
+	in := &installationv1.ListInstallationsRequest{Name: inst.Spec.Name, Namespace: ptr.To(inst.Spec.Namespace)}
+	resp, err := porterClient.ListInstallations(ctx, in)
+	if err != nil {
+		log.V(Log4Debug).Info(fmt.Sprintf("failed to get the run of the installation outputs for: %s:%s installation error: %s", inst.Spec.Name, inst.Spec.Namespace, err.Error()))
+		return
+	}
+	for _, porterInst := range resp.GetInstallation() {
+		if porterInst.GetName() == inst.Spec.Name && porterInst.GetNamespace() == inst.Spec.Namespace {
+			outputs.Status.RunID = porterInst.GetStatus().GetRunId()
+		}
+	}
+}
+
+// getPorterValue returns the value of an output as a string. Values that are
+// not strings are formatted as JSON, for example 3306, true or {"replicas":3}.
+func getPorterValue(value *structpb.Value) string {
+	switch kind := value.GetKind().(type) {
+	case nil, *structpb.Value_NullValue:
+		return ""
+	case *structpb.Value_StringValue:
+		return kind.StringValue
+	}
+
+	data, err := json.Marshal(value.AsInterface())
+	if err != nil {
+		return fmt.Sprintf("%v", value.AsInterface())
+	}
+	return string(data)
+}
@@ -0,0 +1,244 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	v1 "get.porter.sh/operator/api/v1"
+	mocks "get.porter.sh/operator/mocks/grpc"
+	installationv1 "get.porter.sh/porter/gen/proto/go/porterapis/installation/v1alpha1"
+	porterv1alpha1 "get.porter.sh/porter/gen/proto/go/porterapis/porter/v1alpha1"
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/structpb"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestInstallationReconciler_CheckOrCreateInstallationOutputsCR_Refresh(t *testing.T) {
+	ctx := context.Background()
+	inst := testOutputSyncInstallation()
+	inst.Status.Action = &corev1.LocalObjectReference{Name: "mysql-2"}
+	inst.Status.Phase = v1.PhaseSucceeded
+	outputs := testInstallationOutput("mysql://db")
+	outputs.UID = "outputs-uid"
+	outputs.Status.Action = &corev1.LocalObjectReference{Name: "mysql-1"}
+	outputs.Status.Outputs[0].Sensitive = false
+	controller := setupInstallationController(inst, outputs)
+	recorder := controller.Recorder.(*record.FakeRecorder)
+
+	grpcClient := &mocks.PorterClient{}
+	grpcClient.On("ListInstallationLatestOutputs", mock.Anything, mock.Anything).Return(&installationv1.ListInstallationLatestOutputResponse{
+		Outputs: []*installationv1.PorterValue{
+			{Name: "connstr", Type: "string", Sensitive: true, Value: structpb.NewStringValue("mysql://db2")},
+			{Name: "port", Type: "integer", Value: structpb.NewNumberValue(3306)},
+		},
+	}, nil)
+	grpcClient.On("ListInstallations", mock.Anything, mock.Anything).Return(&installationv1.ListInstallationsResponse{
+		Installation: []*installationv1.Installation{
+			{Name: "mysql", Namespace: "dev", Status: &installationv1.InstallationStatus{RunId: "01RUN"}},
+		},
+	}, nil)
+	clientConn := &mocks.ClientConn{}
+	clientConn.On("Close").Return(nil)
+	controller.CreateGRPCClient = func(ctx context.Context) (porterv1alpha1.PorterClient, ClientConn, error) {
+		return grpcClient, clientConn, nil
+	}
+
+	_, err := controller.CheckOrCreateInstallationOutputsCR(ctx, logr.Discard(), inst)
+	require.NoError(t, err)
+
+	require.NoError(t, controller.Get(ctx, client.ObjectKeyFromObject(outputs), outputs))
+	assert.Equal(t, &corev1.LocalObjectReference{Name: "mysql-2"}, outputs.Status.Action, "the action that produced the outputs should be recorded")
+	assert.Equal(t, "01RUN", outputs.Status.RunID, "the Porter run that produced the outputs should be recorded")
+	wantOutputs := []v1.Output{
+		{Name: "connstr", Type: "string", Sensitive: true, Value: v1.RedactedValue,
+			SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "mysql-sensitive-outputs"}, Key: "connstr"}},
+		{Name: "port", Type: "integer", Value: "3306"},
+	}
+	assert.Equal(t, wantOutputs, outputs.Status.Outputs)
+
+	var secret corev1.Secret
+	require.NoError(t, controller.Get(ctx, client.ObjectKey{Namespace: "test", Name: "mysql-sensitive-outputs"}, &secret))
+	assert.Equal(t, map[string][]byte{"connstr": []byte("mysql://db2")}, secret.Data)
+	assert.Contains(t, drainEvents(recorder), "Normal RefreshedInstallationOutputs refreshed installation outputs for mysql from mysql-2")
+
+	require.NoError(t, controller.Get(ctx, client.ObjectKeyFromObject(inst), inst))
+	assert.True(t, apimeta.IsStatusConditionTrue(inst.Status.Conditions, v1.ConditionOutputsAvailable), "the installation should report that its outputs are available")
+
+	// Outputs are not refreshed again for the same run
+	_, err = controller.CheckOrCreateInstallationOutputsCR(ctx, logr.Discard(), inst)
+	require.NoError(t, err)
+	grpcClient.AssertNumberOfCalls(t, "ListInstallationLatestOutputs", 1)
+}
+
+func TestInstallationReconciler_CheckOrCreateInstallationOutputsCR_Create(t *testing.T) {
+	ctx := context.Background()
+	inst := testOutputSyncInstallation()
+	inst.Annotations = map[string]string{v1.PorterDeletePolicyAnnotation: v1.PorterDeletePolicyOrphan, "team": "llamas"}
+	inst.Status.Action = &corev1.LocalObjectReference{Name: "mysql-1"}
+	inst.Status.Phase = v1.PhaseSucceeded
+	controller := setupInstallationController(inst)
+	recorder := controller.Recorder.(*record.FakeRecorder)
+
+	grpcClient := &mocks.PorterClient{}
+	grpcClient.On("ListInstallationLatestOutputs", mock.Anything, mock.Anything).Return(&installationv1.ListInstallationLatestOutputResponse{
+		Outputs: []*installationv1.PorterValue{
+			{Name: "port", Type: "integer", Value: structpb.NewNumberValue(3306)},
+		},
+	}, nil)
+	grpcClient.On("ListInstallations", mock.Anything, mock.Anything).Return(&installationv1.ListInstallationsResponse{}, nil)
+	clientConn := &mocks.ClientConn{}
+	clientConn.On("Close").Return(nil)
+	controller.CreateGRPCClient = func(ctx context.Context) (porterv1alpha1.PorterClient, ClientConn, error) {
+		return grpcClient, clientConn, nil
+	}
+
+	_, err := controller.CheckOrCreateInstallationOutputsCR(ctx, logr.Discard(), inst)
+	require.NoError(t, err)
+	assert.Contains(t, drainEvents(recorder), "Normal CreatingInstallationOutputs created installation outputs for mysql")
+
+	var outputs v1.InstallationOutput
+	require.NoError(t, controller.Get(ctx, client.ObjectKey{Namespace: "test", Name: "mysql"}, &outputs))
+	assert.Equal(t, []v1.Output{{Name: "port", Type: "integer", Value: "3306"}}, outputs.Status.Outputs)
+
+	require.NoError(t, controller.Get(ctx, client.ObjectKeyFromObject(inst), inst))
+	wantAnnotations := map[string]string{
+		v1.PorterDeletePolicyAnnotation: v1.PorterDeletePolicyOrphan,
+		"team":                          "llamas",
+		v1.AnnotationInstallationOutput: "true",
+	}
+	assert.Equal(t, wantAnnotations, inst.Annotations, "the other annotations on the installation should be kept")
+}
+
+func TestInstallationReconciler_CheckOrCreateInstallationOutputsCR_NoOutputs(t *testing.T) {
+	ctx := context.Background()
+	inst := testOutputSyncInstallation()
+	inst.Status.Action = &corev1.LocalObjectReference{Name: "mysql-1"}
+	inst.Status.Phase = v1.PhaseSucceeded
+	controller := setupInstallationController(inst)
+
+	grpcClient := &mocks.PorterClient{}
+	grpcClient.On("ListInstallationLatestOutputs", mock.Anything, mock.Anything).Return(&installationv1.ListInstallationLatestOutputResponse{}, nil)
+	controller.CreateGRPCClient = func(ctx context.Context) (porterv1alpha1.PorterClient, ClientConn, error) {
+		return grpcClient, pooledConn{}, nil
+	}
+
+	result, err := controller.CheckOrCreateInstallationOutputsCR(ctx, logr.Discard(), inst)
+	require.NoError(t, err, "a bundle without outputs should not fail to reconcile")
+	assert.True(t, result.IsZero())
+
+	var outputs v1.InstallationOutput
+	err = controller.Get(ctx, client.ObjectKey{Namespace: "test", Name: "mysql"}, &outputs)
+	assert.True(t, apierrors.IsNotFound(err), "no InstallationOutput should be created when there are no outputs")
+
+	require.NoError(t, controller.Get(ctx, client.ObjectKeyFromObject(inst), inst))
+	assert.True(t, apimeta.IsStatusConditionTrue(inst.Status.Conditions, v1.ConditionOutputsAvailable))
+}
+
+func TestInstallationReconciler_CheckOrCreateInstallationOutputsCR_Unavailable(t *testing.T) {
+	ctx := context.Background()
+	inst := testOutputSyncInstallation()
+	inst.Status.Action = &corev1.LocalObjectReference{Name: "mysql-1"}
+	inst.Status.Phase = v1.PhaseSucceeded
+	controller := setupInstallationController(inst)
+	recorder := controller.Recorder.(*record.FakeRecorder)
+
+	result, err := controller.CheckOrCreateInstallationOutputsCR(ctx, logr.Discard(), inst)
+	require.NoError(t, err)
+	assert.Equal(t, outputsRetryInterval, result.RequeueAfter, "the outputs should be retrieved again")
+
+	require.NoError(t, controller.Get(ctx, client.ObjectKeyFromObject(inst), inst))
+	cond := apimeta.FindStatusCondition(inst.Status.Conditions, v1.ConditionOutputsAvailable)
+	require.NotNil(t, cond)
+	assert.Equal(t, metav1.ConditionFalse, cond.Status)
+	assert.Equal(t, "PorterServerUnavailable", cond.Reason)
+	assert.Equal(t, []string{"Warning OutputsUnavailable could not connect to the porter server: error with grpc"}, drainEvents(recorder))
+
+	// The failure is only reported once
+	_, err = controller.CheckOrCreateInstallationOutputsCR(ctx, logr.Discard(), inst)
+	require.NoError(t, err)
+	assert.Empty(t, drainEvents(recorder))
+
+	// The outputs cannot be retrieved from porter
+	grpcClient := &mocks.PorterClient{}
+	grpcClient.On("ListInstallationLatestOutputs", mock.Anything, mock.Anything).Return(nil, errors.New("installation not found"))
+	controller.CreateGRPCClient = func(ctx context.Context) (porterv1alpha1.PorterClient, ClientConn, error) {
+		return grpcClient, pooledConn{}, nil
+	}
+	_, err = controller.CheckOrCreateInstallationOutputsCR(ctx, logr.Discard(), inst)
+	require.NoError(t, err)
+	require.NoError(t, controller.Get(ctx, client.ObjectKeyFromObject(inst), inst))
+	cond = apimeta.FindStatusCondition(inst.Status.Conditions, v1.ConditionOutputsAvailable)
+	require.NotNil(t, cond)
+	assert.Equal(t, "OutputsFetchFailed", cond.Reason)
+	assert.Contains(t, cond.Message, "could not retrieve the outputs of dev/mysql from porter")
+
+	// Outputs are not expected until the installation succeeds
+	inst.Status.Phase = v1.PhaseRunning
+	inst.Status.Conditions = nil
+	result, err = controller.CheckOrCreateInstallationOutputsCR(ctx, logr.Discard(), inst)
+	require.NoError(t, err)
+	assert.True(t, result.IsZero(), "the installation should not be requeued while it is running")
+	assert.Nil(t, apimeta.FindStatusCondition(inst.Status.Conditions, v1.ConditionOutputsAvailable))
+}
+
+func TestIsOutputsStale(t *testing.T) {
+	outputs := &v1.InstallationOutput{Status: v1.InstallationOutputStatus{Action: &corev1.LocalObjectReference{Name: "mysql-1"}}}
+	testcases := []struct {
+		name   string
+		action string
+		phase  v1.AgentPhase
+		want   bool
+	}{
+		{name: "not run"},
+		{name: "running", action: "mysql-2", phase: v1.PhaseRunning},
+		{name: "failed", action: "mysql-2", phase: v1.PhaseFailed},
+		{name: "same run", action: "mysql-1", phase: v1.PhaseSucceeded},
+		{name: "new run", action: "mysql-2", phase: v1.PhaseSucceeded, want: true},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			inst := &v1.Installation{ObjectMeta: metav1.ObjectMeta{Name: "mysql"}}
+			inst.Status.Phase = tc.phase
+			if tc.action != "" {
+				inst.Status.Action = &corev1.LocalObjectReference{Name: tc.action}
+			}
+			assert.Equal(t, tc.want, isOutputsStale(inst, outputs))
+		})
+	}
+
+	inst := &v1.Installation{}
+	inst.Status.Action = &corev1.LocalObjectReference{Name: "mysql-1"}
+	inst.Status.Phase = v1.PhaseSucceeded
+	assert.True(t, isOutputsStale(inst, &v1.InstallationOutput{}), "outputs that were not captured from a run should be refreshed")
+}
+
+func TestGetPorterValue(t *testing.T) {
+	testcases := []struct {
+		name  string
+		value *structpb.Value
+		want  string
+	}{
+		{name: "nil", value: nil, want: ""},
+		{name: "null", value: structpb.NewNullValue(), want: ""},
+		{name: "string", value: structpb.NewStringValue("mysql://db"), want: "mysql://db"},
+		{name: "integer", value: structpb.NewNumberValue(3306), want: "3306"},
+		{name: "number", value: structpb.NewNumberValue(0.5), want: "0.5"},
+		{name: "boolean", value: structpb.NewBoolValue(true), want: "true"},
+		{name: "object", value: structpb.NewStructValue(&structpb.Struct{Fields: map[string]*structpb.Value{"replicas": structpb.NewNumberValue(3)}}), want: `{"replicas":3}`},
+		{name: "array", value: structpb.NewListValue(&structpb.ListValue{Values: []*structpb.Value{structpb.NewStringValue("a")}}), want: `["a"]`},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, getPorterValue(tc.value))
+		})
+	}
+}
@@ -0,0 +1,230 @@
+package controllers
+
+import (
+	"context"
+
+	v1 "get.porter.sh/operator/api/v1"
+	installationv1 "get.porter.sh/porter/gen/proto/go/porterapis/installation/v1alpha1"
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// recordRun records the finished run of an agent action in an InstallationRun,
+// and prunes the runs of the installation that exceed the run history limit.
+// Each run of the agent action, including when it is retried, has its own Job
+// and is recorded separately. The run recorded by Porter is retrieved on a
+// best effort basis, it is retrieved again on the next reconcile when Porter
+// is not available.
+func (r *InstallationReconciler) recordRun(ctx context.Context, log logr.Logger, inst *v1.Installation, action *v1.AgentAction) error {
+	if !isRunFinished(action) || isDryRunAction(action) {
+		return nil
+	}
+
+	limit, err := r.resolveRunHistoryLimit(ctx, log, inst)
+	if err != nil {
+		return err
+	}
+	if limit == 0 {
+		return r.pruneRuns(ctx, log, inst, limit)
+	}
+
+	run := &v1.InstallationRun{}
+	err = r.Get(ctx, client.ObjectKey{Namespace: inst.Namespace, Name: action.Status.Job.Name}, run)
+	if err == nil {
+		if run.Status.RunID != "" || !r.applyPorterRun(ctx, log, inst, run) {
+			return nil
+		}
+		log.V(Log5Trace).Info("Updating the installation run with the run recorded by porter", "run", run.Name)
+		return errors.Wrapf(r.Status().Update(ctx, run), "error updating the installation run %s", run.Name)
+	}
+	if !apierrors.IsNotFound(err) {
+		return errors.Wrapf(err, "could not retrieve the installation run %s", action.Status.Job.Name)
+	}
+
+	run, err = r.newInstallationRun(ctx, inst, action)
+	if err != nil {
+		return err
+	}
+	status := run.Status
+	log.V(Log5Trace).Info("Creating installation run", "run", run.Name)
+	if err = r.Create(ctx, run); err != nil {
+		return errors.Wrapf(err, "error creating the installation run %s", run.Name)
+	}
+
+	run.Status = status
+	r.applyPorterRun(ctx, log, inst, run)
+	if err = r.Status().Update(ctx, run); err != nil {
+		return errors.Wrapf(err, "error updating the installation run %s", run.Name)
+	}
+
+	return r.pruneRuns(ctx, log, inst, limit)
+}
+
+// isRunFinished determines if the current job of the agent action has finished.
+func isRunFinished(action *v1.AgentAction) bool {
+	if action == nil || action.Status.Job == nil {
+		return false
+	}
+	return action.Status.Phase == v1.PhaseSucceeded || action.Status.Phase == v1.PhaseFailed
+}
+
+// newInstallationRun creates an InstallationRun for the current job of the
+// agent action, from the information available in the cluster.
+func (r *InstallationReconciler) newInstallationRun(ctx context.Context, inst *v1.Installation, action *v1.AgentAction) (*v1.InstallationRun, error) {
+	run := &v1.InstallationRun{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      action.Status.Job.Name,
+			Namespace: inst.Namespace,
+			Labels:    getActionLabels(inst),
+		},
+		Spec: v1.InstallationRunSpec{
+			Installation: corev1.LocalObjectReference{Name: inst.Name},
+			Name:         inst.Spec.Name,
+			Namespace:    inst.Spec.Namespace,
+			AgentAction:  corev1.LocalObjectReference{Name: action.Name},
+			Job:          *action.Status.Job,
+		},
+		Status: v1.InstallationRunStatus{
+			BundleReference: formatBundleReference(inst.Spec.Bundle),
+			Phase:           action.Status.Phase,
+		},
+	}
+	if err := controllerutil.SetControllerReference(inst, run, r.Scheme); err != nil {
+		return nil, errors.Wrap(err, "error setting the owner of the installation run")
+	}
+
+	// The job may have already been deleted after it finished, fall back to when the agent action changed
+	job := &batchv1.Job{}
+	err := r.Get(ctx, client.ObjectKey{Namespace: action.Namespace, Name: action.Status.Job.Name}, job)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return nil, errors.Wrapf(err, "could not retrieve the job %s", action.Status.Job.Name)
+	}
+	if err == nil {
+		run.Status.StartTime, run.Status.CompletionTime = getJobTimes(job)
+	}
+	if run.Status.StartTime == nil {
+		run.Status.StartTime = getConditionTime(action, v1.ConditionStarted)
+	}
+	if run.Status.CompletionTime == nil {
+		finished := v1.ConditionComplete
+		if action.Status.Phase == v1.PhaseFailed {
+			finished = v1.ConditionFailed
+		}
+		run.Status.CompletionTime = getConditionTime(action, finished)
+	}
+	if run.Status.StartTime == nil {
+		run.Status.StartTime = &action.CreationTimestamp
+	}
+
+	return run, nil
+}
+
+// getJobTimes returns when the job started and finished.
+func getJobTimes(job *batchv1.Job) (*metav1.Time, *metav1.Time) {
+	if job.Status.CompletionTime != nil {
+		return job.Status.StartTime, job.Status.CompletionTime
+	}
+	// The completion time is only set when the job succeeds
+	for _, cond := range job.Status.Conditions {
+		if cond.Type == batchv1.JobFailed && cond.Status == corev1.ConditionTrue {
+			return job.Status.StartTime, ptr.To(cond.LastTransitionTime)
+		}
+	}
+	return job.Status.StartTime, nil
+}
+
+func getConditionTime(action *v1.AgentAction, condType v1.AgentConditionType) *metav1.Time {
+	cond := apimeta.FindStatusCondition(action.Status.Conditions, string(condType))
+	if cond == nil {
+		return nil
+	}
+	return ptr.To(cond.LastTransitionTime)
+}
+
+// applyPorterRun updates the run with the last run of the installation recorded
+// by Porter. Returns false when the run could not be retrieved, or Porter has
+// not recorded a run since the agent started.
+func (r *InstallationReconciler) applyPorterRun(ctx context.Context, log logr.Logger, inst *v1.Installation, run *v1.InstallationRun) bool {
+	if r.CreateGRPCClient == nil {
+		return false
+	}
+
+	porterGRPCClient, conn, err := r.CreateGRPCClient(ctx)
+	if err != nil {
+		log.V(Log4Debug).Info("Unable to retrieve the installation run from porter", "error", err.Error())
+		return false
+	}
+	defer conn.Close()
+
+	in := &installationv1.ListInstallationsRequest{Name: inst.Spec.Name, Namespace: ptr.To(inst.Spec.Namespace)}
+	resp, err := porterGRPCClient.ListInstallations(ctx, in)
+	if err != nil {
+		log.V(Log4Debug).Info("Unable to retrieve the installation run from porter", "error", err.Error())
+		return false
+	}
+
+	for _, porterInst := range resp.GetInstallation() {
+		if porterInst.GetName() != inst.Spec.Name || porterInst.GetNamespace() != inst.Spec.Namespace {
+			continue
+		}
+
+		status := porterInst.GetStatus()
+		if status.GetRunId() == "" {
+			return false
+		}
+		// The agent may have failed before Porter ran the bundle, and the last run is from an earlier job
+		if modified := status.GetModified(); run.Status.StartTime != nil && modified != nil && modified.AsTime().Before(run.Status.StartTime.Time) {
+			log.V(Log5Trace).Info("The last run recorded by porter is from before the installation run", "run", run.Name, "runId", status.GetRunId())
+			return false
+		}
+
+		run.Status.RunID = status.GetRunId()
+		run.Status.Action = status.GetAction()
+		run.Status.Result = status.GetResultStatus()
+		if ref := status.GetBundleReference(); ref != "" {
+			run.Status.BundleReference = ref
+		}
+		return true
+	}
+	return false
+}
+
+// resolveRunHistoryLimit determines how many runs are kept for the installation.
+func (r *InstallationReconciler) resolveRunHistoryLimit(ctx context.Context, log logr.Logger, inst *v1.Installation) (int, error) {
+	agentCfg, err := resolveAgentConfigSpec(ctx, log, r.Client, inst.Namespace, inst.Spec.AgentConfig)
+	if err != nil {
+		return 0, err
+	}
+	return v1.NewAgentConfigSpecAdapter(agentCfg.Spec).GetRunHistoryLimit(), nil
+}
+
+// pruneRuns deletes the oldest runs of the installation, keeping the most recent runs up to the limit.
+func (r *InstallationReconciler) pruneRuns(ctx context.Context, log logr.Logger, inst *v1.Installation, limit int) error {
+	labels := getActionLabels(inst)
+	delete(labels, v1.LabelResourceGeneration)
+
+	var runs v1.InstallationRunList
+	if err := r.List(ctx, &runs, client.InNamespace(inst.Namespace), client.MatchingLabels(labels)); err != nil {
+		return errors.Wrap(err, "could not list the installation runs")
+	}
+	if len(runs.Items) <= limit {
+		return nil
+	}
+
+	runs.SortByStartTime()
+	for _, run := range runs.Items[limit:] {
+		log.V(Log5Trace).Info("Deleting installation run that exceeds the run history limit", "run", run.Name, "limit", limit)
+		if err := r.Delete(ctx, &run); client.IgnoreNotFound(err) != nil {
+			return errors.Wrapf(err, "error deleting the installation run %s", run.Name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	v1 "get.porter.sh/operator/api/v1"
+	mocks "get.porter.sh/operator/mocks/grpc"
+	installationv1 "get.porter.sh/porter/gen/proto/go/porterapis/installation/v1alpha1"
+	porterv1alpha1 "get.porter.sh/porter/gen/proto/go/porterapis/porter/v1alpha1"
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestInstallationReconciler_RecordRun(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().Truncate(time.Second)
+	inst := testOutputSyncInstallation()
+	nsCfg := &v1.AgentConfig{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "default"},
+		Spec:       v1.AgentConfigSpec{RunHistoryLimit: ptr.To(int32(2))},
+	}
+	action := &v1.AgentAction{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "mysql-1"},
+		Spec:       v1.AgentActionSpec{Args: []string{"installation", "apply", "installation.yaml"}},
+		Status:     v1.AgentActionStatus{Phase: v1.PhaseSucceeded, Job: &corev1.LocalObjectReference{Name: "mysql-1-abcde"}},
+	}
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "mysql-1-abcde"},
+		Status: batchv1.JobStatus{
+			StartTime:      &metav1.Time{Time: now.Add(-3 * time.Minute)},
+			CompletionTime: &metav1.Time{Time: now.Add(-2 * time.Minute)},
+		},
+	}
+	controller := setupInstallationController(inst, action, job, nsCfg)
+
+	porterRun := func(status *installationv1.InstallationStatus) {
+		grpcClient := &mocks.PorterClient{}
+		grpcClient.On("ListInstallations", mock.Anything, mock.Anything).Return(&installationv1.ListInstallationsResponse{
+			Installation: []*installationv1.Installation{{Name: "mysql", Namespace: "dev", Status: status}},
+		}, nil)
+		controller.CreateGRPCClient = func(ctx context.Context) (porterv1alpha1.PorterClient, ClientConn, error) {
+			return grpcClient, pooledConn{}, nil
+		}
+	}
+	getRun := func(name string) v1.InstallationRun {
+		var run v1.InstallationRun
+		require.NoError(t, controller.Get(ctx, client.ObjectKey{Namespace: "test", Name: name}, &run))
+		return run
+	}
+
+	porterRun(&installationv1.InstallationStatus{RunId: "01RUN", Action: "install", ResultStatus: "succeeded",
+		BundleReference: "ghcr.io/getporter/mysql:v0.1.0", Modified: timestamppb.New(job.Status.CompletionTime.Time)})
+	require.NoError(t, controller.recordRun(ctx, logr.Discard(), inst, action))
+
+	run := getRun("mysql-1-abcde")
+	assert.True(t, metav1.IsControlledBy(&run, inst), "the run should be deleted with the installation")
+	assert.Equal(t, v1.InstallationRunSpec{
+		Installation: corev1.LocalObjectReference{Name: "mysql"},
+		Name:         "mysql",
+		Namespace:    "dev",
+		AgentAction:  corev1.LocalObjectReference{Name: "mysql-1"},
+		Job:          corev1.LocalObjectReference{Name: "mysql-1-abcde"},
+	}, run.Spec)
+	assert.Equal(t, v1.InstallationRunStatus{
+		RunID:           "01RUN",
+		Action:          "install",
+		BundleReference: "ghcr.io/getporter/mysql:v0.1.0",
+		StartTime:       job.Status.StartTime,
+		CompletionTime:  job.Status.CompletionTime,
+		Phase:           v1.PhaseSucceeded,
+		Result:          "succeeded",
+	}, run.Status)
+
+	// The action is retried, and fails before Porter runs the bundle
+	action.Status = v1.AgentActionStatus{
+		Phase: v1.PhaseFailed,
+		Job:   &corev1.LocalObjectReference{Name: "mysql-1-fghij"},
+		Conditions: []metav1.Condition{
+			{Type: string(v1.ConditionStarted), Status: metav1.ConditionTrue, LastTransitionTime: metav1.NewTime(now.Add(-time.Minute))},
+			{Type: string(v1.ConditionFailed), Status: metav1.ConditionTrue, LastTransitionTime: metav1.NewTime(now)},
+		},
+	}
+	require.NoError(t, controller.recordRun(ctx, logr.Discard(), inst, action))
+
+	run = getRun("mysql-1-fghij")
+	assert.Empty(t, run.Status.RunID, "the last run recorded by porter is from the previous job")
+	assert.Equal(t, v1.PhaseFailed, run.Status.Phase)
+	assert.Equal(t, now.Add(-time.Minute), run.Status.StartTime.Time, "the start time should be used from the action when the job was deleted")
+	assert.Equal(t, now, run.Status.CompletionTime.Time)
+
+	// The run is updated once it is recorded by Porter
+	porterRun(&installationv1.InstallationStatus{RunId: "02RUN", Action: "upgrade", ResultStatus: "failed", Modified: timestamppb.New(now)})
+	require.NoError(t, controller.recordRun(ctx, logr.Discard(), inst, action))
+	run = getRun("mysql-1-fghij")
+	assert.Equal(t, "02RUN", run.Status.RunID)
+	assert.Equal(t, "upgrade", run.Status.Action)
+	assert.Equal(t, "failed", run.Status.Result)
+	assert.Equal(t, "ghcr.io/getporter/mysql:v0.1.0", run.Status.BundleReference, "the bundle of the installation should be used when porter does not report it")
+
+	// Dry-runs are not recorded
+	dryRun := action.DeepCopy()
+	dryRun.Spec.Args = append(dryRun.Spec.Args, dryRunFlag)
+	dryRun.Status.Job = &corev1.LocalObjectReference{Name: "mysql-2-klmno"}
+	require.NoError(t, controller.recordRun(ctx, logr.Discard(), inst, dryRun))
+
+	// The oldest runs are pruned when the history limit is exceeded
+	action.Status.Job = &corev1.LocalObjectReference{Name: "mysql-1-pqrst"}
+	action.Status.Conditions[0].LastTransitionTime = metav1.NewTime(now.Add(time.Minute))
+	require.NoError(t, controller.recordRun(ctx, logr.Discard(), inst, action))
+
+	var runs v1.InstallationRunList
+	require.NoError(t, controller.List(ctx, &runs, client.InNamespace("test")))
+	runs.SortByStartTime()
+	require.Len(t, runs.Items, 2)
+	assert.Equal(t, "mysql-1-pqrst", runs.Items[0].Name)
+	assert.Equal(t, "mysql-1-fghij", runs.Items[1].Name)
+
+	// Runs are not kept when the history limit is zero
+	nsCfg.Spec.RunHistoryLimit = ptr.To(int32(0))
+	require.NoError(t, controller.Update(ctx, nsCfg))
+	require.NoError(t, controller.recordRun(ctx, logr.Discard(), inst, action))
+	require.NoError(t, controller.List(ctx, &runs, client.InNamespace("test")))
+	assert.Empty(t, runs.Items)
+}
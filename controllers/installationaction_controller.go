@@ -0,0 +1,339 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// InstallationActionReconciler runs a custom bundle action against an Installation.
+type InstallationActionReconciler struct {
+	client.Client
+	Log      logr.Logger
+	Recorder record.EventRecorder
+	Scheme   *runtime.Scheme
+}
+
+// +kubebuilder:rbac:groups=getporter.org,resources=installationactions,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=getporter.org,resources=installationactions/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=getporter.org,resources=installationactions/finalizers,verbs=update
+// +kubebuilder:rbac:groups=getporter.org,resources=installations,verbs=get;list;watch
+// +kubebuilder:rbac:groups=getporter.org,resources=agentactions,verbs=get;list;watch;create;update;patch;delete
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *InstallationActionReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&porterv1.InstallationAction{}, builder.WithPredicates(resourceChanged{})).
+		Owns(&porterv1.AgentAction{}).
+		Watches(&porterv1.Installation{},
+			handler.EnqueueRequestsFromMapFunc(r.requestsForInstallation),
+			builder.WithPredicates(installationProgressed{})).
+		Complete(r)
+}
+
+// requestsForInstallation returns the installation actions that were not run
+// because the installation was uninstalled, so that they are run once it is installed again.
+func (r *InstallationActionReconciler) requestsForInstallation(ctx context.Context, obj client.Object) []reconcile.Request {
+	var list porterv1.InstallationActionList
+	if err := r.List(ctx, &list, client.InNamespace(obj.GetNamespace())); err != nil {
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, ia := range list.Items {
+		if ia.Spec.Installation.Name == obj.GetName() && apimeta.IsStatusConditionTrue(ia.Status.Conditions, porterv1.ConditionInstallationUninstalled) {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&ia)})
+		}
+	}
+	return requests
+}
+
+// Reconcile is called when the spec of an installation action is changed
+// or the status of its agent action is updated.
+// Run the bundle action once for each generation of the resource.
+func (r *InstallationActionReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := r.Log.WithValues("installationAction", req.Name, "namespace", req.Namespace)
+
+	ia := &porterv1.InstallationAction{}
+	err := r.Get(ctx, req.NamespacedName, ia)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			log.V(Log5Trace).Info("Reconciliation skipped: InstallationAction CRD or one of its owned resources was deleted.")
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+
+	log = log.WithValues("resourceVersion", ia.ResourceVersion, "generation", ia.Generation)
+	log.V(Log5Trace).Info("Reconciling installation action")
+
+	// Check if we have requested an agent run yet
+	action, handled, err := r.isHandled(ctx, log, ia)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if action != nil {
+		log = log.WithValues("agentaction", action.Name)
+	}
+
+	if err = r.syncStatus(ctx, log, ia, action); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if isDeleted(ia) {
+		log.V(Log4Debug).Info("Reconciliation complete: InstallationAction CRD is ready for deletion.")
+		return ctrl.Result{}, nil
+	}
+
+	if handled {
+		// Check if retry was requested
+		if action.GetRetryLabelValue() != ia.GetRetryLabelValue() {
+			err = r.retry(ctx, log, ia, action)
+			log.V(Log4Debug).Info("Reconciliation complete: The associated porter agent action was retried.")
+			return ctrl.Result{}, err
+		}
+
+		//Nothing to do
+		log.V(Log4Debug).Info("Reconciliation complete: A porter agent has already been dispatched.")
+		return ctrl.Result{}, nil
+	}
+
+	inst := &porterv1.Installation{}
+	err = r.Get(ctx, types.NamespacedName{Namespace: ia.Namespace, Name: ia.Spec.Installation.Name}, inst)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			r.Recorder.Event(ia, "Warning", "InstallationNotFound", fmt.Sprintf("waiting for the installation %s to be created", ia.Spec.Installation.Name))
+		}
+		// Requeue until the installation exists
+		return ctrl.Result{}, errors.Wrapf(err, "could not retrieve the installation %s", ia.Spec.Installation.Name)
+	}
+
+	// Bundle actions can only be run against an installation that is installed
+	if isDeleted(inst) || inst.Spec.Uninstalled {
+		err = r.skipInstallationAction(ctx, log, ia, inst)
+		log.V(Log4Debug).Info("Reconciliation complete: The installation is being uninstalled, the bundle action was not run.", "installation", inst.Name)
+		return ctrl.Result{}, err
+	}
+
+	if err = r.runInstallationAction(ctx, log, ia, inst); err != nil {
+		return ctrl.Result{}, err
+	}
+	log.V(Log4Debug).Info("Reconciliation complete: A porter agent has been dispatched to run the bundle action.")
+	return ctrl.Result{}, nil
+}
+
+// isHandled determines if this generation of the installation action resource has been processed by Porter
+func (r *InstallationActionReconciler) isHandled(ctx context.Context, log logr.Logger, ia *porterv1.InstallationAction) (*porterv1.AgentAction, bool, error) {
+	labels := getActionLabels(ia)
+	results := porterv1.AgentActionList{}
+	err := r.List(ctx, &results, client.InNamespace(ia.Namespace), client.MatchingLabels(labels))
+	if err != nil {
+		return nil, false, errors.Wrapf(err, "could not query for the current agent action")
+	}
+
+	if len(results.Items) == 0 {
+		log.V(Log4Debug).Info("No existing agent action was found")
+		return nil, false, nil
+	}
+	action := results.Items[0]
+	log.V(Log4Debug).Info("Found existing agent action", "agentaction", action.Name, "namespace", action.Namespace)
+	return &action, true, nil
+}
+
+// Check the status of the porter-agent job and use that to update the InstallationAction status
+func (r *InstallationActionReconciler) syncStatus(ctx context.Context, log logr.Logger, ia *porterv1.InstallationAction, action *porterv1.AgentAction) error {
+	origStatus := ia.Status
+
+	applyAgentAction(log, ia, action)
+
+	if !reflect.DeepEqual(origStatus, ia.Status) {
+		return r.saveStatus(ctx, log, ia)
+	}
+
+	return nil
+}
+
+// Only update the status with a PATCH, don't clobber the entire resource
+func (r *InstallationActionReconciler) saveStatus(ctx context.Context, log logr.Logger, ia *porterv1.InstallationAction) error {
+	log.V(Log5Trace).Info("Patching installation action status")
+	return PatchStatusWithRetry(ctx, log, r.Client, r.Status().Patch, ia, func() client.Object {
+		return &porterv1.InstallationAction{}
+	})
+}
+
+// skipInstallationAction records that the bundle action was not run because the
+// installation is uninstalled or being deleted. The bundle action is run when the
+// installation is installed again.
+func (r *InstallationActionReconciler) skipInstallationAction(ctx context.Context, log logr.Logger, ia *porterv1.InstallationAction, inst *porterv1.Installation) error {
+	if apimeta.IsStatusConditionTrue(ia.Status.Conditions, porterv1.ConditionInstallationUninstalled) {
+		return nil
+	}
+
+	msg := fmt.Sprintf("the bundle action was not run because the installation %s is uninstalled", inst.Name)
+	r.Recorder.Event(ia, "Warning", "InstallationUninstalled", msg)
+	apimeta.SetStatusCondition(&ia.Status.Conditions, metav1.Condition{
+		Type:               porterv1.ConditionInstallationUninstalled,
+		Status:             metav1.ConditionTrue,
+		Reason:             "InstallationUninstalled",
+		Message:            msg,
+		ObservedGeneration: ia.Generation,
+	})
+	return r.saveStatus(ctx, log, ia)
+}
+
+func (r *InstallationActionReconciler) runInstallationAction(ctx context.Context, log logr.Logger, ia *porterv1.InstallationAction, inst *porterv1.Installation) error {
+	log.V(Log5Trace).Info("Initializing installation action status")
+	ia.Status.Initialize()
+	if err := r.saveStatus(ctx, log, ia); err != nil {
+		return err
+	}
+
+	action, err := r.createAgentAction(ctx, log, ia, inst)
+	if err != nil {
+		return err
+	}
+
+	// Update the InstallationAction Status with the agent action
+	return r.syncStatus(ctx, log, ia, action)
+}
+
+// create a porter AgentAction that runs the bundle action against the installation
+func (r *InstallationActionReconciler) createAgentAction(ctx context.Context, log logr.Logger, ia *porterv1.InstallationAction, inst *porterv1.Installation) (*porterv1.AgentAction, error) {
+	log.V(Log5Trace).Info(fmt.Sprintf("Creating porter agent action to run %s", ia.Spec.Action))
+
+	labels := getActionLabels(ia)
+	for k, v := range ia.Labels {
+		labels[k] = v
+	}
+
+	agentCfg := inst.Spec.AgentConfig
+	if ia.Spec.AgentConfig != nil {
+		agentCfg = ia.Spec.AgentConfig
+	}
+
+	files, err := getInstallationActionFiles(ia, inst)
+	if err != nil {
+		return nil, err
+	}
+
+	action := &porterv1.AgentAction{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:    ia.Namespace,
+			GenerateName: ia.Name + "-",
+			Labels:       labels,
+			Annotations:  ia.Annotations,
+		},
+		Spec: porterv1.AgentActionSpec{
+			AgentConfig: agentCfg,
+			Args:        getInstallationActionArgs(ia, inst),
+			Files:       files,
+		},
+	}
+	if err := controllerutil.SetControllerReference(ia, action, r.Scheme); err != nil {
+		return nil, err
+	}
+
+	if err := r.Create(ctx, action); err != nil {
+		return nil, errors.Wrap(err, "error creating the porter installation action agent action")
+	}
+
+	r.Recorder.Event(ia, "Normal", "CreateAgentAction", fmt.Sprintf("created agent action %s to run %s on %s", action.Name, ia.Spec.Action, inst.Name))
+
+	log.V(Log4Debug).Info("Created porter installation action agent action", "name", action.Name)
+	return action, nil
+}
+
+// Sync the retry annotation from the installation action to the agent action to trigger another run.
+func (r *InstallationActionReconciler) retry(ctx context.Context, log logr.Logger, ia *porterv1.InstallationAction, action *porterv1.AgentAction) error {
+	log.V(Log5Trace).Info("Initializing installation action status")
+	ia.Status.Initialize()
+	ia.Status.Action = &corev1.LocalObjectReference{Name: action.Name}
+	if err := r.saveStatus(ctx, log, ia); err != nil {
+		return err
+	}
+
+	log.V(Log5Trace).Info("Retrying associated porter agent action")
+	retry := ia.GetRetryLabelValue()
+	action.SetRetryAnnotation(retry)
+	if err := r.Update(ctx, action); err != nil {
+		return errors.Wrap(err, "error updating the associated porter agent action")
+	}
+
+	r.Recorder.Event(ia, "Normal", "RetryAgentAction", fmt.Sprintf("retried agent action %s", action.Name))
+	log.V(Log4Debug).Info("Retried associated porter agent action", "name", action.Name, "retry", retry)
+	retries.WithLabelValues("InstallationAction", ia.Namespace).Inc()
+	return nil
+}
+
+// installationActionParametersFile is the parameter set file with the parameter
+// overrides of an installation action.
+const installationActionParametersFile = "parameters.yaml"
+
+// getInstallationActionArgs builds the porter command for the installation action,
+// including any parameter set and credential overrides. Parameter overrides are
+// passed in a parameter set file, so that their values are not on the command line.
+func getInstallationActionArgs(ia *porterv1.InstallationAction, inst *porterv1.Installation) []string {
+	args := getBundleActionArgs(inst, ia.Spec.Action)
+
+	for _, ps := range ia.Spec.ParameterSets {
+		args = append(args, "--parameter-set", ps)
+	}
+	// Parameter overrides are last, so that they take precedence over the parameter sets
+	if len(ia.Spec.Parameters) > 0 {
+		args = append(args, "--parameter-set", installationActionParametersFile)
+	}
+	for _, cs := range ia.Spec.CredentialSets {
+		args = append(args, "--cred", cs)
+	}
+
+	return args
+}
+
+// getInstallationActionFiles returns the files for the agent action of the
+// installation action, with the parameter set file for its parameter overrides.
+func getInstallationActionFiles(ia *porterv1.InstallationAction, inst *porterv1.Installation) (map[string][]byte, error) {
+	if len(ia.Spec.Parameters) == 0 {
+		return nil, nil
+	}
+
+	// Sort the parameters so that the generated file is stable
+	paramNames := make([]string, 0, len(ia.Spec.Parameters))
+	for name := range ia.Spec.Parameters {
+		paramNames = append(paramNames, name)
+	}
+	sort.Strings(paramNames)
+
+	ps := porterv1.ParameterSetSpec{
+		SchemaVersion: porterv1.ParameterSetSchemaVersion,
+		Name:          ia.Name,
+		Namespace:     inst.Spec.Namespace,
+	}
+	for _, name := range paramNames {
+		ps.Parameters = append(ps.Parameters, porterv1.Parameter{Name: name, Source: porterv1.ParameterSource{Value: ia.Spec.Parameters[name]}})
+	}
+
+	paramsB, err := ps.ToPorterDocument()
+	if err != nil {
+		return nil, err
+	}
+	return map[string][]byte{installationActionParametersFile: paramsB}, nil
+}
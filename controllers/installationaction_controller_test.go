@@ -0,0 +1,269 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestInstallationActionReconciler_Reconcile(t *testing.T) {
+	ctx := context.Background()
+
+	namespace := "test"
+	name := "backup"
+	inst := &porterv1.Installation{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "mybuns"},
+		Spec:       porterv1.InstallationSpec{Name: "mybuns", Namespace: "dev"},
+	}
+	testdata := &porterv1.InstallationAction{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, Generation: 1},
+		Spec: porterv1.InstallationActionSpec{
+			Installation: corev1.LocalObjectReference{Name: "mybuns"},
+			Action:       "backup",
+		},
+	}
+	controller := setupInstallationActionController(testdata, inst)
+
+	var ia porterv1.InstallationAction
+	triggerReconcile := func() {
+		fullname := types.NamespacedName{Namespace: namespace, Name: name}
+		request := ctrl.Request{
+			NamespacedName: fullname,
+		}
+		result, err := controller.Reconcile(ctx, request)
+		require.NoError(t, err)
+		require.True(t, result.IsZero())
+
+		require.NoError(t, controller.Get(ctx, fullname, &ia))
+	}
+	triggerReconcile()
+
+	// Verify an AgentAction was created and set on the status
+	require.NotNil(t, ia.Status.Action, "expected Action to be set")
+	assert.Equal(t, porterv1.PhaseUnknown, ia.Status.Phase, "New resources should be initialized to Phase: Unknown")
+	var action porterv1.AgentAction
+	require.NoError(t, controller.Get(ctx, client.ObjectKey{Namespace: ia.Namespace, Name: ia.Status.Action.Name}, &action))
+	assert.Equal(t, "1", action.Labels[porterv1.LabelResourceGeneration], "The wrong action is set on the status")
+	assert.Equal(t, []string{"invoke", "mybuns", "--action", "backup", "--namespace", "dev"}, action.Spec.Args)
+
+	// Mark the action as started
+	action.Status.Phase = porterv1.PhaseRunning
+	action.Status.Conditions = []metav1.Condition{{Type: string(porterv1.ConditionStarted), Status: metav1.ConditionTrue}}
+	require.NoError(t, controller.Status().Update(ctx, &action))
+
+	triggerReconcile()
+
+	// Verify the installation action status was synced with the action
+	assert.Equal(t, porterv1.PhaseRunning, ia.Status.Phase, "incorrect Phase")
+	assert.True(t, apimeta.IsStatusConditionTrue(ia.Status.Conditions, string(porterv1.ConditionStarted)))
+
+	// Complete the action
+	action.Status.Phase = porterv1.PhaseSucceeded
+	action.Status.Conditions = []metav1.Condition{{Type: string(porterv1.ConditionComplete), Status: metav1.ConditionTrue}}
+	require.NoError(t, controller.Status().Update(ctx, &action))
+
+	triggerReconcile()
+
+	// Verify the installation action status was synced with the action
+	assert.Equal(t, porterv1.PhaseSucceeded, ia.Status.Phase, "incorrect Phase")
+	assert.True(t, apimeta.IsStatusConditionTrue(ia.Status.Conditions, string(porterv1.ConditionComplete)))
+
+	// Reconciling again should not run the action again
+	triggerReconcile()
+	var actions porterv1.AgentActionList
+	require.NoError(t, controller.List(ctx, &actions, client.InNamespace(namespace)))
+	assert.Len(t, actions.Items, 1, "the action should only be run once per generation")
+
+	// Retry the last action
+	ia.Annotations = map[string]string{porterv1.AnnotationRetry: "retry-1"}
+	require.NoError(t, controller.Update(ctx, &ia))
+
+	triggerReconcile()
+
+	// Verify that action has retry set on it now
+	require.NotNil(t, ia.Status.Action, "Expected the action to still be set")
+	assert.Equal(t, action.Name, ia.Status.Action.Name, "Expected the action to be the same")
+	require.NoError(t, controller.Get(ctx, client.ObjectKey{Namespace: ia.Namespace, Name: ia.Status.Action.Name}, &action))
+	assert.NotEmpty(t, action.Annotations[porterv1.AnnotationRetry], "Expected the action to have its retry annotation set")
+	assert.Equal(t, porterv1.PhaseUnknown, ia.Status.Phase, "The status should be reset when the action is retried")
+}
+
+func TestInstallationActionReconciler_Reconcile_MissingInstallation(t *testing.T) {
+	ctx := context.Background()
+
+	testdata := &porterv1.InstallationAction{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "backup", Generation: 1},
+		Spec: porterv1.InstallationActionSpec{
+			Installation: corev1.LocalObjectReference{Name: "mybuns"},
+			Action:       "backup",
+		},
+	}
+	controller := setupInstallationActionController(testdata)
+
+	_, err := controller.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "test", Name: "backup"}})
+	require.Error(t, err, "the action should be requeued until the installation exists")
+	assert.Contains(t, err.Error(), "could not retrieve the installation mybuns")
+
+	var actions porterv1.AgentActionList
+	require.NoError(t, controller.List(ctx, &actions, client.InNamespace("test")))
+	assert.Empty(t, actions.Items)
+}
+
+func TestInstallationActionReconciler_Reconcile_UninstalledInstallation(t *testing.T) {
+	ctx := context.Background()
+
+	inst := &porterv1.Installation{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "mybuns"},
+		Spec:       porterv1.InstallationSpec{Name: "mybuns", Namespace: "dev", Uninstalled: true},
+	}
+	testdata := &porterv1.InstallationAction{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "backup", Generation: 1},
+		Spec: porterv1.InstallationActionSpec{
+			Installation: corev1.LocalObjectReference{Name: "mybuns"},
+			Action:       "backup",
+		},
+	}
+	controller := setupInstallationActionController(testdata, inst)
+	recorder := controller.Recorder.(*record.FakeRecorder)
+
+	key := types.NamespacedName{Namespace: "test", Name: "backup"}
+	_, err := controller.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+	require.NoError(t, err)
+
+	var actions porterv1.AgentActionList
+	require.NoError(t, controller.List(ctx, &actions, client.InNamespace("test")))
+	assert.Empty(t, actions.Items, "the bundle action should not be run against an uninstalled installation")
+
+	var ia porterv1.InstallationAction
+	require.NoError(t, controller.Get(ctx, key, &ia))
+	assert.True(t, apimeta.IsStatusConditionTrue(ia.Status.Conditions, porterv1.ConditionInstallationUninstalled))
+	assert.Equal(t, []string{"Warning InstallationUninstalled the bundle action was not run because the installation mybuns is uninstalled"}, drainEvents(recorder))
+
+	// The installation action is requeued once the installation is installed again
+	inst.Spec.Uninstalled = false
+	require.NoError(t, controller.Update(ctx, inst))
+	requests := controller.requestsForInstallation(ctx, inst)
+	require.Len(t, requests, 1)
+	assert.Equal(t, key, requests[0].NamespacedName)
+
+	_, err = controller.Reconcile(ctx, requests[0])
+	require.NoError(t, err)
+	require.NoError(t, controller.List(ctx, &actions, client.InNamespace("test")))
+	require.Len(t, actions.Items, 1, "the bundle action should be run once the installation is installed")
+	require.NoError(t, controller.Get(ctx, key, &ia))
+	assert.Nil(t, apimeta.FindStatusCondition(ia.Status.Conditions, porterv1.ConditionInstallationUninstalled))
+	assert.Contains(t, drainEvents(recorder), "Normal CreateAgentAction created agent action "+actions.Items[0].Name+" to run backup on mybuns")
+}
+
+func TestInstallationActionReconciler_createAgentAction(t *testing.T) {
+	controller := setupInstallationActionController()
+
+	inst := &porterv1.Installation{
+		Spec: porterv1.InstallationSpec{
+			Name:        "mybuns",
+			Namespace:   "dev",
+			AgentConfig: &corev1.LocalObjectReference{Name: "installAgentConfig"},
+		},
+	}
+	ia := &porterv1.InstallationAction{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: porterv1.GroupVersion.String(),
+			Kind:       "InstallationAction",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:  "test",
+			Name:       "rotate",
+			UID:        "random-uid",
+			Generation: 1,
+			Labels: map[string]string{
+				"testLabel": "abc123",
+			},
+		},
+		Spec: porterv1.InstallationActionSpec{
+			AgentConfig:    &corev1.LocalObjectReference{Name: "myAgentConfig"},
+			Installation:   corev1.LocalObjectReference{Name: "mybuns"},
+			Action:         "rotate-keys",
+			Parameters:     map[string]string{"region": "eastus", "algorithm": "rsa"},
+			ParameterSets:  []string{"mybuns-params"},
+			CredentialSets: []string{"mybuns-creds", "admin-creds"},
+		},
+	}
+
+	action, err := controller.createAgentAction(context.Background(), logr.Discard(), ia, inst)
+	require.NoError(t, err)
+	assert.Equal(t, "test", action.Namespace)
+	assert.Contains(t, action.Name, "rotate-")
+	wantOwnerRef := metav1.OwnerReference{
+		APIVersion:         porterv1.GroupVersion.String(),
+		Kind:               "InstallationAction",
+		Name:               "rotate",
+		UID:                "random-uid",
+		Controller:         ptr.To(true),
+		BlockOwnerDeletion: ptr.To(true),
+	}
+	require.Len(t, action.OwnerReferences, 1, "expected an owner reference")
+	assert.Equal(t, wantOwnerRef, action.OwnerReferences[0], "incorrect owner reference")
+	assertContains(t, action.Labels, porterv1.LabelManaged, "true", "incorrect label")
+	assertContains(t, action.Labels, porterv1.LabelResourceKind, "InstallationAction", "incorrect label")
+	assertContains(t, action.Labels, porterv1.LabelResourceName, "rotate", "incorrect label")
+	assertContains(t, action.Labels, porterv1.LabelResourceGeneration, "1", "incorrect label")
+	assertContains(t, action.Labels, "testLabel", "abc123", "incorrect label")
+
+	assert.Equal(t, ia.Spec.AgentConfig, action.Spec.AgentConfig, "the AgentConfig on the installation action should take precedence")
+	wantArgs := []string{
+		"invoke", "mybuns", "--action", "rotate-keys", "--namespace", "dev",
+		"--parameter-set", "mybuns-params", "--parameter-set", "parameters.yaml",
+		"--cred", "mybuns-creds", "--cred", "admin-creds",
+	}
+	assert.Equal(t, wantArgs, action.Spec.Args, "incorrect agent arguments")
+	for _, arg := range action.Spec.Args {
+		assert.NotContains(t, arg, "eastus", "parameter values should not be passed on the command line")
+	}
+
+	wantParams := `schemaVersion: 1.0.1
+name: rotate
+namespace: dev
+parameters:
+    - name: algorithm
+      source:
+        value: rsa
+    - name: region
+      source:
+        value: eastus
+`
+	assert.Equal(t, wantParams, string(action.Spec.Files["parameters.yaml"]), "the parameter overrides should be passed in a parameter set file")
+}
+
+func setupInstallationActionController(objs ...client.Object) *InstallationActionReconciler {
+	scheme := runtime.NewScheme()
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(porterv1.AddToScheme(scheme))
+
+	fakeBuilder := fake.NewClientBuilder()
+	fakeBuilder.WithScheme(scheme)
+	fakeBuilder.WithObjects(objs...).WithStatusSubresource(objs...).WithStatusSubresource(&porterv1.AgentAction{})
+	fakeClient := fakeBuilder.Build()
+
+	return &InstallationActionReconciler{
+		Log:      logr.Discard(),
+		Client:   fakeClient,
+		Recorder: record.NewFakeRecorder(42),
+		Scheme:   scheme,
+	}
+}
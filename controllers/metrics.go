@@ -0,0 +1,205 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+	"github.com/prometheus/client_golang/prometheus"
+	batchv1 "k8s.io/api/batch/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const metricsNamespace = "porter_operator"
+
+var (
+	// agentJobDuration is how long the Porter Agent jobs run, by the porter command that was run.
+	agentJobDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "agent_job_duration_seconds",
+		Help:      "Duration of Porter Agent jobs, by the porter command run and the phase of the job when it finished.",
+		Buckets:   []float64{5, 15, 30, 60, 120, 300, 600, 1200, 1800, 3600},
+	}, []string{"action", "phase"})
+
+	// retries counts the number of times a resource retried its agent action.
+	retries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "retries_total",
+		Help:      "Number of times that a resource retried its agent action.",
+	}, []string{"kind", "namespace"})
+
+	// pluginInstallDuration is how long it takes to install the plugins defined on an AgentConfig.
+	pluginInstallDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "plugin_install_duration_seconds",
+		Help:      "Duration of installing the plugins defined on an AgentConfig, by the phase of the agent action when it finished.",
+		Buckets:   []float64{5, 15, 30, 60, 120, 300, 600},
+	}, []string{"phase"})
+
+	// outputFetchErrors counts the failures to retrieve installation outputs from the Porter gRPC server.
+	outputFetchErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "output_fetch_errors_total",
+		Help:      "Number of times that installation outputs could not be retrieved from the Porter gRPC server.",
+	}, []string{"namespace"})
+
+	installationPhaseDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "", "installations"),
+		"Number of Installations, by namespace and phase.",
+		[]string{"namespace", "phase"}, nil)
+
+	installationPhases = []porterv1.AgentPhase{
+		porterv1.PhaseUnknown,
+		porterv1.PhasePending,
+		porterv1.PhaseRunning,
+		porterv1.PhaseSucceeded,
+		porterv1.PhaseFailed,
+		porterv1.PhasePendingApproval,
+	}
+)
+
+func init() {
+	metrics.Registry.MustRegister(agentJobDuration, retries, pluginInstallDuration, outputFetchErrors)
+}
+
+// InstallationCollector reports the number of Installations in each phase
+// per namespace, read from the controller's cache when the metrics are scraped.
+type InstallationCollector struct {
+	Client client.Reader
+}
+
+// NewInstallationCollector creates a collector that reports Installation metrics.
+func NewInstallationCollector(c client.Reader) *InstallationCollector {
+	return &InstallationCollector{Client: c}
+}
+
+var _ prometheus.Collector = &InstallationCollector{}
+
+// Describe the metrics reported by the collector.
+func (c *InstallationCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- installationPhaseDesc
+}
+
+// Collect the number of Installations in each phase per namespace.
+func (c *InstallationCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var list porterv1.InstallationList
+	if err := c.Client.List(ctx, &list); err != nil {
+		ch <- prometheus.NewInvalidMetric(installationPhaseDesc, err)
+		return
+	}
+
+	counts := make(map[string]map[porterv1.AgentPhase]int)
+	for _, inst := range list.Items {
+		phase := inst.Status.Phase
+		if phase == "" {
+			phase = porterv1.PhaseUnknown
+		}
+		if counts[inst.Namespace] == nil {
+			counts[inst.Namespace] = make(map[porterv1.AgentPhase]int, len(installationPhases))
+		}
+		counts[inst.Namespace][phase]++
+	}
+
+	for namespace, phases := range counts {
+		// Report every phase so that a namespace's series drop to zero instead of disappearing
+		for _, phase := range installationPhases {
+			ch <- prometheus.MustNewConstMetric(installationPhaseDesc, prometheus.GaugeValue, float64(phases[phase]), namespace, string(phase))
+		}
+	}
+}
+
+// porterCommandGroups are the porter commands that are followed by a subcommand,
+// for example porter installation apply.
+var porterCommandGroups = map[string]bool{
+	"installation":  true,
+	"installations": true,
+	"credentials":   true,
+	"parameters":    true,
+	"plugins":       true,
+}
+
+// getActionType returns the porter command run by an agent action, for example
+// "installation apply", or "invoke backup" for a custom bundle action. Positional
+// arguments such as the installation name are left out so that the metric
+// labels have a small number of values.
+func getActionType(action *porterv1.AgentAction) string {
+	args := action.Spec.Args
+	if len(args) == 0 {
+		return ""
+	}
+
+	actionType := args[0]
+	if porterCommandGroups[actionType] && len(args) > 1 && !strings.HasPrefix(args[1], "-") {
+		actionType += " " + args[1]
+	}
+	for i, arg := range args {
+		if arg == "--action" && i+1 < len(args) {
+			return actionType + " " + args[i+1]
+		}
+		if value, ok := strings.CutPrefix(arg, "--action="); ok {
+			return actionType + " " + value
+		}
+	}
+	return actionType
+}
+
+// isFinished determines if an agent action has completed, successfully or not.
+func isFinished(phase porterv1.AgentPhase) bool {
+	return phase == porterv1.PhaseSucceeded || phase == porterv1.PhaseFailed
+}
+
+// recordAgentJobDuration observes how long an agent job ran, once it has finished.
+func recordAgentJobDuration(action *porterv1.AgentAction, job *batchv1.Job) {
+	if job == nil || job.Status.StartTime == nil {
+		return
+	}
+
+	end := getJobEndTime(job)
+	if end.IsZero() {
+		return
+	}
+
+	agentJobDuration.WithLabelValues(getActionType(action), string(action.Status.Phase)).
+		Observe(end.Sub(job.Status.StartTime.Time).Seconds())
+}
+
+// getJobEndTime returns when the job finished, or the zero time when it is still running.
+func getJobEndTime(job *batchv1.Job) time.Time {
+	if job.Status.CompletionTime != nil {
+		return job.Status.CompletionTime.Time
+	}
+
+	var end time.Time
+	for _, condition := range job.Status.Conditions {
+		if condition.Type == batchv1.JobFailed {
+			end = condition.LastTransitionTime.Time
+		}
+	}
+	return end
+}
+
+// recordPluginInstallDuration observes how long the agent action that installs
+// plugins took, from when its job was scheduled until it finished.
+func recordPluginInstallDuration(action *porterv1.AgentAction) {
+	if action == nil {
+		return
+	}
+
+	scheduled := apimeta.FindStatusCondition(action.Status.Conditions, string(porterv1.ConditionScheduled))
+	finished := apimeta.FindStatusCondition(action.Status.Conditions, string(porterv1.ConditionComplete))
+	if finished == nil {
+		finished = apimeta.FindStatusCondition(action.Status.Conditions, string(porterv1.ConditionFailed))
+	}
+	if scheduled == nil || finished == nil {
+		return
+	}
+
+	pluginInstallDuration.WithLabelValues(string(action.Status.Phase)).
+		Observe(finished.LastTransitionTime.Sub(scheduled.LastTransitionTime.Time).Seconds())
+}
@@ -0,0 +1,184 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestInstallationCollector(t *testing.T) {
+	newInstallation := func(namespace string, name string, phase porterv1.AgentPhase) client.Object {
+		return &porterv1.Installation{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+			Status:     porterv1.InstallationStatus{PorterResourceStatus: porterv1.PorterResourceStatus{Phase: phase}},
+		}
+	}
+
+	scheme := runtime.NewScheme()
+	utilruntime.Must(porterv1.AddToScheme(scheme))
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		newInstallation("dev", "mysql", porterv1.PhaseSucceeded),
+		newInstallation("dev", "wordpress", porterv1.PhaseSucceeded),
+		newInstallation("dev", "redis", porterv1.PhaseFailed),
+		newInstallation("test", "mysql", porterv1.PhaseRunning),
+		newInstallation("test", "wordpress", ""),
+	).Build()
+
+	want := `
+# HELP porter_operator_installations Number of Installations, by namespace and phase.
+# TYPE porter_operator_installations gauge
+porter_operator_installations{namespace="dev",phase="Failed"} 1
+porter_operator_installations{namespace="dev",phase="Pending"} 0
+porter_operator_installations{namespace="dev",phase="PendingApproval"} 0
+porter_operator_installations{namespace="dev",phase="Running"} 0
+porter_operator_installations{namespace="dev",phase="Succeeded"} 2
+porter_operator_installations{namespace="dev",phase="Unknown"} 0
+porter_operator_installations{namespace="test",phase="Failed"} 0
+porter_operator_installations{namespace="test",phase="Pending"} 0
+porter_operator_installations{namespace="test",phase="PendingApproval"} 0
+porter_operator_installations{namespace="test",phase="Running"} 1
+porter_operator_installations{namespace="test",phase="Succeeded"} 0
+porter_operator_installations{namespace="test",phase="Unknown"} 1
+`
+	err := testutil.CollectAndCompare(NewInstallationCollector(c), strings.NewReader(want))
+	require.NoError(t, err)
+}
+
+func TestGetActionType(t *testing.T) {
+	testcases := map[string]struct {
+		args []string
+		want string
+	}{
+		"installation": {args: []string{"installation", "apply", "installation.yaml"}, want: "installation apply"},
+		"plugins":      {args: []string{"plugins", "install", "-f", "plugins.yaml"}, want: "plugins install"},
+		"single":       {args: []string{"version"}, want: "version"},
+		"bundle":       {args: []string{"upgrade", "mybuns", "--namespace", "dev"}, want: "upgrade"},
+		"invoke":       {args: []string{"invoke", "x", "--action", "backup"}, want: "invoke backup"},
+		"invoke equal": {args: []string{"invoke", "x", "--action=backup", "--namespace", "dev"}, want: "invoke backup"},
+		"none":         {args: nil, want: ""},
+	}
+	for name, tc := range testcases {
+		t.Run(name, func(t *testing.T) {
+			action := &porterv1.AgentAction{Spec: porterv1.AgentActionSpec{Args: tc.args}}
+			assert.Equal(t, tc.want, getActionType(action))
+		})
+	}
+}
+
+func TestRecordAgentJobDuration(t *testing.T) {
+	agentJobDuration.Reset()
+	defer agentJobDuration.Reset()
+
+	start := metav1.NewTime(time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC))
+	succeeded := &porterv1.AgentAction{
+		Spec:   porterv1.AgentActionSpec{Args: []string{"installation", "apply", "installation.yaml"}},
+		Status: porterv1.AgentActionStatus{Phase: porterv1.PhaseSucceeded},
+	}
+	recordAgentJobDuration(succeeded, &batchv1.Job{Status: batchv1.JobStatus{
+		StartTime:      &start,
+		CompletionTime: &metav1.Time{Time: start.Add(90 * time.Second)},
+	}})
+
+	failed := &porterv1.AgentAction{
+		Spec:   porterv1.AgentActionSpec{Args: []string{"installation", "apply", "installation.yaml"}},
+		Status: porterv1.AgentActionStatus{Phase: porterv1.PhaseFailed},
+	}
+	recordAgentJobDuration(failed, &batchv1.Job{Status: batchv1.JobStatus{
+		StartTime: &start,
+		Conditions: []batchv1.JobCondition{
+			{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, LastTransitionTime: metav1.NewTime(start.Add(10 * time.Second))},
+		},
+	}})
+
+	// Jobs that have not started are not recorded
+	recordAgentJobDuration(succeeded, &batchv1.Job{})
+
+	assert.Equal(t, 2, testutil.CollectAndCount(agentJobDuration))
+	want := `
+# HELP porter_operator_agent_job_duration_seconds Duration of Porter Agent jobs, by the porter command run and the phase of the job when it finished.
+# TYPE porter_operator_agent_job_duration_seconds histogram
+porter_operator_agent_job_duration_seconds_sum{action="installation apply",phase="Succeeded"} 90
+porter_operator_agent_job_duration_seconds_count{action="installation apply",phase="Succeeded"} 1
+porter_operator_agent_job_duration_seconds_sum{action="installation apply",phase="Failed"} 10
+porter_operator_agent_job_duration_seconds_count{action="installation apply",phase="Failed"} 1
+`
+	err := testutil.CollectAndCompare(agentJobDuration, strings.NewReader(want),
+		"porter_operator_agent_job_duration_seconds_sum", "porter_operator_agent_job_duration_seconds_count")
+	require.NoError(t, err)
+}
+
+func TestAgentActionReconciler_SyncStatus_RecordsJobDuration(t *testing.T) {
+	agentJobDuration.Reset()
+	defer agentJobDuration.Reset()
+
+	action := &porterv1.AgentAction{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "myaction", Generation: 1},
+		Spec:       porterv1.AgentActionSpec{Args: []string{"credentials", "apply", "credentials.yaml"}},
+		Status:     porterv1.AgentActionStatus{Phase: porterv1.PhaseRunning},
+	}
+	start := metav1.NewTime(time.Now().Add(-time.Minute))
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "myaction-job"},
+		Status: batchv1.JobStatus{
+			Succeeded:      1,
+			StartTime:      &start,
+			CompletionTime: &metav1.Time{Time: start.Add(30 * time.Second)},
+			Conditions:     []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}},
+		},
+	}
+	controller := setupAgentActionController(action)
+	ctx := context.Background()
+
+	require.NoError(t, controller.syncStatus(ctx, controller.Log, action, job))
+	assert.Equal(t, porterv1.PhaseSucceeded, action.Status.Phase)
+	assert.Equal(t, 1, testutil.CollectAndCount(agentJobDuration), "the duration should be recorded when the job finishes")
+
+	// Syncing a finished job again should not record it twice
+	require.NoError(t, controller.syncStatus(ctx, controller.Log, action, job))
+	err := testutil.CollectAndCompare(agentJobDuration, strings.NewReader(`
+# HELP porter_operator_agent_job_duration_seconds Duration of Porter Agent jobs, by the porter command run and the phase of the job when it finished.
+# TYPE porter_operator_agent_job_duration_seconds histogram
+porter_operator_agent_job_duration_seconds_count{action="credentials apply",phase="Succeeded"} 1
+`), "porter_operator_agent_job_duration_seconds_count")
+	require.NoError(t, err)
+}
+
+func TestRecordPluginInstallDuration(t *testing.T) {
+	pluginInstallDuration.Reset()
+	defer pluginInstallDuration.Reset()
+
+	scheduled := metav1.NewTime(time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC))
+	action := &porterv1.AgentAction{
+		Status: porterv1.AgentActionStatus{
+			Phase: porterv1.PhaseSucceeded,
+			Conditions: []metav1.Condition{
+				{Type: string(porterv1.ConditionScheduled), Status: metav1.ConditionTrue, LastTransitionTime: scheduled},
+				{Type: string(porterv1.ConditionStarted), Status: metav1.ConditionTrue, LastTransitionTime: metav1.NewTime(scheduled.Add(5 * time.Second))},
+				{Type: string(porterv1.ConditionComplete), Status: metav1.ConditionTrue, LastTransitionTime: metav1.NewTime(scheduled.Add(45 * time.Second))},
+			},
+		},
+	}
+	recordPluginInstallDuration(action)
+	recordPluginInstallDuration(nil)
+
+	err := testutil.CollectAndCompare(pluginInstallDuration, strings.NewReader(`
+# HELP porter_operator_plugin_install_duration_seconds Duration of installing the plugins defined on an AgentConfig, by the phase of the agent action when it finished.
+# TYPE porter_operator_plugin_install_duration_seconds histogram
+porter_operator_plugin_install_duration_seconds_sum{phase="Succeeded"} 45
+porter_operator_plugin_install_duration_seconds_count{phase="Succeeded"} 1
+`), "porter_operator_plugin_install_duration_seconds_sum", "porter_operator_plugin_install_duration_seconds_count")
+	require.NoError(t, err)
+}
@@ -0,0 +1,128 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	v1 "get.porter.sh/operator/api/v1"
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// errOutputTargetNotOwned is returned when the ConfigMap or Secret that outputs
+// are written to already exists, and is not owned by the installation.
+var errOutputTargetNotOwned = errors.New("it already exists and is not owned by the installation")
+
+// syncOutputs writes the outputs of the installation to a ConfigMap, and its
+// sensitive outputs to a Secret, when output sync is enabled. The outputs are
+// read from the installation's InstallationOutput.
+func (r *InstallationReconciler) syncOutputs(ctx context.Context, log logr.Logger, inst *v1.Installation) error {
+	sync := inst.Spec.OutputSync
+	if sync == nil || isDeleted(inst) {
+		return nil
+	}
+
+	var outputs v1.InstallationOutput
+	err := r.Get(ctx, types.NamespacedName{Namespace: inst.Namespace, Name: inst.Spec.Name}, &outputs)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			log.V(Log5Trace).Info("Not syncing the installation outputs because they have not been captured")
+			return nil
+		}
+		return errors.Wrap(err, "could not retrieve the installation outputs")
+	}
+
+	data := make(map[string]string)
+	secretData := make(map[string][]byte)
+	for _, output := range outputs.Status.Outputs {
+		value, ok, err := r.resolveOutputValue(ctx, outputs.Namespace, output)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+
+		key := sync.GetKey(output.Name)
+		if output.Sensitive {
+			secretData[key] = []byte(value)
+		} else {
+			data[key] = value
+		}
+	}
+
+	origStatus := inst.Status.DeepCopy()
+	labels := getOutputSyncLabels(inst)
+
+	cm := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: inst.Namespace, Name: sync.GetConfigMapName(inst.Name)}}
+	cmResult, err := r.writeOutputTarget(ctx, inst, "ConfigMap", cm, func() {
+		cm.Labels = labels
+		cm.Data = data
+	})
+	if err != nil {
+		return err
+	}
+	if cmResult != "" {
+		inst.Status.OutputConfigMap = &corev1.LocalObjectReference{Name: cm.Name}
+	}
+
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: inst.Namespace, Name: sync.GetSecretName(inst.Name)}}
+	secretResult, err := r.writeOutputTarget(ctx, inst, "Secret", secret, func() {
+		secret.Labels = labels
+		secret.Type = corev1.SecretTypeOpaque
+		secret.Data = secretData
+	})
+	if err != nil {
+		return err
+	}
+	if secretResult != "" {
+		inst.Status.OutputSecret = &corev1.LocalObjectReference{Name: secret.Name}
+	}
+
+	if isOutputTargetChanged(cmResult) || isOutputTargetChanged(secretResult) {
+		log.V(Log4Debug).Info("Synced the installation outputs", "configmap", cm.Name, "secret", secret.Name)
+		r.Recorder.Event(inst, "Normal", "OutputsSynced", fmt.Sprintf("wrote the outputs of %s to the ConfigMap %s and the Secret %s", inst.Name, cm.Name, secret.Name))
+	}
+
+	return r.saveStatusIfChanged(ctx, log, inst, origStatus)
+}
+
+// writeOutputTarget creates or updates a ConfigMap or Secret that outputs are
+// written to, and returns the result. The result is empty when the object is
+// not owned by the installation, and it is left unchanged.
+func (r *InstallationReconciler) writeOutputTarget(ctx context.Context, inst *v1.Installation, kind string, obj client.Object, mutate func()) (controllerutil.OperationResult, error) {
+	result, err := controllerutil.CreateOrUpdate(ctx, r.Client, obj, func() error {
+		if obj.GetResourceVersion() != "" && !metav1.IsControlledBy(obj, inst) {
+			return errOutputTargetNotOwned
+		}
+		mutate()
+		return controllerutil.SetControllerReference(inst, obj, r.Scheme)
+	})
+	if err != nil {
+		if errors.Is(err, errOutputTargetNotOwned) {
+			r.Recorder.Event(inst, "Warning", "OutputSyncFailed", fmt.Sprintf("the outputs were not written to the %s %s because %s", kind, obj.GetName(), err))
+			return "", nil
+		}
+		return "", errors.Wrapf(err, "error writing the installation outputs to the %s %s", kind, obj.GetName())
+	}
+	return result, nil
+}
+
+func isOutputTargetChanged(result controllerutil.OperationResult) bool {
+	return result == controllerutil.OperationResultCreated || result == controllerutil.OperationResultUpdated
+}
+
+// getOutputSyncLabels returns the labels applied to the ConfigMap and Secret that the outputs of an installation are written to.
+func getOutputSyncLabels(inst *v1.Installation) map[string]string {
+	return map[string]string{
+		v1.LabelManaged:      "true",
+		v1.LabelResourceKind: "Installation",
+		v1.LabelResourceName: inst.Name,
+	}
+}
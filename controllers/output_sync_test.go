@@ -0,0 +1,94 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	v1 "get.porter.sh/operator/api/v1"
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func testOutputSyncInstallation() *v1.Installation {
+	inst := testInstallation("test", "mysql")
+	inst.Spec.OutputSync = &v1.OutputSync{Keys: map[string]string{"connstr": "DATABASE_URL"}}
+	return inst
+}
+
+func TestInstallationReconciler_syncOutputs(t *testing.T) {
+	ctx := context.Background()
+	inst := testOutputSyncInstallation()
+	outputs := testInstallationOutput("mysql://db")
+	controller := setupInstallationController(inst, outputs)
+	recorder := controller.Recorder.(*record.FakeRecorder)
+
+	require.NoError(t, controller.syncOutputs(ctx, logr.Discard(), inst))
+
+	var cm corev1.ConfigMap
+	require.NoError(t, controller.Get(ctx, client.ObjectKey{Namespace: "test", Name: "mysql-outputs"}, &cm))
+	assert.Equal(t, map[string]string{"port": "3306"}, cm.Data, "outputs that are not sensitive should be written to the ConfigMap")
+	assert.True(t, metav1.IsControlledBy(&cm, inst), "the ConfigMap should be owned by the installation")
+	assertContains(t, cm.Labels, v1.LabelResourceName, "mysql", "incorrect label")
+
+	var secret corev1.Secret
+	require.NoError(t, controller.Get(ctx, client.ObjectKey{Namespace: "test", Name: "mysql-outputs"}, &secret))
+	assert.Equal(t, map[string][]byte{"DATABASE_URL": []byte("mysql://db")}, secret.Data, "sensitive outputs should be written to the Secret with the mapped key")
+	assert.True(t, metav1.IsControlledBy(&secret, inst), "the Secret should be owned by the installation")
+
+	assert.Equal(t, &corev1.LocalObjectReference{Name: "mysql-outputs"}, inst.Status.OutputConfigMap)
+	assert.Equal(t, &corev1.LocalObjectReference{Name: "mysql-outputs"}, inst.Status.OutputSecret)
+	assert.Equal(t, []string{"Normal OutputsSynced wrote the outputs of mysql to the ConfigMap mysql-outputs and the Secret mysql-outputs"}, drainEvents(recorder))
+
+	// Syncing outputs that have not changed does nothing
+	require.NoError(t, controller.syncOutputs(ctx, logr.Discard(), inst))
+	assert.Empty(t, drainEvents(recorder))
+
+	// Changed outputs are kept in sync
+	outputs.Status.Outputs[0].Value = "mysql://db2"
+	require.NoError(t, controller.Status().Update(ctx, outputs))
+	require.NoError(t, controller.syncOutputs(ctx, logr.Discard(), inst))
+	require.NoError(t, controller.Get(ctx, client.ObjectKey{Namespace: "test", Name: "mysql-outputs"}, &secret))
+	assert.Equal(t, []byte("mysql://db2"), secret.Data["DATABASE_URL"])
+	assert.Len(t, drainEvents(recorder), 1)
+}
+
+func TestInstallationReconciler_syncOutputs_NotOwned(t *testing.T) {
+	ctx := context.Background()
+	inst := testOutputSyncInstallation()
+	inst.Spec.OutputSync.ConfigMapName = "app-config"
+	existing := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "app-config"},
+		Data:       map[string]string{"color": "blue"},
+	}
+	controller := setupInstallationController(inst, testInstallationOutput("mysql://db"), existing)
+
+	require.NoError(t, controller.syncOutputs(ctx, logr.Discard(), inst))
+
+	var cm corev1.ConfigMap
+	require.NoError(t, controller.Get(ctx, client.ObjectKey{Namespace: "test", Name: "app-config"}, &cm))
+	assert.Equal(t, existing.Data, cm.Data, "a ConfigMap that is not owned by the installation should not be changed")
+	assert.Nil(t, inst.Status.OutputConfigMap)
+	assert.NotNil(t, inst.Status.OutputSecret, "the Secret should still be written")
+
+	events := drainEvents(controller.Recorder.(*record.FakeRecorder))
+	assert.Contains(t, events, "Warning OutputSyncFailed the outputs were not written to the ConfigMap app-config because it already exists and is not owned by the installation")
+}
+
+func TestInstallationReconciler_syncOutputs_Disabled(t *testing.T) {
+	ctx := context.Background()
+	inst := testOutputSyncInstallation()
+	inst.Spec.OutputSync = nil
+	controller := setupInstallationController(inst, testInstallationOutput("mysql://db"))
+
+	require.NoError(t, controller.syncOutputs(ctx, logr.Discard(), inst))
+
+	var cm corev1.ConfigMap
+	err := controller.Get(ctx, client.ObjectKey{Namespace: "test", Name: "mysql-outputs"}, &cm)
+	assert.True(t, apierrors.IsNotFound(err), "outputs should not be written when output sync is disabled")
+}
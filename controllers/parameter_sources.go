@@ -0,0 +1,332 @@
+package controllers
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	v1 "get.porter.sh/operator/api/v1"
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	// reasonOutputsNotReady is the reason that an installation waits for the
+	// outputs used by its parameter sources.
+	reasonOutputsNotReady = "OutputsNotReady"
+
+	// unresolvedParametersDigest is the digest of parameters that could not be
+	// resolved, which does not match the digest of any agent action.
+	unresolvedParametersDigest = "unresolved"
+)
+
+// checkParameterSources determines if the installation must wait for the outputs
+// used by its parameter sources before it is applied, and reports why it is
+// waiting in its status. Sensitive outputs are passed to Porter in a parameter
+// set, and the installation also waits for it to be applied.
+func (r *InstallationReconciler) checkParameterSources(ctx context.Context, log logr.Logger, inst *v1.Installation) (bool, error) {
+	if len(inst.Spec.ParameterSources) == 0 {
+		return false, nil
+	}
+
+	resolved, err := r.resolveParameters(ctx, inst)
+	if err != nil {
+		return false, err
+	}
+	if len(resolved.Pending) > 0 {
+		msg := fmt.Sprintf("waiting for outputs: %s", strings.Join(resolved.Pending, ", "))
+		log.V(Log4Debug).Info("Reconciliation complete: The installation is waiting for the outputs used by its parameters.", "pending", resolved.Pending)
+		return true, r.waitForDependencies(ctx, log, inst, reasonOutputsNotReady, msg)
+	}
+	if len(resolved.Sensitive) == 0 {
+		return false, nil
+	}
+
+	ps, err := r.applyOutputParameterSet(ctx, inst, resolved.Sensitive)
+	if err != nil || isParameterSetApplied(ps) {
+		return false, err
+	}
+
+	msg := fmt.Sprintf("waiting for the parameter set %s with the sensitive outputs", ps.Name)
+	log.V(Log4Debug).Info("Reconciliation complete: The installation is waiting for the parameter set with its sensitive outputs.", "parameterSet", ps.Name)
+	return true, r.waitForDependencies(ctx, log, inst, reasonOutputsNotReady, msg)
+}
+
+// resolvedParameters are the parameters of an installation, with its parameter
+// sources resolved.
+type resolvedParameters struct {
+	// Parameters are passed to Porter in the installation document.
+	Parameters runtime.RawExtension
+
+	// Sensitive are the parameters that use a sensitive output. Their values are
+	// not included in the installation document, they are passed to Porter in a
+	// parameter set that references the Secret with the sensitive outputs.
+	Sensitive []v1.Parameter
+
+	// Pending are the outputs that are not available yet.
+	Pending []string
+
+	// sensitiveVersions identify the version of the Secret that stores each
+	// sensitive parameter, which is only used to detect when they change. The
+	// values are never included in the digest, because it is stored in a label.
+	sensitiveVersions map[string]string
+}
+
+// Digest returns a digest of the resolved parameters, and of the version of the
+// Secrets referenced by the sensitive parameters.
+func (p resolvedParameters) Digest() string {
+	hash := md5.New()
+	hash.Write(p.Parameters.Raw)
+
+	names := make([]string, 0, len(p.sensitiveVersions))
+	for name := range p.sensitiveVersions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(hash, "\x00%s=%s", name, p.sensitiveVersions[name])
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// resolveParameters returns the parameters of the installation, with its
+// parameter sources resolved, and the outputs that are not available yet.
+func (r *InstallationReconciler) resolveParameters(ctx context.Context, inst *v1.Installation) (resolvedParameters, error) {
+	if len(inst.Spec.ParameterSources) == 0 {
+		return resolvedParameters{Parameters: inst.Spec.Parameters}, nil
+	}
+
+	params := make(map[string]interface{})
+	if inst.Spec.Parameters.Raw != nil {
+		if err := json.Unmarshal(inst.Spec.Parameters.Raw, &params); err != nil {
+			return resolvedParameters{}, errors.Wrap(err, "error reading the installation parameters")
+		}
+	}
+
+	var resolved resolvedParameters
+	for _, param := range inst.Spec.ParameterSources {
+		source := param.Source
+		switch {
+		case source.Output != nil:
+			output, err := r.getOutput(ctx, inst.Namespace, source.Output)
+			if err != nil {
+				return resolvedParameters{}, err
+			}
+			// Sensitive outputs are only passed by reference, once they are stored in a Secret
+			if output == nil || isSensitiveOutputUnredacted(*output) {
+				resolved.Pending = append(resolved.Pending, fmt.Sprintf("%s/%s", source.Output.Name, source.Output.Key))
+				continue
+			}
+			if ref := output.SecretKeyRef; ref != nil {
+				delete(params, param.Name)
+				resolved.Sensitive = append(resolved.Sensitive, v1.Parameter{
+					Name:   param.Name,
+					Source: v1.ParameterSource{Secret: fmt.Sprintf("%s/%s", ref.Name, ref.Key)},
+				})
+				version, err := r.getSecretVersion(ctx, inst.Namespace, ref)
+				if err != nil {
+					return resolvedParameters{}, err
+				}
+				if resolved.sensitiveVersions == nil {
+					resolved.sensitiveVersions = make(map[string]string)
+				}
+				resolved.sensitiveVersions[param.Name] = version
+				continue
+			}
+			params[param.Name] = getOutputValue(output)
+		case source.Value != "":
+			params[param.Name] = source.Value
+		}
+	}
+
+	raw, err := json.Marshal(params)
+	if err != nil {
+		return resolvedParameters{}, errors.Wrap(err, "error resolving the installation parameter sources")
+	}
+	resolved.Parameters = runtime.RawExtension{Raw: raw}
+	return resolved, nil
+}
+
+// getSecretVersion returns the name, key, UID and resource version of the
+// Secret that stores a sensitive output, which changes when its value changes.
+func (r *InstallationReconciler) getSecretVersion(ctx context.Context, namespace string, ref *corev1.SecretKeySelector) (string, error) {
+	var secret corev1.Secret
+	if err := r.Get(ctx, types.NamespacedName{Namespace: namespace, Name: ref.Name}, &secret); err != nil {
+		return "", errors.Wrapf(err, "could not retrieve the Secret %s", ref.Name)
+	}
+	return fmt.Sprintf("%s/%s@%s/%s", ref.Name, ref.Key, secret.UID, secret.ResourceVersion), nil
+}
+
+// getParametersDigest returns a digest of the resolved parameters of an
+// installation with parameter sources, or an empty string when it has none.
+func (r *InstallationReconciler) getParametersDigest(ctx context.Context, inst *v1.Installation) (string, error) {
+	if len(inst.Spec.ParameterSources) == 0 {
+		return "", nil
+	}
+
+	resolved, err := r.resolveParameters(ctx, inst)
+	if err != nil {
+		return "", err
+	}
+	if len(resolved.Pending) > 0 {
+		return unresolvedParametersDigest, nil
+	}
+	return resolved.Digest(), nil
+}
+
+// getOutputParameterSetName returns the name of the parameter set, both in
+// Kubernetes and in Porter, that passes the sensitive outputs used by the
+// installation to Porter.
+func getOutputParameterSetName(spec v1.InstallationSpec) string {
+	return spec.Name + "-output-parameters"
+}
+
+// applyOutputParameterSet creates or updates the ParameterSet, owned by the
+// installation, with the parameters that use a sensitive output.
+func (r *InstallationReconciler) applyOutputParameterSet(ctx context.Context, inst *v1.Installation, params []v1.Parameter) (*v1.ParameterSet, error) {
+	ps := &v1.ParameterSet{ObjectMeta: metav1.ObjectMeta{Namespace: inst.Namespace, Name: getOutputParameterSetName(inst.Spec)}}
+	_, err := controllerutil.CreateOrUpdate(ctx, r.Client, ps, func() error {
+		if ps.ResourceVersion != "" && !metav1.IsControlledBy(ps, inst) {
+			return errors.Errorf("the ParameterSet %s already exists and is not owned by the installation", ps.Name)
+		}
+		ps.Labels = map[string]string{
+			v1.LabelManaged:      "true",
+			v1.LabelResourceKind: "Installation",
+			v1.LabelResourceName: inst.Name,
+		}
+		ps.Spec.AgentConfig = inst.Spec.AgentConfig
+		ps.Spec.SchemaVersion = v1.ParameterSetSchemaVersion
+		ps.Spec.Namespace = inst.Spec.Namespace
+		ps.Spec.Name = ps.Name
+		ps.Spec.Parameters = params
+		return controllerutil.SetControllerReference(inst, ps, r.Scheme)
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "error applying the parameter set with the sensitive outputs used by %s", inst.Name)
+	}
+	return ps, nil
+}
+
+// isParameterSetApplied determines if the latest changes to the parameter set
+// were applied in Porter.
+func isParameterSetApplied(ps *v1.ParameterSet) bool {
+	return ps.Status.ObservedGeneration == ps.Generation && ps.Status.Phase == v1.PhaseSucceeded
+}
+
+// getOutput returns an output captured in an InstallationOutput, with the value
+// of a sensitive output read from its Secret, or nil when it is not available.
+func (r *InstallationReconciler) getOutput(ctx context.Context, namespace string, source *v1.OutputSource) (*v1.Output, error) {
+	var outputs v1.InstallationOutput
+	err := r.Get(ctx, types.NamespacedName{Namespace: namespace, Name: source.Name}, &outputs)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "could not retrieve the installation outputs %s", source.Name)
+	}
+
+	for _, output := range outputs.Status.Outputs {
+		if output.Name != source.Key {
+			continue
+		}
+		value, ok, err := r.resolveOutputValue(ctx, namespace, output)
+		if err != nil || !ok {
+			return nil, err
+		}
+		output.Value = value
+		return &output, nil
+	}
+	return nil, nil
+}
+
+// getOutputValue converts the value of an output to the type of the output, so
+// that it is passed to the bundle with the expected type.
+func getOutputValue(output *v1.Output) interface{} {
+	switch output.Type {
+	case "integer", "number", "boolean", "object", "array":
+		var value interface{}
+		if err := json.Unmarshal([]byte(output.Value), &value); err == nil {
+			return value
+		}
+	}
+	return output.Value
+}
+
+// usesOutputs determines if the installation has a parameter source that uses the InstallationOutput.
+func usesOutputs(inst *v1.Installation, outputs client.Object) bool {
+	if inst.Namespace != outputs.GetNamespace() {
+		return false
+	}
+	for _, param := range inst.Spec.ParameterSources {
+		if param.Source.Output != nil && param.Source.Output.Name == outputs.GetName() {
+			return true
+		}
+	}
+	return false
+}
+
+// requestsForOutputs requeues the installations that use the outputs of an
+// InstallationOutput in their parameter sources, so that they are applied
+// again with the new values.
+func (r *InstallationReconciler) requestsForOutputs(ctx context.Context, obj client.Object) []reconcile.Request {
+	var list v1.InstallationList
+	if err := r.List(ctx, &list, client.InNamespace(obj.GetNamespace())); err != nil {
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for i := range list.Items {
+		if usesOutputs(&list.Items[i], obj) {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&list.Items[i])})
+		}
+	}
+	return requests
+}
+
+// outputsChanged is a predicate that only triggers when the outputs captured in
+// an InstallationOutput change, or are refreshed by another run.
+type outputsChanged struct {
+	predicate.Funcs
+}
+
+func (outputsChanged) Create(event.CreateEvent) bool {
+	return true
+}
+
+func (outputsChanged) Delete(event.DeleteEvent) bool {
+	return true
+}
+
+func (outputsChanged) Update(e event.UpdateEvent) bool {
+	oldOutputs, ok := e.ObjectOld.(*v1.InstallationOutput)
+	if !ok {
+		return false
+	}
+	newOutputs, ok := e.ObjectNew.(*v1.InstallationOutput)
+	if !ok {
+		return false
+	}
+	// Sensitive values are stored in a Secret, so a change to them is detected from the run that refreshed the outputs
+	return !reflect.DeepEqual(oldOutputs.Status.Outputs, newOutputs.Status.Outputs) ||
+		!reflect.DeepEqual(oldOutputs.Status.Action, newOutputs.Status.Action) ||
+		oldOutputs.Status.RunID != newOutputs.Status.RunID
+}
+
+func (outputsChanged) Generic(event.GenericEvent) bool {
+	return false
+}
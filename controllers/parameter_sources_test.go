@@ -0,0 +1,264 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	v1 "get.porter.sh/operator/api/v1"
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func testOutputSourceInstallation() *v1.Installation {
+	inst := testInstallation("test", "wordpress")
+	inst.Spec.Parameters = runtime.RawExtension{Raw: []byte(`{"port":80,"region":"eastus"}`)}
+	inst.Spec.ParameterSources = []v1.Parameter{
+		{Name: "connstr", Source: v1.ParameterSource{Output: &v1.OutputSource{Name: "mysql", Key: "connstr"}}},
+		{Name: "port", Source: v1.ParameterSource{Output: &v1.OutputSource{Name: "mysql", Key: "port"}}},
+		{Name: "region", Source: v1.ParameterSource{Value: "westus"}},
+	}
+	return inst
+}
+
+func testInstallationOutput(connstr string) *v1.InstallationOutput {
+	return &v1.InstallationOutput{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "mysql"},
+		Spec:       v1.InstallationOutputSpec{Namespace: "dev", Name: "mysql"},
+		Status: v1.InstallationOutputStatus{
+			Outputs: []v1.Output{
+				{Name: "connstr", Type: "string", Sensitive: true, Value: connstr},
+				{Name: "port", Type: "integer", Value: "3306"},
+			},
+		},
+	}
+}
+
+// testStoredInstallationOutput returns an InstallationOutput whose sensitive
+// output is stored in a Secret, and the Secret.
+func testStoredInstallationOutput(connstr string) (*v1.InstallationOutput, *corev1.Secret) {
+	outputs := testInstallationOutput(v1.RedactedValue)
+	outputs.Status.Outputs[0].SecretKeyRef = &corev1.SecretKeySelector{
+		LocalObjectReference: corev1.LocalObjectReference{Name: "mysql-sensitive-outputs"},
+		Key:                  "connstr",
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "mysql-sensitive-outputs"},
+		Data:       map[string][]byte{"connstr": []byte(connstr)},
+	}
+	return outputs, secret
+}
+
+func TestInstallationReconciler_resolveParameters(t *testing.T) {
+	ctx := context.Background()
+	inst := testOutputSourceInstallation()
+
+	t.Run("resolved", func(t *testing.T) {
+		outputs, secret := testStoredInstallationOutput("mysql://db")
+		controller := setupInstallationController(inst, outputs, secret)
+		resolved, err := controller.resolveParameters(ctx, inst)
+		require.NoError(t, err)
+		assert.Empty(t, resolved.Pending)
+		assert.JSONEq(t, `{"port":3306,"region":"westus"}`, string(resolved.Parameters.Raw),
+			"the parameter sources should take precedence, and outputs should be converted to their type")
+		wantSensitive := []v1.Parameter{
+			{Name: "connstr", Source: v1.ParameterSource{Secret: "mysql-sensitive-outputs/connstr"}},
+		}
+		assert.Equal(t, wantSensitive, resolved.Sensitive, "sensitive outputs should be passed by reference")
+	})
+
+	t.Run("sensitive output not stored in a Secret", func(t *testing.T) {
+		controller := setupInstallationController(inst, testInstallationOutput("mysql://db"))
+		resolved, err := controller.resolveParameters(ctx, inst)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"mysql/connstr"}, resolved.Pending)
+		assert.NotContains(t, string(resolved.Parameters.Raw), "mysql://db")
+	})
+
+	t.Run("missing output", func(t *testing.T) {
+		outputs, secret := testStoredInstallationOutput("mysql://db")
+		outputs.Status.Outputs = outputs.Status.Outputs[:1]
+		controller := setupInstallationController(inst, outputs, secret)
+		resolved, err := controller.resolveParameters(ctx, inst)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"mysql/port"}, resolved.Pending)
+	})
+
+	t.Run("missing InstallationOutput", func(t *testing.T) {
+		controller := setupInstallationController(inst)
+		resolved, err := controller.resolveParameters(ctx, inst)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"mysql/connstr", "mysql/port"}, resolved.Pending)
+	})
+
+	t.Run("digest", func(t *testing.T) {
+		outputs, secret := testStoredInstallationOutput("mysql://db")
+		controller := setupInstallationController(inst, outputs, secret)
+		resolved, err := controller.resolveParameters(ctx, inst)
+		require.NoError(t, err)
+
+		secret.Data["connstr"] = []byte("mysql://db2")
+		require.NoError(t, controller.Update(ctx, secret))
+		changed, err := controller.resolveParameters(ctx, inst)
+		require.NoError(t, err)
+		assert.NotEqual(t, resolved.Digest(), changed.Digest(), "the digest should change when a sensitive output changes")
+		for _, version := range changed.sensitiveVersions {
+			assert.NotContains(t, version, "mysql://db2", "the digest should not be computed from the sensitive value")
+		}
+	})
+}
+
+func TestInstallationReconciler_Reconcile_ParameterSources(t *testing.T) {
+	ctx := context.Background()
+	controller := setupInstallationController(testOutputSourceInstallation())
+
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "test", Name: "wordpress"}}
+	var inst v1.Installation
+	reconcileInstallation := func() {
+		_, err := controller.Reconcile(ctx, req)
+		require.NoError(t, err)
+		require.NoError(t, controller.Get(ctx, req.NamespacedName, &inst))
+	}
+
+	// Wait for the outputs to be captured
+	reconcileInstallation()
+	assert.Nil(t, inst.Status.Action, "the installation should not be applied until its outputs are available")
+	cond := apimeta.FindStatusCondition(inst.Status.Conditions, v1.ConditionWaitingForDependencies)
+	require.NotNil(t, cond, "expected the WaitingForDependencies condition")
+	assert.Equal(t, "OutputsNotReady", cond.Reason)
+	assert.Equal(t, "waiting for outputs: mysql/connstr, mysql/port", cond.Message)
+
+	// Wait for the parameter set with the sensitive outputs to be applied
+	outputs, secret := testStoredInstallationOutput("mysql://db")
+	require.NoError(t, controller.Create(ctx, secret))
+	require.NoError(t, controller.Create(ctx, outputs))
+	assert.Equal(t, []reconcile.Request{{NamespacedName: req.NamespacedName}}, controller.requestsForOutputs(ctx, outputs))
+	reconcileInstallation()
+	assert.Nil(t, inst.Status.Action, "the installation should not be applied until the parameter set with its sensitive outputs is applied")
+	cond = apimeta.FindStatusCondition(inst.Status.Conditions, v1.ConditionWaitingForDependencies)
+	require.NotNil(t, cond, "expected the WaitingForDependencies condition")
+	assert.Equal(t, "waiting for the parameter set wordpress-output-parameters with the sensitive outputs", cond.Message)
+
+	var ps v1.ParameterSet
+	require.NoError(t, controller.Get(ctx, client.ObjectKey{Namespace: "test", Name: "wordpress-output-parameters"}, &ps))
+	assert.True(t, metav1.IsControlledBy(&ps, &inst), "the parameter set should be owned by the installation")
+	assert.Equal(t, "dev", ps.Spec.Namespace)
+	assert.Equal(t, "wordpress-output-parameters", ps.Spec.Name)
+	assert.Equal(t, []v1.Parameter{{Name: "connstr", Source: v1.ParameterSource{Secret: "mysql-sensitive-outputs/connstr"}}}, ps.Spec.Parameters)
+
+	// Apply the installation with the outputs
+	ps.Status.Phase = v1.PhaseSucceeded
+	ps.Status.ObservedGeneration = ps.Generation
+	require.NoError(t, controller.Status().Update(ctx, &ps))
+	reconcileInstallation()
+	require.NotNil(t, inst.Status.Action, "the installation should be applied once its outputs are available")
+	firstAction := inst.Status.Action.Name
+
+	var action v1.AgentAction
+	require.NoError(t, controller.Get(ctx, client.ObjectKey{Namespace: "test", Name: firstAction}, &action))
+	assert.Contains(t, string(action.Spec.Files["installation.yaml"]), "port: 3306", "the outputs should be resolved in the Porter document")
+	assert.Contains(t, string(action.Spec.Files["installation.yaml"]), "- wordpress-output-parameters", "the parameter set with the sensitive outputs should be used")
+	for name, contents := range action.Spec.Files {
+		assert.NotContains(t, string(contents), "mysql://db", "the sensitive output should not be included in %s", name)
+	}
+	assert.NotEmpty(t, action.Labels[v1.LabelParametersDigest], "expected the digest of the resolved parameters")
+
+	// Reconciling again does not apply the installation again
+	reconcileInstallation()
+	assert.Equal(t, firstAction, inst.Status.Action.Name)
+
+	// Apply the installation again when the output changes
+	secret.Data["connstr"] = []byte("mysql://db2")
+	require.NoError(t, controller.Update(ctx, secret))
+	reconcileInstallation()
+	require.NotNil(t, inst.Status.Action)
+	assert.NotEqual(t, firstAction, inst.Status.Action.Name, "expected a new agent action with the new output")
+
+	require.NoError(t, controller.Get(ctx, client.ObjectKey{Namespace: "test", Name: inst.Status.Action.Name}, &action))
+	for name, contents := range action.Spec.Files {
+		assert.NotContains(t, string(contents), "mysql://db2", "the sensitive output should not be included in %s", name)
+	}
+	current, handled, err := controller.isHandled(ctx, logr.Discard(), &inst)
+	require.NoError(t, err)
+	require.True(t, handled)
+	assert.Equal(t, action.Name, current.Name, "the agent action with the current outputs should be used")
+}
+
+func TestInstallationReconciler_isHandled_ParametersChangedBack(t *testing.T) {
+	ctx := context.Background()
+	inst := testOutputSourceInstallation()
+	outputs, secret := testStoredInstallationOutput("mysql://db")
+	controller := setupInstallationController(inst, outputs, secret)
+	digest, err := controller.getParametersDigest(ctx, inst)
+	require.NoError(t, err)
+	require.NotEqual(t, unresolvedParametersDigest, digest)
+
+	// The outputs changed from mysql://db to mysql://db2, and then back to mysql://db
+	newAction := func(name string, digest string, created time.Time) *v1.AgentAction {
+		labels := getActionLabels(inst)
+		labels[v1.LabelParametersDigest] = digest
+		return &v1.AgentAction{ObjectMeta: metav1.ObjectMeta{
+			Namespace:         inst.Namespace,
+			Name:              name,
+			Labels:            labels,
+			CreationTimestamp: metav1.NewTime(created),
+		}}
+	}
+	now := time.Now().Truncate(time.Second)
+	require.NoError(t, controller.Create(ctx, newAction("wordpress-db", digest, now.Add(-time.Hour))))
+	require.NoError(t, controller.Create(ctx, newAction("wordpress-db2", "db2-digest", now)))
+
+	action, handled, err := controller.isHandled(ctx, logr.Discard(), inst)
+	require.NoError(t, err)
+	assert.False(t, handled, "the installation should be applied again when the outputs change back to earlier values")
+	assert.Nil(t, action)
+
+	// Once applied again, the latest action has the current parameters
+	require.NoError(t, controller.Create(ctx, newAction("wordpress-db-again", digest, now.Add(time.Minute))))
+	action, handled, err = controller.isHandled(ctx, logr.Discard(), inst)
+	require.NoError(t, err)
+	require.True(t, handled)
+	assert.Equal(t, "wordpress-db-again", action.Name)
+}
+
+func TestInstallationReconciler_getPlannedParameters_ParameterSources(t *testing.T) {
+	inst := testOutputSourceInstallation()
+	controller := setupInstallationController(inst, testInstallationOutput("mysql://db"))
+
+	params, err := controller.getPlannedParameters(context.Background(), logr.Discard(), inst)
+	require.NoError(t, err)
+
+	want := []v1.PlannedParameter{
+		{Name: "port", Value: "3306", Source: "installationOutput/mysql"},
+		{Name: "region", Value: "westus", Source: "installation"},
+		{Name: "connstr", Value: v1.RedactedValue, Source: "installationOutput/mysql"},
+	}
+	assert.Equal(t, want, params)
+}
+
+func TestOutputsChanged(t *testing.T) {
+	outputs := testInstallationOutput("mysql://db")
+	pred := outputsChanged{}
+
+	changed := outputs.DeepCopy()
+	changed.Labels = map[string]string{"team": "llamas"}
+	assert.False(t, pred.Update(event.UpdateEvent{ObjectOld: outputs, ObjectNew: changed}), "unrelated changes should not trigger")
+
+	changed = outputs.DeepCopy()
+	changed.Status.Outputs[0].Value = "mysql://db2"
+	assert.True(t, pred.Update(event.UpdateEvent{ObjectOld: outputs, ObjectNew: changed}), "output changes should trigger")
+
+	changed = outputs.DeepCopy()
+	changed.Status.RunID = "01RUN"
+	assert.True(t, pred.Update(event.UpdateEvent{ObjectOld: outputs, ObjectNew: changed}), "outputs refreshed by another run should trigger")
+}
@@ -11,10 +11,12 @@ import (
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 
 	porterv1 "get.porter.sh/operator/api/v1"
 )
@@ -22,8 +24,9 @@ import (
 // ParameterSetReconciler reconciles a ParameterSet object
 type ParameterSetReconciler struct {
 	client.Client
-	Log    logr.Logger
-	Scheme *runtime.Scheme
+	Log      logr.Logger
+	Recorder record.EventRecorder
+	Scheme   *runtime.Scheme
 }
 
 //+kubebuilder:rbac:groups=getporter.org,resources=parametersets,verbs=get;list;watch;create;update;patch;delete
@@ -31,6 +34,7 @@ type ParameterSetReconciler struct {
 //+kubebuilder:rbac:groups=getporter.org,resources=parametersets/finalizers,verbs=update
 //+kubebuilder:rbac:groups=getporter.org,resources=agentconfigs,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=getporter.org,resources=porterconfigs,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 //+kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups="",resources=persistentvolumeclaims,verbs=get;list;watch;create;update;patch;delete
@@ -40,6 +44,9 @@ func (r *ParameterSetReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&porterv1.ParameterSet{}, builder.WithPredicates(resourceChanged{})).
 		Owns(&porterv1.AgentAction{}).
+		Watches(&porterv1.AgentConfig{},
+			handler.EnqueueRequestsFromMapFunc(requestsForAgentConfig(r.Client, func() client.ObjectList { return &porterv1.ParameterSetList{} })),
+			builder.WithPredicates(agentConfigSuspendChanged{})).
 		Complete(r)
 }
 
@@ -61,6 +68,12 @@ func (r *ParameterSetReconciler) Reconcile(ctx context.Context, req ctrl.Request
 	log = log.WithValues("resourceVersion", ps.ResourceVersion, "generation", ps.Generation)
 	log.V(Log5Trace).Info("Reconciling parameter set")
 
+	// Leave the parameter set as-is while it is suspended, changes are applied when it is resumed
+	if suspended, err := checkSuspended(ctx, log, r.Client, r.Recorder, ps, ps.Spec.Suspend, ps.Spec.AgentConfig); err != nil || suspended {
+		log.V(Log4Debug).Info("Reconciliation skipped: The parameter set is suspended.")
+		return ctrl.Result{}, err
+	}
+
 	// Check if we have requested an agent run yet
 	action, handled, err := r.isHandled(ctx, log, ps)
 	if err != nil {
@@ -233,6 +246,7 @@ func (r *ParameterSetReconciler) retry(ctx context.Context, log logr.Logger, ps
 	}
 
 	log.V(Log4Debug).Info("Retried associated porter agent action", "name", "retry", action.Name, retry)
+	retries.WithLabelValues("ParameterSet", ps.Namespace).Inc()
 	return nil
 }
 
@@ -0,0 +1,223 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	v1 "get.porter.sh/operator/api/v1"
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// dryRunFlag is passed to porter installation apply to evaluate the installation without executing the bundle.
+const dryRunFlag = "--dry-run"
+
+// plannedActionPattern matches the message that Porter logs when the installation
+// is out-of-sync, and which bundle action it runs.
+var plannedActionPattern = regexp.MustCompile(`run(?:ning)? the (install|upgrade|uninstall) action`)
+
+// plannedNoopPatterns match the messages that Porter logs when the installation
+// does not need to be applied.
+var plannedNoopPatterns = []string{"ignoring because", "is up-to-date"}
+
+// isDryRunAction determines if the agent action evaluates the installation without executing the bundle.
+func isDryRunAction(action *v1.AgentAction) bool {
+	for _, arg := range action.Spec.Args {
+		if arg == dryRunFlag {
+			return true
+		}
+	}
+	return false
+}
+
+// recordPlan records what Porter would do to apply the installation in its
+// status, once the dry-run of the installation has completed.
+func (r *InstallationReconciler) recordPlan(ctx context.Context, log logr.Logger, inst *v1.Installation, action *v1.AgentAction) error {
+	// Failed dry-runs are reported with the Failed condition
+	if action.Status.Phase != v1.PhaseSucceeded {
+		return nil
+	}
+	if inst.Status.Plan != nil && inst.Status.Plan.AgentAction.Name == action.Name {
+		return nil
+	}
+
+	logs, err := r.getAgentLogs(ctx, action)
+	if err != nil {
+		return err
+	}
+
+	params, err := r.getPlannedParameters(ctx, log, inst)
+	if err != nil {
+		return err
+	}
+
+	plan := &v1.InstallationPlan{
+		Generation:  inst.Generation,
+		AgentAction: corev1.LocalObjectReference{Name: action.Name},
+		Action:      getPlannedAction(logs),
+		Bundle:      formatBundleReference(inst.Spec.Bundle),
+		Parameters:  params,
+		PlanTime:    metav1.Now(),
+	}
+	inst.Status.Plan = plan
+	log.V(Log4Debug).Info("Recorded the installation plan", "action", plan.Action, "bundle", plan.Bundle)
+
+	message := fmt.Sprintf("porter would run the %s action with bundle %s", plan.Action, plan.Bundle)
+	switch plan.Action {
+	case v1.PlanActionNoop:
+		message = "the installation is up-to-date"
+	case v1.PlanActionUnknown:
+		message = "the action that porter would run could not be determined, see the Porter Agent logs"
+	}
+	r.Recorder.Event(inst, "Normal", "Planned", message)
+
+	return r.saveStatus(ctx, log, inst)
+}
+
+// getAgentLogs returns the Porter Agent logs that were captured for the action,
+// or an empty string when they are not available.
+func (r *InstallationReconciler) getAgentLogs(ctx context.Context, action *v1.AgentAction) (string, error) {
+	if action.Status.Logs == nil {
+		return "", nil
+	}
+
+	var cm corev1.ConfigMap
+	err := r.Get(ctx, client.ObjectKey{Namespace: action.Namespace, Name: action.Status.Logs.Name}, &cm)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return "", nil
+		}
+		return "", errors.Wrapf(err, "error retrieving the Porter Agent logs for %s", action.Name)
+	}
+	return cm.Data[v1.AgentLogsKey], nil
+}
+
+// getPlannedAction determines which bundle action Porter would run from the output of the dry-run.
+func getPlannedAction(logs string) string {
+	logs = strings.ToLower(logs)
+	if match := plannedActionPattern.FindStringSubmatch(logs); match != nil {
+		return match[1]
+	}
+
+	for _, pattern := range plannedNoopPatterns {
+		if strings.Contains(logs, pattern) {
+			return v1.PlanActionNoop
+		}
+	}
+	return v1.PlanActionUnknown
+}
+
+// getPlannedParameters returns the parameter values that Porter would use for
+// the installation. The parameter sets are applied in order, then the
+// parameters on the installation, and then its parameter sources. Parameter
+// sets that are not defined with a ParameterSet resource in the namespace,
+// and outputs that are not available, are not included.
+func (r *InstallationReconciler) getPlannedParameters(ctx context.Context, log logr.Logger, inst *v1.Installation) ([]v1.PlannedParameter, error) {
+	var names []string
+	values := make(map[string]v1.PlannedParameter)
+	setParam := func(param v1.PlannedParameter) {
+		if _, ok := values[param.Name]; !ok {
+			names = append(names, param.Name)
+		}
+		values[param.Name] = param
+	}
+
+	if len(inst.Spec.ParameterSets) > 0 {
+		var paramSets v1.ParameterSetList
+		if err := r.List(ctx, &paramSets, client.InNamespace(inst.Namespace)); err != nil {
+			return nil, errors.Wrap(err, "could not query for the installation's parameter sets")
+		}
+
+		for _, name := range inst.Spec.ParameterSets {
+			ps := findParameterSet(paramSets.Items, name, inst.Spec.Namespace)
+			if ps == nil {
+				log.V(Log4Debug).Info("Parameter set is not managed by the operator, its parameters are not included in the plan", "parameterSet", name)
+				continue
+			}
+
+			for _, param := range ps.Spec.Parameters {
+				value := param.Source.Value
+				if param.Source.Secret != "" {
+					value = v1.RedactedValue
+				}
+				setParam(v1.PlannedParameter{Name: param.Name, Value: value, Source: "parameterSet/" + name})
+			}
+		}
+	}
+
+	if inst.Spec.Parameters.Raw != nil {
+		var params map[string]interface{}
+		if err := json.Unmarshal(inst.Spec.Parameters.Raw, &params); err != nil {
+			return nil, errors.Wrap(err, "error reading the installation parameters")
+		}
+
+		keys := make([]string, 0, len(params))
+		for key := range params {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			value, ok := params[key].(string)
+			if !ok {
+				b, _ := json.Marshal(params[key])
+				value = string(b)
+			}
+			setParam(v1.PlannedParameter{Name: key, Value: value, Source: "installation"})
+		}
+	}
+
+	for _, param := range inst.Spec.ParameterSources {
+		source := param.Source
+		switch {
+		case source.Output != nil:
+			output, err := r.getOutput(ctx, inst.Namespace, source.Output)
+			if err != nil {
+				return nil, err
+			}
+			if output == nil {
+				continue
+			}
+			value := output.Value
+			if output.Sensitive {
+				value = v1.RedactedValue
+			}
+			setParam(v1.PlannedParameter{Name: param.Name, Value: value, Source: "installationOutput/" + source.Output.Name})
+		case source.Value != "":
+			setParam(v1.PlannedParameter{Name: param.Name, Value: source.Value, Source: "installation"})
+		}
+	}
+
+	result := make([]v1.PlannedParameter, len(names))
+	for i, name := range names {
+		result[i] = values[name]
+	}
+	return result, nil
+}
+
+// findParameterSet returns the parameter set that Porter would use for the
+// installation, looking in the installation's namespace and then the global namespace.
+func findParameterSet(paramSets []v1.ParameterSet, name string, namespace string) *v1.ParameterSet {
+	var global *v1.ParameterSet
+	for i := range paramSets {
+		ps := &paramSets[i]
+		if ps.Spec.Name != name {
+			continue
+		}
+		if ps.Spec.Namespace == namespace {
+			return ps
+		}
+		if ps.Spec.Namespace == "" {
+			global = ps
+		}
+	}
+	return global
+}
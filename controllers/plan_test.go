@@ -0,0 +1,155 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	v1 "get.porter.sh/operator/api/v1"
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+)
+
+func testDryRunInstallation() *v1.Installation {
+	inst := testInstallation("test", "mysql")
+	inst.Generation = 2
+	inst.Spec.DryRun = true
+	inst.Spec.ParameterSets = []string{"mysql"}
+	inst.Spec.Parameters = runtime.RawExtension{Raw: []byte(`{"database":"wordpress","replicas":2}`)}
+	return inst
+}
+
+func TestGetPlannedAction(t *testing.T) {
+	testcases := []struct {
+		name string
+		logs string
+		want string
+	}{
+		{name: "install", logs: "The installation is out-of-sync, running the install action...\nSkipping bundle execution because --dry-run was specified\n", want: v1.PlanActionInstall},
+		{name: "upgrade", logs: `{"level":"info","msg":"The installation is out-of-sync, running the upgrade action..."}`, want: v1.PlanActionUpgrade},
+		{name: "uninstall", logs: "Triggering because installation.uninstalled is true\nThe installation is out-of-sync, running the uninstall action...\n", want: v1.PlanActionUninstall},
+		{name: "up-to-date", logs: "Ignoring because the installation is up-to-date\n", want: v1.PlanActionNoop},
+		{name: "no logs", logs: "", want: v1.PlanActionUnknown},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, getPlannedAction(tc.logs))
+		})
+	}
+}
+
+func TestInstallationReconciler_createAgentAction_DryRun(t *testing.T) {
+	controller := setupInstallationController()
+	inst := testDryRunInstallation()
+
+	action, err := controller.createAgentAction(context.Background(), logr.Discard(), inst)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"installation", "apply", "installation.yaml", "--dry-run"}, action.Spec.Args, "incorrect agent arguments")
+	assert.True(t, isDryRunAction(action))
+
+	// Deleted installations are uninstalled for real
+	now := metav1.Now()
+	inst.DeletionTimestamp = &now
+	action, err = controller.createAgentAction(context.Background(), logr.Discard(), inst)
+	require.NoError(t, err)
+	assert.False(t, isDryRunAction(action), "the uninstall of a deleted installation should not be a dry-run")
+}
+
+func TestInstallationReconciler_getPlannedParameters(t *testing.T) {
+	inst := testDryRunInstallation()
+	inst.Spec.ParameterSets = []string{"mysql", "defaults", "unmanaged"}
+	controller := setupInstallationController(
+		&v1.ParameterSet{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "mysql-dev"},
+			Spec: v1.ParameterSetSpec{Name: "mysql", Namespace: "dev", Parameters: []v1.Parameter{
+				{Name: "password", Source: v1.ParameterSource{Secret: "mysql-password"}},
+				{Name: "database", Source: v1.ParameterSource{Value: "mydb"}},
+			}},
+		},
+		&v1.ParameterSet{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "mysql-prod"},
+			Spec: v1.ParameterSetSpec{Name: "mysql", Namespace: "prod", Parameters: []v1.Parameter{
+				{Name: "database", Source: v1.ParameterSource{Value: "wrong"}},
+			}},
+		},
+		&v1.ParameterSet{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "defaults"},
+			Spec: v1.ParameterSetSpec{Name: "defaults", Parameters: []v1.Parameter{
+				{Name: "region", Source: v1.ParameterSource{Value: "eastus"}},
+			}},
+		})
+
+	params, err := controller.getPlannedParameters(context.Background(), logr.Discard(), inst)
+	require.NoError(t, err)
+
+	want := []v1.PlannedParameter{
+		{Name: "password", Value: v1.RedactedValue, Source: "parameterSet/mysql"},
+		{Name: "database", Value: "wordpress", Source: "installation"},
+		{Name: "region", Value: "eastus", Source: "parameterSet/defaults"},
+		{Name: "replicas", Value: "2", Source: "installation"},
+	}
+	assert.Equal(t, want, params)
+}
+
+func TestInstallationReconciler_recordPlan(t *testing.T) {
+	ctx := context.Background()
+	inst := testDryRunInstallation()
+	inst.Spec.ParameterSets = nil
+	action := &v1.AgentAction{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "mysql-abc"},
+		Spec:       v1.AgentActionSpec{Args: []string{"installation", "apply", "installation.yaml", "--dry-run"}},
+		Status:     v1.AgentActionStatus{Phase: v1.PhaseRunning},
+	}
+	logs := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "mysql-abc-logs"},
+		Data:       map[string]string{v1.AgentLogsKey: "The installation is out-of-sync, running the upgrade action...\n"},
+	}
+	controller := setupInstallationController(inst, action, logs)
+
+	// Wait for the dry-run to finish
+	require.NoError(t, controller.recordPlan(ctx, logr.Discard(), inst, action))
+	assert.Nil(t, inst.Status.Plan, "the plan should not be recorded until the dry-run succeeds")
+
+	action.Status.Phase = v1.PhaseSucceeded
+	action.Status.Logs = &corev1.LocalObjectReference{Name: logs.Name}
+	require.NoError(t, controller.recordPlan(ctx, logr.Discard(), inst, action))
+
+	var saved v1.Installation
+	require.NoError(t, controller.Get(ctx, types.NamespacedName{Namespace: "test", Name: "mysql"}, &saved))
+	plan := saved.Status.Plan
+	require.NotNil(t, plan, "expected the plan to be saved in the status")
+	assert.Equal(t, int64(2), plan.Generation)
+	assert.Equal(t, "mysql-abc", plan.AgentAction.Name)
+	assert.Equal(t, v1.PlanActionUpgrade, plan.Action)
+	assert.Equal(t, "ghcr.io/getporter/mysql:v0.1.0", plan.Bundle)
+	assert.Len(t, plan.Parameters, 2)
+	assert.False(t, plan.PlanTime.IsZero(), "expected the plan time to be set")
+
+	recorder := controller.Recorder.(*record.FakeRecorder)
+	require.Len(t, recorder.Events, 1)
+	assert.Equal(t, "Normal Planned porter would run the upgrade action with bundle ghcr.io/getporter/mysql:v0.1.0", <-recorder.Events)
+
+	// The plan is only recorded once for the action
+	require.NoError(t, controller.recordPlan(ctx, logr.Discard(), inst, action))
+	assert.Empty(t, recorder.Events)
+}
+
+func TestInstallationReconciler_recordPlan_NoLogs(t *testing.T) {
+	inst := testDryRunInstallation()
+	inst.Spec.ParameterSets = nil
+	action := &v1.AgentAction{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "mysql-abc"},
+		Status:     v1.AgentActionStatus{Phase: v1.PhaseSucceeded, Logs: &corev1.LocalObjectReference{Name: "missing"}},
+	}
+	controller := setupInstallationController(inst, action)
+
+	require.NoError(t, controller.recordPlan(context.Background(), logr.Discard(), inst, action))
+	require.NotNil(t, inst.Status.Plan)
+	assert.Equal(t, v1.PlanActionUnknown, inst.Status.Plan.Action, "the action can't be determined without the logs")
+}
@@ -0,0 +1,231 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+	porterv1alpha1 "get.porter.sh/porter/gen/proto/go/porterapis/porter/v1alpha1"
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// DefaultPorterConnections is the default number of connections to the
+	// Porter gRPC server that are shared by the controllers.
+	DefaultPorterConnections = 2
+
+	// porterHealthCheckInterval is how often the connections to the gRPC server are health checked.
+	porterHealthCheckInterval = 30 * time.Second
+
+	// porterHealthCheckTimeout is the maximum amount of time to wait for a health check.
+	porterHealthCheckTimeout = 5 * time.Second
+)
+
+// PorterClientManager maintains a pool of long-lived connections to the Porter
+// gRPC server that are shared by the controllers. The connections are created
+// when they are first used, and are recreated when the endpoint or the TLS
+// configuration of the PorterServer changes. Once it is added to the manager,
+// the connections are health checked in the background and the result is
+// reported by ReadyzCheck.
+type PorterClientManager struct {
+	clnt     client.Reader
+	log      logr.Logger
+	poolSize int
+
+	mu sync.Mutex
+	// poolKey identifies the endpoint and TLS configuration of the pooled connections.
+	poolKey string
+	pool    []*grpc.ClientConn
+	next    int
+	// healthErr is the result of the last health check.
+	healthErr error
+}
+
+// NewPorterClientManager creates a PorterClientManager that keeps poolSize
+// connections to the gRPC server of the default PorterServer.
+func NewPorterClientManager(clnt client.Reader, log logr.Logger, poolSize int) *PorterClientManager {
+	if poolSize <= 0 {
+		poolSize = DefaultPorterConnections
+	}
+	return &PorterClientManager{clnt: clnt, log: log, poolSize: poolSize}
+}
+
+// GetClient returns a client for the Porter gRPC server that uses one of the
+// pooled connections. Closing the returned ClientConn releases the connection
+// back to the pool, it remains open until the manager is stopped.
+func (m *PorterClientManager) GetClient(ctx context.Context) (porterv1alpha1.PorterClient, ClientConn, error) {
+	server, err := getPorterServer(ctx, m.clnt)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	conn, err := m.getConn(ctx, server)
+	if err != nil {
+		return nil, nil, err
+	}
+	return porterv1alpha1.NewPorterClient(conn), pooledConn{}, nil
+}
+
+// getConn returns the next connection from the pool, creating the pool when
+// the PorterServer has changed since the connections were created.
+func (m *PorterClientManager) getConn(ctx context.Context, server *porterv1.PorterServer) (*grpc.ClientConn, error) {
+	key := getPorterPoolKey(server)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.poolKey != key || len(m.pool) == 0 {
+		pool := make([]*grpc.ClientConn, 0, m.poolSize)
+		for i := 0; i < m.poolSize; i++ {
+			conn, err := dialPorterServer(ctx, m.clnt, server)
+			if err != nil {
+				closeConns(pool)
+				return nil, err
+			}
+			pool = append(pool, conn)
+		}
+
+		m.log.V(Log4Debug).Info("Connected to the porter server", "endpoint", server.Status.Endpoint, "connections", len(pool))
+		closeConns(m.pool)
+		m.pool = pool
+		m.poolKey = key
+		m.next = 0
+	}
+
+	conn := m.pool[m.next%len(m.pool)]
+	m.next++
+	return conn, nil
+}
+
+// Start health checks the connections to the gRPC server until the context is
+// cancelled, and then closes them.
+func (m *PorterClientManager) Start(ctx context.Context) error {
+	ticker := time.NewTicker(porterHealthCheckInterval)
+	defer ticker.Stop()
+	defer m.close()
+
+	for {
+		m.checkHealth(ctx)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// NeedLeaderElection returns false so that every replica of the operator
+// reports whether it can reach the gRPC server.
+func (m *PorterClientManager) NeedLeaderElection() bool {
+	return false
+}
+
+// ReadyzCheck reports an error when the gRPC server of the default PorterServer
+// is defined but did not pass the last health check.
+func (m *PorterClientManager) ReadyzCheck(_ *http.Request) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.healthErr
+}
+
+// checkHealth checks each pooled connection with the gRPC health service and records the result.
+func (m *PorterClientManager) checkHealth(ctx context.Context) {
+	err := m.healthCheck(ctx)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if (err == nil) != (m.healthErr == nil) {
+		if err != nil {
+			m.log.Info("The porter server is unhealthy", "error", err.Error())
+		} else {
+			m.log.Info("The porter server is healthy")
+		}
+	}
+	m.healthErr = err
+}
+
+func (m *PorterClientManager) healthCheck(ctx context.Context) error {
+	server, err := getPorterServer(ctx, m.clnt)
+	if err != nil {
+		// The operator is ready without a PorterServer, outputs are not captured until one is defined
+		if errors.As(err, &porterServerNotDefinedError{}) {
+			return nil
+		}
+		return err
+	}
+
+	// Check every connection in the pool, the first use creates the pool
+	if _, err = m.getConn(ctx, server); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	pool := append([]*grpc.ClientConn(nil), m.pool...)
+	m.mu.Unlock()
+
+	for i, conn := range pool {
+		if err := checkConnHealth(ctx, conn); err != nil {
+			return errors.Wrapf(err, "health check failed for connection %d to the porter server at %s", i, server.Status.Endpoint)
+		}
+	}
+	return nil
+}
+
+// checkConnHealth calls the gRPC health service. Servers that do not implement
+// the health service are healthy when they can be reached.
+func checkConnHealth(ctx context.Context, conn *grpc.ClientConn) error {
+	ctx, cancel := context.WithTimeout(ctx, porterHealthCheckTimeout)
+	defer cancel()
+
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+	if err != nil {
+		if status.Code(err) == codes.Unimplemented {
+			return nil
+		}
+		return err
+	}
+	if resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		return errors.Errorf("the porter server is %s", resp.GetStatus())
+	}
+	return nil
+}
+
+func (m *PorterClientManager) close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	closeConns(m.pool)
+	m.pool = nil
+	m.poolKey = ""
+}
+
+// getPorterPoolKey identifies the settings of a PorterServer used to connect to its gRPC server.
+func getPorterPoolKey(server *porterv1.PorterServer) string {
+	key := server.Status.Endpoint
+	if tlsCfg := server.Spec.TLS; tlsCfg != nil {
+		key += fmt.Sprintf("|%s|%s|%s", tlsCfg.SecretName, tlsCfg.ClientSecretName, tlsCfg.ServerName)
+	}
+	return key
+}
+
+func closeConns(conns []*grpc.ClientConn) {
+	for _, conn := range conns {
+		_ = conn.Close()
+	}
+}
+
+// pooledConn is returned instead of a pooled connection, so that callers that
+// close the connection when they are done do not close the shared connection.
+type pooledConn struct{}
+
+func (pooledConn) Close() error {
+	return nil
+}
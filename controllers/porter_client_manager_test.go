@@ -0,0 +1,105 @@
+package controllers
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestPorterClientManager_GetClient(t *testing.T) {
+	ctx := context.Background()
+	endpoint, _ := startInsecureTestGRPCServer(t)
+	server := testPorterServer(endpoint)
+	controller := setupPorterServerController(server)
+	m := NewPorterClientManager(controller.Client, logr.Discard(), 2)
+
+	_, conn, err := m.GetClient(ctx)
+	require.NoError(t, err)
+	require.NoError(t, conn.Close())
+	_, _, err = m.GetClient(ctx)
+	require.NoError(t, err)
+	_, _, err = m.GetClient(ctx)
+	require.NoError(t, err)
+
+	require.Len(t, m.pool, 2, "the connections should be reused")
+	pool := append([]*grpc.ClientConn(nil), m.pool...)
+	for _, c := range pool {
+		assert.NotEqual(t, connectivity.Shutdown, c.GetState(), "closing the client should not close the pooled connection")
+	}
+	assert.Equal(t, 3, m.next, "the connections should be used in turn")
+
+	// The connections are recreated when the endpoint changes
+	newEndpoint, _ := startInsecureTestGRPCServer(t)
+	require.NoError(t, controller.Get(ctx, client.ObjectKeyFromObject(server), server))
+	server.Status.Endpoint = newEndpoint
+	require.NoError(t, controller.Status().Update(ctx, server))
+	_, _, err = m.GetClient(ctx)
+	require.NoError(t, err)
+
+	require.Len(t, m.pool, 2)
+	assert.NotSame(t, pool[0], m.pool[0], "new connections should be created for the new endpoint")
+	for _, c := range pool {
+		assert.Equal(t, connectivity.Shutdown, c.GetState(), "the connections to the old endpoint should be closed")
+	}
+
+	m.close()
+	assert.Empty(t, m.pool)
+}
+
+func TestPorterClientManager_ReadyzCheck(t *testing.T) {
+	ctx := context.Background()
+	controller := setupPorterServerController()
+	m := NewPorterClientManager(controller.Client, logr.Discard(), 1)
+	defer m.close()
+
+	m.checkHealth(ctx)
+	require.NoError(t, m.ReadyzCheck(nil), "the operator should be ready when a PorterServer is not defined")
+
+	endpoint, healthServer := startInsecureTestGRPCServer(t)
+	server := testPorterServer(endpoint)
+	server.Status.Ready = false
+	require.NoError(t, controller.Create(ctx, server))
+	m.checkHealth(ctx)
+	require.ErrorContains(t, m.ReadyzCheck(nil), "the porter server porter-operator-system/default is not ready")
+
+	server.Status.Ready = true
+	require.NoError(t, controller.Update(ctx, server))
+	m.checkHealth(ctx)
+	require.NoError(t, m.ReadyzCheck(nil))
+
+	healthServer.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+	m.checkHealth(ctx)
+	require.ErrorContains(t, m.ReadyzCheck(nil), "the porter server is NOT_SERVING")
+}
+
+func testPorterServer(endpoint string) *porterv1.PorterServer {
+	return &porterv1.PorterServer{
+		ObjectMeta: metav1.ObjectMeta{Namespace: operatorNamespace, Name: defaultPorterServerName},
+		Status:     porterv1.PorterServerStatus{Endpoint: endpoint, Ready: true},
+	}
+}
+
+// startInsecureTestGRPCServer starts a gRPC server with the health service, without TLS.
+func startInsecureTestGRPCServer(t *testing.T) (string, *health.Server) {
+	srv := grpc.NewServer()
+	healthServer := health.NewServer()
+	healthpb.RegisterHealthServer(srv, healthServer)
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() { _ = srv.Serve(lis) }()
+	t.Cleanup(srv.Stop)
+
+	return lis.Addr().String(), healthServer
+}
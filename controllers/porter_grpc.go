@@ -0,0 +1,80 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// defaultPorterServerName is the name of the PorterServer, in the operator
+	// namespace, that deploys the gRPC server used by the operator.
+	defaultPorterServerName = "default"
+
+	// porterConnectTimeout is the minimum amount of time to wait for a
+	// connection to the gRPC server to be established.
+	porterConnectTimeout = 10 * time.Second
+)
+
+// porterConnectBackoff is the backoff used to reconnect to the gRPC server.
+var porterConnectBackoff = backoff.Config{
+	BaseDelay:  time.Second,
+	Multiplier: 1.6,
+	Jitter:     0.2,
+	MaxDelay:   30 * time.Second,
+}
+
+// dialPorterServer creates a connection to the gRPC server of a PorterServer.
+// When the PorterServer is configured with TLS, the certificates are loaded
+// from its Secrets. The connection is reestablished with an exponential
+// backoff when the server is unavailable.
+func dialPorterServer(ctx context.Context, clnt client.Reader, server *porterv1.PorterServer) (*grpc.ClientConn, error) {
+	creds, err := newPorterTransportCredentials(ctx, clnt, server)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint := server.Status.Endpoint
+	conn, err := grpc.NewClient(endpoint,
+		grpc.WithTransportCredentials(creds),
+		grpc.WithConnectParams(grpc.ConnectParams{Backoff: porterConnectBackoff, MinConnectTimeout: porterConnectTimeout}))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error creating the porter grpc client for %s", endpoint)
+	}
+	return conn, nil
+}
+
+// getPorterServer returns the PorterServer that the operator connects to, once it is ready.
+func getPorterServer(ctx context.Context, clnt client.Reader) (*porterv1.PorterServer, error) {
+	server := &porterv1.PorterServer{}
+	key := types.NamespacedName{Namespace: operatorNamespace, Name: defaultPorterServerName}
+	err := clnt.Get(ctx, key, server)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, porterServerNotDefinedError{key: key}
+		}
+		return nil, errors.Wrap(err, "could not retrieve the porter server")
+	}
+
+	if !server.Status.Ready || server.Status.Endpoint == "" {
+		return nil, errors.Errorf("the porter server %s/%s is not ready", server.Namespace, server.Name)
+	}
+	return server, nil
+}
+
+// porterServerNotDefinedError is returned when the PorterServer that the operator connects to does not exist.
+type porterServerNotDefinedError struct {
+	key types.NamespacedName
+}
+
+func (e porterServerNotDefinedError) Error() string {
+	return fmt.Sprintf("the PorterServer %s is not defined", e.key)
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"reflect"
+	"strconv"
 	"time"
 
 	porterv1 "get.porter.sh/operator/api/v1"
@@ -74,17 +75,28 @@ func applyAgentAction(log logr.Logger, resource PorterResource, action *porterv1
 	status.ObservedGeneration = resource.GetGeneration()
 	status.Phase = porterv1.PhaseUnknown
 
+	// Keep the conditions that are managed by the resource's controller, and not copied from the agent action
+	ownConditions := getResourceConditions(status.Conditions)
+
 	if action == nil {
 		status.Action = nil
-		status.Conditions = nil
+		status.Logs = nil
+		status.Conditions = ownConditions
 		log.V(Log5Trace).Info("Cleared status because there is no current agent action")
 	} else {
 		status.Action = &corev1.LocalObjectReference{Name: action.Name}
+		status.Logs = action.Status.Logs.DeepCopy()
 		if action.Status.Phase != "" {
 			status.Phase = action.Status.Phase
 		}
-		status.Conditions = make([]metav1.Condition, len(action.Status.Conditions))
-		copy(status.Conditions, action.Status.Conditions)
+		// The resource has its own Suspended condition, so the action's is not copied
+		status.Conditions = make([]metav1.Condition, 0, len(action.Status.Conditions)+len(ownConditions))
+		for _, cond := range action.Status.Conditions {
+			if cond.Type != porterv1.ConditionSuspended {
+				status.Conditions = append(status.Conditions, cond)
+			}
+		}
+		status.Conditions = append(status.Conditions, ownConditions...)
 
 		if log.V(Log5Trace).Enabled() {
 			conditions := make([]string, len(status.Conditions))
@@ -98,6 +110,20 @@ func applyAgentAction(log logr.Logger, resource PorterResource, action *porterv1
 	resource.SetStatus(status)
 }
 
+// getResourceConditions returns the conditions that were not copied from an agent action.
+func getResourceConditions(conditions []metav1.Condition) []metav1.Condition {
+	var result []metav1.Condition
+	for _, cond := range conditions {
+		switch porterv1.AgentConditionType(cond.Type) {
+		case porterv1.ConditionScheduled, porterv1.ConditionStarted, porterv1.ConditionComplete, porterv1.ConditionFailed:
+			continue
+		default:
+			result = append(result, cond)
+		}
+	}
+	return result
+}
+
 // isDeleted checks whether a porter resource is deleted.
 func isDeleted(resource PorterResource) bool {
 	timestamp := resource.GetDeletionTimestamp()
@@ -157,9 +183,19 @@ func getActionLabels(resource metav1.Object) map[string]string {
 	}
 }
 
+// getRetryAttempt returns the automatic retry attempt that the agent action was created for,
+// or zero when it is not a retry.
+func getRetryAttempt(action *porterv1.AgentAction) int {
+	attempt, err := strconv.Atoi(action.Labels[porterv1.LabelRetryAttempt])
+	if err != nil {
+		return 0
+	}
+	return attempt
+}
+
 // resourceChanged is a predicate that filters events that are sent to Reconcile
 // only triggers when the spec or the finalizer was changed.
-// Allows forcing Reconcile with the retry annotation as well.
+// Allows forcing Reconcile with the retry and approve annotations as well.
 type resourceChanged struct {
 	predicate.Funcs
 }
@@ -177,5 +213,9 @@ func (resourceChanged) Update(e event.UpdateEvent) bool {
 		return true
 	}
 
+	if e.ObjectNew.GetAnnotations()[porterv1.AnnotationApprove] != e.ObjectOld.GetAnnotations()[porterv1.AnnotationApprove] {
+		return true
+	}
+
 	return false
 }
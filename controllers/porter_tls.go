@@ -0,0 +1,154 @@
+package controllers
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"time"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// tlsCAKey is the key of the certificate authority in a kubernetes.io/tls
+	// Secret, as populated by cert-manager.
+	tlsCAKey = "ca.crt"
+
+	// tlsLoadTimeout is the maximum amount of time to load the certificates
+	// when a connection to the gRPC server is verified.
+	tlsLoadTimeout = 10 * time.Second
+)
+
+// newPorterTransportCredentials returns the credentials used to connect to the
+// gRPC server of a PorterServer. The connection is not encrypted when the
+// PorterServer is not configured with TLS.
+func newPorterTransportCredentials(ctx context.Context, clnt client.Reader, server *porterv1.PorterServer) (credentials.TransportCredentials, error) {
+	if server.Spec.TLS == nil {
+		return insecure.NewCredentials(), nil
+	}
+
+	serverName := server.Spec.TLS.ServerName
+	if serverName == "" {
+		host, _, err := net.SplitHostPort(server.Status.Endpoint)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid porter server endpoint %s", server.Status.Endpoint)
+		}
+		serverName = host
+	}
+
+	loader := &porterTLSLoader{
+		clnt:       clnt,
+		namespace:  server.Namespace,
+		tls:        *server.Spec.TLS,
+		serverName: serverName,
+	}
+
+	// Fail fast when the certificates are not available, instead of when the connection is established
+	if _, err := loader.loadCA(ctx); err != nil {
+		return nil, err
+	}
+
+	cfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: serverName,
+		// The certificate of the server is verified against the latest certificate
+		// authority in verifyConnection, so that it can be rotated.
+		InsecureSkipVerify: true, //nolint:gosec
+		VerifyConnection:   loader.verifyConnection,
+	}
+	if server.IsMutualTLS() {
+		if _, err := loader.loadClientCertificate(ctx); err != nil {
+			return nil, err
+		}
+		cfg.GetClientCertificate = loader.getClientCertificate
+	}
+
+	return credentials.NewTLS(cfg), nil
+}
+
+// porterTLSLoader loads the certificates used to connect to the Porter gRPC
+// server from Secrets each time that a connection is established, so that
+// rotated certificates are used without restarting the operator.
+type porterTLSLoader struct {
+	clnt       client.Reader
+	namespace  string
+	tls        porterv1.PorterServerTLS
+	serverName string
+}
+
+// loadCA returns the certificate authority used to verify the gRPC server.
+func (l *porterTLSLoader) loadCA(ctx context.Context) (*x509.CertPool, error) {
+	data, err := l.getSecretData(ctx, l.tls.SecretName)
+	if err != nil {
+		return nil, err
+	}
+
+	caPEM, ok := data[tlsCAKey]
+	if !ok {
+		return nil, errors.Errorf("the TLS secret %s/%s does not contain %s", l.namespace, l.tls.SecretName, tlsCAKey)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return nil, errors.Errorf("the %s in the TLS secret %s/%s does not contain a valid certificate", tlsCAKey, l.namespace, l.tls.SecretName)
+	}
+	return pool, nil
+}
+
+// loadClientCertificate returns the certificate that the operator presents to the gRPC server.
+func (l *porterTLSLoader) loadClientCertificate(ctx context.Context) (*tls.Certificate, error) {
+	data, err := l.getSecretData(ctx, l.tls.ClientSecretName)
+	if err != nil {
+		return nil, err
+	}
+
+	cert, err := tls.X509KeyPair(data[corev1.TLSCertKey], data[corev1.TLSPrivateKeyKey])
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid client certificate in the TLS secret %s/%s", l.namespace, l.tls.ClientSecretName)
+	}
+	return &cert, nil
+}
+
+// getClientCertificate is called when the gRPC server requests a client certificate.
+func (l *porterTLSLoader) getClientCertificate(info *tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return l.loadClientCertificate(info.Context())
+}
+
+// verifyConnection verifies the certificate presented by the gRPC server.
+func (l *porterTLSLoader) verifyConnection(state tls.ConnectionState) error {
+	if len(state.PeerCertificates) == 0 {
+		return errors.New("the porter server did not present a certificate")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), tlsLoadTimeout)
+	defer cancel()
+	roots, err := l.loadCA(ctx)
+	if err != nil {
+		return err
+	}
+
+	opts := x509.VerifyOptions{
+		DNSName:       l.serverName,
+		Roots:         roots,
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, cert := range state.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	_, err = state.PeerCertificates[0].Verify(opts)
+	return errors.Wrap(err, "could not verify the certificate of the porter server")
+}
+
+func (l *porterTLSLoader) getSecretData(ctx context.Context, name string) (map[string][]byte, error) {
+	secret := &corev1.Secret{}
+	if err := l.clnt.Get(ctx, client.ObjectKey{Namespace: l.namespace, Name: name}, secret); err != nil {
+		return nil, errors.Wrapf(err, "could not retrieve the TLS secret %s/%s", l.namespace, name)
+	}
+	return secret.Data, nil
+}
@@ -0,0 +1,217 @@
+package controllers
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/peer"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestDialPorterServer_MutualTLS(t *testing.T) {
+	ctx := context.Background()
+	ca := newTestCA(t, "porter-ca")
+	serverCert := ca.issue(t, "porter-server")
+	endpoint, clientNames := startTestGRPCServer(t, ca, serverCert)
+
+	server := testTLSPorterServer(endpoint)
+	serverSecret := ca.tlsSecret("porter-server-tls", serverCert)
+	clientSecret := ca.tlsSecret("porter-operator-tls", ca.issue(t, "operator-1"))
+	controller := setupPorterServerController(server, serverSecret, clientSecret)
+
+	checkHealth := func() error {
+		conn, err := dialPorterServer(ctx, controller.Client, server)
+		require.NoError(t, err)
+		defer conn.Close()
+		return checkConnHealth(ctx, conn)
+	}
+
+	require.NoError(t, checkHealth(), "the operator should connect to the server over mTLS")
+	assert.Equal(t, "operator-1", clientNames.last(), "the operator should present the client certificate")
+
+	// Rotated client certificates are used for new connections
+	require.NoError(t, controller.Get(ctx, client.ObjectKeyFromObject(clientSecret), clientSecret))
+	clientSecret.Data = ca.tlsSecret(clientSecret.Name, ca.issue(t, "operator-2")).Data
+	require.NoError(t, controller.Update(ctx, clientSecret))
+	require.NoError(t, checkHealth())
+	assert.Equal(t, "operator-2", clientNames.last(), "the rotated client certificate should be used")
+
+	// The server is not trusted when it is not signed by the certificate authority
+	otherCA := newTestCA(t, "other-ca")
+	require.NoError(t, controller.Get(ctx, client.ObjectKeyFromObject(serverSecret), serverSecret))
+	serverSecret.Data[tlsCAKey] = otherCA.certPEM
+	require.NoError(t, controller.Update(ctx, serverSecret))
+	err := checkHealth()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "could not verify the certificate of the porter server")
+}
+
+func TestDialPorterServer_MissingSecret(t *testing.T) {
+	server := testTLSPorterServer("127.0.0.1:3001")
+	controller := setupPorterServerController(server)
+
+	_, err := dialPorterServer(context.Background(), controller.Client, server)
+	require.ErrorContains(t, err, "could not retrieve the TLS secret porter-operator-system/porter-server-tls")
+}
+
+func TestDialPorterServer_Insecure(t *testing.T) {
+	server := testTLSPorterServer("127.0.0.1:3001")
+	server.Spec.TLS = nil
+	controller := setupPorterServerController(server)
+
+	conn, err := dialPorterServer(context.Background(), controller.Client, server)
+	require.NoError(t, err, "the client should connect without TLS when it is not configured")
+	require.NoError(t, conn.Close())
+}
+
+func testTLSPorterServer(endpoint string) *porterv1.PorterServer {
+	server := testPorterServer(endpoint)
+	server.Spec.TLS = &porterv1.PorterServerTLS{SecretName: "porter-server-tls", ClientSecretName: "porter-operator-tls"}
+	return server
+}
+
+// startTestGRPCServer starts a gRPC server that requires clients to present a
+// certificate signed by the certificate authority, and records the common name
+// of the client certificates.
+func startTestGRPCServer(t *testing.T, ca *testCA, cert tls.Certificate) (string, *clientNameRecorder) {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	tlsCfg := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	names := &clientNameRecorder{}
+	srv := grpc.NewServer(grpc.Creds(credentials.NewTLS(tlsCfg)),
+		grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			if p, ok := peer.FromContext(ctx); ok {
+				if tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo); ok && len(tlsInfo.State.PeerCertificates) > 0 {
+					names.record(tlsInfo.State.PeerCertificates[0].Subject.CommonName)
+				}
+			}
+			return handler(ctx, req)
+		}))
+	healthpb.RegisterHealthServer(srv, health.NewServer())
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() { _ = srv.Serve(lis) }()
+	t.Cleanup(srv.Stop)
+
+	return lis.Addr().String(), names
+}
+
+type clientNameRecorder struct {
+	mu    sync.Mutex
+	names []string
+}
+
+func (r *clientNameRecorder) record(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.names = append(r.names, name)
+}
+
+func (r *clientNameRecorder) last() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.names) == 0 {
+		return ""
+	}
+	return r.names[len(r.names)-1]
+}
+
+// testCA is a certificate authority that issues certificates for 127.0.0.1.
+type testCA struct {
+	cert    *x509.Certificate
+	certPEM []byte
+	key     *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return &testCA{
+		cert:    cert,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		key:     key,
+	}
+}
+
+func (ca *testCA) issue(t *testing.T, name string) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	cert, err := tls.X509KeyPair(
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+	require.NoError(t, err)
+	return cert
+}
+
+// tlsSecret returns a kubernetes.io/tls Secret with the certificate, in the same format as cert-manager.
+func (ca *testCA) tlsSecret(name string, cert tls.Certificate) *corev1.Secret {
+	keyDER, _ := x509.MarshalECPrivateKey(cert.PrivateKey.(*ecdsa.PrivateKey))
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: operatorNamespace, Name: name},
+		Type:       corev1.SecretTypeTLS,
+		Data: map[string][]byte{
+			corev1.TLSCertKey:       pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}),
+			corev1.TLSPrivateKeyKey: pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+			tlsCAKey:                ca.certPEM,
+		},
+	}
+}
@@ -0,0 +1,324 @@
+package controllers
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"reflect"
+	"strconv"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// PorterServerReconciler deploys the Porter gRPC server that the operator uses to query Porter.
+type PorterServerReconciler struct {
+	client.Client
+	Log      logr.Logger
+	Recorder record.EventRecorder
+	Scheme   *runtime.Scheme
+}
+
+// +kubebuilder:rbac:groups=getporter.org,resources=porterservers,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=getporter.org,resources=porterservers/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=getporter.org,resources=porterservers/finalizers,verbs=update
+// +kubebuilder:rbac:groups=getporter.org,resources=porterconfigs,verbs=get;list;watch
+// +kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups="",resources=services,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update;patch;delete
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *PorterServerReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&porterv1.PorterServer{}, builder.WithPredicates(resourceChanged{})).
+		Owns(&appsv1.Deployment{}).
+		Owns(&corev1.Service{}).
+		Owns(&corev1.Secret{}).
+		// PorterConfig is resolved from the operator namespace and the namespace of the server, the same as AgentConfig
+		Watches(&porterv1.PorterConfig{},
+			handler.EnqueueRequestsFromMapFunc(requestsForAgentConfig(r.Client, func() client.ObjectList { return &porterv1.PorterServerList{} }))).
+		// Restart the server when its certificates are rotated
+		Watches(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(r.requestsForTLSSecret)).
+		Complete(r)
+}
+
+// Reconcile is called when the spec of a PorterServer is changed, the
+// PorterConfig that it uses is changed, or the deployment of the gRPC server
+// is updated. Deploy the gRPC server and report its endpoint in the status.
+func (r *PorterServerReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := r.Log.WithValues("porterServer", req.Name, "namespace", req.Namespace)
+
+	server := &porterv1.PorterServer{}
+	err := r.Get(ctx, req.NamespacedName, server)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			log.V(Log5Trace).Info("Reconciliation skipped: PorterServer CRD or one of its owned resources was deleted.")
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+
+	if server.GetDeletionTimestamp() != nil {
+		log.V(Log4Debug).Info("Reconciliation complete: PorterServer CRD is ready for deletion.")
+		return ctrl.Result{}, nil
+	}
+
+	log = log.WithValues("resourceVersion", server.ResourceVersion, "generation", server.Generation, "observedGeneration", server.Status.ObservedGeneration)
+	log.V(Log5Trace).Info("Reconciling porter server")
+
+	porterCfg, err := resolvePorterConfigSpec(ctx, log, r.Client, server.Namespace)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	configDigest, err := r.applyConfigSecret(ctx, log, server, porterCfg)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	tlsDigest, err := r.getTLSDigest(ctx, server)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	deployment, err := r.applyDeployment(ctx, log, server, configDigest, tlsDigest)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if err = r.applyService(ctx, log, server); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if err = r.syncStatus(ctx, log, server, deployment); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	log.V(Log4Debug).Info("Reconciliation complete: The porter server is deployed.", "endpoint", server.Status.Endpoint, "ready", server.Status.Ready)
+	return ctrl.Result{}, nil
+}
+
+// applyConfigSecret creates or updates the secret with the porter configuration
+// file used by the gRPC server, and returns a digest of its contents.
+func (r *PorterServerReconciler) applyConfigSecret(ctx context.Context, log logr.Logger, server *porterv1.PorterServer, porterCfg porterv1.PorterConfigSpec) (string, error) {
+	porterCfgB, err := porterCfg.ToPorterDocument()
+	if err != nil {
+		return "", errors.Wrap(err, "error marshaling the porter config.json file")
+	}
+
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: server.Namespace, Name: server.GetResourceName()}}
+	result, err := controllerutil.CreateOrUpdate(ctx, r.Client, secret, func() error {
+		secret.Labels = getPorterServerLabels(server)
+		secret.Labels[porterv1.LabelSecretType] = porterv1.SecretTypeConfig
+		secret.Type = corev1.SecretTypeOpaque
+		secret.Data = map[string][]byte{"config.yaml": porterCfgB}
+		return controllerutil.SetControllerReference(server, secret, r.Scheme)
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "error applying the porter config secret")
+	}
+	log.V(Log5Trace).Info("Applied secret for the porter config", "name", secret.Name, "result", result)
+
+	hash := md5.Sum(porterCfgB)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// getTLSDigest returns a digest of the certificates of the gRPC server, or an
+// empty string when the server does not use TLS.
+func (r *PorterServerReconciler) getTLSDigest(ctx context.Context, server *porterv1.PorterServer) (string, error) {
+	if server.Spec.TLS == nil {
+		return "", nil
+	}
+
+	secret := &corev1.Secret{}
+	key := client.ObjectKey{Namespace: server.Namespace, Name: server.Spec.TLS.SecretName}
+	if err := r.Get(ctx, key, secret); err != nil {
+		return "", errors.Wrapf(err, "could not retrieve the TLS secret %s of the porter server", key.Name)
+	}
+
+	hash := md5.New()
+	for _, k := range []string{corev1.TLSCertKey, corev1.TLSPrivateKeyKey, tlsCAKey} {
+		hash.Write(secret.Data[k])
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// requestsForTLSSecret returns the PorterServers that use a Secret for their certificates.
+func (r *PorterServerReconciler) requestsForTLSSecret(ctx context.Context, obj client.Object) []reconcile.Request {
+	servers := &porterv1.PorterServerList{}
+	if err := r.List(ctx, servers, client.InNamespace(obj.GetNamespace())); err != nil {
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, server := range servers.Items {
+		if tlsCfg := server.Spec.TLS; tlsCfg != nil && tlsCfg.SecretName == obj.GetName() {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&server)})
+		}
+	}
+	return requests
+}
+
+// applyDeployment creates or updates the deployment of the gRPC server. The
+// pods are restarted when the porter configuration or the certificates change.
+func (r *PorterServerReconciler) applyDeployment(ctx context.Context, log logr.Logger, server *porterv1.PorterServer, configDigest string, tlsDigest string) (*appsv1.Deployment, error) {
+	labels := getPorterServerLabels(server)
+	port := server.GetPort()
+
+	deployment := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: server.Namespace, Name: server.GetResourceName()}}
+	result, err := controllerutil.CreateOrUpdate(ctx, r.Client, deployment, func() error {
+		deployment.Labels = labels
+		deployment.Spec.Replicas = ptr.To(server.GetReplicas())
+		deployment.Spec.Selector = &metav1.LabelSelector{MatchLabels: labels}
+		deployment.Spec.Template.Labels = labels
+		deployment.Spec.Template.Annotations = map[string]string{porterv1.AnnotationConfigDigest: configDigest}
+		if tlsDigest != "" {
+			deployment.Spec.Template.Annotations[porterv1.AnnotationTLSDigest] = tlsDigest
+		}
+
+		podSpec := &deployment.Spec.Template.Spec
+		podSpec.ServiceAccountName = server.Spec.ServiceAccount
+		podSpec.Volumes = []corev1.Volume{
+			{
+				Name: porterv1.VolumePorterConfigName,
+				VolumeSource: corev1.VolumeSource{
+					Secret: &corev1.SecretVolumeSource{SecretName: server.GetResourceName(), Optional: ptr.To(false)},
+				},
+			},
+		}
+		volumeMounts := []corev1.VolumeMount{
+			{Name: porterv1.VolumePorterConfigName, MountPath: porterv1.VolumePorterConfigPath},
+		}
+		if server.Spec.TLS != nil {
+			podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+				Name: porterv1.VolumePorterServerTLSName,
+				VolumeSource: corev1.VolumeSource{
+					Secret: &corev1.SecretVolumeSource{SecretName: server.Spec.TLS.SecretName, Optional: ptr.To(false)},
+				},
+			})
+			volumeMounts = append(volumeMounts, corev1.VolumeMount{Name: porterv1.VolumePorterServerTLSName, MountPath: porterv1.VolumePorterServerTLSPath, ReadOnly: true})
+		}
+		podSpec.Containers = []corev1.Container{
+			{
+				Name:            "porter-server",
+				Image:           server.GetPorterImage(),
+				ImagePullPolicy: server.GetPullPolicy(),
+				Args:            getPorterServerArgs(server),
+				Ports:           []corev1.ContainerPort{{Name: "grpc", ContainerPort: port, Protocol: corev1.ProtocolTCP}},
+				ReadinessProbe: &corev1.Probe{
+					ProbeHandler: corev1.ProbeHandler{TCPSocket: &corev1.TCPSocketAction{Port: intstr.FromString("grpc")}},
+				},
+				VolumeMounts: volumeMounts,
+			},
+		}
+		return controllerutil.SetControllerReference(server, deployment, r.Scheme)
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error applying the porter server deployment")
+	}
+	log.V(Log5Trace).Info("Applied deployment for the porter server", "name", deployment.Name, "result", result)
+	return deployment, nil
+}
+
+// applyService creates or updates the service that exposes the gRPC server.
+func (r *PorterServerReconciler) applyService(ctx context.Context, log logr.Logger, server *porterv1.PorterServer) error {
+	svc := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: server.Namespace, Name: server.GetResourceName()}}
+	result, err := controllerutil.CreateOrUpdate(ctx, r.Client, svc, func() error {
+		svc.Labels = getPorterServerLabels(server)
+		svc.Spec.Selector = getPorterServerLabels(server)
+		svc.Spec.Ports = []corev1.ServicePort{
+			{Name: "grpc", Port: server.GetPort(), TargetPort: intstr.FromString("grpc"), Protocol: corev1.ProtocolTCP},
+		}
+		return controllerutil.SetControllerReference(server, svc, r.Scheme)
+	})
+	if err != nil {
+		return errors.Wrap(err, "error applying the porter server service")
+	}
+	log.V(Log5Trace).Info("Applied service for the porter server", "name", svc.Name, "result", result)
+	return nil
+}
+
+// syncStatus reports the endpoint of the gRPC server, and whether it is ready, in the status.
+func (r *PorterServerReconciler) syncStatus(ctx context.Context, log logr.Logger, server *porterv1.PorterServer, deployment *appsv1.Deployment) error {
+	origStatus := server.Status.DeepCopy()
+
+	server.Status.ObservedGeneration = server.Generation
+	server.Status.Endpoint = server.GetEndpoint()
+	server.Status.Ready = deployment.Status.AvailableReplicas > 0
+
+	cond := metav1.Condition{
+		Type:               porterv1.ConditionPorterServerReady,
+		Status:             metav1.ConditionFalse,
+		Reason:             "DeploymentNotAvailable",
+		Message:            fmt.Sprintf("waiting for the deployment %s to be available", deployment.Name),
+		ObservedGeneration: server.Generation,
+	}
+	if server.Status.Ready {
+		cond.Status = metav1.ConditionTrue
+		cond.Reason = "DeploymentAvailable"
+		cond.Message = fmt.Sprintf("the porter server is available at %s", server.Status.Endpoint)
+	}
+	apimeta.SetStatusCondition(&server.Status.Conditions, cond)
+
+	if reflect.DeepEqual(origStatus, &server.Status) {
+		return nil
+	}
+
+	if origStatus.Ready != server.Status.Ready {
+		if server.Status.Ready {
+			r.Recorder.Event(server, "Normal", "Ready", cond.Message)
+		} else {
+			r.Recorder.Event(server, "Warning", "NotReady", cond.Message)
+		}
+	}
+
+	log.V(Log5Trace).Info("Patching porter server status")
+	return PatchStatusWithRetry(ctx, log, r.Client, r.Status().Patch, server, func() client.Object {
+		return &porterv1.PorterServer{}
+	})
+}
+
+// getPorterServerArgs returns the arguments of the gRPC server. The certificates
+// are read from the mounted TLS secret, and the ca.crt is used to verify client
+// certificates when mTLS is enabled.
+func getPorterServerArgs(server *porterv1.PorterServer) []string {
+	args := []string{"grpc-server", "run", "--port", strconv.Itoa(int(server.GetPort()))}
+	if server.Spec.TLS == nil {
+		return args
+	}
+
+	args = append(args,
+		"--tls-cert-file", path.Join(porterv1.VolumePorterServerTLSPath, corev1.TLSCertKey),
+		"--tls-key-file", path.Join(porterv1.VolumePorterServerTLSPath, corev1.TLSPrivateKeyKey))
+	if server.IsMutualTLS() {
+		args = append(args, "--tls-client-ca-file", path.Join(porterv1.VolumePorterServerTLSPath, tlsCAKey))
+	}
+	return args
+}
+
+// getPorterServerLabels returns the labels applied to the resources created for a PorterServer.
+func getPorterServerLabels(server *porterv1.PorterServer) map[string]string {
+	return map[string]string{
+		porterv1.LabelManaged:      "true",
+		porterv1.LabelResourceKind: "PorterServer",
+		porterv1.LabelResourceName: server.Name,
+	}
+}
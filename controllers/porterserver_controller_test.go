@@ -0,0 +1,162 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestPorterServerReconciler_Reconcile(t *testing.T) {
+	ctx := context.Background()
+	server := &porterv1.PorterServer{
+		ObjectMeta: metav1.ObjectMeta{Namespace: operatorNamespace, Name: "default", Generation: 1},
+		Spec:       porterv1.PorterServerSpec{ServiceAccount: "porter-server", Replicas: ptr.To(int32(2))},
+	}
+	controller := setupPorterServerController(server)
+	recorder := controller.Recorder.(*record.FakeRecorder)
+
+	req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(server)}
+	_, err := controller.Reconcile(ctx, req)
+	require.NoError(t, err)
+
+	var secret corev1.Secret
+	require.NoError(t, controller.Get(ctx, client.ObjectKey{Namespace: operatorNamespace, Name: "porter-server-default"}, &secret))
+	assert.Contains(t, string(secret.Data["config.yaml"]), "default-storage: in-cluster-mongodb", "the resolved porter config should be used")
+	assert.True(t, metav1.IsControlledBy(&secret, server))
+
+	var deployment appsv1.Deployment
+	require.NoError(t, controller.Get(ctx, client.ObjectKey{Namespace: operatorNamespace, Name: "porter-server-default"}, &deployment))
+	assert.True(t, metav1.IsControlledBy(&deployment, server))
+	assert.Equal(t, int32(2), *deployment.Spec.Replicas)
+	podSpec := deployment.Spec.Template.Spec
+	assert.Equal(t, "porter-server", podSpec.ServiceAccountName)
+	require.Len(t, podSpec.Containers, 1)
+	assert.Equal(t, "ghcr.io/getporter/porter-agent:"+porterv1.DefaultPorterAgentVersion, podSpec.Containers[0].Image)
+	assert.Equal(t, []string{"grpc-server", "run", "--port", "3001"}, podSpec.Containers[0].Args)
+	assert.Equal(t, "porter-server-default", podSpec.Volumes[0].Secret.SecretName, "the porter config should be mounted")
+	configDigest := deployment.Spec.Template.Annotations[porterv1.AnnotationConfigDigest]
+	assert.NotEmpty(t, configDigest)
+
+	var svc corev1.Service
+	require.NoError(t, controller.Get(ctx, client.ObjectKey{Namespace: operatorNamespace, Name: "porter-server-default"}, &svc))
+	assert.Equal(t, deployment.Spec.Selector.MatchLabels, svc.Spec.Selector)
+	assert.Equal(t, int32(3001), svc.Spec.Ports[0].Port)
+
+	require.NoError(t, controller.Get(ctx, req.NamespacedName, server))
+	assert.Equal(t, "porter-server-default.porter-operator-system.svc:3001", server.Status.Endpoint)
+	assert.False(t, server.Status.Ready, "the server should not be ready until the deployment is available")
+	assert.Equal(t, int64(1), server.Status.ObservedGeneration)
+
+	_, err = getPorterServer(ctx, controller.Client)
+	require.ErrorContains(t, err, "the porter server porter-operator-system/default is not ready")
+
+	// The server is ready when the deployment is available
+	deployment.Status.AvailableReplicas = 1
+	require.NoError(t, controller.Status().Update(ctx, &deployment))
+	_, err = controller.Reconcile(ctx, req)
+	require.NoError(t, err)
+
+	require.NoError(t, controller.Get(ctx, req.NamespacedName, server))
+	assert.True(t, server.Status.Ready)
+	cond := apimeta.FindStatusCondition(server.Status.Conditions, porterv1.ConditionPorterServerReady)
+	require.NotNil(t, cond)
+	assert.Equal(t, metav1.ConditionTrue, cond.Status)
+	assert.Equal(t, []string{"Normal Ready the porter server is available at porter-server-default.porter-operator-system.svc:3001"}, drainEvents(recorder))
+
+	readyServer, err := getPorterServer(ctx, controller.Client)
+	require.NoError(t, err)
+	assert.Equal(t, server.Status.Endpoint, readyServer.Status.Endpoint, "the operator should connect to the endpoint of the server")
+
+	// The server is restarted when the porter config changes
+	porterCfg := &porterv1.PorterConfig{
+		ObjectMeta: metav1.ObjectMeta{Namespace: operatorNamespace, Name: "default"},
+		Spec:       porterv1.PorterConfigSpec{Verbosity: ptr.To("debug")},
+	}
+	require.NoError(t, controller.Create(ctx, porterCfg))
+	_, err = controller.Reconcile(ctx, req)
+	require.NoError(t, err)
+
+	require.NoError(t, controller.Get(ctx, client.ObjectKeyFromObject(&deployment), &deployment))
+	assert.NotEqual(t, configDigest, deployment.Spec.Template.Annotations[porterv1.AnnotationConfigDigest])
+	require.NoError(t, controller.Get(ctx, client.ObjectKeyFromObject(&secret), &secret))
+	assert.Contains(t, string(secret.Data["config.yaml"]), "verbosity: debug")
+}
+
+func TestPorterServerReconciler_Reconcile_TLS(t *testing.T) {
+	ctx := context.Background()
+	server := testTLSPorterServer("")
+	controller := setupPorterServerController(server)
+	req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(server)}
+
+	_, err := controller.Reconcile(ctx, req)
+	require.ErrorContains(t, err, "could not retrieve the TLS secret porter-server-tls", "the server should not be deployed until its certificates are available")
+
+	ca := newTestCA(t, "porter-ca")
+	serverSecret := ca.tlsSecret("porter-server-tls", ca.issue(t, "porter-server"))
+	require.NoError(t, controller.Create(ctx, serverSecret))
+	assert.Equal(t, []reconcile.Request{req}, controller.requestsForTLSSecret(ctx, serverSecret), "the server should be reconciled when its certificates are rotated")
+
+	_, err = controller.Reconcile(ctx, req)
+	require.NoError(t, err)
+
+	var deployment appsv1.Deployment
+	require.NoError(t, controller.Get(ctx, client.ObjectKey{Namespace: operatorNamespace, Name: "porter-server-default"}, &deployment))
+	podSpec := deployment.Spec.Template.Spec
+	assert.Equal(t, []string{"grpc-server", "run", "--port", "3001",
+		"--tls-cert-file", "/porter-server-tls/tls.crt",
+		"--tls-key-file", "/porter-server-tls/tls.key",
+		"--tls-client-ca-file", "/porter-server-tls/ca.crt"}, podSpec.Containers[0].Args)
+	require.Len(t, podSpec.Volumes, 2)
+	assert.Equal(t, "porter-server-tls", podSpec.Volumes[1].Secret.SecretName, "the certificates should be mounted")
+	tlsDigest := deployment.Spec.Template.Annotations[porterv1.AnnotationTLSDigest]
+	assert.NotEmpty(t, tlsDigest)
+
+	// The server is restarted when the certificates are rotated
+	serverSecret.Data = ca.tlsSecret(serverSecret.Name, ca.issue(t, "porter-server")).Data
+	require.NoError(t, controller.Update(ctx, serverSecret))
+	_, err = controller.Reconcile(ctx, req)
+	require.NoError(t, err)
+	require.NoError(t, controller.Get(ctx, client.ObjectKeyFromObject(&deployment), &deployment))
+	assert.NotEqual(t, tlsDigest, deployment.Spec.Template.Annotations[porterv1.AnnotationTLSDigest])
+}
+
+func TestGetPorterServer_NotDefined(t *testing.T) {
+	controller := setupPorterServerController()
+	_, err := getPorterServer(context.Background(), controller.Client)
+	require.ErrorContains(t, err, "the PorterServer porter-operator-system/default is not defined")
+}
+
+func setupPorterServerController(objs ...client.Object) *PorterServerReconciler {
+	scheme := runtime.NewScheme()
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(porterv1.AddToScheme(scheme))
+
+	fakeBuilder := fake.NewClientBuilder()
+	fakeBuilder.WithScheme(scheme)
+	fakeBuilder.WithObjects(objs...).WithStatusSubresource(objs...)
+	fakeClient := fakeBuilder.Build()
+
+	return &PorterServerReconciler{
+		Log:      logr.Discard(),
+		Client:   fakeClient,
+		Recorder: record.NewFakeRecorder(42),
+		Scheme:   scheme,
+	}
+}
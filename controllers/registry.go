@@ -0,0 +1,357 @@
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// manifestMediaTypes are the manifest formats accepted when resolving the digest of a tag.
+var manifestMediaTypes = []string{
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+// RegistryClient queries an OCI registry for the tags and digests of a bundle repository.
+type RegistryClient interface {
+	// ListTags returns the tags defined in the repository.
+	ListTags(ctx context.Context, repository string, opts RegistryOptions) ([]string, error)
+
+	// GetDigest returns the digest of the manifest referenced by the tag.
+	GetDigest(ctx context.Context, repository string, tag string, opts RegistryOptions) (string, error)
+}
+
+// RegistryOptions specifies how a registry is accessed.
+type RegistryOptions struct {
+	// Credentials for each registry host. Registries without credentials are accessed anonymously.
+	Credentials map[string]RegistryCredential
+
+	// Insecure accesses the registry over plain HTTP.
+	Insecure bool
+}
+
+// RegistryCredential is the username and password, or identity token, used to access a registry.
+type RegistryCredential struct {
+	Username string
+	Password string
+}
+
+// NewRegistryClient returns a RegistryClient that uses the OCI distribution API.
+// Registries that require authentication are accessed with the credentials for the
+// registry, or anonymously when there are none.
+// When httpClient is nil, http.DefaultClient is used.
+func NewRegistryClient(httpClient *http.Client) RegistryClient {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &registryClient{httpClient: httpClient}
+}
+
+type registryClient struct {
+	httpClient *http.Client
+}
+
+func (c *registryClient) ListTags(ctx context.Context, repository string, opts RegistryOptions) ([]string, error) {
+	host, name, err := parseRepository(repository)
+	if err != nil {
+		return nil, err
+	}
+
+	var tags []string
+	next, _ := url.Parse(fmt.Sprintf("%s://%s/v2/%s/tags/list", opts.scheme(), host, name))
+	for next != nil {
+		resp, err := c.do(ctx, http.MethodGet, next, name, nil, opts.getCredential(host))
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not list the tags for %s", repository)
+		}
+
+		var page struct {
+			Tags []string `json:"tags"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not parse the tags for %s", repository)
+		}
+		tags = append(tags, page.Tags...)
+
+		next, err = getNextLink(next, resp.Header.Get("Link"))
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not list the tags for %s", repository)
+		}
+	}
+
+	return tags, nil
+}
+
+func (c *registryClient) GetDigest(ctx context.Context, repository string, tag string, opts RegistryOptions) (string, error) {
+	host, name, err := parseRepository(repository)
+	if err != nil {
+		return "", err
+	}
+
+	manifestURL, _ := url.Parse(fmt.Sprintf("%s://%s/v2/%s/manifests/%s", opts.scheme(), host, name, tag))
+	header := http.Header{"Accept": []string{strings.Join(manifestMediaTypes, ", ")}}
+	cred := opts.getCredential(host)
+	resp, err := c.do(ctx, http.MethodHead, manifestURL, name, header, cred)
+	if err != nil {
+		return "", errors.Wrapf(err, "could not resolve the digest of %s:%s", repository, tag)
+	}
+	resp.Body.Close()
+	if digest := resp.Header.Get("Docker-Content-Digest"); digest != "" {
+		return digest, nil
+	}
+
+	// The digest header is optional, calculate it from the manifest instead
+	resp, err = c.do(ctx, http.MethodGet, manifestURL, name, header, cred)
+	if err != nil {
+		return "", errors.Wrapf(err, "could not resolve the digest of %s:%s", repository, tag)
+	}
+	defer resp.Body.Close()
+	h := sha256.New()
+	if _, err = io.Copy(h, resp.Body); err != nil {
+		return "", errors.Wrapf(err, "could not read the manifest for %s:%s", repository, tag)
+	}
+	return fmt.Sprintf("sha256:%x", h.Sum(nil)), nil
+}
+
+// do sends a request to the registry, authenticating and trying again when the
+// registry requires authentication. Registries that use basic authentication are
+// sent the credential, and registries that use bearer tokens are sent a token
+// requested with the credential, or an anonymous token when there is no credential.
+func (c *registryClient) do(ctx context.Context, method string, u *url.URL, name string, header http.Header, cred *RegistryCredential) (*http.Response, error) {
+	send := func(authorization string) (*http.Response, error) {
+		req, err := http.NewRequestWithContext(ctx, method, u.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		return c.httpClient.Do(req)
+	}
+
+	resp, err := send("")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		resp.Body.Close()
+		challenge := resp.Header.Get("WWW-Authenticate")
+		var authorization string
+		if scheme, _ := parseChallenge(challenge); strings.EqualFold(scheme, "basic") && cred != nil {
+			authorization = "Basic " + base64.StdEncoding.EncodeToString([]byte(cred.Username+":"+cred.Password))
+		} else {
+			token, err := c.getToken(ctx, challenge, name, cred)
+			if err != nil {
+				return nil, err
+			}
+			authorization = "Bearer " + token
+		}
+		if resp, err = send(authorization); err != nil {
+			return nil, err
+		}
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		resp.Body.Close()
+		return nil, errors.Errorf("%s %s returned %s", method, u.String(), resp.Status)
+	}
+	return resp, nil
+}
+
+// getToken requests a pull token from the authorization server in the bearer challenge,
+// authenticating with the credential when there is one.
+func (c *registryClient) getToken(ctx context.Context, challenge string, name string, cred *RegistryCredential) (string, error) {
+	scheme, params := parseChallenge(challenge)
+	if !strings.EqualFold(scheme, "bearer") || params["realm"] == "" {
+		return "", errors.Errorf("the registry requires unsupported authentication %q", challenge)
+	}
+
+	tokenURL, err := url.Parse(params["realm"])
+	if err != nil {
+		return "", errors.Wrapf(err, "invalid authentication realm %q", params["realm"])
+	}
+	query := tokenURL.Query()
+	if params["service"] != "" {
+		query.Set("service", params["service"])
+	}
+	scope := params["scope"]
+	if scope == "" {
+		scope = fmt.Sprintf("repository:%s:pull", name)
+	}
+	query.Set("scope", scope)
+	tokenURL.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, tokenURL.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	if cred != nil {
+		req.SetBasicAuth(cred.Username, cred.Password)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", errors.Wrap(err, "could not request a registry token")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.Errorf("could not request a registry token: %s", resp.Status)
+	}
+
+	var result struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", errors.Wrap(err, "could not parse the registry token")
+	}
+	if result.Token != "" {
+		return result.Token, nil
+	}
+	return result.AccessToken, nil
+}
+
+func (o RegistryOptions) scheme() string {
+	if o.Insecure {
+		return "http"
+	}
+	return "https"
+}
+
+// getCredential returns the credential for the registry host, or nil when the registry is accessed anonymously.
+func (o RegistryOptions) getCredential(host string) *RegistryCredential {
+	if cred, ok := o.Credentials[host]; ok {
+		return &cred
+	}
+	return nil
+}
+
+// parseDockerConfig reads the registry credentials from a docker config file,
+// such as the .dockerconfigjson key of a kubernetes.io/dockerconfigjson secret.
+// The registries are keyed by the host used to access them.
+func parseDockerConfig(data []byte) (map[string]RegistryCredential, error) {
+	type authConfig struct {
+		Auth          string `json:"auth"`
+		Username      string `json:"username"`
+		Password      string `json:"password"`
+		IdentityToken string `json:"identitytoken"`
+	}
+	var config struct {
+		Auths map[string]authConfig `json:"auths"`
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, errors.Wrap(err, "invalid docker config")
+	}
+	if config.Auths == nil {
+		// The legacy .dockercfg format only has the auths
+		if err := json.Unmarshal(data, &config.Auths); err != nil {
+			return nil, errors.Wrap(err, "invalid docker config")
+		}
+	}
+
+	creds := make(map[string]RegistryCredential, len(config.Auths))
+	for registry, auth := range config.Auths {
+		cred := RegistryCredential{Username: auth.Username, Password: auth.Password}
+		if auth.Auth != "" {
+			decoded, err := base64.StdEncoding.DecodeString(auth.Auth)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid auth for the registry %s in the docker config", registry)
+			}
+			cred.Username, cred.Password, _ = strings.Cut(string(decoded), ":")
+		}
+		if auth.IdentityToken != "" {
+			// Identity tokens are exchanged for a registry token like a password
+			cred.Username, cred.Password = "<token>", auth.IdentityToken
+		}
+		creds[getRegistryHost(registry)] = cred
+	}
+	return creds, nil
+}
+
+// getRegistryHost returns the host of a registry in a docker config, which may
+// be a URL such as https://index.docker.io/v1/, with the host used to access it.
+func getRegistryHost(registry string) string {
+	host := registry
+	if i := strings.Index(host, "://"); i >= 0 {
+		host = host[i+3:]
+	}
+	host, _, _ = strings.Cut(host, "/")
+	if host == "docker.io" || host == "index.docker.io" {
+		return "registry-1.docker.io"
+	}
+	return host
+}
+
+// parseRepository splits a repository, such as ghcr.io/getporter/porter-hello, into
+// the registry host and the repository name. Repositories without a registry are on Docker Hub.
+func parseRepository(repository string) (string, string, error) {
+	host, name := "docker.io", repository
+	if i := strings.Index(repository, "/"); i > 0 {
+		domain := repository[:i]
+		if strings.ContainsAny(domain, ".:") || domain == "localhost" {
+			host, name = domain, repository[i+1:]
+		}
+	}
+	if name == "" || strings.ContainsAny(name, ":@") {
+		return "", "", errors.Errorf("invalid repository %q, the repository should not include a tag or digest", repository)
+	}
+
+	if host == "docker.io" || host == "index.docker.io" {
+		host = "registry-1.docker.io"
+		if !strings.Contains(name, "/") {
+			name = "library/" + name
+		}
+	}
+	return host, name, nil
+}
+
+// parseChallenge parses a WWW-Authenticate header, such as
+// Bearer realm="https://auth.example.com/token",service="registry.example.com"
+func parseChallenge(challenge string) (string, map[string]string) {
+	scheme, rest, _ := strings.Cut(strings.TrimSpace(challenge), " ")
+	params := make(map[string]string)
+	for rest != "" {
+		var key, value string
+		key, rest, _ = strings.Cut(strings.TrimLeft(rest, " ,"), "=")
+		if strings.HasPrefix(rest, `"`) {
+			value, rest, _ = strings.Cut(rest[1:], `"`)
+		} else {
+			value, rest, _ = strings.Cut(rest, ",")
+		}
+		if key = strings.TrimSpace(key); key != "" {
+			params[strings.ToLower(key)] = value
+		}
+	}
+	return scheme, params
+}
+
+// getNextLink returns the next page of results from a Link header, such as
+// </v2/mybuns/tags/list?last=v1.0.0&n=100>; rel="next"
+func getNextLink(current *url.URL, link string) (*url.URL, error) {
+	if link == "" || !strings.Contains(link, `rel="next"`) {
+		return nil, nil
+	}
+	start, end := strings.Index(link, "<"), strings.Index(link, ">")
+	if start < 0 || end < start {
+		return nil, errors.Errorf("invalid Link header %q", link)
+	}
+	next, err := url.Parse(link[start+1 : end])
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid Link header %q", link)
+	}
+	return current.ResolveReference(next), nil
+}
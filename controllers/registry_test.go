@@ -0,0 +1,237 @@
+package controllers
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testRegistry is a stand-in for an OCI registry that serves the tags of a single repository,
+// requiring an anonymous bearer token like Docker Hub and GHCR.
+type testRegistry struct {
+	*httptest.Server
+
+	// Name of the repository served by the registry.
+	Name string
+
+	// Tags maps each tag to the digest of its manifest.
+	Tags map[string]string
+
+	// PageSize limits the number of tags returned per request.
+	PageSize int
+
+	// Credential is required to request a token when set, like a private repository.
+	Credential *RegistryCredential
+}
+
+func newTestRegistry(t *testing.T, name string, tags map[string]string) *testRegistry {
+	r := &testRegistry{Name: name, Tags: tags, PageSize: 2}
+
+	const token = "anonymous-token"
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, req *http.Request) {
+		if r.Credential != nil {
+			if username, password, _ := req.BasicAuth(); username != r.Credential.Username || password != r.Credential.Password {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+		}
+		if req.URL.Query().Get("scope") != fmt.Sprintf("repository:%s:pull", name) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"token": token})
+	})
+	mux.HandleFunc("/v2/", func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Authorization") != "Bearer "+token {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="testregistry",scope="repository:%s:pull"`, r.URL, name))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		path := strings.TrimPrefix(req.URL.Path, "/v2/")
+		switch {
+		case path == name+"/tags/list":
+			r.listTags(w, req)
+		case strings.HasPrefix(path, name+"/manifests/"):
+			digest, ok := r.Tags[strings.TrimPrefix(path, name+"/manifests/")]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Docker-Content-Digest", digest)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	r.Server = httptest.NewTLSServer(mux)
+	t.Cleanup(r.Close)
+	return r
+}
+
+// Repository returns the full repository name, including the registry host.
+func (r *testRegistry) Repository() string {
+	return strings.TrimPrefix(r.URL, "https://") + "/" + r.Name
+}
+
+func (r *testRegistry) listTags(w http.ResponseWriter, req *http.Request) {
+	tags := make([]string, 0, len(r.Tags))
+	for tag := range r.Tags {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+
+	// Page through the results like the distribution API
+	last := req.URL.Query().Get("last")
+	start := sort.SearchStrings(tags, last)
+	if last != "" && start < len(tags) && tags[start] == last {
+		start++
+	}
+	end := start + r.PageSize
+	if end < len(tags) {
+		w.Header().Set("Link", fmt.Sprintf(`</v2/%s/tags/list?last=%s&n=%d>; rel="next"`, r.Name, tags[end-1], r.PageSize))
+	} else {
+		end = len(tags)
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"name": r.Name, "tags": tags[start:end]})
+}
+
+func TestRegistryClient_ListTags(t *testing.T) {
+	reg := newTestRegistry(t, "getporter/mybuns", map[string]string{
+		"v1.0.0": "sha256:100", "v1.1.0": "sha256:110", "v1.2.0": "sha256:120", "latest": "sha256:120", "v2.0.0": "sha256:200",
+	})
+	c := NewRegistryClient(reg.Client())
+
+	tags, err := c.ListTags(context.Background(), reg.Repository(), RegistryOptions{})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"latest", "v1.0.0", "v1.1.0", "v1.2.0", "v2.0.0"}, tags, "all pages of tags should be returned")
+
+	_, err = c.ListTags(context.Background(), strings.TrimPrefix(reg.URL, "https://")+"/getporter/missing", RegistryOptions{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "404 Not Found")
+}
+
+func TestRegistryClient_GetDigest(t *testing.T) {
+	reg := newTestRegistry(t, "getporter/mybuns", map[string]string{"v1.0.0": "sha256:100"})
+	c := NewRegistryClient(reg.Client())
+
+	digest, err := c.GetDigest(context.Background(), reg.Repository(), "v1.0.0", RegistryOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "sha256:100", digest)
+
+	_, err = c.GetDigest(context.Background(), reg.Repository(), "v9.9.9", RegistryOptions{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "could not resolve the digest of")
+}
+
+func TestRegistryClient_PrivateRegistry(t *testing.T) {
+	reg := newTestRegistry(t, "getporter/mybuns", map[string]string{"v1.0.0": "sha256:100"})
+	reg.Credential = &RegistryCredential{Username: "porter", Password: "hunter2"}
+	c := NewRegistryClient(reg.Client())
+	host := strings.TrimPrefix(reg.URL, "https://")
+
+	_, err := c.GetDigest(context.Background(), reg.Repository(), "v1.0.0", RegistryOptions{})
+	require.Error(t, err, "a private registry should not be accessible anonymously")
+	assert.Contains(t, err.Error(), "could not request a registry token")
+
+	opts := RegistryOptions{Credentials: map[string]RegistryCredential{host: *reg.Credential}}
+	digest, err := c.GetDigest(context.Background(), reg.Repository(), "v1.0.0", opts)
+	require.NoError(t, err)
+	assert.Equal(t, "sha256:100", digest, "the token should be requested with the credential for the registry")
+}
+
+func TestRegistryClient_InsecureRegistry(t *testing.T) {
+	// A registry served over plain HTTP that uses basic authentication
+	cred := RegistryCredential{Username: "porter", Password: "hunter2"}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if username, password, _ := req.BasicAuth(); username != cred.Username || password != cred.Password {
+			w.Header().Set("WWW-Authenticate", `Basic realm="testregistry"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"name": "mybuns", "tags": []string{"v1.0.0"}})
+	}))
+	t.Cleanup(server.Close)
+	host := strings.TrimPrefix(server.URL, "http://")
+	c := NewRegistryClient(server.Client())
+
+	_, err := c.ListTags(context.Background(), host+"/mybuns", RegistryOptions{Credentials: map[string]RegistryCredential{host: cred}})
+	require.Error(t, err, "the registry should be accessed over HTTPS by default")
+
+	tags, err := c.ListTags(context.Background(), host+"/mybuns", RegistryOptions{Insecure: true, Credentials: map[string]RegistryCredential{host: cred}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"v1.0.0"}, tags)
+}
+
+func TestParseDockerConfig(t *testing.T) {
+	auth := base64.StdEncoding.EncodeToString([]byte("porter:hunter2"))
+	creds, err := parseDockerConfig([]byte(`{"auths": {
+		"https://index.docker.io/v1/": {"auth": "` + auth + `"},
+		"ghcr.io": {"username": "octocat", "password": "ghp_token"},
+		"myregistry.azurecr.io": {"identitytoken": "refresh-token"}
+	}}`))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]RegistryCredential{
+		"registry-1.docker.io":  {Username: "porter", Password: "hunter2"},
+		"ghcr.io":               {Username: "octocat", Password: "ghp_token"},
+		"myregistry.azurecr.io": {Username: "<token>", Password: "refresh-token"},
+	}, creds)
+
+	creds, err = parseDockerConfig([]byte(`{"localhost:5000": {"auth": "` + auth + `"}}`))
+	require.NoError(t, err, "the legacy .dockercfg format should be supported")
+	assert.Equal(t, map[string]RegistryCredential{"localhost:5000": {Username: "porter", Password: "hunter2"}}, creds)
+
+	_, err = parseDockerConfig([]byte(`oops`))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid docker config")
+}
+
+func TestParseRepository(t *testing.T) {
+	testcases := []struct {
+		repository string
+		wantHost   string
+		wantName   string
+		wantErr    string
+	}{
+		{repository: "ghcr.io/getporter/porter-hello", wantHost: "ghcr.io", wantName: "getporter/porter-hello"},
+		{repository: "localhost:5000/mybuns", wantHost: "localhost:5000", wantName: "mybuns"},
+		{repository: "localhost/mybuns", wantHost: "localhost", wantName: "mybuns"},
+		{repository: "getporter/porter-hello", wantHost: "registry-1.docker.io", wantName: "getporter/porter-hello"},
+		{repository: "docker.io/mybuns", wantHost: "registry-1.docker.io", wantName: "library/mybuns"},
+		{repository: "ghcr.io/getporter/porter-hello:v0.1.0", wantErr: "should not include a tag or digest"},
+		{repository: "", wantErr: "invalid repository"},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.repository, func(t *testing.T) {
+			host, name, err := parseRepository(tc.repository)
+			if tc.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantHost, host)
+			assert.Equal(t, tc.wantName, name)
+		})
+	}
+}
+
+func TestParseChallenge(t *testing.T) {
+	scheme, params := parseChallenge(`Bearer realm="https://auth.docker.io/token",service="registry.docker.io",scope="repository:getporter/mybuns:pull,push"`)
+	assert.Equal(t, "Bearer", scheme)
+	assert.Equal(t, map[string]string{
+		"realm":   "https://auth.docker.io/token",
+		"service": "registry.docker.io",
+		"scope":   "repository:getporter/mybuns:pull,push",
+	}, params)
+}
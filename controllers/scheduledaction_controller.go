@@ -0,0 +1,360 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	"github.com/robfig/cron/v3"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/clock"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	// ConditionScheduleReady is the condition type set on a ScheduledAction to indicate
+	// if its runs are being scheduled.
+	ConditionScheduleReady = "Ready"
+
+	// maxMissedSchedules is the number of missed schedules that are walked through
+	// before skipping ahead to the most recent one, the same limit as the CronJob controller.
+	maxMissedSchedules = 100
+)
+
+// ScheduledActionReconciler creates AgentActions for an Installation on a cron schedule.
+type ScheduledActionReconciler struct {
+	client.Client
+	Log      logr.Logger
+	Recorder record.EventRecorder
+	Scheme   *runtime.Scheme
+
+	// Clock is used to determine when runs are due. Defaults to the system clock.
+	Clock clock.PassiveClock
+}
+
+// +kubebuilder:rbac:groups=getporter.org,resources=scheduledactions,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=getporter.org,resources=scheduledactions/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=getporter.org,resources=scheduledactions/finalizers,verbs=update
+// +kubebuilder:rbac:groups=getporter.org,resources=installations,verbs=get;list;watch
+// +kubebuilder:rbac:groups=getporter.org,resources=agentactions,verbs=get;list;watch;create;update;patch;delete
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *ScheduledActionReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&porterv1.ScheduledAction{}, builder.WithPredicates(resourceChanged{})).
+		Owns(&porterv1.AgentAction{}).
+		Complete(r)
+}
+
+// Reconcile is called when the spec of a scheduled action is changed, when
+// one of its runs is updated, or when the next run is due.
+// Create an AgentAction for any run that is due, prune old runs and requeue for the next scheduled time.
+func (r *ScheduledActionReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := r.Log.WithValues("scheduledAction", req.Name, "namespace", req.Namespace)
+
+	sa := &porterv1.ScheduledAction{}
+	err := r.Get(ctx, req.NamespacedName, sa)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			log.V(Log5Trace).Info("Reconciliation skipped: ScheduledAction CRD or one of its owned resources was deleted.")
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+
+	if sa.DeletionTimestamp != nil {
+		log.V(Log4Debug).Info("Reconciliation complete: ScheduledAction CRD is ready for deletion.")
+		return ctrl.Result{}, nil
+	}
+
+	log = log.WithValues("resourceVersion", sa.ResourceVersion, "generation", sa.Generation, "observedGeneration", sa.Status.ObservedGeneration)
+	log.V(Log5Trace).Info("Reconciling scheduled action")
+
+	origStatus := sa.Status.DeepCopy()
+	sa.Status.ObservedGeneration = sa.Generation
+
+	sched, err := cron.ParseStandard(sa.Spec.Schedule)
+	if err != nil {
+		log.V(Log4Debug).Info("Reconciliation complete: The schedule is invalid.", "schedule", sa.Spec.Schedule, "error", err.Error())
+		r.Recorder.Event(sa, "Warning", "InvalidSchedule", fmt.Sprintf("unparseable schedule %q: %s", sa.Spec.Schedule, err))
+		setScheduleCondition(sa, metav1.ConditionFalse, "InvalidSchedule", err.Error())
+		sa.Status.NextScheduleTime = nil
+		return ctrl.Result{}, r.syncStatus(ctx, log, sa, origStatus)
+	}
+
+	active, err := r.syncRuns(ctx, log, sa)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	now := r.now()
+	missed, next, tooManyMissed := getNextScheduleTime(sa, now, sched)
+	if tooManyMissed {
+		log.V(Log4Debug).Info("Too many missed schedules, skipping to the most recent one.")
+		r.Recorder.Event(sa, "Warning", "TooManyMissedSchedules", fmt.Sprintf("more than %d scheduled runs were missed, only the most recent one is started. Set or decrease spec.startingDeadlineSeconds or check for clock skew", maxMissedSchedules))
+	}
+	if missed != nil {
+		log = log.WithValues("scheduledTime", missed.Format(time.RFC3339))
+		if err = r.runScheduledAction(ctx, log, sa, active, *missed, now); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	sa.Status.NextScheduleTime = &metav1.Time{Time: next}
+	if err = r.syncStatus(ctx, log, sa, origStatus); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	log.V(Log4Debug).Info("Reconciliation complete: Waiting for the next scheduled run.", "nextScheduleTime", next.Format(time.RFC3339))
+	return ctrl.Result{RequeueAfter: next.Sub(now)}, nil
+}
+
+func (r *ScheduledActionReconciler) now() time.Time {
+	if r.Clock == nil {
+		return time.Now()
+	}
+	return r.Clock.Now()
+}
+
+// syncRuns updates the status with the currently active runs, and prunes
+// completed runs that exceed the history limits. The active runs are returned.
+func (r *ScheduledActionReconciler) syncRuns(ctx context.Context, log logr.Logger, sa *porterv1.ScheduledAction) ([]porterv1.AgentAction, error) {
+	results := porterv1.AgentActionList{}
+	err := r.List(ctx, &results, client.InNamespace(sa.Namespace), client.MatchingLabels(getScheduledActionLabels(sa)))
+	if err != nil {
+		return nil, errors.Wrap(err, "could not query for the scheduled agent actions")
+	}
+
+	var active, successful, failed []porterv1.AgentAction
+	for _, action := range results.Items {
+		switch action.Status.Phase {
+		case porterv1.PhaseSucceeded:
+			successful = append(successful, action)
+		case porterv1.PhaseFailed:
+			failed = append(failed, action)
+		default:
+			active = append(active, action)
+		}
+	}
+
+	sa.Status.Active = nil
+	for _, action := range active {
+		sa.Status.Active = append(sa.Status.Active, corev1.LocalObjectReference{Name: action.Name})
+	}
+
+	for _, action := range successful {
+		cond := apimeta.FindStatusCondition(action.Status.Conditions, string(porterv1.ConditionComplete))
+		if cond == nil {
+			continue
+		}
+		if sa.Status.LastSuccessfulTime == nil || sa.Status.LastSuccessfulTime.Before(&cond.LastTransitionTime) {
+			sa.Status.LastSuccessfulTime = cond.LastTransitionTime.DeepCopy()
+		}
+	}
+
+	if err = r.pruneRuns(ctx, log, successful, sa.Spec.GetSuccessfulRunsHistoryLimit()); err != nil {
+		return nil, err
+	}
+	if err = r.pruneRuns(ctx, log, failed, sa.Spec.GetFailedRunsHistoryLimit()); err != nil {
+		return nil, err
+	}
+
+	return active, nil
+}
+
+// pruneRuns removes the oldest runs until only the specified number remain.
+func (r *ScheduledActionReconciler) pruneRuns(ctx context.Context, log logr.Logger, runs []porterv1.AgentAction, limit int32) error {
+	if int32(len(runs)) <= limit {
+		return nil
+	}
+
+	sort.Slice(runs, func(i, j int) bool {
+		return runs[i].CreationTimestamp.Before(&runs[j].CreationTimestamp)
+	})
+
+	for i := 0; i < len(runs)-int(limit); i++ {
+		log.V(Log4Debug).Info("Removing old scheduled run", "agentaction", runs[i].Name)
+		if err := r.Delete(ctx, &runs[i], client.PropagationPolicy(metav1.DeletePropagationBackground)); err != nil && !apierrors.IsNotFound(err) {
+			return errors.Wrapf(err, "error removing old scheduled run %s", runs[i].Name)
+		}
+	}
+	return nil
+}
+
+// runScheduledAction creates an AgentAction for the scheduled time, honoring the concurrency policy and starting deadline.
+func (r *ScheduledActionReconciler) runScheduledAction(ctx context.Context, log logr.Logger, sa *porterv1.ScheduledAction, active []porterv1.AgentAction, scheduledTime time.Time, now time.Time) error {
+	if sa.Spec.StartingDeadlineSeconds != nil {
+		deadline := scheduledTime.Add(time.Duration(*sa.Spec.StartingDeadlineSeconds) * time.Second)
+		if now.After(deadline) {
+			log.V(Log4Debug).Info("Skipping scheduled run because it missed its starting deadline")
+			r.Recorder.Event(sa, "Warning", "MissedSchedule", fmt.Sprintf("missed the scheduled run at %s", scheduledTime.Format(time.RFC3339)))
+			sa.Status.LastScheduleTime = &metav1.Time{Time: scheduledTime}
+			return nil
+		}
+	}
+
+	if len(active) > 0 {
+		switch sa.Spec.GetConcurrencyPolicy() {
+		case porterv1.ForbidConcurrent:
+			// Leave the last schedule time alone so that the run is picked up once the active run completes
+			log.V(Log4Debug).Info("Postponing scheduled run because a previous run is still active")
+			r.Recorder.Event(sa, "Normal", "RunAlreadyActive", "postponing the scheduled run because a previous run is still active")
+			return nil
+		case porterv1.ReplaceConcurrent:
+			for i := range active {
+				log.V(Log4Debug).Info("Replacing active scheduled run", "agentaction", active[i].Name)
+				if err := r.Delete(ctx, &active[i], client.PropagationPolicy(metav1.DeletePropagationBackground)); err != nil && !apierrors.IsNotFound(err) {
+					return errors.Wrapf(err, "error replacing the active scheduled run %s", active[i].Name)
+				}
+			}
+			sa.Status.Active = nil
+		}
+	}
+
+	inst := &porterv1.Installation{}
+	err := r.Get(ctx, types.NamespacedName{Namespace: sa.Namespace, Name: sa.Spec.Installation.Name}, inst)
+	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			return errors.Wrapf(err, "could not retrieve the installation %s", sa.Spec.Installation.Name)
+		}
+		log.V(Log4Debug).Info("Skipping scheduled run because the installation does not exist", "installation", sa.Spec.Installation.Name)
+		r.Recorder.Event(sa, "Warning", "InstallationNotFound", fmt.Sprintf("skipped the scheduled run because the installation %s was not found", sa.Spec.Installation.Name))
+		setScheduleCondition(sa, metav1.ConditionFalse, "InstallationNotFound", fmt.Sprintf("installation %s not found", sa.Spec.Installation.Name))
+		sa.Status.LastScheduleTime = &metav1.Time{Time: scheduledTime}
+		return nil
+	}
+
+	if isDeleted(inst) || inst.Spec.Uninstalled {
+		log.V(Log4Debug).Info("Skipping scheduled run because the installation is being removed", "installation", inst.Name)
+		r.Recorder.Event(sa, "Normal", "InstallationUninstalled", fmt.Sprintf("skipped the scheduled run because the installation %s is being uninstalled", inst.Name))
+		sa.Status.LastScheduleTime = &metav1.Time{Time: scheduledTime}
+		return nil
+	}
+
+	action, err := r.createAgentAction(ctx, log, sa, inst, scheduledTime)
+	if err != nil {
+		return err
+	}
+
+	setScheduleCondition(sa, metav1.ConditionTrue, "RunScheduled", fmt.Sprintf("created agent action %s", action.Name))
+	sa.Status.Active = append(sa.Status.Active, corev1.LocalObjectReference{Name: action.Name})
+	sa.Status.LastScheduleTime = &metav1.Time{Time: scheduledTime}
+	return nil
+}
+
+// create an AgentAction that runs the scheduled bundle action against the installation
+func (r *ScheduledActionReconciler) createAgentAction(ctx context.Context, log logr.Logger, sa *porterv1.ScheduledAction, inst *porterv1.Installation, scheduledTime time.Time) (*porterv1.AgentAction, error) {
+	log.V(Log5Trace).Info("Creating porter agent action")
+
+	labels := getScheduledActionLabels(sa)
+	for k, v := range sa.Labels {
+		labels[k] = v
+	}
+
+	agentCfg := inst.Spec.AgentConfig
+	if sa.Spec.AgentConfig != nil {
+		agentCfg = sa.Spec.AgentConfig
+	}
+
+	action := &porterv1.AgentAction{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:    sa.Namespace,
+			GenerateName: sa.Name + "-",
+			Labels:       labels,
+			Annotations: map[string]string{
+				porterv1.AnnotationScheduledTime: scheduledTime.Format(time.RFC3339),
+			},
+		},
+		Spec: porterv1.AgentActionSpec{
+			AgentConfig: agentCfg,
+			Args:        getBundleActionArgs(inst, sa.Spec.Action),
+		},
+	}
+	if err := controllerutil.SetControllerReference(sa, action, r.Scheme); err != nil {
+		return nil, err
+	}
+	if err := r.Create(ctx, action); err != nil {
+		return nil, errors.Wrap(err, "error creating the scheduled porter agent action")
+	}
+
+	r.Recorder.Event(sa, "Normal", "CreateAgentAction", fmt.Sprintf("created scheduled agent action %s for %s", action.Name, inst.Name))
+	log.V(Log4Debug).Info("Created porter agent action", "name", action.Name)
+	return action, nil
+}
+
+func (r *ScheduledActionReconciler) syncStatus(ctx context.Context, log logr.Logger, sa *porterv1.ScheduledAction, origStatus *porterv1.ScheduledActionStatus) error {
+	if reflect.DeepEqual(*origStatus, sa.Status) {
+		return nil
+	}
+
+	log.V(Log5Trace).Info("Patching scheduled action status")
+	return PatchStatusWithRetry(ctx, log, r.Client, r.Status().Patch, sa, func() client.Object {
+		return &porterv1.ScheduledAction{}
+	})
+}
+
+// getNextScheduleTime returns the most recent scheduled time that has not been run yet, if any, and the next scheduled time after now.
+// When more than maxMissedSchedules were missed, the remaining missed schedules are skipped and tooManyMissed is true.
+func getNextScheduleTime(sa *porterv1.ScheduledAction, now time.Time, sched cron.Schedule) (missed *time.Time, next time.Time, tooManyMissed bool) {
+	earliest := sa.CreationTimestamp.Time
+	if sa.Status.LastScheduleTime != nil {
+		earliest = sa.Status.LastScheduleTime.Time
+	}
+	if sa.Spec.StartingDeadlineSeconds != nil {
+		// Don't bother walking through schedules that could never be started
+		deadline := now.Add(-time.Duration(*sa.Spec.StartingDeadlineSeconds) * time.Second)
+		if deadline.After(earliest) {
+			earliest = deadline
+		}
+	}
+
+	t := sched.Next(earliest)
+	for count := 0; !t.After(now); count++ {
+		if count == maxMissedSchedules {
+			tooManyMissed = true
+			// Skip to the schedules just before now, estimating how often it runs from the last two missed schedules
+			if skip := now.Add(-2 * t.Sub(*missed)); skip.After(t) {
+				t = sched.Next(skip)
+				continue
+			}
+		}
+		scheduled := t
+		missed = &scheduled
+		t = sched.Next(t)
+	}
+
+	return missed, sched.Next(now), tooManyMissed
+}
+
+// Build the set of labels used to identify the AgentActions created by a ScheduledAction.
+func getScheduledActionLabels(sa *porterv1.ScheduledAction) map[string]string {
+	return map[string]string{
+		porterv1.LabelManaged:      "true",
+		porterv1.LabelResourceKind: porterv1.KindScheduledAction,
+		porterv1.LabelResourceName: sa.Name,
+	}
+}
+
+func setScheduleCondition(sa *porterv1.ScheduledAction, status metav1.ConditionStatus, reason string, message string) {
+	apimeta.SetStatusCondition(&sa.Status.Conditions, metav1.Condition{
+		Type:               ConditionScheduleReady,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: sa.Generation,
+	})
+}
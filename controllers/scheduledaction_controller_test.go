@@ -0,0 +1,322 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+	"github.com/go-logr/logr"
+	"github.com/robfig/cron/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	clocktesting "k8s.io/utils/clock/testing"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestScheduledActionReconciler_Reconcile(t *testing.T) {
+	ctx := context.Background()
+
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	inst := &porterv1.Installation{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "mybuns"},
+		Spec: porterv1.InstallationSpec{
+			Name:        "mybuns",
+			Namespace:   "dev",
+			AgentConfig: &corev1.LocalObjectReference{Name: "myagent"},
+		},
+	}
+	sa := &porterv1.ScheduledAction{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "nightly-backup", Generation: 1, CreationTimestamp: metav1.NewTime(created)},
+		Spec: porterv1.ScheduledActionSpec{
+			Installation: corev1.LocalObjectReference{Name: "mybuns"},
+			Action:       "backup",
+			Schedule:     "0 2 * * *",
+		},
+	}
+	clock := clocktesting.NewFakePassiveClock(created.Add(time.Hour))
+	controller := setupScheduledActionController(clock, inst, sa)
+
+	triggerReconcile := func() ctrl.Result {
+		result, err := controller.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "test", Name: "nightly-backup"}})
+		require.NoError(t, err)
+		require.NoError(t, controller.Get(ctx, client.ObjectKeyFromObject(sa), sa))
+		return result
+	}
+
+	// Nothing is due yet, wait until the next scheduled time
+	result := triggerReconcile()
+	assert.Equal(t, time.Hour, result.RequeueAfter)
+	require.NotNil(t, sa.Status.NextScheduleTime)
+	assert.Equal(t, created.Add(2*time.Hour), sa.Status.NextScheduleTime.UTC())
+	assert.Nil(t, sa.Status.LastScheduleTime)
+	actions := listScheduledRuns(t, controller, sa)
+	assert.Empty(t, actions)
+
+	// The run is due, an agent action should be created
+	clock.SetTime(created.Add(2*time.Hour + time.Minute))
+	result = triggerReconcile()
+	assert.Equal(t, 24*time.Hour-time.Minute, result.RequeueAfter)
+	require.NotNil(t, sa.Status.LastScheduleTime)
+	assert.Equal(t, created.Add(2*time.Hour), sa.Status.LastScheduleTime.UTC())
+	actions = listScheduledRuns(t, controller, sa)
+	require.Len(t, actions, 1)
+	action := actions[0]
+	assert.Equal(t, []string{"invoke", "mybuns", "--action", "backup", "--namespace", "dev"}, action.Spec.Args)
+	assert.Equal(t, "myagent", action.Spec.AgentConfig.Name, "the agent config should be inherited from the installation")
+	assert.Equal(t, created.Add(2*time.Hour).Format(time.RFC3339), action.Annotations[porterv1.AnnotationScheduledTime])
+	require.Len(t, action.OwnerReferences, 1)
+	assert.Equal(t, "nightly-backup", action.OwnerReferences[0].Name)
+	require.Len(t, sa.Status.Active, 1)
+	assert.Equal(t, action.Name, sa.Status.Active[0].Name)
+	assert.True(t, apimeta.IsStatusConditionTrue(sa.Status.Conditions, ConditionScheduleReady))
+
+	// Reconciling again before the next run should not create another action
+	triggerReconcile()
+	assert.Len(t, listScheduledRuns(t, controller, sa), 1)
+
+	// The previous run is still active, the next run should be postponed
+	clock.SetTime(created.Add(26*time.Hour + time.Minute))
+	triggerReconcile()
+	assert.Len(t, listScheduledRuns(t, controller, sa), 1)
+	assert.Equal(t, created.Add(2*time.Hour), sa.Status.LastScheduleTime.UTC(), "the postponed run should not update the last schedule time")
+
+	// Once the previous run completes, the postponed run is created
+	action.Status.Phase = porterv1.PhaseSucceeded
+	apimeta.SetStatusCondition(&action.Status.Conditions, metav1.Condition{Type: string(porterv1.ConditionComplete), Status: metav1.ConditionTrue, Reason: "JobCompleted"})
+	require.NoError(t, controller.Status().Update(ctx, &action))
+	triggerReconcile()
+	assert.Len(t, listScheduledRuns(t, controller, sa), 2)
+	assert.Equal(t, created.Add(26*time.Hour), sa.Status.LastScheduleTime.UTC())
+	assert.NotNil(t, sa.Status.LastSuccessfulTime)
+}
+
+func TestScheduledActionReconciler_Reconcile_InvalidSchedule(t *testing.T) {
+	ctx := context.Background()
+
+	sa := &porterv1.ScheduledAction{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "nightly-backup", Generation: 1},
+		Spec: porterv1.ScheduledActionSpec{
+			Installation: corev1.LocalObjectReference{Name: "mybuns"},
+			Action:       "backup",
+			Schedule:     "every night",
+		},
+	}
+	controller := setupScheduledActionController(clocktesting.NewFakePassiveClock(time.Now()), sa)
+
+	result, err := controller.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "test", Name: "nightly-backup"}})
+	require.NoError(t, err)
+	assert.True(t, result.IsZero(), "an invalid schedule should not be requeued")
+
+	require.NoError(t, controller.Get(ctx, client.ObjectKeyFromObject(sa), sa))
+	cond := apimeta.FindStatusCondition(sa.Status.Conditions, ConditionScheduleReady)
+	require.NotNil(t, cond)
+	assert.Equal(t, metav1.ConditionFalse, cond.Status)
+	assert.Equal(t, "InvalidSchedule", cond.Reason)
+	assert.Nil(t, sa.Status.NextScheduleTime)
+}
+
+func TestScheduledActionReconciler_Reconcile_TooManyMissed(t *testing.T) {
+	ctx := context.Background()
+
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	inst := &porterv1.Installation{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "mybuns"},
+		Spec:       porterv1.InstallationSpec{Name: "mybuns", Namespace: "dev"},
+	}
+	sa := &porterv1.ScheduledAction{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "hourly-backup", Generation: 1, CreationTimestamp: metav1.NewTime(created)},
+		Spec: porterv1.ScheduledActionSpec{
+			Installation: corev1.LocalObjectReference{Name: "mybuns"},
+			Action:       "backup",
+			Schedule:     "0 * * * *",
+		},
+	}
+	controller := setupScheduledActionController(clocktesting.NewFakePassiveClock(created.Add(30*24*time.Hour+time.Minute)), inst, sa)
+
+	_, err := controller.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "test", Name: "hourly-backup"}})
+	require.NoError(t, err)
+
+	require.NoError(t, controller.Get(ctx, client.ObjectKeyFromObject(sa), sa))
+	require.NotNil(t, sa.Status.LastScheduleTime)
+	assert.Equal(t, created.Add(30*24*time.Hour), sa.Status.LastScheduleTime.UTC(), "only the most recent missed run should be started")
+	assert.Len(t, listScheduledRuns(t, controller, sa), 1)
+
+	events := drainEvents(controller.Recorder.(*record.FakeRecorder))
+	assert.Contains(t, events, "Warning TooManyMissedSchedules more than 100 scheduled runs were missed, only the most recent one is started. Set or decrease spec.startingDeadlineSeconds or check for clock skew")
+}
+
+func TestScheduledActionReconciler_Reconcile_ReplaceConcurrent(t *testing.T) {
+	ctx := context.Background()
+
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	inst := &porterv1.Installation{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "mybuns"},
+		Spec:       porterv1.InstallationSpec{Name: "mybuns", Namespace: "dev"},
+	}
+	sa := &porterv1.ScheduledAction{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "upgrade", Generation: 1, CreationTimestamp: metav1.NewTime(created)},
+		Spec: porterv1.ScheduledActionSpec{
+			AgentConfig:       &corev1.LocalObjectReference{Name: "override"},
+			Installation:      corev1.LocalObjectReference{Name: "mybuns"},
+			Action:            "upgrade",
+			Schedule:          "@hourly",
+			ConcurrencyPolicy: porterv1.ReplaceConcurrent,
+		},
+	}
+	clock := clocktesting.NewFakePassiveClock(created.Add(time.Hour))
+	controller := setupScheduledActionController(clock, inst, sa)
+
+	triggerReconcile := func() {
+		_, err := controller.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "test", Name: "upgrade"}})
+		require.NoError(t, err)
+		require.NoError(t, controller.Get(ctx, client.ObjectKeyFromObject(sa), sa))
+	}
+
+	triggerReconcile()
+	actions := listScheduledRuns(t, controller, sa)
+	require.Len(t, actions, 1)
+	first := actions[0]
+	assert.Equal(t, []string{"upgrade", "mybuns", "--namespace", "dev"}, first.Spec.Args)
+	assert.Equal(t, "override", first.Spec.AgentConfig.Name)
+
+	clock.SetTime(created.Add(2 * time.Hour))
+	triggerReconcile()
+	actions = listScheduledRuns(t, controller, sa)
+	require.Len(t, actions, 1, "the active run should have been replaced")
+	assert.NotEqual(t, first.Name, actions[0].Name)
+}
+
+func TestScheduledActionReconciler_Reconcile_PrunesHistory(t *testing.T) {
+	ctx := context.Background()
+
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	sa := &porterv1.ScheduledAction{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "upgrade", Generation: 1, CreationTimestamp: metav1.NewTime(created)},
+		Spec: porterv1.ScheduledActionSpec{
+			Installation:               corev1.LocalObjectReference{Name: "mybuns"},
+			Action:                     "upgrade",
+			Schedule:                   "@yearly",
+			SuccessfulRunsHistoryLimit: ptr.To(int32(1)),
+			FailedRunsHistoryLimit:     ptr.To(int32(0)),
+		},
+		Status: porterv1.ScheduledActionStatus{LastScheduleTime: &metav1.Time{Time: created}},
+	}
+	run := func(name string, age time.Duration, phase porterv1.AgentPhase) *porterv1.AgentAction {
+		return &porterv1.AgentAction{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:         "test",
+				Name:              name,
+				CreationTimestamp: metav1.NewTime(created.Add(-age)),
+				Labels:            getScheduledActionLabels(sa),
+			},
+			Status: porterv1.AgentActionStatus{Phase: phase},
+		}
+	}
+	controller := setupScheduledActionController(clocktesting.NewFakePassiveClock(created.Add(time.Hour)), sa,
+		run("old-success", 3*time.Hour, porterv1.PhaseSucceeded),
+		run("new-success", time.Hour, porterv1.PhaseSucceeded),
+		run("failed", 2*time.Hour, porterv1.PhaseFailed),
+		run("running", 0, porterv1.PhaseRunning),
+	)
+
+	_, err := controller.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "test", Name: "upgrade"}})
+	require.NoError(t, err)
+
+	var names []string
+	for _, action := range listScheduledRuns(t, controller, sa) {
+		names = append(names, action.Name)
+	}
+	assert.ElementsMatch(t, []string{"new-success", "running"}, names)
+}
+
+func TestGetNextScheduleTime(t *testing.T) {
+	sched, err := cron.ParseStandard("*/15 * * * *")
+	require.NoError(t, err)
+
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := created.Add(time.Hour + 5*time.Minute)
+
+	t.Run("never run", func(t *testing.T) {
+		sa := &porterv1.ScheduledAction{ObjectMeta: metav1.ObjectMeta{CreationTimestamp: metav1.NewTime(created)}}
+		missed, next, tooManyMissed := getNextScheduleTime(sa, now, sched)
+		require.NotNil(t, missed)
+		assert.Equal(t, created.Add(time.Hour), *missed, "only the most recent missed run should be returned")
+		assert.Equal(t, created.Add(time.Hour+15*time.Minute), next)
+		assert.False(t, tooManyMissed)
+	})
+
+	t.Run("up to date", func(t *testing.T) {
+		sa := &porterv1.ScheduledAction{
+			ObjectMeta: metav1.ObjectMeta{CreationTimestamp: metav1.NewTime(created)},
+			Status:     porterv1.ScheduledActionStatus{LastScheduleTime: &metav1.Time{Time: created.Add(time.Hour)}},
+		}
+		missed, next, tooManyMissed := getNextScheduleTime(sa, now, sched)
+		assert.Nil(t, missed)
+		assert.Equal(t, created.Add(time.Hour+15*time.Minute), next)
+		assert.False(t, tooManyMissed)
+	})
+
+	t.Run("starting deadline", func(t *testing.T) {
+		sa := &porterv1.ScheduledAction{
+			ObjectMeta: metav1.ObjectMeta{CreationTimestamp: metav1.NewTime(created)},
+			Spec:       porterv1.ScheduledActionSpec{StartingDeadlineSeconds: ptr.To(int64(60))},
+		}
+		missed, _, _ := getNextScheduleTime(sa, now, sched)
+		assert.Nil(t, missed, "runs that missed the starting deadline should not be returned")
+	})
+
+	t.Run("too many missed", func(t *testing.T) {
+		sa := &porterv1.ScheduledAction{ObjectMeta: metav1.ObjectMeta{CreationTimestamp: metav1.NewTime(created)}}
+		now := created.Add(365*24*time.Hour + 5*time.Minute)
+		missed, next, tooManyMissed := getNextScheduleTime(sa, now, sched)
+		require.NotNil(t, missed)
+		assert.Equal(t, created.Add(365*24*time.Hour), *missed, "the most recent missed run should be returned")
+		assert.Equal(t, created.Add(365*24*time.Hour+15*time.Minute), next)
+		assert.True(t, tooManyMissed)
+	})
+}
+
+func TestGetBundleActionArgs(t *testing.T) {
+	inst := &porterv1.Installation{Spec: porterv1.InstallationSpec{Name: "mybuns", Namespace: "dev"}}
+
+	assert.Equal(t, []string{"upgrade", "mybuns", "--namespace", "dev"}, getBundleActionArgs(inst, "upgrade"))
+	assert.Equal(t, []string{"invoke", "mybuns", "--action", "backup", "--namespace", "dev"}, getBundleActionArgs(inst, "backup"))
+}
+
+func listScheduledRuns(t *testing.T, controller *ScheduledActionReconciler, sa *porterv1.ScheduledAction) []porterv1.AgentAction {
+	var actions porterv1.AgentActionList
+	err := controller.List(context.Background(), &actions, client.InNamespace(sa.Namespace), client.MatchingLabels(getScheduledActionLabels(sa)))
+	require.NoError(t, err)
+	return actions.Items
+}
+
+func setupScheduledActionController(clock *clocktesting.FakePassiveClock, objs ...client.Object) *ScheduledActionReconciler {
+	scheme := runtime.NewScheme()
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(porterv1.AddToScheme(scheme))
+
+	fakeBuilder := fake.NewClientBuilder()
+	fakeBuilder.WithScheme(scheme)
+	fakeBuilder.WithObjects(objs...).WithStatusSubresource(objs...).WithStatusSubresource(&porterv1.AgentAction{})
+	fakeClient := fakeBuilder.Build()
+
+	return &ScheduledActionReconciler{
+		Log:      logr.Discard(),
+		Client:   fakeClient,
+		Recorder: record.NewFakeRecorder(42),
+		Scheme:   scheme,
+		Clock:    clock,
+	}
+}
@@ -0,0 +1,106 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	v1 "get.porter.sh/operator/api/v1"
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// storeSensitiveOutputs moves the values of sensitive outputs into a Secret that
+// is owned by the InstallationOutput, and redacts them in its status. It returns
+// true when the status was changed, and must be saved.
+func (r *InstallationReconciler) storeSensitiveOutputs(ctx context.Context, outputs *v1.InstallationOutput) (bool, error) {
+	values := make(map[string][]byte)
+	for _, output := range outputs.Status.Outputs {
+		if isSensitiveOutputUnredacted(output) {
+			values[output.Name] = []byte(output.Value)
+		}
+	}
+	if len(values) == 0 {
+		return false, nil
+	}
+
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: outputs.Namespace, Name: outputs.GetSensitiveOutputsSecretName()}}
+	_, err := controllerutil.CreateOrUpdate(ctx, r.Client, secret, func() error {
+		if secret.ResourceVersion != "" && !metav1.IsControlledBy(secret, outputs) {
+			return errors.Errorf("the Secret %s already exists and is not owned by the InstallationOutput", secret.Name)
+		}
+		secret.Labels = map[string]string{
+			v1.LabelManaged:      "true",
+			v1.LabelResourceKind: "InstallationOutput",
+			v1.LabelResourceName: outputs.Name,
+		}
+		secret.Type = corev1.SecretTypeOpaque
+		if secret.Data == nil {
+			secret.Data = make(map[string][]byte, len(values))
+		}
+		for key, value := range values {
+			secret.Data[key] = value
+		}
+		return controllerutil.SetControllerReference(outputs, secret, r.Scheme)
+	})
+	if err != nil {
+		return false, errors.Wrapf(err, "error storing the sensitive outputs of %s", outputs.Name)
+	}
+
+	for i, output := range outputs.Status.Outputs {
+		if isSensitiveOutputUnredacted(output) {
+			outputs.Status.Outputs[i].Value = v1.RedactedValue
+			outputs.Status.Outputs[i].SecretKeyRef = &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: secret.Name},
+				Key:                  output.Name,
+			}
+		}
+	}
+	return true, nil
+}
+
+// migrateSensitiveOutputs redacts the sensitive outputs of an InstallationOutput
+// that was created before their values were stored in a Secret.
+func (r *InstallationReconciler) migrateSensitiveOutputs(ctx context.Context, log logr.Logger, outputs *v1.InstallationOutput) error {
+	changed, err := r.storeSensitiveOutputs(ctx, outputs)
+	if err != nil || !changed {
+		return err
+	}
+
+	log.V(Log4Debug).Info("Moved the sensitive outputs into a Secret", "secret", outputs.GetSensitiveOutputsSecretName())
+	if err = r.Status().Update(ctx, outputs); err != nil {
+		return errors.Wrapf(err, "error redacting the sensitive outputs of %s", outputs.Name)
+	}
+	r.Recorder.Event(outputs, "Normal", "SensitiveOutputsRedacted", fmt.Sprintf("moved the sensitive outputs to the Secret %s", outputs.GetSensitiveOutputsSecretName()))
+	return nil
+}
+
+// resolveOutputValue returns the value of an output, and reads the value of a
+// sensitive output from its Secret. It returns false when the value is not
+// available.
+func (r *InstallationReconciler) resolveOutputValue(ctx context.Context, namespace string, output v1.Output) (string, bool, error) {
+	ref := output.SecretKeyRef
+	if ref == nil {
+		return output.Value, true, nil
+	}
+
+	var secret corev1.Secret
+	err := r.Get(ctx, types.NamespacedName{Namespace: namespace, Name: ref.Name}, &secret)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return "", false, nil
+		}
+		return "", false, errors.Wrapf(err, "could not retrieve the value of the output %s", output.Name)
+	}
+
+	value, ok := secret.Data[ref.Key]
+	return string(value), ok, nil
+}
+
+func isSensitiveOutputUnredacted(output v1.Output) bool {
+	return output.Sensitive && output.SecretKeyRef == nil
+}
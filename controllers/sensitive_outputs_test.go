@@ -0,0 +1,76 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	v1 "get.porter.sh/operator/api/v1"
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestInstallationReconciler_CheckOrCreateInstallationOutputsCR_MigrateSensitiveOutputs(t *testing.T) {
+	ctx := context.Background()
+	inst := testOutputSourceInstallation()
+	outputs := testInstallationOutput("mysql://db")
+	outputs.UID = "outputs-uid"
+	mysql := testOutputSyncInstallation()
+	controller := setupInstallationController(inst, mysql, outputs)
+	recorder := controller.Recorder.(*record.FakeRecorder)
+
+	_, err := controller.CheckOrCreateInstallationOutputsCR(ctx, logr.Discard(), mysql)
+	require.NoError(t, err)
+
+	var secret corev1.Secret
+	require.NoError(t, controller.Get(ctx, client.ObjectKey{Namespace: "test", Name: "mysql-sensitive-outputs"}, &secret))
+	assert.Equal(t, map[string][]byte{"connstr": []byte("mysql://db")}, secret.Data, "only sensitive outputs should be stored in the Secret")
+	assert.True(t, metav1.IsControlledBy(&secret, outputs), "the Secret should be owned by the InstallationOutput")
+
+	require.NoError(t, controller.Get(ctx, client.ObjectKeyFromObject(outputs), outputs))
+	wantOutputs := []v1.Output{
+		{Name: "connstr", Type: "string", Sensitive: true, Value: v1.RedactedValue,
+			SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "mysql-sensitive-outputs"}, Key: "connstr"}},
+		{Name: "port", Type: "integer", Value: "3306"},
+	}
+	assert.Equal(t, wantOutputs, outputs.Status.Outputs, "sensitive outputs should be redacted in the status")
+	assert.Contains(t, drainEvents(recorder), "Normal SensitiveOutputsRedacted moved the sensitive outputs to the Secret mysql-sensitive-outputs")
+
+	// Outputs that were already migrated are left alone
+	_, err = controller.CheckOrCreateInstallationOutputsCR(ctx, logr.Discard(), mysql)
+	require.NoError(t, err)
+	assert.Empty(t, drainEvents(recorder))
+
+	// Sensitive outputs are passed by reference to the Secret
+	resolved, err := controller.resolveParameters(ctx, inst)
+	require.NoError(t, err)
+	assert.Empty(t, resolved.Pending)
+	assert.JSONEq(t, `{"port":3306,"region":"westus"}`, string(resolved.Parameters.Raw))
+	assert.Equal(t, []v1.Parameter{{Name: "connstr", Source: v1.ParameterSource{Secret: "mysql-sensitive-outputs/connstr"}}}, resolved.Sensitive)
+
+	require.NoError(t, controller.syncOutputs(ctx, logr.Discard(), mysql))
+	var synced corev1.Secret
+	require.NoError(t, controller.Get(ctx, client.ObjectKey{Namespace: "test", Name: "mysql-outputs"}, &synced))
+	assert.Equal(t, []byte("mysql://db"), synced.Data["DATABASE_URL"])
+
+	// Sensitive outputs are not available without their Secret
+	require.NoError(t, controller.Delete(ctx, &secret))
+	resolved, err = controller.resolveParameters(ctx, inst)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"mysql/connstr"}, resolved.Pending)
+}
+
+func TestInstallationReconciler_storeSensitiveOutputs_NotOwned(t *testing.T) {
+	ctx := context.Background()
+	outputs := testInstallationOutput("mysql://db")
+	existing := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "mysql-sensitive-outputs"}}
+	controller := setupInstallationController(outputs, existing)
+
+	_, err := controller.storeSensitiveOutputs(ctx, outputs)
+	require.ErrorContains(t, err, "the Secret mysql-sensitive-outputs already exists and is not owned by the InstallationOutput")
+	assert.Equal(t, "mysql://db", outputs.Status.Outputs[0].Value, "the output should not be redacted when its value was not stored")
+}
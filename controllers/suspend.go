@@ -0,0 +1,159 @@
+package controllers
+
+import (
+	"context"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	// suspendedBySpec is the message on the Suspended condition when the resource is suspended.
+	suspendedBySpec = "reconciliation is suspended by spec.suspend"
+
+	// suspendedByAgentConfig is the message on the Suspended condition when the AgentConfig is suspended.
+	suspendedByAgentConfig = "reconciliation is suspended by the AgentConfig"
+)
+
+// isSuspended determines if reconciling a resource is suspended, either on the
+// resource itself or by the AgentConfig that applies to it, and returns a message
+// explaining why.
+func isSuspended(ctx context.Context, log logr.Logger, clnt client.Client, namespace string, suspend bool, agentCfgRef *corev1.LocalObjectReference) (bool, string, error) {
+	if suspend {
+		return true, suspendedBySpec, nil
+	}
+
+	agentCfg, err := resolveAgentConfigSpec(ctx, log, clnt, namespace, agentCfgRef)
+	if err != nil {
+		return false, "", err
+	}
+	if porterv1.NewAgentConfigSpecAdapter(agentCfg.Spec).IsSuspended() {
+		return true, suspendedByAgentConfig, nil
+	}
+	return false, "", nil
+}
+
+// checkSuspended records on the Suspended condition whether reconciling the
+// resource is suspended, and saves the status when it changes.
+// Returns true when the resource is suspended and should not be reconciled.
+func checkSuspended(ctx context.Context, log logr.Logger, clnt client.Client, recorder record.EventRecorder, resource PorterResource, suspend bool, agentCfgRef *corev1.LocalObjectReference) (bool, error) {
+	suspended, message, err := isSuspended(ctx, log, clnt, resource.GetNamespace(), suspend, agentCfgRef)
+	if err != nil {
+		return false, err
+	}
+
+	status := resource.GetStatus()
+	if !applySuspended(recorder, resource, &status.Conditions, suspended, message) {
+		return suspended, nil
+	}
+	resource.SetStatus(status)
+
+	log.V(Log4Debug).Info("Saving the Suspended condition", "suspended", suspended)
+	err = PatchStatusWithRetry(ctx, log, clnt, clnt.Status().Patch, resource, func() client.Object {
+		return resource.DeepCopyObject().(client.Object)
+	})
+	return suspended, errors.Wrap(err, "error saving the Suspended condition")
+}
+
+// applySuspended sets the Suspended condition, and emits an event when the
+// resource is suspended or resumed. The condition is only added to resources
+// that have been suspended. Returns whether the condition changed.
+func applySuspended(recorder record.EventRecorder, obj client.Object, conditions *[]metav1.Condition, suspended bool, message string) bool {
+	wasSuspended := apimeta.IsStatusConditionTrue(*conditions, porterv1.ConditionSuspended)
+
+	cond := metav1.Condition{
+		Type:               porterv1.ConditionSuspended,
+		Status:             metav1.ConditionTrue,
+		Reason:             "Suspended",
+		Message:            message,
+		ObservedGeneration: obj.GetGeneration(),
+	}
+	if !suspended {
+		if !wasSuspended {
+			return false
+		}
+		cond.Status = metav1.ConditionFalse
+		cond.Reason = "Resumed"
+		cond.Message = "reconciliation has resumed"
+	}
+
+	if !apimeta.SetStatusCondition(conditions, cond) {
+		return false
+	}
+
+	if suspended && !wasSuspended {
+		recorder.Event(obj, "Normal", "Suspended", message)
+	} else if !suspended {
+		recorder.Event(obj, "Normal", "Resumed", "reconciliation has resumed, changes made while suspended will be applied")
+	}
+	return true
+}
+
+// agentConfigSuspendChanged is a predicate that only triggers when an AgentConfig
+// is suspended or resumed.
+type agentConfigSuspendChanged struct {
+	predicate.Funcs
+}
+
+func (agentConfigSuspendChanged) Create(e event.CreateEvent) bool {
+	return isAgentConfigSuspended(e.Object)
+}
+
+func (agentConfigSuspendChanged) Delete(e event.DeleteEvent) bool {
+	return isAgentConfigSuspended(e.Object)
+}
+
+func (agentConfigSuspendChanged) Update(e event.UpdateEvent) bool {
+	return isAgentConfigSuspended(e.ObjectOld) != isAgentConfigSuspended(e.ObjectNew)
+}
+
+func (agentConfigSuspendChanged) Generic(event.GenericEvent) bool {
+	return false
+}
+
+func isAgentConfigSuspended(obj client.Object) bool {
+	agentCfg, ok := obj.(*porterv1.AgentConfig)
+	return ok && agentCfg.Spec.Suspend
+}
+
+// requestsForAgentConfig returns a function that requeues the resources that
+// may use an AgentConfig, so that they are suspended or resumed with it.
+// The AgentConfig in the operator namespace applies to the resources in every namespace.
+func requestsForAgentConfig(clnt client.Client, newList func() client.ObjectList) handler.MapFunc {
+	return func(ctx context.Context, obj client.Object) []reconcile.Request {
+		var opts []client.ListOption
+		if obj.GetNamespace() != operatorNamespace {
+			opts = append(opts, client.InNamespace(obj.GetNamespace()))
+		}
+
+		list := newList()
+		if err := clnt.List(ctx, list, opts...); err != nil {
+			return nil
+		}
+
+		items, err := apimeta.ExtractList(list)
+		if err != nil {
+			return nil
+		}
+
+		requests := make([]reconcile.Request, 0, len(items))
+		for _, item := range items {
+			itemObj, ok := item.(client.Object)
+			if !ok {
+				continue
+			}
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(itemObj)})
+		}
+		return requests
+	}
+}
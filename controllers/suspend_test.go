@@ -0,0 +1,209 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	batchv1 "k8s.io/api/batch/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+func TestInstallationReconciler_Reconcile_Suspended(t *testing.T) {
+	ctx := context.Background()
+	inst := &porterv1.Installation{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "mysql", Generation: 1},
+		Spec:       porterv1.InstallationSpec{Namespace: "dev", Name: "mysql", Suspend: true},
+	}
+	controller := setupInstallationController(inst)
+
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "test", Name: "mysql"}}
+	result, err := controller.Reconcile(ctx, req)
+	require.NoError(t, err)
+	assert.True(t, result.IsZero())
+
+	var saved porterv1.Installation
+	require.NoError(t, controller.Get(ctx, req.NamespacedName, &saved))
+	assert.Empty(t, saved.Finalizers, "a suspended installation should not be modified")
+	suspended := apimeta.FindStatusCondition(saved.Status.Conditions, porterv1.ConditionSuspended)
+	require.NotNil(t, suspended, "expected the Suspended condition")
+	assert.Equal(t, metav1.ConditionTrue, suspended.Status)
+	assert.Equal(t, suspendedBySpec, suspended.Message)
+
+	var actions porterv1.AgentActionList
+	require.NoError(t, controller.List(ctx, &actions))
+	assert.Empty(t, actions.Items, "no agent action should be created while the installation is suspended")
+
+	recorder := controller.Recorder.(*record.FakeRecorder)
+	require.Len(t, recorder.Events, 1)
+	assert.Equal(t, "Normal Suspended "+suspendedBySpec, <-recorder.Events)
+
+	// Reconciling again does not repeat the event
+	_, err = controller.Reconcile(ctx, req)
+	require.NoError(t, err)
+	assert.Empty(t, recorder.Events)
+}
+
+func TestCredentialSetReconciler_Reconcile_SuspendedNamespace(t *testing.T) {
+	ctx := context.Background()
+	cs := &porterv1.CredentialSet{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "mycreds", Generation: 1},
+	}
+	nsCfg := &porterv1.AgentConfig{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "default"},
+		Spec:       porterv1.AgentConfigSpec{Suspend: true},
+	}
+	controller := setupCredentialSetController(cs, nsCfg)
+
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "test", Name: "mycreds"}}
+	reconcile := func() {
+		_, err := controller.Reconcile(ctx, req)
+		require.NoError(t, err)
+		require.NoError(t, controller.Get(ctx, req.NamespacedName, cs))
+	}
+	reconcile()
+
+	assert.True(t, apimeta.IsStatusConditionTrue(cs.Status.Conditions, porterv1.ConditionSuspended))
+	assert.Equal(t, suspendedByAgentConfig, apimeta.FindStatusCondition(cs.Status.Conditions, porterv1.ConditionSuspended).Message)
+	assert.Empty(t, cs.Finalizers, "a suspended credential set should not be modified")
+
+	// Change the credential set while it is suspended
+	cs.Generation = 2
+	require.NoError(t, controller.Update(ctx, cs))
+	reconcile()
+	assert.Nil(t, cs.Status.Action, "no agent action should be created while the namespace is suspended")
+
+	// Resume the namespace
+	nsCfg.Spec.Suspend = false
+	require.NoError(t, controller.Update(ctx, nsCfg))
+	reconcile() // sets the finalizer
+
+	suspended := apimeta.FindStatusCondition(cs.Status.Conditions, porterv1.ConditionSuspended)
+	require.NotNil(t, suspended, "expected the Suspended condition to be updated when it is resumed")
+	assert.Equal(t, metav1.ConditionFalse, suspended.Status)
+	assert.Equal(t, "Resumed", suspended.Reason)
+
+	reconcile() // applies the queued change
+
+	require.NotNil(t, cs.Status.Action, "the change made while suspended should be applied")
+	var action porterv1.AgentAction
+	require.NoError(t, controller.Get(ctx, client.ObjectKey{Namespace: "test", Name: cs.Status.Action.Name}, &action))
+	assert.Equal(t, "2", action.Labels[porterv1.LabelResourceGeneration], "the action should be for the latest generation")
+
+	recorder := controller.Recorder.(*record.FakeRecorder)
+	require.Len(t, recorder.Events, 2)
+	assert.Equal(t, "Normal Suspended "+suspendedByAgentConfig, <-recorder.Events)
+	assert.Equal(t, "Normal Resumed reconciliation has resumed, changes made while suspended will be applied", <-recorder.Events)
+}
+
+func TestParameterSetReconciler_Reconcile_Suspended(t *testing.T) {
+	ctx := context.Background()
+	ps := &porterv1.ParameterSet{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "myparams", Generation: 1},
+		Spec:       porterv1.ParameterSetSpec{Suspend: true},
+	}
+	controller := setupParameterSetController(ps)
+
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "test", Name: "myparams"}}
+	_, err := controller.Reconcile(ctx, req)
+	require.NoError(t, err)
+
+	require.NoError(t, controller.Get(ctx, req.NamespacedName, ps))
+	assert.True(t, apimeta.IsStatusConditionTrue(ps.Status.Conditions, porterv1.ConditionSuspended))
+	assert.Empty(t, ps.Finalizers, "a suspended parameter set should not be modified")
+}
+
+func TestAgentActionReconciler_Reconcile_Suspended(t *testing.T) {
+	ctx := context.Background()
+	action := testAgentAction()
+	action.Spec.Suspend = true
+	controller := setupAgentActionController(action)
+
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: action.Namespace, Name: action.Name}}
+	_, err := controller.Reconcile(ctx, req)
+	require.NoError(t, err)
+
+	var jobs batchv1.JobList
+	require.NoError(t, controller.List(ctx, &jobs))
+	assert.Empty(t, jobs.Items, "the agent job should not be started while the action is suspended")
+
+	require.NoError(t, controller.Get(ctx, req.NamespacedName, action))
+	assert.True(t, apimeta.IsStatusConditionTrue(action.Status.Conditions, porterv1.ConditionSuspended))
+}
+
+func TestApplySuspended(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	cs := &porterv1.CredentialSet{ObjectMeta: metav1.ObjectMeta{Generation: 3}}
+
+	assert.False(t, applySuspended(recorder, cs, &cs.Status.Conditions, false, ""), "a resource that was never suspended should not have the condition")
+	assert.Empty(t, cs.Status.Conditions)
+
+	assert.True(t, applySuspended(recorder, cs, &cs.Status.Conditions, true, suspendedBySpec))
+	suspended := apimeta.FindStatusCondition(cs.Status.Conditions, porterv1.ConditionSuspended)
+	require.NotNil(t, suspended)
+	assert.Equal(t, int64(3), suspended.ObservedGeneration)
+
+	assert.True(t, applySuspended(recorder, cs, &cs.Status.Conditions, true, suspendedByAgentConfig), "the message should be updated")
+	assert.False(t, applySuspended(recorder, cs, &cs.Status.Conditions, true, suspendedByAgentConfig))
+
+	assert.True(t, applySuspended(recorder, cs, &cs.Status.Conditions, false, ""))
+	assert.False(t, apimeta.IsStatusConditionTrue(cs.Status.Conditions, porterv1.ConditionSuspended))
+
+	require.Len(t, recorder.Events, 2, "events should only be emitted when the resource is suspended or resumed")
+}
+
+func TestApplyAgentAction_Suspended(t *testing.T) {
+	inst := &porterv1.Installation{}
+	inst.Status.Conditions = []metav1.Condition{{Type: porterv1.ConditionSuspended, Status: metav1.ConditionFalse, Reason: "Resumed"}}
+	action := &porterv1.AgentAction{
+		ObjectMeta: metav1.ObjectMeta{Name: "myaction"},
+		Status: porterv1.AgentActionStatus{Conditions: []metav1.Condition{
+			{Type: porterv1.ConditionSuspended, Status: metav1.ConditionTrue, Reason: "Suspended"},
+			{Type: string(porterv1.ConditionScheduled), Status: metav1.ConditionTrue},
+		}},
+	}
+
+	applyAgentAction(logr.Discard(), inst, action)
+
+	require.Len(t, inst.Status.Conditions, 2)
+	suspended := apimeta.FindStatusCondition(inst.Status.Conditions, porterv1.ConditionSuspended)
+	require.NotNil(t, suspended)
+	assert.Equal(t, "Resumed", suspended.Reason, "the Suspended condition of the action should not be copied")
+}
+
+func TestAgentConfigSuspendChanged(t *testing.T) {
+	suspended := &porterv1.AgentConfig{Spec: porterv1.AgentConfigSpec{Suspend: true}}
+	active := &porterv1.AgentConfig{}
+
+	p := agentConfigSuspendChanged{}
+	assert.True(t, p.Update(event.UpdateEvent{ObjectOld: active, ObjectNew: suspended}), "suspending should trigger")
+	assert.True(t, p.Update(event.UpdateEvent{ObjectOld: suspended, ObjectNew: active}), "resuming should trigger")
+	assert.False(t, p.Update(event.UpdateEvent{ObjectOld: active, ObjectNew: active}), "other changes should not trigger")
+	assert.True(t, p.Delete(event.DeleteEvent{Object: suspended}), "deleting a suspended config resumes its resources")
+	assert.False(t, p.Create(event.CreateEvent{Object: active}))
+}
+
+func TestRequestsForAgentConfig(t *testing.T) {
+	controller := setupCredentialSetController(
+		&porterv1.CredentialSet{ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "creds1"}},
+		&porterv1.CredentialSet{ObjectMeta: metav1.ObjectMeta{Namespace: "other", Name: "creds2"}})
+	mapFn := requestsForAgentConfig(controller.Client, func() client.ObjectList { return &porterv1.CredentialSetList{} })
+
+	nsCfg := &porterv1.AgentConfig{ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "default"}}
+	requests := mapFn(context.Background(), nsCfg)
+	require.Len(t, requests, 1, "only the resources in the namespace should be requeued")
+	assert.Equal(t, types.NamespacedName{Namespace: "test", Name: "creds1"}, requests[0].NamespacedName)
+
+	systemCfg := &porterv1.AgentConfig{ObjectMeta: metav1.ObjectMeta{Namespace: operatorNamespace, Name: "default"}}
+	requests = mapFn(context.Background(), systemCfg)
+	assert.Len(t, requests, 2, "the resources in all namespaces should be requeued")
+}
@@ -0,0 +1,241 @@
+package controllers
+
+import (
+	"context"
+	"os"
+	"sort"
+	"strings"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+const (
+	// tracerName is the instrumentation scope of the spans created by the operator.
+	tracerName = "get.porter.sh/operator"
+
+	// tracingServiceName is the service name reported for the operator's spans,
+	// unless overridden with OTEL_SERVICE_NAME.
+	tracingServiceName = "porter-operator"
+)
+
+// tracePropagator passes the trace context between the resources created by
+// the operator, and into the Porter Agent, using W3C Trace Context.
+var tracePropagator = propagation.TraceContext{}
+
+// traceAnnotations maps the trace context fields to the annotations that store them on a resource.
+var traceAnnotations = map[string]string{
+	"traceparent": porterv1.AnnotationTraceParent,
+	"tracestate":  porterv1.AnnotationTraceState,
+}
+
+func tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// SetupTracing configures the global tracer provider from the standard
+// OpenTelemetry environment variables. Spans are exported with OTLP when
+// OTEL_EXPORTER_OTLP_ENDPOINT or OTEL_EXPORTER_OTLP_TRACES_ENDPOINT is set,
+// otherwise tracing is disabled. The returned function flushes and stops the
+// exporter.
+func SetupTracing(ctx context.Context) (func(context.Context) error, error) {
+	exporter, err := newTraceExporter(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if exporter == nil {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	return setTracerProvider(ctx, sdktrace.WithBatcher(exporter))
+}
+
+// newTraceExporter creates the OTLP exporter requested by the environment,
+// returning nil when tracing is not configured.
+func newTraceExporter(ctx context.Context) (sdktrace.SpanExporter, error) {
+	if strings.EqualFold(os.Getenv("OTEL_TRACES_EXPORTER"), "none") {
+		return nil, nil
+	}
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" && os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") == "" {
+		return nil, nil
+	}
+
+	protocol := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_PROTOCOL")
+	if protocol == "" {
+		protocol = os.Getenv("OTEL_EXPORTER_OTLP_PROTOCOL")
+	}
+
+	// The exporters read the endpoint, headers and TLS settings from the environment
+	switch protocol {
+	case "", "grpc":
+		exporter, err := otlptracegrpc.New(ctx)
+		return exporter, errors.Wrap(err, "error creating the OTLP gRPC trace exporter")
+	case "http/protobuf":
+		exporter, err := otlptracehttp.New(ctx)
+		return exporter, errors.Wrap(err, "error creating the OTLP HTTP trace exporter")
+	default:
+		return nil, errors.Errorf("unsupported OTLP protocol %q, must be grpc or http/protobuf", protocol)
+	}
+}
+
+// setTracerProvider registers a tracer provider built with the specified
+// options as the global tracer provider.
+func setTracerProvider(ctx context.Context, opts ...sdktrace.TracerProviderOption) (func(context.Context) error, error) {
+	res, err := resource.New(ctx,
+		resource.WithAttributes(semconv.ServiceName(tracingServiceName)),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK())
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating the trace resource")
+	}
+
+	provider := sdktrace.NewTracerProvider(append([]sdktrace.TracerProviderOption{sdktrace.WithResource(res)}, opts...)...)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return provider.Shutdown, nil
+}
+
+// annotationCarrier stores the trace context in the annotations of a resource.
+type annotationCarrier map[string]string
+
+var _ propagation.TextMapCarrier = annotationCarrier{}
+
+func (c annotationCarrier) Get(key string) string {
+	annotation, ok := traceAnnotations[key]
+	if !ok {
+		return ""
+	}
+	return c[annotation]
+}
+
+func (c annotationCarrier) Set(key string, value string) {
+	if annotation, ok := traceAnnotations[key]; ok {
+		c[annotation] = value
+	}
+}
+
+func (c annotationCarrier) Keys() []string {
+	keys := make([]string, 0, len(traceAnnotations))
+	for key, annotation := range traceAnnotations {
+		if _, ok := c[annotation]; ok {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// injectTraceContext records the trace context from ctx in the annotations of
+// the resource. The annotations are copied first because resources created
+// by the operator often share the annotations of the resource that owns them.
+func injectTraceContext(ctx context.Context, obj metav1.Object) {
+	annotations := make(map[string]string, len(obj.GetAnnotations())+len(traceAnnotations))
+	for k, v := range obj.GetAnnotations() {
+		annotations[k] = v
+	}
+	// Do not carry over a trace context that was copied from another resource
+	for _, annotation := range traceAnnotations {
+		delete(annotations, annotation)
+	}
+
+	tracePropagator.Inject(ctx, annotationCarrier(annotations))
+
+	if len(annotations) == 0 {
+		annotations = nil
+	}
+	obj.SetAnnotations(annotations)
+}
+
+// extractTraceContext returns a context with the trace context recorded in
+// the annotations of the resource, so that new spans are part of that trace.
+func extractTraceContext(ctx context.Context, obj metav1.Object) context.Context {
+	return tracePropagator.Extract(ctx, annotationCarrier(obj.GetAnnotations()))
+}
+
+// getTraceEnv returns the environment variables that pass the trace context
+// to the Porter Agent, so that the spans created by Porter are part of the
+// same trace as the operator.
+func getTraceEnv(ctx context.Context) []corev1.EnvVar {
+	carrier := propagation.MapCarrier{}
+	tracePropagator.Inject(ctx, carrier)
+
+	env := make([]corev1.EnvVar, 0, len(carrier))
+	for key, value := range carrier {
+		env = append(env, corev1.EnvVar{Name: strings.ToUpper(key), Value: value})
+	}
+	sort.Slice(env, func(i, j int) bool {
+		return env[i].Name < env[j].Name
+	})
+	return env
+}
+
+// endSpan records the error returned by the traced operation, and ends the span.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// startReconcileSpan starts the span for reconciling a resource.
+func startReconcileSpan(ctx context.Context, kind string, req ctrl.Request) (context.Context, trace.Span) {
+	return tracer().Start(ctx, "Reconcile "+kind,
+		trace.WithAttributes(
+			attribute.String("k8s.namespace.name", req.Namespace),
+			attribute.String("porter.resource.kind", kind),
+			attribute.String("porter.resource.name", req.Name),
+		))
+}
+
+// startAgentActionSpan starts the span for running the Porter Agent for an
+// agent action, continuing the trace of the resource that created the action.
+func startAgentActionSpan(ctx context.Context, action *porterv1.AgentAction) (context.Context, trace.Span) {
+	return tracer().Start(extractTraceContext(ctx, action), "Run Porter Agent",
+		trace.WithAttributes(
+			attribute.String("k8s.namespace.name", action.Namespace),
+			attribute.String("porter.agentaction", action.Name),
+			attribute.String("porter.command", getActionType(action)),
+		))
+}
+
+// recordAgentJobSpan records a span for the time that the Porter Agent job
+// ran, once it has finished. The span is a child of the span that created
+// the job, like the spans created by Porter in the job.
+func recordAgentJobSpan(ctx context.Context, action *porterv1.AgentAction, job *batchv1.Job) {
+	if job == nil || job.Status.StartTime == nil {
+		return
+	}
+	end := getJobEndTime(job)
+	if end.IsZero() {
+		return
+	}
+
+	ctx = extractTraceContext(ctx, job)
+	_, span := tracer().Start(ctx, "Porter Agent job",
+		trace.WithTimestamp(job.Status.StartTime.Time),
+		trace.WithAttributes(
+			attribute.String("k8s.namespace.name", job.Namespace),
+			attribute.String("k8s.job.name", job.Name),
+			attribute.String("porter.agentaction", action.Name),
+			attribute.String("porter.command", getActionType(action)),
+			attribute.String("porter.phase", string(action.Status.Phase)),
+		))
+	if action.Status.Phase == porterv1.PhaseFailed {
+		span.SetStatus(codes.Error, "the Porter Agent job failed")
+	}
+	span.End(trace.WithTimestamp(end))
+}
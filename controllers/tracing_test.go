@@ -0,0 +1,201 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// setupTestTracing records the spans created during the test in memory.
+func setupTestTracing(t *testing.T) *tracetest.InMemoryExporter {
+	origProvider := otel.GetTracerProvider()
+	origPropagator := otel.GetTextMapPropagator()
+
+	exporter := tracetest.NewInMemoryExporter()
+	shutdown, err := setTracerProvider(context.Background(), sdktrace.WithSyncer(exporter))
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		shutdown(context.Background())
+		otel.SetTracerProvider(origProvider)
+		otel.SetTextMapPropagator(origPropagator)
+	})
+	return exporter
+}
+
+func findSpan(t *testing.T, spans tracetest.SpanStubs, name string) tracetest.SpanStub {
+	for _, span := range spans {
+		if span.Name == name {
+			return span
+		}
+	}
+	require.Failf(t, "span not found", "expected a span named %q", name)
+	return tracetest.SpanStub{}
+}
+
+func TestNewTraceExporter(t *testing.T) {
+	t.Run("disabled by default", func(t *testing.T) {
+		t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "")
+		t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "")
+
+		exporter, err := newTraceExporter(context.Background())
+		require.NoError(t, err)
+		assert.Nil(t, exporter)
+	})
+
+	t.Run("disabled with none", func(t *testing.T) {
+		t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "http://localhost:4317")
+		t.Setenv("OTEL_TRACES_EXPORTER", "none")
+
+		exporter, err := newTraceExporter(context.Background())
+		require.NoError(t, err)
+		assert.Nil(t, exporter)
+	})
+
+	t.Run("grpc", func(t *testing.T) {
+		t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "http://localhost:4317")
+
+		exporter, err := newTraceExporter(context.Background())
+		require.NoError(t, err)
+		require.NotNil(t, exporter)
+		exporter.Shutdown(context.Background())
+	})
+
+	t.Run("http", func(t *testing.T) {
+		t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "http://localhost:4318/v1/traces")
+		t.Setenv("OTEL_EXPORTER_OTLP_PROTOCOL", "http/protobuf")
+
+		exporter, err := newTraceExporter(context.Background())
+		require.NoError(t, err)
+		require.NotNil(t, exporter)
+		exporter.Shutdown(context.Background())
+	})
+
+	t.Run("unsupported protocol", func(t *testing.T) {
+		t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "http://localhost:4317")
+		t.Setenv("OTEL_EXPORTER_OTLP_TRACES_PROTOCOL", "http/json")
+
+		_, err := newTraceExporter(context.Background())
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `unsupported OTLP protocol "http/json"`)
+	})
+}
+
+func TestInjectTraceContext(t *testing.T) {
+	setupTestTracing(t)
+
+	ctx, span := tracer().Start(context.Background(), "test")
+	defer span.End()
+
+	ownerAnnotations := map[string]string{
+		porterv1.AnnotationRetry:       "1",
+		porterv1.AnnotationTraceParent: "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01",
+	}
+	action := &porterv1.AgentAction{ObjectMeta: metav1.ObjectMeta{Annotations: ownerAnnotations}}
+	injectTraceContext(ctx, action)
+
+	assert.Equal(t, "1", action.Annotations[porterv1.AnnotationRetry], "the existing annotations should be kept")
+	assert.Contains(t, action.Annotations[porterv1.AnnotationTraceParent], span.SpanContext().SpanID().String(), "the traceparent should be replaced with the current span")
+	assert.Equal(t, "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01", ownerAnnotations[porterv1.AnnotationTraceParent], "the annotations of the owner should not be modified")
+
+	extracted := trace.SpanContextFromContext(extractTraceContext(context.Background(), action))
+	assert.Equal(t, span.SpanContext().TraceID(), extracted.TraceID(), "incorrect trace id")
+	assert.Equal(t, span.SpanContext().SpanID(), extracted.SpanID(), "incorrect span id")
+	assert.True(t, extracted.IsRemote(), "the extracted span context should be remote")
+}
+
+func TestInjectTraceContext_NoTrace(t *testing.T) {
+	job := &batchv1.Job{}
+	injectTraceContext(context.Background(), job)
+	assert.Nil(t, job.Annotations, "no annotations should be added when there is no trace")
+	assert.Empty(t, getTraceEnv(context.Background()), "no environment variables should be added when there is no trace")
+}
+
+func TestInstallationReconciler_Reconcile_Tracing(t *testing.T) {
+	exporter := setupTestTracing(t)
+	controller := setupInstallationController()
+
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "test", Name: "missing"}}
+	_, err := controller.Reconcile(context.Background(), req)
+	require.NoError(t, err)
+
+	span := findSpan(t, exporter.GetSpans(), "Reconcile Installation")
+	assert.Contains(t, span.Attributes, attribute.String("k8s.namespace.name", "test"))
+	assert.Equal(t, codes.Unset, span.Status.Code)
+}
+
+func TestTracing_InstallationToAgentJob(t *testing.T) {
+	exporter := setupTestTracing(t)
+
+	// Create the agent action while reconciling the installation
+	ctx, reconcileSpan := tracer().Start(context.Background(), "Reconcile Installation")
+	instController := setupInstallationController()
+	inst := &porterv1.Installation{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "mysql", UID: "random-uid", Generation: 1},
+		Spec:       porterv1.InstallationSpec{Namespace: "dev", Name: "mysql"},
+	}
+	action, err := instController.createAgentAction(ctx, logr.Discard(), inst)
+	require.NoError(t, err)
+	reconcileSpan.End()
+	assert.NotContains(t, inst.Annotations, porterv1.AnnotationTraceParent, "the trace context should not be added to the installation")
+
+	// Create the job for the agent action
+	action.UID = "action-uid"
+	actionController := setupAgentActionController(action)
+	actionCtx, actionSpan := startAgentActionSpan(context.Background(), action)
+	pvc := &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: "mypvc"}}
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "mysecret"}}
+	job, err := actionController.createAgentJob(actionCtx, logr.Discard(), action, testAgentCfgSpec(), pvc, secret, secret, nil)
+	require.NoError(t, err)
+	actionSpan.End()
+
+	traceParent := job.Annotations[porterv1.AnnotationTraceParent]
+	require.NotEmpty(t, traceParent, "the trace context should be recorded on the job")
+	assertEnvVar(t, job.Spec.Template.Spec.Containers[0].Env, "TRACEPARENT", traceParent)
+
+	// Finish the job
+	start := metav1.NewTime(time.Now().Add(-time.Minute))
+	end := metav1.Now()
+	job.Status = batchv1.JobStatus{
+		StartTime:      &start,
+		CompletionTime: &end,
+		Succeeded:      1,
+		Conditions:     []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}},
+	}
+	require.NoError(t, actionController.syncStatus(context.Background(), logr.Discard(), action, &job))
+
+	// Verify that the spans are all part of the same trace
+	spans := exporter.GetSpans()
+	rootSpan := findSpan(t, spans, "Reconcile Installation")
+	createActionSpan := findSpan(t, spans, "Create AgentAction")
+	runAgentSpan := findSpan(t, spans, "Run Porter Agent")
+	jobSpan := findSpan(t, spans, "Porter Agent job")
+
+	traceID := rootSpan.SpanContext.TraceID()
+	for _, span := range []tracetest.SpanStub{createActionSpan, runAgentSpan, jobSpan} {
+		assert.Equal(t, traceID, span.SpanContext.TraceID(), "expected span %s to be in the same trace", span.Name)
+	}
+	assert.Equal(t, rootSpan.SpanContext.SpanID(), createActionSpan.Parent.SpanID(), "incorrect parent for creating the agent action")
+	assert.Equal(t, createActionSpan.SpanContext.SpanID(), runAgentSpan.Parent.SpanID(), "incorrect parent for running the agent")
+	assert.Equal(t, runAgentSpan.SpanContext.SpanID(), jobSpan.Parent.SpanID(), "incorrect parent for the agent job")
+	assert.Contains(t, traceParent, runAgentSpan.SpanContext.SpanID().String(), "porter should continue the trace from running the agent")
+
+	assert.True(t, start.Time.Equal(jobSpan.StartTime), "the job span should start when the job started")
+	assert.True(t, end.Time.Equal(jobSpan.EndTime), "the job span should end when the job finished")
+}
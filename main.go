@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"os"
 
@@ -11,13 +12,16 @@ import (
 
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/kubernetes"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
 	"sigs.k8s.io/controller-runtime/pkg/metrics/server"
 
 	v1 "get.porter.sh/operator/api/v1"
+	v2 "get.porter.sh/operator/api/v2"
 	"get.porter.sh/operator/controllers"
 	// +kubebuilder:scaffold:imports
 )
@@ -30,6 +34,7 @@ var (
 func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 	utilruntime.Must(v1.AddToScheme(scheme))
+	utilruntime.Must(v2.AddToScheme(scheme))
 	// +kubebuilder:scaffold:scheme
 }
 
@@ -37,11 +42,20 @@ func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
+	var porterConnections int
+	var allowCrossNamespaceDependencies bool
+	var porterGRPCReadyzCheck bool
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.IntVar(&porterConnections, "porter-grpc-connections", controllers.DefaultPorterConnections,
+		"The number of connections to the Porter gRPC server that are shared by the controllers.")
+	flag.BoolVar(&allowCrossNamespaceDependencies, "allow-cross-namespace-dependencies", false,
+		"Allow installations to depend on installations in other namespaces.")
+	flag.BoolVar(&porterGRPCReadyzCheck, "porter-grpc-readyz-check", false,
+		"Report the operator as not ready while the Porter gRPC server is defined but unhealthy.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -50,6 +64,13 @@ func main() {
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
+	ctx := ctrl.SetupSignalHandler()
+	shutdownTracing, err := controllers.SetupTracing(ctx)
+	if err != nil {
+		setupLog.Error(err, "unable to set up tracing")
+		os.Exit(1)
+	}
+
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme: scheme,
 		Metrics: server.Options{
@@ -63,50 +84,122 @@ func main() {
 		setupLog.Error(err, "unable to start manager")
 		os.Exit(1)
 	}
+	porterClients := controllers.NewPorterClientManager(mgr.GetClient(), ctrl.Log.WithName("porter-grpc"), porterConnections)
+	if err = mgr.Add(porterClients); err != nil {
+		setupLog.Error(err, "unable to set up the porter grpc client")
+		os.Exit(1)
+	}
 	if err = (&controllers.InstallationReconciler{
-		Client:           mgr.GetClient(),
-		Recorder:         mgr.GetEventRecorderFor("installation"),
-		Log:              ctrl.Log.WithName("controllers").WithName("Installation"),
-		Scheme:           mgr.GetScheme(),
-		CreateGRPCClient: controllers.CreatePorterGRPCClient,
+		Client:                          mgr.GetClient(),
+		Recorder:                        mgr.GetEventRecorderFor("installation"),
+		Log:                             ctrl.Log.WithName("controllers").WithName("Installation"),
+		Scheme:                          mgr.GetScheme(),
+		CreateGRPCClient:                porterClients.GetClient,
+		AllowCrossNamespaceDependencies: allowCrossNamespaceDependencies,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Installation")
 		os.Exit(1)
 	}
+	clientset, err := kubernetes.NewForConfig(mgr.GetConfig())
+	if err != nil {
+		setupLog.Error(err, "unable to create the kubernetes clientset")
+		os.Exit(1)
+	}
 	if err = (&controllers.AgentActionReconciler{
-		Client: mgr.GetClient(),
-		Log:    ctrl.Log.WithName("controllers").WithName("AgentAction"),
-		Scheme: mgr.GetScheme(),
+		Client:    mgr.GetClient(),
+		Log:       ctrl.Log.WithName("controllers").WithName("AgentAction"),
+		Recorder:  mgr.GetEventRecorderFor("agentaction"),
+		Scheme:    mgr.GetScheme(),
+		PodLogs:   controllers.NewPodLogReader(clientset),
+		APIReader: mgr.GetAPIReader(),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "AgentAction")
 		os.Exit(1)
 	}
 	if err = (&controllers.CredentialSetReconciler{
-		Client: mgr.GetClient(),
-		Log:    ctrl.Log.WithName("controllers").WithName("CredentialSet"),
-		Scheme: mgr.GetScheme(),
+		Client:   mgr.GetClient(),
+		Log:      ctrl.Log.WithName("controllers").WithName("CredentialSet"),
+		Recorder: mgr.GetEventRecorderFor("credentialset"),
+		Scheme:   mgr.GetScheme(),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "CredentialSet")
 		os.Exit(1)
 	}
 	if err = (&controllers.ParameterSetReconciler{
-		Client: mgr.GetClient(),
-		Log:    ctrl.Log.WithName("controllers").WithName("ParameterSet"),
-		Scheme: mgr.GetScheme(),
+		Client:   mgr.GetClient(),
+		Log:      ctrl.Log.WithName("controllers").WithName("ParameterSet"),
+		Recorder: mgr.GetEventRecorderFor("parameterset"),
+		Scheme:   mgr.GetScheme(),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "ParameterSet")
 		os.Exit(1)
 	}
 	if err = (&controllers.AgentConfigReconciler{
-		Client: mgr.GetClient(),
-		Log:    ctrl.Log.WithName("controllers").WithName("AgentConfig"),
-		Scheme: mgr.GetScheme(),
+		Client:   mgr.GetClient(),
+		Log:      ctrl.Log.WithName("controllers").WithName("AgentConfig"),
+		Recorder: mgr.GetEventRecorderFor("agentconfig"),
+		Scheme:   mgr.GetScheme(),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "AgentConfig")
 		os.Exit(1)
 	}
+	if err = (&controllers.ScheduledActionReconciler{
+		Client:   mgr.GetClient(),
+		Recorder: mgr.GetEventRecorderFor("scheduledaction"),
+		Log:      ctrl.Log.WithName("controllers").WithName("ScheduledAction"),
+		Scheme:   mgr.GetScheme(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "ScheduledAction")
+		os.Exit(1)
+	}
+	if err = (&controllers.InstallationActionReconciler{
+		Client:   mgr.GetClient(),
+		Recorder: mgr.GetEventRecorderFor("installationaction"),
+		Log:      ctrl.Log.WithName("controllers").WithName("InstallationAction"),
+		Scheme:   mgr.GetScheme(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "InstallationAction")
+		os.Exit(1)
+	}
+	if err = (&controllers.PorterServerReconciler{
+		Client:   mgr.GetClient(),
+		Recorder: mgr.GetEventRecorderFor("porterserver"),
+		Log:      ctrl.Log.WithName("controllers").WithName("PorterServer"),
+		Scheme:   mgr.GetScheme(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "PorterServer")
+		os.Exit(1)
+	}
+	// Admission and conversion webhooks require a serving certificate, see config/default/manager_webhook_patch.yaml
+	if os.Getenv("ENABLE_WEBHOOKS") == "true" {
+		if err = (&v1.Installation{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "Installation")
+			os.Exit(1)
+		}
+		if err = (&v1.CredentialSet{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "CredentialSet")
+			os.Exit(1)
+		}
+		if err = (&v1.ParameterSet{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "ParameterSet")
+			os.Exit(1)
+		}
+		if err = (&v1.AgentConfig{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "AgentConfig")
+			os.Exit(1)
+		}
+		if err = (&v1.PorterConfig{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "PorterConfig")
+			os.Exit(1)
+		}
+	}
 	// +kubebuilder:scaffold:builder
 
+	if err := metrics.Registry.Register(controllers.NewInstallationCollector(mgr.GetClient())); err != nil {
+		setupLog.Error(err, "unable to register the installation metrics")
+		os.Exit(1)
+	}
+
 	if err := mgr.AddHealthzCheck("health", healthz.Ping); err != nil {
 		setupLog.Error(err, "unable to set up health check")
 		os.Exit(1)
@@ -115,9 +208,21 @@ func main() {
 		setupLog.Error(err, "unable to set up ready check")
 		os.Exit(1)
 	}
+	// The gRPC server is optional, so it only affects readiness when requested
+	if porterGRPCReadyzCheck {
+		if err := mgr.AddReadyzCheck("porter-grpc", porterClients.ReadyzCheck); err != nil {
+			setupLog.Error(err, "unable to set up the porter grpc ready check")
+			os.Exit(1)
+		}
+	}
 
 	setupLog.Info("starting manager")
-	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
+	err = mgr.Start(ctx)
+	// Flush any spans that have not been exported yet
+	if shutdownErr := shutdownTracing(context.Background()); shutdownErr != nil {
+		setupLog.Error(shutdownErr, "problem shutting down tracing")
+	}
+	if err != nil {
 		setupLog.Error(err, "problem running manager")
 		os.Exit(1)
 	}
@@ -69,40 +69,72 @@ var _ = BeforeSuite(func(done Done) {
 	})
 	Expect(err).ToNot(HaveOccurred())
 
+	porterClients := controllers.NewPorterClientManager(k8sManager.GetClient(), ctrl.Log.WithName("porter-grpc"), controllers.DefaultPorterConnections)
+	Expect(k8sManager.Add(porterClients)).To(Succeed())
+
 	err = (&controllers.InstallationReconciler{
 		Client:           k8sManager.GetClient(),
 		Scheme:           scheme.Scheme,
 		Recorder:         k8sManager.GetEventRecorderFor("installation"),
 		Log:              ctrl.Log.WithName("controllers").WithName("Installation"),
-		CreateGRPCClient: controllers.CreatePorterGRPCClient,
+		CreateGRPCClient: porterClients.GetClient,
 	}).SetupWithManager(k8sManager)
 	Expect(err).ToNot(HaveOccurred())
 
 	err = (&controllers.CredentialSetReconciler{
-		Client: k8sManager.GetClient(),
-		Scheme: scheme.Scheme,
-		Log:    ctrl.Log.WithName("controllers").WithName("CredentialSet"),
+		Client:   k8sManager.GetClient(),
+		Scheme:   scheme.Scheme,
+		Recorder: k8sManager.GetEventRecorderFor("credentialset"),
+		Log:      ctrl.Log.WithName("controllers").WithName("CredentialSet"),
 	}).SetupWithManager(k8sManager)
 	Expect(err).ToNot(HaveOccurred())
 
 	err = (&controllers.ParameterSetReconciler{
-		Client: k8sManager.GetClient(),
-		Scheme: scheme.Scheme,
-		Log:    ctrl.Log.WithName("controllers").WithName("ParameterSet"),
+		Client:   k8sManager.GetClient(),
+		Scheme:   scheme.Scheme,
+		Recorder: k8sManager.GetEventRecorderFor("parameterset"),
+		Log:      ctrl.Log.WithName("controllers").WithName("ParameterSet"),
 	}).SetupWithManager(k8sManager)
 	Expect(err).ToNot(HaveOccurred())
 
 	err = (&controllers.AgentActionReconciler{
-		Client: k8sManager.GetClient(),
-		Scheme: scheme.Scheme,
-		Log:    ctrl.Log.WithName("controllers").WithName("AgentAction"),
+		Client:    k8sManager.GetClient(),
+		APIReader: k8sManager.GetAPIReader(),
+		Scheme:    scheme.Scheme,
+		Recorder:  k8sManager.GetEventRecorderFor("agentaction"),
+		Log:       ctrl.Log.WithName("controllers").WithName("AgentAction"),
 	}).SetupWithManager(k8sManager)
 	Expect(err).ToNot(HaveOccurred())
 
 	err = (&controllers.AgentConfigReconciler{
-		Client: k8sManager.GetClient(),
-		Scheme: scheme.Scheme,
-		Log:    ctrl.Log.WithName("controllers").WithName("AgentConfig"),
+		Client:   k8sManager.GetClient(),
+		Scheme:   scheme.Scheme,
+		Recorder: k8sManager.GetEventRecorderFor("agentconfig"),
+		Log:      ctrl.Log.WithName("controllers").WithName("AgentConfig"),
+	}).SetupWithManager(k8sManager)
+	Expect(err).ToNot(HaveOccurred())
+
+	err = (&controllers.ScheduledActionReconciler{
+		Client:   k8sManager.GetClient(),
+		Scheme:   scheme.Scheme,
+		Recorder: k8sManager.GetEventRecorderFor("scheduledaction"),
+		Log:      ctrl.Log.WithName("controllers").WithName("ScheduledAction"),
+	}).SetupWithManager(k8sManager)
+	Expect(err).ToNot(HaveOccurred())
+
+	err = (&controllers.InstallationActionReconciler{
+		Client:   k8sManager.GetClient(),
+		Recorder: k8sManager.GetEventRecorderFor("installationaction"),
+		Scheme:   scheme.Scheme,
+		Log:      ctrl.Log.WithName("controllers").WithName("InstallationAction"),
+	}).SetupWithManager(k8sManager)
+	Expect(err).ToNot(HaveOccurred())
+
+	err = (&controllers.PorterServerReconciler{
+		Client:   k8sManager.GetClient(),
+		Scheme:   scheme.Scheme,
+		Recorder: k8sManager.GetEventRecorderFor("porterserver"),
+		Log:      ctrl.Log.WithName("controllers").WithName("PorterServer"),
 	}).SetupWithManager(k8sManager)
 	Expect(err).ToNot(HaveOccurred())
 
@@ -0,0 +1,78 @@
+//go:build integration
+
+package integration_test
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var _ = Describe("Suspend reconciliation", func() {
+	Context("when a CredentialSet is created with spec.suspend", func() {
+		It("should not run porter until it is resumed", func() {
+			ctx := context.Background()
+			ns := createTestNamespace(ctx)
+			name := "test-cs-" + ns
+			cs := NewTestCredSet(name)
+			cs.ObjectMeta.Namespace = ns
+			cs.Spec.Namespace = ns
+			cs.Spec.Suspend = true
+			cs.Spec.Credentials = append(cs.Spec.Credentials, porterv1.Credential{
+				Name:   "insecureValue",
+				Source: porterv1.CredentialSource{Secret: name},
+			})
+
+			By("setting the Suspended condition", func() {
+				Log(fmt.Sprintf("create suspended credential set '%s'", name))
+				Expect(k8sClient.Create(ctx, cs)).Should(Succeed())
+				Eventually(func() bool {
+					if err := k8sClient.Get(ctx, client.ObjectKeyFromObject(cs), cs); err != nil {
+						return false
+					}
+					return apimeta.IsStatusConditionTrue(cs.Status.Conditions, porterv1.ConditionSuspended)
+				}, getWaitTimeout(), time.Second).Should(BeTrue())
+				Expect(cs.Status.Action).To(BeNil(), "a suspended credential set should not run porter")
+			})
+
+			By("recording a Suspended event", func() {
+				Eventually(func() bool {
+					return hasEvent(ctx, cs, "Suspended")
+				}, getWaitTimeout(), time.Second).Should(BeTrue())
+			})
+
+			By("running porter when it is resumed", func() {
+				Log(fmt.Sprintf("resume credential set '%s'", name))
+				patch := client.MergeFrom(cs.DeepCopy())
+				cs.Spec.Suspend = false
+				Expect(k8sClient.Patch(ctx, cs, patch)).Should(Succeed())
+				Expect(waitForPorter(ctx, cs, 2, "waiting for credential set to apply")).Should(Succeed())
+				validateResourceConditions(cs)
+				Eventually(func() bool {
+					return hasEvent(ctx, cs, "Resumed")
+				}, getWaitTimeout(), time.Second).Should(BeTrue())
+			})
+		})
+	})
+})
+
+// hasEvent determines if an event with the specified reason was recorded for the resource.
+func hasEvent(ctx context.Context, obj client.Object, reason string) bool {
+	var events corev1.EventList
+	if err := k8sClient.List(ctx, &events, client.InNamespace(obj.GetNamespace())); err != nil {
+		return false
+	}
+	for _, e := range events.Items {
+		if e.InvolvedObject.Name == obj.GetName() && e.Reason == reason {
+			return true
+		}
+	}
+	return false
+}